@@ -9,32 +9,57 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentproto"
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/executor"
 	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/utils"
 	"github.com/gorilla/websocket"
 )
 
 // WebSocket 消息类型
 const (
-	WSTypeHeartbeat     = constant.WSTypeHeartbeat
-	WSTypeHeartbeatAck  = constant.WSTypeHeartbeatAck
-	WSTypeTasks         = constant.WSTypeTasks
-	WSTypeTaskResult    = constant.WSTypeTaskResult
-	WSTypeUpdate        = constant.WSTypeUpdate
-	WSTypeConnected     = constant.WSTypeConnected
-	WSTypeDisabled      = constant.WSTypeDisabled
-	WSTypeEnabled       = constant.WSTypeEnabled
-	WSTypeFetchTasks    = constant.WSTypeFetchTasks
-	WSTypeTaskLog       = constant.WSTypeTaskLog
-	WSTypeExecute       = constant.WSTypeExecute
-	WSTypeTaskHeartbeat = constant.WSTypeTaskHeartbeat
-	WSTypeStop          = constant.WSTypeStop
+	WSTypeHeartbeat       = constant.WSTypeHeartbeat
+	WSTypeHeartbeatAck    = constant.WSTypeHeartbeatAck
+	WSTypeTasks           = constant.WSTypeTasks
+	WSTypeTaskResult      = constant.WSTypeTaskResult
+	WSTypeUpdate          = constant.WSTypeUpdate
+	WSTypeConnected       = constant.WSTypeConnected
+	WSTypeDisabled        = constant.WSTypeDisabled
+	WSTypeEnabled         = constant.WSTypeEnabled
+	WSTypeFetchTasks      = constant.WSTypeFetchTasks
+	WSTypeTaskLog         = constant.WSTypeTaskLog
+	WSTypeExecute         = constant.WSTypeExecute
+	WSTypeTaskHeartbeat   = constant.WSTypeTaskHeartbeat
+	WSTypeStop            = constant.WSTypeStop
+	WSTypeFileSync        = constant.WSTypeFileSync
+	WSTypeFileBundle      = constant.WSTypeFileBundle
+	WSTypeTerminalOpen    = constant.WSTypeTerminalOpen
+	WSTypeTerminalInput   = constant.WSTypeTerminalInput
+	WSTypeTerminalResize  = constant.WSTypeTerminalResize
+	WSTypeTerminalClose   = constant.WSTypeTerminalClose
+	WSTypeTerminalOutput  = constant.WSTypeTerminalOutput
+	WSTypeTerminalExit    = constant.WSTypeTerminalExit
+	WSTypeRuntimes        = constant.WSTypeRuntimes
+	WSTypeFetchRuntimes   = constant.WSTypeFetchRuntimes
+	WSTypeCommand         = constant.WSTypeCommand
+	WSTypeCommandOutput   = constant.WSTypeCommandOutput
+	WSTypeCommandResult   = constant.WSTypeCommandResult
+	WSTypeUpdateResult    = constant.WSTypeUpdateResult
+	WSTypeRotateKey       = constant.WSTypeRotateKey
+	WSTypeHello           = constant.WSTypeHello
+	WSTypeSDKRequest      = constant.WSTypeSDKRequest
+	WSTypeSDKResponse     = constant.WSTypeSDKResponse
+	WSTypeTaskResultAck   = constant.WSTypeTaskResultAck
+	WSTypeSDKGrantRequest = constant.WSTypeSDKGrantRequest
+	WSTypeSDKGrant        = constant.WSTypeSDKGrant
 )
 
 type WSMessage struct {
@@ -57,6 +82,7 @@ type AgentTask struct {
 	RandomRange int                 `json:"random_range"`
 	Secrets     []string            `json:"secrets"`
 	Enabled     bool                `json:"enabled"`
+	SyncFiles   []string            `json:"sync_files"` // 执行前需从面板同步的脚本文件或目录
 }
 
 func (t *AgentTask) GetID() string {
@@ -103,12 +129,13 @@ func (t *AgentTask) GetLanguages() []map[string]string {
 	return t.Languages
 }
 
+// GetUseMise 配置了语言时经由 Agent 本机的 mise 执行
 func (t *AgentTask) GetUseMise() bool {
-	return false
+	return len(t.Languages) > 0
 }
 
 func (t *AgentTask) UseMise() bool {
-	return false
+	return t.GetUseMise()
 }
 
 func (t *AgentTask) GetSchedule() string {
@@ -134,6 +161,10 @@ type TaskResult struct {
 	ExitCode  int    `json:"exit_code"`
 	StartTime int64  `json:"start_time"`
 	EndTime   int64  `json:"end_time"`
+
+	Usage *models.ResourceUsage `json:"usage,omitempty"` // 进程树资源占用
+
+	SpooledAt int64 `json:"spooled_at,omitempty"` // 断线期间缓存到本地的时间，非 0 表示重连后补传
 }
 
 type Agent struct {
@@ -153,6 +184,29 @@ type Agent struct {
 	taskLogs         map[string][]string // 记录最近的日志行，用于失败显示
 	logMu            sync.Mutex          // taskLogs 的锁
 	schedulerStarted bool                // 调度器是否已经启动
+	spool            *resultSpool        // 断线期间的任务结果缓存
+	resultMu         sync.Mutex          // 保证结果按产生顺序上报
+	state            agentState          // 落盘的调度配置与任务列表
+	stateMu          sync.Mutex
+	inlineTasks      map[string]*AgentTask                   // 随执行指令下发、不在任务列表中的任务定义
+	fileWaiters      map[string]chan *models.AgentFileBundle // 等待面板返回文件的同步请求
+	fileMu           sync.Mutex                              // fileWaiters 的锁
+	fileSyncMu       sync.Mutex                              // 串行写入同步文件
+	terminals        *terminalManager                        // 面板打开的远程终端会话
+
+	updating            atomic.Bool // 正在下载或替换新版本
+	updateMu            sync.Mutex
+	updateTimer         *time.Timer // 新版本确认期限，超时回滚
+	updateConfirmed     bool        // 新版本已连上面板
+	failedUpdateVersion string      // 上次回滚的版本，自动更新时跳过
+
+	pendingApproval atomic.Bool // 等待面板审批注册，审批通过前不拉取任务
+
+	keys *e2eKeyring // 端到端加密密钥，不可用时面板按明文下发
+
+	panel atomic.Pointer[agentproto.Peer] // 面板握手协商结果
+
+	sdk *sdkRelay // 任务脚本的 SDK 转发端点，启动失败时脚本按任务配置直连面板
 }
 
 func NewAgent(config *Config, configFile string) *Agent {
@@ -165,6 +219,10 @@ func NewAgent(config *Config, configFile string) *Agent {
 		stopCh:        make(chan struct{}),
 		lastTaskCount: -1,
 		taskLogs:      make(map[string][]string),
+		spool:         newResultSpool(getSpoolDir()),
+		inlineTasks:   make(map[string]*AgentTask),
+		fileWaiters:   make(map[string]chan *models.AgentFileBundle),
+		terminals:     newTerminalManager(),
 	}
 
 	// 初始化调度器
@@ -191,9 +249,18 @@ type AgentHandler struct {
 func (h *AgentHandler) OnTaskScheduled(req *executor.ExecutionRequest) {}
 
 func (h *AgentHandler) OnTaskExecuting(req *executor.ExecutionRequest) (io.Writer, io.Writer, error) {
+	if task := h.agent.lookupTask(req.TaskID); task != nil && len(task.SyncFiles) > 0 {
+		if err := h.agent.prepareTaskFiles(req, task); err != nil {
+			return nil, nil, err
+		}
+	}
+	h.agent.sdk.issue(req)
+
 	if req.LogID != "" {
-		writer := &RealTimeLogWriter{agent: h.agent, logID: req.LogID}
-		return writer, writer, nil
+		// stdout 与 stderr 分别发送并标记输出流，执行器会以管道方式运行
+		stdout := &RealTimeLogWriter{agent: h.agent, logID: req.LogID, stream: "stdout"}
+		stderr := &RealTimeLogWriter{agent: h.agent, logID: req.LogID, stream: "stderr"}
+		return stdout, stderr, nil
 	}
 	return nil, nil, nil
 }
@@ -216,9 +283,15 @@ func (h *AgentHandler) OnTaskHeartbeat(req *executor.ExecutionRequest, duration
 func (h *AgentHandler) OnTaskStarted(req *executor.ExecutionRequest) {}
 
 func (h *AgentHandler) OnTaskCompleted(req *executor.ExecutionRequest, result *executor.ExecutionResult) {
+	// 本地定时触发的执行沿用申请 SDK 凭证时生成的日志 ID，面板收到结果后据此吊销凭证
+	logID := result.LogID
+	if logID == "" {
+		logID = h.agent.sdk.runLogID(req)
+	}
+	h.agent.sdk.revoke(req)
 	h.agent.sendTaskResult(&TaskResult{
 		TaskID:    req.TaskID,
-		LogID:     result.LogID,
+		LogID:     logID,
 		Command:   req.Command,
 		Output:    result.Output,
 		Error:     result.Error,
@@ -227,6 +300,7 @@ func (h *AgentHandler) OnTaskCompleted(req *executor.ExecutionRequest, result *e
 		ExitCode:  result.ExitCode,
 		StartTime: result.StartTime.Unix(),
 		EndTime:   result.EndTime.Unix(),
+		Usage:     result.Usage,
 	})
 
 	if result.Status == constant.TaskStatusFailed {
@@ -236,11 +310,13 @@ func (h *AgentHandler) OnTaskCompleted(req *executor.ExecutionRequest, result *e
 }
 
 func (h *AgentHandler) OnTaskFailed(req *executor.ExecutionRequest, err error) {
+	h.agent.sdk.revoke(req)
 	errMsg := fmt.Sprintf("任务执行失败: %v", err)
 	// 先发送日志，确保服务端能收到错误信息
 	h.agent.sendWSMessage(WSTypeTaskLog, map[string]interface{}{
 		"log_id":  req.LogID,
 		"content": errMsg,
+		"stream":  "system",
 	})
 
 	h.agent.sendTaskResult(&TaskResult{
@@ -268,7 +344,23 @@ func (a *Agent) Start() error {
 	}
 
 	logger.Infof("机器识别码: %s", a.machineID[:16]+"...")
-	// 调度器暂不在此启动，等待 WebSocket 连接成功并获取到调度配置后再启动
+	// 有本地保存的任务时立即启动调度器，否则等待 WebSocket 连接成功并获取到调度配置后再启动
+	a.checkPendingUpdate()
+	keys, err := loadKeyring()
+	if err != nil {
+		logger.Errorf("加载端到端加密密钥失败，变量与机密将以明文下发: %v", err)
+	} else {
+		a.keys = keys
+	}
+	if relay, err := startSDKRelay(a); err != nil {
+		logger.Warnf("启动 SDK 转发端点失败，脚本将按任务配置直连面板: %v", err)
+	} else {
+		a.sdk = relay
+	}
+	a.restoreState()
+	if n := a.spool.Len(); n > 0 {
+		logger.Infof("[Spool] 有 %d 条未上报的任务结果，连接后补传", n)
+	}
 	go a.wsLoop()
 
 	logger.Info("Agent 已启动 (时区: Asia/Shanghai, 模式: WebSocket)")
@@ -278,6 +370,7 @@ func (a *Agent) Start() error {
 func (a *Agent) Stop() {
 	close(a.stopCh)
 	a.closeWS()
+	a.sdk.Close()
 
 	a.mu.Lock()
 	started := a.schedulerStarted
@@ -318,6 +411,12 @@ func (a *Agent) connectWS() error {
 	wsURL := strings.Replace(serverURL, "http://", "ws://", 1)
 	wsURL = strings.Replace(wsURL, "https://", "wss://", 1)
 	wsURL = fmt.Sprintf("%s/api/agent/ws?token=%s&machine_id=%s", wsURL, url.QueryEscape(a.config.Token), url.QueryEscape(a.machineID))
+	// 主机信息供面板审批新 Agent 时核对
+	hostname, _ := os.Hostname()
+	wsURL += fmt.Sprintf("&hostname=%s&os=%s&arch=%s&version=%s", url.QueryEscape(hostname), runtime.GOOS, runtime.GOARCH, url.QueryEscape(Version))
+	if pub := a.publicKey(); pub != "" {
+		wsURL += "&public_key=" + url.QueryEscape(pub)
+	}
 
 	logger.Infof("正在连接 WebSocket: %s", wsURL)
 	logger.Infof("Token: %s..., MachineID: %s...", a.config.Token[:8], a.machineID[:16])
@@ -341,6 +440,7 @@ func (a *Agent) connectWS() error {
 	a.wsMu.Unlock()
 
 	logger.Info("WebSocket 已连接")
+	a.sendHello()
 	a.sendHeartbeat()
 	go a.heartbeatLoop()
 
@@ -364,6 +464,7 @@ func (a *Agent) readWS() {
 	defer func() {
 		logger.Info("readWS 退出，准备关闭连接")
 		a.closeWS()
+		a.terminals.CloseAll()
 	}()
 
 	for {
@@ -408,10 +509,37 @@ func (a *Agent) handleWSMessage(msg *WSMessage) {
 	case WSTypeEnabled:
 		logger.Info("Agent 已被启用，主动拉取任务")
 		a.fetchTasks()
+		if a.pendingApproval.Swap(false) {
+			go a.flushSpool()
+			if a.panelSupports(constant.AgentCapMise) {
+				go a.reportRuntimes()
+			}
+		}
 	case WSTypeExecute:
 		a.handleExecute(msg.Data)
 	case WSTypeStop:
 		a.handleStop(msg.Data)
+	case WSTypeFileBundle:
+		a.handleFileBundle(msg.Data)
+	case WSTypeSDKResponse:
+		a.sdk.handleResponse(msg.Data)
+	case WSTypeSDKGrant:
+		a.sdk.handleGrant(msg.Data)
+	case WSTypeTaskResultAck:
+		var ack struct {
+			LogID string `json:"log_id"`
+		}
+		if json.Unmarshal(msg.Data, &ack) == nil {
+			a.spool.Ack(ack.LogID)
+		}
+	case WSTypeRotateKey:
+		a.rotateKey(msg.Data)
+	case WSTypeTerminalOpen, WSTypeTerminalInput, WSTypeTerminalResize, WSTypeTerminalClose:
+		a.handleTerminalMessage(msg.Type, msg.Data)
+	case WSTypeCommand: // 安装依赖等耗时命令，不阻塞读循环
+		go a.handleCommand(msg.Data)
+	case WSTypeFetchRuntimes:
+		go a.reportRuntimes()
 	}
 }
 
@@ -429,8 +557,10 @@ func (a *Agent) handleConnected(data json.RawMessage) {
 		IsNewAgent      bool                   `json:"is_new_agent"`
 		MachineID       string                 `json:"machine_id"`
 		SchedulerConfig map[string]interface{} `json:"scheduler_config"`
+		PendingApproval bool                   `json:"pending_approval"`
 	}
 	json.Unmarshal(data, &resp)
+	a.handlePanelHello(data)
 
 	if resp.IsNewAgent {
 		logger.Infof("注册成功: Agent #%s, 机器码: %s", resp.AgentID, a.machineID[:16]+"...")
@@ -441,9 +571,20 @@ func (a *Agent) handleConnected(data json.RawMessage) {
 	// 更新调度器配置
 	if resp.SchedulerConfig != nil {
 		a.updateSchedulerConfig(resp.SchedulerConfig)
+		a.saveState(func(state *agentState) { state.SchedulerConfig = resp.SchedulerConfig })
 	}
 
+	a.confirmUpdate()
+	a.pendingApproval.Store(resp.PendingApproval)
+	if resp.PendingApproval {
+		logger.Warnf("Agent #%s 等待面板管理员审批，审批通过后开始接收任务", resp.AgentID)
+		return
+	}
 	a.fetchTasks()
+	go a.flushSpool()
+	if a.panelSupports(constant.AgentCapMise) {
+		go a.reportRuntimes()
+	}
 }
 
 func (a *Agent) updateSchedulerConfig(config map[string]interface{}) {
@@ -479,7 +620,7 @@ func (a *Agent) updateSchedulerConfig(config map[string]interface{}) {
 	a.mu.Unlock()
 
 	if !started {
-		logger.Infof("首次连接成功，启动调度器配置: workers=%d, queue=%d, rate=%v, strict=%t",
+		logger.Infof("启动调度器: workers=%d, queue=%d, rate=%v, strict=%t",
 			newCfg.WorkerCount, newCfg.QueueSize, newCfg.RateInterval, newCfg.StrictQueue)
 		// 用下发的最新配置加载并启动调度器与计划任务管理器
 		a.scheduler.Reload(newCfg)
@@ -505,6 +646,9 @@ func (a *Agent) handleHeartbeatAck(data json.RawMessage) {
 	json.Unmarshal(data, &resp)
 
 	if resp.NeedUpdate && (a.config.AutoUpdate || resp.ForceUpdate) {
+		if !resp.ForceUpdate && resp.LatestVersion != "" && resp.LatestVersion == a.failedUpdateVersion {
+			return // 该版本已回滚过，等待面板强制更新或发布新版本
+		}
 		logger.Infof("发现新版本 %s，开始更新...", resp.LatestVersion)
 		go a.selfUpdate()
 	}
@@ -523,6 +667,7 @@ func (a *Agent) handleTasks(data json.RawMessage) {
 	}
 
 	a.updateTasks(resp.Tasks)
+	a.saveState(func(state *agentState) { state.Tasks = resp.Tasks })
 }
 
 func (a *Agent) handleExecute(data json.RawMessage) {
@@ -534,6 +679,9 @@ func (a *Agent) handleExecute(data json.RawMessage) {
 		Command     string   `json:"command"`
 		PreCommand  string   `json:"pre_command"`
 		PostCommand string   `json:"post_command"`
+
+		Task     *AgentTask `json:"task"`      // 服务端按标签选择器派发的任务不在本地任务列表中，随指令附带定义
+		SDKToken string     `json:"sdk_token"` // 面板为本次执行签发的 SDK 转发凭证，启用加密时为密文
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
 		logger.Errorf("解析立即执行请求失败: %v", err)
@@ -545,16 +693,37 @@ func (a *Agent) handleExecute(data json.RawMessage) {
 	task, exists := a.tasks[req.TaskID]
 	a.mu.RUnlock()
 
+	if !exists && req.Task != nil && req.Task.ID == req.TaskID {
+		inline, err := a.decryptTask(*req.Task)
+		if err != nil {
+			a.failExecute(&executor.ExecutionRequest{TaskID: req.TaskID, LogID: req.LogID, Name: req.Task.Name}, err)
+			return
+		}
+		task, exists = &inline, true
+		a.mu.Lock()
+		a.inlineTasks[task.ID] = task
+		a.mu.Unlock()
+	}
+
 	if !exists {
 		logger.Warnf("任务 #%s 不存在，无法执行", req.TaskID)
 		return
 	}
 
+	reqEnvs, secrets, err := a.decryptPayload(req.Envs, req.Secrets)
+	if err == nil {
+		req.SDKToken, err = a.decryptValue(req.SDKToken)
+	}
+	if err != nil {
+		a.failExecute(&executor.ExecutionRequest{TaskID: task.ID, LogID: req.LogID, Name: task.Name}, err)
+		return
+	}
+
 	// 准备执行请求
 	// 如果消息中携带了环境变量或指令，则优先使用（确保即时生效）
 	envs := task.Envs
-	if req.Envs != "" {
-		envs = req.Envs
+	if reqEnvs != "" {
+		envs = reqEnvs
 	}
 
 	command := task.Command
@@ -581,7 +750,7 @@ func (a *Agent) handleExecute(data json.RawMessage) {
 		PostCommand: postCommand,
 		WorkDir:     task.WorkDir,
 		Envs:        executor.ParseEnvVars(envs),
-		Secrets:     req.Secrets,
+		Secrets:     secrets,
 		Timeout:     task.Timeout,
 		Languages:   task.Languages,
 		UseMise:     task.UseMise(),
@@ -589,6 +758,7 @@ func (a *Agent) handleExecute(data json.RawMessage) {
 	}
 
 	// 立即执行任务（加入队列）
+	a.sdk.accept(req.LogID, req.SDKToken)
 	a.scheduler.EnqueueOrExecute(execReq)
 }
 
@@ -611,8 +781,9 @@ func (a *Agent) handleStop(data json.RawMessage) {
 
 // RealTimeLogWriter 实时日志写入器，通过 WebSocket 发送日志
 type RealTimeLogWriter struct {
-	agent *Agent
-	logID string
+	agent  *Agent
+	logID  string
+	stream string // stdout 或 stderr
 }
 
 func (w *RealTimeLogWriter) Write(p []byte) (n int, err error) {
@@ -627,6 +798,7 @@ func (w *RealTimeLogWriter) Write(p []byte) (n int, err error) {
 	msg := map[string]interface{}{
 		"log_id":  w.logID,
 		"content": string(p),
+		"stream":  w.stream,
 	}
 
 	// 发送消息
@@ -697,16 +869,57 @@ func (a *Agent) sendHeartbeat() {
 		"os":          runtime.GOOS,
 		"arch":        runtime.GOARCH,
 		"auto_update": a.config.AutoUpdate,
+		"load":        a.schedulerLoad(),
+		"metrics":     hostMetrics(),
+		"public_key":  a.publicKey(),
+		"key_proof":   a.keyProof(),
 	}
 	if err := a.sendWSMessage(WSTypeHeartbeat, data); err != nil {
 		logger.Warnf("发送心跳失败: %v", err)
 	}
 }
 
+// schedulerLoad 当前调度器负载，服务端据此为选择器任务挑选最空闲的 Agent
+func (a *Agent) schedulerLoad() models.AgentLoad {
+	statuses := a.scheduler.GetWorkerStatuses()
+	load := models.AgentLoad{
+		WorkerCount:  len(statuses),
+		QueueSize:    a.scheduler.GetQueueSize(),
+		RunningTasks: a.scheduler.GetRunningTaskCount(),
+	}
+	for _, w := range statuses {
+		if w.Status == "running" {
+			load.BusyWorkers++
+		}
+	}
+	return load
+}
+
+// sendTaskResult 上报任务结果，WebSocket 与 HTTP 都不可用时缓存到本地，重连后补传
 func (a *Agent) sendTaskResult(result *TaskResult) {
-	if err := a.sendWSMessage(WSTypeTaskResult, result); err != nil {
+	a.resultMu.Lock()
+	defer a.resultMu.Unlock()
+
+	// 已有未补传的结果时直接排在其后，保证面板按产生顺序收到
+	if a.spool.Len() == 0 {
+		err := a.sendWSMessage(WSTypeTaskResult, result)
+		if err == nil {
+			return
+		}
 		logger.Warnf("发送任务结果失败: %v，尝试 HTTP 上报", err)
-		a.reportResultHTTP(result)
+		if err = a.reportResultHTTP(result); err == nil {
+			return
+		}
+		logger.Warnf("HTTP 上报任务结果失败: %v，缓存到本地", err)
+	}
+
+	result.SpooledAt = time.Now().Unix()
+	if result.LogID == "" {
+		// 本地调度的任务没有面板分配的日志 ID，按开始时间生成，面板以此确认补传并按执行时间排序
+		result.LogID = utils.GenerateIDAt(time.Unix(result.StartTime, 0))
+	}
+	if err := a.spool.Push(result); err != nil {
+		logger.Errorf("缓存任务结果失败 (LogID: %s): %v", result.LogID, err)
 	}
 }
 
@@ -716,6 +929,9 @@ func (a *Agent) reportResultHTTP(result *TaskResult) error {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
 	return nil
 }
 
@@ -725,7 +941,13 @@ func (a *Agent) updateTasks(tasks []AgentTask) {
 
 	newTasks := make(map[string]*AgentTask)
 	for i := range tasks {
-		newTasks[tasks[i].ID] = &tasks[i]
+		// 解密后的副本只在内存中，调用方保存到本地的仍是密文
+		task, err := a.decryptTask(tasks[i])
+		if err != nil {
+			logger.Errorf("任务 #%s 的变量无法解密，暂不调度: %v", tasks[i].ID, err)
+			continue
+		}
+		newTasks[task.ID] = &task
 	}
 
 	// 1. 移除不再存在的任务
@@ -744,7 +966,8 @@ func (a *Agent) updateTasks(tasks []AgentTask) {
 			oldTask.PreCommand != task.PreCommand || oldTask.PostCommand != task.PostCommand ||
 			oldTask.Enabled != task.Enabled || oldTask.Timeout != task.Timeout ||
 			oldTask.WorkDir != task.WorkDir || oldTask.Envs != task.Envs ||
-			oldTask.RandomRange != task.RandomRange {
+			oldTask.RandomRange != task.RandomRange || !slices.Equal(oldTask.SyncFiles, task.SyncFiles) ||
+			!languagesEqual(oldTask.Languages, task.Languages) {
 			if task.Enabled {
 				err := a.cronManager.AddTask(task)
 				if err != nil {
@@ -772,6 +995,7 @@ func (a *Agent) clearAllTasks() {
 
 	a.tasks = make(map[string]*AgentTask)
 	a.lastTaskCount = 0
+	a.saveState(func(state *agentState) { state.Tasks = nil })
 	logger.Info("所有任务已清空")
 }
 
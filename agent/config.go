@@ -15,6 +15,8 @@ type Config struct {
 	Token      string
 	Interval   int
 	AutoUpdate bool
+
+	UpdatePublicKey string // 自更新签名公钥，仅在编译时未内置公钥时生效
 }
 
 func loadConfigFile(path string, config *Config) error {
@@ -41,6 +43,9 @@ func loadConfigFile(path string, config *Config) error {
 	if v := section.Key("auto_update").String(); v != "" {
 		config.AutoUpdate = v == "true" || v == "1"
 	}
+	if v := section.Key("update_public_key").String(); v != "" {
+		config.UpdatePublicKey = v
+	}
 	return nil
 }
 
@@ -61,6 +66,9 @@ func saveConfigFile(path string, config *Config) error {
 	} else {
 		section.Key("auto_update").SetValue("false")
 	}
+	if config.UpdatePublicKey != "" {
+		section.Key("update_public_key").SetValue(config.UpdatePublicKey)
+	}
 
 	return cfg.SaveTo(path)
 }
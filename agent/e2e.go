@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+)
+
+// e2eKeyring 端到端加密密钥，面板用公钥加密下发的变量与机密，明文只在执行前解出
+// 轮换后保留上一把私钥，用于解密轮换前下发或保存在本地状态中的任务
+type e2eKeyring struct {
+	mu        sync.RWMutex
+	Current   string `json:"private_key"`
+	Previous  string `json:"previous_key,omitempty"`
+	RotatedAt int64  `json:"rotated_at"`
+	proof     string // 用旧私钥解出的轮换挑战，随心跳回传证明新公钥来自本机
+}
+
+func getKeyFile() string {
+	return filepath.Join(dataDir, "e2e.key")
+}
+
+// loadKeyring 读取本地密钥，不存在时生成新密钥
+func loadKeyring() (*e2eKeyring, error) {
+	k := &e2eKeyring{}
+	data, err := os.ReadFile(getKeyFile())
+	if err == nil {
+		if err := json.Unmarshal(data, k); err != nil {
+			return nil, fmt.Errorf("读取加密密钥失败: %v", err)
+		}
+		if _, err := agentcrypto.PublicKey(k.Current); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := k.Rotate(""); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// PublicKey 当前公钥，随连接与心跳上报给面板
+func (k *e2eKeyring) PublicKey() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	pub, _ := agentcrypto.PublicKey(k.Current)
+	return pub
+}
+
+// Proof 最近一次轮换挑战的明文，没有时为空
+func (k *e2eKeyring) Proof() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.proof
+}
+
+// Rotate 生成新密钥并落盘，旧私钥保留一轮；challenge 为面板用旧公钥加密的挑战
+func (k *e2eKeyring) Rotate(challenge string) error {
+	var proof string
+	if challenge != "" {
+		plain, err := k.Decrypt(challenge)
+		if err == nil && !agentcrypto.IsEncrypted(challenge) {
+			err = fmt.Errorf("挑战未加密")
+		}
+		if err != nil {
+			return fmt.Errorf("解密轮换挑战失败: %v", err)
+		}
+		proof = plain
+	}
+
+	_, priv, err := agentcrypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	next := e2eKeyring{Current: priv, Previous: k.Current, RotatedAt: time.Now().Unix()}
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(dataDir, 0755)
+	tmp := getKeyFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, getKeyFile()); err != nil {
+		return err
+	}
+	k.Current, k.Previous, k.RotatedAt = next.Current, next.Previous, next.RotatedAt
+	k.proof = proof
+	return nil
+}
+
+// Decrypt 依次尝试当前与上一把私钥，明文值原样返回
+func (k *e2eKeyring) Decrypt(value string) (string, error) {
+	if !agentcrypto.IsEncrypted(value) {
+		return value, nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	plain, err := agentcrypto.Decrypt(k.Current, value)
+	if err != nil && k.Previous != "" {
+		if prev, prevErr := agentcrypto.Decrypt(k.Previous, value); prevErr == nil {
+			return prev, nil
+		}
+	}
+	return plain, err
+}
+
+// decryptPayload 解密变量与机密，未启用加密时原样返回
+func (a *Agent) decryptPayload(envs string, secrets []string) (string, []string, error) {
+	if a.keys == nil {
+		return envs, secrets, nil
+	}
+	plainEnvs, err := a.keys.Decrypt(envs)
+	if err != nil {
+		return "", nil, fmt.Errorf("解密环境变量失败: %v", err)
+	}
+	var plainSecrets []string
+	if secrets != nil {
+		plainSecrets = make([]string, len(secrets))
+	}
+	for i, s := range secrets {
+		if plainSecrets[i], err = a.keys.Decrypt(s); err != nil {
+			return "", nil, fmt.Errorf("解密机密失败: %v", err)
+		}
+	}
+	return plainEnvs, plainSecrets, nil
+}
+
+// decryptValue 解密面板下发的单个值（如 SDK 转发凭证），未启用加密时原样返回
+func (a *Agent) decryptValue(value string) (string, error) {
+	if a.keys == nil {
+		return value, nil
+	}
+	return a.keys.Decrypt(value)
+}
+
+// decryptTask 返回解密后的任务副本，本地保存的任务状态仍为密文
+func (a *Agent) decryptTask(task AgentTask) (AgentTask, error) {
+	envs, secrets, err := a.decryptPayload(task.Envs, task.Secrets)
+	if err != nil {
+		return task, err
+	}
+	task.Envs, task.Secrets = envs, secrets
+	return task, nil
+}
+
+// publicKey 上报给面板的公钥，密钥不可用时为空，面板按明文下发
+func (a *Agent) publicKey() string {
+	if a.keys == nil {
+		return ""
+	}
+	return a.keys.PublicKey()
+}
+
+// keyProof 随心跳回传的轮换挑战明文
+func (a *Agent) keyProof() string {
+	if a.keys == nil {
+		return ""
+	}
+	return a.keys.Proof()
+}
+
+// rotateKey 面板要求轮换密钥，立即通过心跳上报新公钥与挑战明文，面板随后用新公钥重新下发任务
+func (a *Agent) rotateKey(data json.RawMessage) {
+	if a.keys == nil {
+		logger.Warn("端到端加密密钥不可用，无法轮换")
+		return
+	}
+	var req struct {
+		Challenge string `json:"challenge"`
+	}
+	json.Unmarshal(data, &req)
+	if err := a.keys.Rotate(req.Challenge); err != nil {
+		logger.Errorf("轮换加密密钥失败: %v", err)
+		return
+	}
+	logger.Info("已轮换端到端加密密钥")
+	a.sendHeartbeat()
+}
+
+// failExecute 立即执行的任务无法准备时直接上报失败
+func (a *Agent) failExecute(req *executor.ExecutionRequest, err error) {
+	logger.Errorf("任务 #%s 无法执行: %v", req.TaskID, err)
+	(&AgentHandler{agent: a}).OnTaskFailed(req, err)
+}
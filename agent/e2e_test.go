@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+)
+
+func TestKeyringRotateAndDecrypt(t *testing.T) {
+	oldDataDir := dataDir
+	dataDir = t.TempDir()
+	defer func() { dataDir = oldDataDir }()
+
+	keys, err := loadKeyring()
+	if err != nil {
+		t.Fatalf("loadKeyring: %v", err)
+	}
+	oldPub := keys.PublicKey()
+	sealedEnvs, _ := agentcrypto.Encrypt(oldPub, "TOKEN=abc")
+	sealedSecret, _ := agentcrypto.Encrypt(oldPub, "abc")
+
+	// 重新加载得到同一把密钥
+	reloaded, err := loadKeyring()
+	if err != nil || reloaded.PublicKey() != oldPub {
+		t.Fatalf("reloaded key differs: %v", err)
+	}
+
+	if err := keys.Rotate("not-a-challenge"); err == nil {
+		t.Fatal("rotation with an undecryptable challenge should fail")
+	}
+	challenge, _ := agentcrypto.Encrypt(oldPub, "nonce-1")
+	if err := keys.Rotate(challenge); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if keys.PublicKey() == oldPub {
+		t.Fatal("public key should change after rotation")
+	}
+	if keys.Proof() != "nonce-1" {
+		t.Errorf("proof = %q, want the decrypted challenge", keys.Proof())
+	}
+
+	// 轮换前下发的任务仍可用上一把私钥解密
+	a := &Agent{keys: keys}
+	task, err := a.decryptTask(AgentTask{ID: "t1", Envs: sealedEnvs, Secrets: []string{sealedSecret, "plain"}})
+	if err != nil {
+		t.Fatalf("decryptTask: %v", err)
+	}
+	if task.Envs != "TOKEN=abc" || task.Secrets[0] != "abc" || task.Secrets[1] != "plain" {
+		t.Errorf("decrypted task = %+v", task)
+	}
+
+	// 再轮换一次后最早的密钥被丢弃
+	keys.Rotate("")
+	if _, err := keys.Decrypt(sealedEnvs); err == nil {
+		t.Error("value sealed two rotations ago should not decrypt")
+	}
+
+	// 未启用加密时原样返回
+	plain := &Agent{}
+	if envs, secrets, err := plain.decryptPayload("A=1", []string{"s"}); err != nil || envs != "A=1" || secrets[0] != "s" {
+		t.Errorf("decryptPayload without keys = %q %v %v", envs, secrets, err)
+	}
+}
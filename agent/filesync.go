@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// fileSyncTimeout 等待面板返回文件的超时时间
+const fileSyncTimeout = 60 * time.Second
+
+// errPanelUnavailable 面板不可达，此时沿用本地已同步的文件执行
+var errPanelUnavailable = errors.New("面板不可达")
+
+// 同步文件的本地缓存：objects 下按 SHA-256 保存内容，manifests 下记录每个任务上次同步的清单
+func getFileCacheDir() string {
+	return filepath.Join(scriptsDir, ".baihu")
+}
+
+func getObjectPath(hash string) string {
+	return filepath.Join(getFileCacheDir(), "objects", hash)
+}
+
+func getManifestPath(taskID string) string {
+	return filepath.Join(getFileCacheDir(), "manifests", taskID+".json")
+}
+
+func loadFileManifest(path string) []models.AgentFile {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var files []models.AgentFile
+	json.Unmarshal(data, &files)
+	return files
+}
+
+// writeFileAtomic 先写临时文件再重命名，执行中的脚本不会读到半个文件
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	os.Chmod(tmp, mode)
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// lookupTask 查找任务定义，包括随执行指令下发、不在本地任务列表中的任务
+func (a *Agent) lookupTask(taskID string) *AgentTask {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if task, ok := a.tasks[taskID]; ok {
+		return task
+	}
+	return a.inlineTasks[taskID]
+}
+
+// requestFiles 向面板请求任务的文件清单及本地缺少的内容
+func (a *Agent) requestFiles(taskID string, have []string) (*models.AgentFileBundle, error) {
+	if !a.panelSupports(constant.AgentCapFileSync) {
+		return nil, fmt.Errorf("%w: 面板版本过旧，不支持文件同步", errPanelUnavailable)
+	}
+
+	requestID := utils.GenerateID()
+	ch := make(chan *models.AgentFileBundle, 1)
+	a.fileMu.Lock()
+	a.fileWaiters[requestID] = ch
+	a.fileMu.Unlock()
+	defer func() {
+		a.fileMu.Lock()
+		delete(a.fileWaiters, requestID)
+		a.fileMu.Unlock()
+	}()
+
+	err := a.sendWSMessage(WSTypeFileSync, map[string]interface{}{
+		"request_id": requestID,
+		"task_id":    taskID,
+		"have":       have,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPanelUnavailable, err)
+	}
+
+	select {
+	case bundle := <-ch:
+		if bundle.Error != "" {
+			return nil, fmt.Errorf("面板拒绝同步: %s", bundle.Error)
+		}
+		return bundle, nil
+	case <-time.After(fileSyncTimeout):
+		return nil, fmt.Errorf("%w: 等待文件超时", errPanelUnavailable)
+	}
+}
+
+// handleFileBundle 将面板返回的文件交给等待中的同步请求
+func (a *Agent) handleFileBundle(data json.RawMessage) {
+	var bundle models.AgentFileBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		logger.Errorf("解析文件同步响应失败: %v", err)
+		return
+	}
+	a.fileMu.Lock()
+	ch, ok := a.fileWaiters[bundle.RequestID]
+	a.fileMu.Unlock()
+	if ok {
+		ch <- &bundle
+	}
+}
+
+// syncTaskFiles 执行前同步任务所需的脚本文件到本地脚本目录，只传输内容有变化的文件
+// 返回更新的文件数
+func (a *Agent) syncTaskFiles(task *AgentTask) (int, error) {
+	a.fileSyncMu.Lock()
+	defer a.fileSyncMu.Unlock()
+
+	prev := loadFileManifest(getManifestPath(task.ID))
+	var have []string
+	for _, f := range prev {
+		if _, err := os.Stat(getObjectPath(f.Hash)); err == nil {
+			have = append(have, f.Hash)
+		}
+	}
+
+	bundle, err := a.requestFiles(task.ID, have)
+	if err != nil {
+		return 0, err
+	}
+	return a.applyFileBundle(task.ID, prev, bundle)
+}
+
+// applyFileBundle 保存面板返回的内容并写出文件，prev 为该任务上次同步的清单
+func (a *Agent) applyFileBundle(taskID string, prev []models.AgentFile, bundle *models.AgentFileBundle) (int, error) {
+	prevHash := make(map[string]string, len(prev))
+	for _, f := range prev {
+		prevHash[f.Path] = f.Hash
+	}
+
+	// 1. 校验并保存新内容
+	for hash, compressed := range bundle.Blobs {
+		content, err := utils.DecompressZstd(compressed)
+		if err != nil {
+			return 0, fmt.Errorf("解压文件内容失败: %v", err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		if hex.EncodeToString(sum[:]) != hash {
+			return 0, fmt.Errorf("文件内容校验失败: %s", hash)
+		}
+		if err := writeFileAtomic(getObjectPath(hash), []byte(content), 0600); err != nil {
+			return 0, err
+		}
+	}
+
+	// 2. 写出内容有变化或本地缺失的文件
+	root, _ := filepath.Abs(scriptsDir)
+	updated := 0
+	current := make(map[string]bool, len(bundle.Files))
+	for _, f := range bundle.Files {
+		target := filepath.Join(root, filepath.FromSlash(f.Path))
+		if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return updated, fmt.Errorf("非法的同步路径: %s", f.Path)
+		}
+		if len(f.Hash) != sha256.Size*2 {
+			return updated, fmt.Errorf("非法的文件哈希: %s", f.Hash)
+		}
+		current[f.Path] = true
+		if info, err := os.Stat(target); err == nil && info.Size() == f.Size && prevHash[f.Path] == f.Hash {
+			continue
+		}
+		content, err := os.ReadFile(getObjectPath(f.Hash))
+		if err != nil {
+			return updated, fmt.Errorf("本地缓存缺少文件 %s: %v", f.Path, err)
+		}
+		mode := os.FileMode(f.Mode).Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := writeFileAtomic(target, content, mode); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	// 3. 删除面板上已移除、且不被其他任务使用的文件
+	others := a.syncedPaths(taskID)
+	for _, f := range prev {
+		if !current[f.Path] && !others[f.Path] {
+			os.Remove(filepath.Join(root, filepath.FromSlash(f.Path)))
+		}
+	}
+
+	data, _ := json.Marshal(bundle.Files)
+	if err := writeFileAtomic(getManifestPath(taskID), data, 0600); err != nil {
+		return updated, err
+	}
+	a.pruneObjects()
+	return updated, nil
+}
+
+// syncedPaths 其他任务已同步的文件路径
+func (a *Agent) syncedPaths(exceptTaskID string) map[string]bool {
+	paths := make(map[string]bool)
+	entries, _ := os.ReadDir(filepath.Join(getFileCacheDir(), "manifests"))
+	for _, e := range entries {
+		if e.Name() == exceptTaskID+".json" {
+			continue
+		}
+		for _, f := range loadFileManifest(filepath.Join(getFileCacheDir(), "manifests", e.Name())) {
+			paths[f.Path] = true
+		}
+	}
+	return paths
+}
+
+// pruneObjects 清理不再被任何任务清单引用的缓存内容
+func (a *Agent) pruneObjects() {
+	used := make(map[string]bool)
+	manifestDir := filepath.Join(getFileCacheDir(), "manifests")
+	entries, _ := os.ReadDir(manifestDir)
+	for _, e := range entries {
+		for _, f := range loadFileManifest(filepath.Join(manifestDir, e.Name())) {
+			used[f.Hash] = true
+		}
+	}
+	objects, _ := os.ReadDir(filepath.Join(getFileCacheDir(), "objects"))
+	for _, o := range objects {
+		if !used[o.Name()] {
+			os.Remove(getObjectPath(o.Name()))
+		}
+	}
+}
+
+// prepareTaskFiles 执行前同步任务文件，未指定工作目录时在脚本目录中执行
+// 面板不可达时沿用上次同步的文件，面板拒绝或文件校验失败时任务失败
+func (a *Agent) prepareTaskFiles(req *executor.ExecutionRequest, task *AgentTask) error {
+	updated, err := a.syncTaskFiles(task)
+	switch {
+	case errors.Is(err, errPanelUnavailable):
+		logger.Warnf("任务 #%s 同步文件失败，使用本地已同步的文件: %v", task.ID, err)
+		a.sendTaskSystemLog(req.LogID, fmt.Sprintf("[文件同步] %v，使用本地已同步的文件\n", err))
+	case err != nil:
+		return fmt.Errorf("同步任务文件失败: %v", err)
+	case updated > 0:
+		logger.Infof("任务 #%s 已同步 %d 个更新的文件", task.ID, updated)
+		a.sendTaskSystemLog(req.LogID, fmt.Sprintf("[文件同步] 已更新 %d 个文件\n", updated))
+	}
+
+	if strings.TrimSpace(req.WorkDir) == "" {
+		req.WorkDir, _ = filepath.Abs(scriptsDir)
+	}
+	return nil
+}
+
+// sendTaskSystemLog 向面板发送一条系统日志
+func (a *Agent) sendTaskSystemLog(logID, content string) {
+	if logID == "" {
+		return
+	}
+	a.sendWSMessage(WSTypeTaskLog, map[string]interface{}{
+		"log_id":  logID,
+		"content": content,
+		"stream":  "system",
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+func TestApplyFileBundle(t *testing.T) {
+	old := scriptsDir
+	scriptsDir = t.TempDir()
+	defer func() { scriptsDir = old }()
+
+	file := func(path, content string) (models.AgentFile, []byte) {
+		sum := sha256.Sum256([]byte(content))
+		return models.AgentFile{Path: path, Hash: hex.EncodeToString(sum[:]), Size: int64(len(content)), Mode: 0755}, utils.CompressZstd(content)
+	}
+	a := &Agent{}
+
+	// 首次同步：全部写出
+	main1, blob1 := file("job/main.sh", "echo v1\n")
+	lib, blobLib := file("job/lib.sh", "helper\n")
+	bundle := &models.AgentFileBundle{
+		Files: []models.AgentFile{lib, main1},
+		Blobs: map[string][]byte{main1.Hash: blob1, lib.Hash: blobLib},
+	}
+	if n, err := a.applyFileBundle("t1", nil, bundle); err != nil || n != 2 {
+		t.Fatalf("first sync: n=%d err=%v", n, err)
+	}
+
+	// 再次同步：只有 main.sh 变化，lib.sh 从面板上移除
+	main2, blob2 := file("job/main.sh", "echo v2\n")
+	bundle = &models.AgentFileBundle{
+		Files: []models.AgentFile{main2},
+		Blobs: map[string][]byte{main2.Hash: blob2},
+	}
+	if n, err := a.applyFileBundle("t1", []models.AgentFile{lib, main1}, bundle); err != nil || n != 1 {
+		t.Fatalf("second sync: n=%d err=%v", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(scriptsDir, "job", "main.sh")); string(data) != "echo v2\n" {
+		t.Errorf("main.sh = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(scriptsDir, "job", "lib.sh")); !os.IsNotExist(err) {
+		t.Errorf("lib.sh should be removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(getObjectPath(main1.Hash)); !os.IsNotExist(err) {
+		t.Errorf("unused object should be pruned")
+	}
+
+	// 内容与哈希不符时拒绝
+	bad := &models.AgentFileBundle{Files: []models.AgentFile{main2}, Blobs: map[string][]byte{main2.Hash: blob1}}
+	if _, err := a.applyFileBundle("t1", nil, bad); err == nil {
+		t.Error("expected checksum error")
+	}
+	escape, blobEscape := file("../evil.sh", "x")
+	bad = &models.AgentFileBundle{Files: []models.AgentFile{escape}, Blobs: map[string][]byte{escape.Hash: blobEscape}}
+	if _, err := a.applyFileBundle("t1", nil, bad); err == nil {
+		t.Error("expected path error")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/gorilla/websocket"
+)
+
+func TestTaskLogWritersTagStream(t *testing.T) {
+	frames := make(chan WSMessage, 4)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg WSMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			frames <- msg
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("连接测试服务失败: %v", err)
+	}
+	defer conn.Close()
+	a := &Agent{wsConn: conn, taskLogs: make(map[string][]string)}
+
+	stdout, stderr, err := (&AgentHandler{agent: a}).OnTaskExecuting(&executor.ExecutionRequest{TaskID: "t1", LogID: "l1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout == stderr {
+		t.Fatal("stdout 与 stderr 应使用不同的写入器")
+	}
+	stdout.Write([]byte("out\n"))
+	stderr.Write([]byte("err\n"))
+
+	for _, want := range []struct{ content, stream string }{{"out\n", "stdout"}, {"err\n", "stderr"}} {
+		select {
+		case msg := <-frames:
+			var data struct {
+				LogID   string `json:"log_id"`
+				Content string `json:"content"`
+				Stream  string `json:"stream"`
+			}
+			json.Unmarshal(msg.Data, &data)
+			if msg.Type != WSTypeTaskLog || data.LogID != "l1" || data.Content != want.content || data.Stream != want.stream {
+				t.Errorf("日志帧不正确: %s %+v", msg.Type, data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("未收到日志帧")
+		}
+	}
+}
@@ -25,6 +25,8 @@ const ServiceDesc = "Baihu Agent Service"
 var (
 	Version   = "dev"
 	BuildTime = ""
+
+	UpdatePublicKey = "" // 自更新签名公钥（base64 编码的 ed25519 公钥）
 )
 
 // 全局配置
@@ -32,6 +34,7 @@ var (
 	configFile = "config.ini"
 	logFile    = "logs/agent.log"
 	dataDir    = "data"
+	scriptsDir = "scripts" // 从面板同步的脚本文件存放目录
 )
 
 func main() {
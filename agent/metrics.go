@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/engigu/baihu-panel/internal/models"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// hostMetrics 采集本机资源，随心跳上报。CPU 使用率为距上次采集（即上次心跳）以来的平均值
+// 磁盘统计脚本目录所在分区，任务产生的文件与日志都写在这里
+func hostMetrics() models.AgentHostMetrics {
+	var m models.AgentHostMetrics
+	if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+		m.CPUPercent = percents[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		m.MemTotal, m.MemUsed, m.MemPercent = vm.Total, vm.Used, vm.UsedPercent
+	}
+	m.DiskPath, _ = filepath.Abs(scriptsDir)
+	usage, err := disk.Usage(m.DiskPath)
+	if err != nil {
+		m.DiskPath = filepath.VolumeName(m.DiskPath) + string(filepath.Separator)
+		usage, err = disk.Usage(m.DiskPath)
+	}
+	if err == nil {
+		m.DiskTotal, m.DiskUsed, m.DiskPercent = usage.Total, usage.Used, usage.UsedPercent
+	}
+	if avg, err := load.Avg(); err == nil {
+		m.Load1, m.Load5, m.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	if uptime, err := host.Uptime(); err == nil {
+		m.Uptime = uptime
+	}
+	return m
+}
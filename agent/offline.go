@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/logger"
+)
+
+// maxSpoolSize 本地缓存的任务结果上限，超出后丢弃最旧的结果，避免长时间断线占满磁盘
+const maxSpoolSize = 1000
+
+// resultAckTimeout 补传一条结果后等待面板确认的时间，超时则保留缓存在下次连接时重传
+var resultAckTimeout = 30 * time.Second
+
+// resultSpool 与面板断线期间的任务结果缓存
+// 每条结果保存为一个文件，文件名按产生顺序递增，重连后按顺序补传
+type resultSpool struct {
+	dir string
+	mu  sync.Mutex
+	seq uint64
+
+	ackMu sync.Mutex
+	acks  map[string]chan struct{} // 等待面板确认的补传结果，按日志 ID
+}
+
+func newResultSpool(dir string) *resultSpool {
+	return &resultSpool{dir: dir}
+}
+
+// files 按产生顺序返回缓存文件名
+func (s *resultSpool) files() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len 待补传的结果数
+func (s *resultSpool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files())
+}
+
+// Push 缓存一条结果，先写临时文件再重命名，避免进程退出时留下半个文件
+func (s *resultSpool) Push(result *TaskResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), s.seq%1000000)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if names := s.files(); len(names) > maxSpoolSize {
+		for _, old := range names[:len(names)-maxSpoolSize] {
+			os.Remove(filepath.Join(s.dir, old))
+		}
+		logger.Warnf("[Spool] 本地缓存的任务结果超过 %d 条，已丢弃最旧的 %d 条", maxSpoolSize, len(names)-maxSpoolSize)
+	}
+	return nil
+}
+
+// Flush 按产生顺序补传缓存的结果，send 失败时停止并保留剩余结果，返回成功补传的条数
+func (s *resultSpool) Flush(send func(*TaskResult) error) (int, error) {
+	sent := 0
+	for {
+		s.mu.Lock()
+		names := s.files()
+		if len(names) == 0 {
+			s.mu.Unlock()
+			return sent, nil
+		}
+		path := filepath.Join(s.dir, names[0])
+		data, err := os.ReadFile(path)
+		if err != nil {
+			s.mu.Unlock()
+			return sent, err
+		}
+
+		var result TaskResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			// 损坏的文件无法补传，直接丢弃
+			logger.Warnf("[Spool] 丢弃无法解析的缓存结果 %s: %v", names[0], err)
+			os.Remove(path)
+			s.mu.Unlock()
+			continue
+		}
+		if err := send(&result); err != nil {
+			s.mu.Unlock()
+			return sent, err
+		}
+		os.Remove(path)
+		sent++
+		s.mu.Unlock()
+	}
+}
+
+// Ack 面板确认已保存日志 ID 对应的补传结果
+func (s *resultSpool) Ack(logID string) {
+	s.ackMu.Lock()
+	defer s.ackMu.Unlock()
+	if ch, ok := s.acks[logID]; ok {
+		close(ch)
+		delete(s.acks, logID)
+	}
+}
+
+// sendAndWait 发送一条补传结果并等待面板确认，写入连接成功不代表面板已保存
+func (s *resultSpool) sendAndWait(result *TaskResult, send func(*TaskResult) error, timeout time.Duration) error {
+	ch := make(chan struct{})
+	s.ackMu.Lock()
+	if s.acks == nil {
+		s.acks = make(map[string]chan struct{})
+	}
+	s.acks[result.LogID] = ch
+	s.ackMu.Unlock()
+
+	defer func() {
+		s.ackMu.Lock()
+		if s.acks[result.LogID] == ch {
+			delete(s.acks, result.LogID)
+		}
+		s.ackMu.Unlock()
+	}()
+
+	if err := send(result); err != nil {
+		return err
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("等待面板确认结果 %s 超时", result.LogID)
+	}
+}
+
+// agentState 落盘的调度配置与任务列表，Agent 在面板不可达时重启仍按原计划执行
+type agentState struct {
+	SchedulerConfig map[string]interface{} `json:"scheduler_config"`
+	Tasks           []AgentTask            `json:"tasks"`
+	SavedAt         int64                  `json:"saved_at"`
+}
+
+func getStateFile() string {
+	return filepath.Join(dataDir, "state.json")
+}
+
+func getSpoolDir() string {
+	return filepath.Join(dataDir, "spool")
+}
+
+// loadState 读取上次保存的状态，文件不存在时返回 nil
+func loadState() (*agentState, error) {
+	data, err := os.ReadFile(getStateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var state agentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveState 更新并保存状态，update 在持有锁时修改内存中的状态
+func (a *Agent) saveState(update func(state *agentState)) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	update(&a.state)
+	a.state.SavedAt = time.Now().Unix()
+	data, err := json.Marshal(&a.state)
+	if err != nil {
+		return
+	}
+
+	os.MkdirAll(dataDir, 0755)
+	tmp := getStateFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		logger.Warnf("保存任务状态失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, getStateFile()); err != nil {
+		logger.Warnf("保存任务状态失败: %v", err)
+	}
+}
+
+// restoreState 使用上次保存的调度配置和任务启动调度器，不等待面板连接
+func (a *Agent) restoreState() {
+	state, err := loadState()
+	if err != nil {
+		logger.Warnf("读取本地任务状态失败: %v", err)
+		return
+	}
+	if state == nil || len(state.Tasks) == 0 {
+		return
+	}
+
+	a.stateMu.Lock()
+	a.state = *state
+	a.stateMu.Unlock()
+
+	logger.Infof("从本地恢复 %d 个任务 (保存于 %s)，连接面板前按原计划执行",
+		len(state.Tasks), time.Unix(state.SavedAt, 0).Format("2006-01-02 15:04:05"))
+	a.updateSchedulerConfig(state.SchedulerConfig)
+	a.lastTaskCount = len(state.Tasks)
+	a.updateTasks(state.Tasks)
+}
+
+// flushSpool 重连后按顺序补传断线期间缓存的结果
+func (a *Agent) flushSpool() {
+	a.resultMu.Lock()
+	defer a.resultMu.Unlock()
+
+	send := func(result *TaskResult) error {
+		return a.sendWSMessage(WSTypeTaskResult, result)
+	}
+	if a.panelSupports(constant.AgentCapResultAck) {
+		// 面板确认保存后才删除缓存，发送后连接中断的结果在下次连接时重传
+		write := send
+		send = func(result *TaskResult) error {
+			return a.spool.sendAndWait(result, write, resultAckTimeout)
+		}
+	}
+	sent, err := a.spool.Flush(send)
+	if sent > 0 {
+		logger.Infof("[Spool] 已补传 %d 条断线期间的任务结果", sent)
+	}
+	if err != nil {
+		logger.Warnf("[Spool] 补传中断，剩余结果将在下次连接时继续: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResultSpoolFlushInOrder(t *testing.T) {
+	spool := newResultSpool(t.TempDir())
+	for _, id := range []string{"a", "b", "c"} {
+		if err := spool.Push(&TaskResult{LogID: id}); err != nil {
+			t.Fatalf("Push(%s) error: %v", id, err)
+		}
+	}
+
+	// 发送失败时停止，已发送的移除，其余保留
+	var got []string
+	sent, err := spool.Flush(func(r *TaskResult) error {
+		if r.LogID == "b" {
+			return errors.New("offline")
+		}
+		got = append(got, r.LogID)
+		return nil
+	})
+	if err == nil || sent != 1 || spool.Len() != 2 {
+		t.Fatalf("partial flush: sent=%d err=%v len=%d", sent, err, spool.Len())
+	}
+
+	sent, err = spool.Flush(func(r *TaskResult) error {
+		got = append(got, r.LogID)
+		return nil
+	})
+	if err != nil || sent != 2 || spool.Len() != 0 {
+		t.Fatalf("flush: sent=%d err=%v len=%d", sent, err, spool.Len())
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("flush order = %v, want [a b c]", got)
+	}
+}
+
+func TestResultSpoolKeepsUnackedResults(t *testing.T) {
+	spool := newResultSpool(t.TempDir())
+	if err := spool.Push(&TaskResult{LogID: "a"}); err != nil {
+		t.Fatalf("Push error: %v", err)
+	}
+
+	// 写入成功但面板未确认（如发送后连接中断），结果保留待下次重传
+	sent, err := spool.Flush(func(r *TaskResult) error {
+		return spool.sendAndWait(r, func(*TaskResult) error { return nil }, 50*time.Millisecond)
+	})
+	if err == nil || sent != 0 || spool.Len() != 1 {
+		t.Fatalf("unacked flush: sent=%d err=%v len=%d", sent, err, spool.Len())
+	}
+
+	sent, err = spool.Flush(func(r *TaskResult) error {
+		return spool.sendAndWait(r, func(r *TaskResult) error {
+			go spool.Ack(r.LogID)
+			return nil
+		}, time.Second)
+	})
+	if err != nil || sent != 1 || spool.Len() != 0 {
+		t.Fatalf("acked flush: sent=%d err=%v len=%d", sent, err, spool.Len())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/logger"
+)
+
+// sendHello 连接建立后立即上报协议版本与能力，面板据此决定可使用的功能
+func (a *Agent) sendHello() {
+	// 面板的 connected 消息到达前按旧版面板处理
+	legacy := agentproto.Legacy()
+	a.panel.Store(&legacy)
+	if err := a.sendWSMessage(WSTypeHello, agentproto.Local()); err != nil {
+		logger.Warnf("发送握手信息失败: %v", err)
+	}
+}
+
+// handlePanelHello 解析 connected 消息中的面板协议信息，旧版面板不带这些字段
+// 面板修改调度配置时也会推送不带协议信息的 connected 消息，此时保留连接时的协商结果
+func (a *Agent) handlePanelHello(data json.RawMessage) {
+	var hello agentproto.Hello
+	if err := json.Unmarshal(data, &hello); err != nil || hello.ProtocolVersion == 0 {
+		return
+	}
+	peer := agentproto.Negotiate(hello)
+	a.panel.Store(&peer)
+	logger.Infof("面板协议版本 %d，能力 %v", peer.ProtocolVersion, peer.Capabilities)
+}
+
+// panelSupports 面板是否支持某项能力，未握手时视为旧版面板
+func (a *Agent) panelSupports(capability string) bool {
+	peer := a.panel.Load()
+	return peer != nil && peer.Supports(capability)
+}
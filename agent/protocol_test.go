@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+func TestPanelHandshakeCompat(t *testing.T) {
+	a := &Agent{}
+	legacy := agentproto.Legacy()
+	a.panel.Store(&legacy)
+
+	// 旧版面板的 connected 不带协议信息，文件同步等新功能不可用
+	a.handlePanelHello(json.RawMessage(`{"agent_id":"a1","name":"agent-1","is_new_agent":false,"machine_id":"m1","scheduler_config":{"worker_count":4}}`))
+	if a.panelSupports(constant.AgentCapFileSync) {
+		t.Error("legacy panel should not support file sync")
+	}
+	if _, err := a.requestFiles("t1", nil); !errors.Is(err, errPanelUnavailable) {
+		t.Errorf("requestFiles on legacy panel = %v, want errPanelUnavailable", err)
+	}
+
+	// 新版面板在 connected 中声明能力
+	local, _ := json.Marshal(map[string]interface{}{
+		"agent_id":         "a1",
+		"protocol_version": constant.AgentProtocolVersion,
+		"capabilities":     agentproto.Local().Capabilities,
+	})
+	a.handlePanelHello(local)
+	if !a.panelSupports(constant.AgentCapFileSync) || !a.panelSupports(constant.AgentCapMise) {
+		t.Error("current panel should support file sync and mise")
+	}
+
+	// 修改调度配置时推送的 connected 不带协议信息，保留协商结果
+	a.handlePanelHello(json.RawMessage(`{"agent_id":"a1","name":"agent-1","scheduler_config":{"worker_count":2}}`))
+	if !a.panelSupports(constant.AgentCapFileSync) {
+		t.Error("scheduler config push should keep negotiated capabilities")
+	}
+
+	// 未握手（尚未连接）时视为旧版面板
+	if (&Agent{}).panelSupports(constant.AgentCapFileSync) {
+		t.Error("agent without handshake should treat panel as legacy")
+	}
+}
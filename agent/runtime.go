@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// maxCommandOutput 一次性命令结果中保留的输出长度，超出时只保留末尾
+const maxCommandOutput = 512 << 10
+
+// defaultCommandTimeout 面板未指定超时时间时的默认值
+const defaultCommandTimeout = 30 * time.Minute
+
+// languagesEqual 比较任务的语言配置
+func languagesEqual(a, b []map[string]string) bool {
+	return slices.EqualFunc(a, b, func(x, y map[string]string) bool { return maps.Equal(x, y) })
+}
+
+// parseMiseList 解析 mise ls --json 的输出，兼容数组与按插件分组的对象两种格式
+func parseMiseList(output []byte) (models.AgentRuntimes, error) {
+	var list []models.AgentRuntime
+	if err := json.Unmarshal(output, &list); err == nil {
+		return list, nil
+	}
+
+	var grouped map[string][]models.AgentRuntime
+	if err := json.Unmarshal(output, &grouped); err != nil {
+		return nil, fmt.Errorf("解析 mise ls --json 输出失败: %v", err)
+	}
+	var runtimes models.AgentRuntimes
+	for _, plugin := range slices.Sorted(maps.Keys(grouped)) {
+		for _, item := range grouped[plugin] {
+			if item.Plugin == "" {
+				item.Plugin = plugin
+			}
+			runtimes = append(runtimes, item)
+		}
+	}
+	return runtimes, nil
+}
+
+// listRuntimes 检测本机通过 mise 安装的运行时，未安装 mise 时返回空列表
+func listRuntimes() (models.AgentRuntimes, error) {
+	if _, err := exec.LookPath("mise"); err != nil {
+		return models.AgentRuntimes{}, nil
+	}
+	cmd := exec.Command("mise", "ls", "--json")
+	cmd.Env = append(os.Environ(), "MISE_NO_COLOR=1", "TERM=dumb")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("mise ls --json 运行失败: %w", err)
+	}
+	return parseMiseList(output)
+}
+
+// reportRuntimes 向面板上报本机的 mise 运行时
+func (a *Agent) reportRuntimes() {
+	runtimes, err := listRuntimes()
+	if err != nil {
+		logger.Warnf("检测 mise 运行时失败: %v", err)
+		return
+	}
+	a.sendWSMessage(WSTypeRuntimes, map[string]interface{}{"runtimes": runtimes})
+}
+
+// commandOutput 收集一次性命令的输出并实时转发给面板
+type commandOutput struct {
+	agent     *Agent
+	requestID string
+	mu        sync.Mutex
+	buf       []byte
+}
+
+func (w *commandOutput) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > maxCommandOutput {
+		w.buf = w.buf[len(w.buf)-maxCommandOutput:]
+	}
+	w.mu.Unlock()
+	w.agent.sendWSMessage(WSTypeCommandOutput, map[string]interface{}{
+		"request_id": w.requestID,
+		"data":       string(p),
+	})
+	return len(p), nil
+}
+
+func (w *commandOutput) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.buf)
+}
+
+// handleCommand 执行面板下发的一次性命令（如安装依赖），完成后上报结果并刷新运行时
+func (a *Agent) handleCommand(data json.RawMessage) {
+	var req models.AgentCommand
+	if err := json.Unmarshal(data, &req); err != nil || req.RequestID == "" {
+		logger.Errorf("解析命令请求失败: %v", err)
+		return
+	}
+	timeout := time.Duration(req.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	logger.Infof("执行面板下发的命令: %s", req.Command)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := utils.NewShellCommandCmd(req.Command)
+	cmd.Env = append(os.Environ(), "MISE_NO_COLOR=1", "TERM=dumb")
+	out := &commandOutput{agent: a, requestID: req.RequestID}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	result := models.AgentCommandResult{RequestID: req.RequestID}
+	if err := cmd.Start(); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+	} else {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				result.ExitCode = cmd.ProcessState.ExitCode()
+				if result.ExitCode == -1 {
+					result.Error = err.Error()
+				}
+			}
+		case <-ctx.Done():
+			cmd.Process.Kill()
+			<-done
+			result.ExitCode = -1
+			result.Error = fmt.Sprintf("执行超时 (%s)", timeout)
+		}
+	}
+	result.Output = strings.TrimRight(out.String(), "\n")
+
+	a.sendWSMessage(WSTypeCommandResult, result)
+	a.reportRuntimes()
+}
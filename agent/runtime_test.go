@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseMiseList(t *testing.T) {
+	grouped := []byte(`{"python":[{"version":"3.12.1","installed":true}],"node":[{"version":"20.11.0"},{"version":"22.1.0"}]}`)
+	runtimes, err := parseMiseList(grouped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"node@20.11.0", "node@22.1.0", "python@3.12.1"}
+	if len(runtimes) != len(want) {
+		t.Fatalf("got %v", runtimes)
+	}
+	for i, r := range runtimes {
+		if r.Plugin+"@"+r.Version != want[i] {
+			t.Fatalf("runtimes[%d] = %s@%s, want %s", i, r.Plugin, r.Version, want[i])
+		}
+	}
+
+	list, err := parseMiseList([]byte(`[{"plugin":"go","version":"1.22.0"}]`))
+	if err != nil || len(list) != 1 || list[0].Plugin != "go" {
+		t.Fatalf("got %v, %v", list, err)
+	}
+
+	if _, err := parseMiseList([]byte("not json")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+const (
+	sdkRelayTimeout = 60 * time.Second // 等待面板返回 SDK 调用结果的超时时间
+	sdkRelayMaxBody = 4 << 20          // 单次 SDK 调用的请求体上限
+	sdkGrantTimeout = 10 * time.Second // 本地定时触发的执行等待面板签发凭证的超时时间
+)
+
+// sdkGrant 运行凭证对应的任务执行
+type sdkGrant struct {
+	TaskID     string
+	LogID      string
+	PanelToken string // 面板随执行指令签发的转发凭证，转发时原样带回
+}
+
+// sdkRelay 只监听回环地址的 SDK 转发端点
+// 每次执行生成独立的运行凭证注入 BHPKG_* 变量，脚本的 SDK 调用经 Agent 已认证的 WebSocket 转发到面板，
+// 无需把 OpenAPI Token 复制到 Agent 上，也不要求 Agent 能通过 HTTP 访问面板；执行结束后凭证立即失效
+type sdkRelay struct {
+	agent    *Agent
+	listener net.Listener
+	baseURL  string
+
+	mu      sync.Mutex
+	grants  map[string]sdkGrant                      // 运行凭证 -> 任务执行
+	panel   map[string]string                        // 执行 LogID -> 面板签发的转发凭证
+	tokens  map[*executor.ExecutionRequest]string    // 任务执行 -> 运行凭证
+	runs    map[*executor.ExecutionRequest]string    // 本地定时触发的执行 -> 申请凭证时生成的日志 ID
+	waiters map[string]chan *models.AgentSDKResponse // 等待面板返回结果的调用
+
+	grantWaiters map[string]chan *models.AgentSDKGrantResponse // 等待面板签发凭证的申请
+}
+
+// startSDKRelay 在回环地址的随机端口上启动转发端点
+func startSDKRelay(a *Agent) (*sdkRelay, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &sdkRelay{
+		agent:    a,
+		listener: ln,
+		baseURL:  "http://" + ln.Addr().String(),
+		grants:   make(map[string]sdkGrant),
+		panel:    make(map[string]string),
+		tokens:   make(map[*executor.ExecutionRequest]string),
+		runs:     make(map[*executor.ExecutionRequest]string),
+		waiters:  make(map[string]chan *models.AgentSDKResponse),
+
+		grantWaiters: make(map[string]chan *models.AgentSDKGrantResponse),
+	}
+	srv := &http.Server{Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	logger.Infof("SDK 转发端点已启动: %s", r.baseURL)
+	return r, nil
+}
+
+func (r *sdkRelay) Close() {
+	if r != nil {
+		r.listener.Close()
+	}
+}
+
+// accept 保存面板随执行指令签发的转发凭证，执行开始时据此生成运行凭证
+func (r *sdkRelay) accept(logID, panelToken string) {
+	if r == nil || logID == "" || panelToken == "" {
+		return
+	}
+	r.mu.Lock()
+	r.panel[logID] = panelToken
+	r.mu.Unlock()
+}
+
+// issue 为任务执行生成运行凭证，并注入指向本地转发端点的 BHPKG_* 变量，覆盖任务中配置的面板地址与 Token
+// 面板下发的执行使用随指令签发的凭证，Agent 本地定时触发的执行在开始时向面板申请；
+// 面板不支持转发或没有可用凭证时不做处理，脚本仍按任务配置直连面板
+func (r *sdkRelay) issue(req *executor.ExecutionRequest) {
+	if r == nil || !r.agent.panelSupports(constant.AgentCapSDKRelay) {
+		return
+	}
+	logID := req.LogID
+	r.mu.Lock()
+	panelToken, ok := r.panel[logID]
+	r.mu.Unlock()
+	if !ok && logID == "" {
+		logID, panelToken, ok = r.requestGrant(req)
+	}
+	if !ok {
+		return
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Warnf("生成运行凭证失败: %v", err)
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	r.mu.Lock()
+	r.grants[token] = sdkGrant{TaskID: req.TaskID, LogID: logID, PanelToken: panelToken}
+	r.tokens[req] = token
+	if logID != req.LogID {
+		r.runs[req] = logID
+	}
+	r.mu.Unlock()
+
+	req.Envs = append(req.Envs,
+		"BHPKG_NOTIFY_URL="+r.baseURL+"/api/v1/notify/send",
+		"BHPKG_NOTIFY_TOKEN="+token,
+		"BHPKG_OPENAPI_URL="+r.baseURL+"/open2api/v1/env",
+		"BHPKG_OPENAPI_TOKEN="+token,
+	)
+	req.Secrets = append(req.Secrets, token)
+}
+
+// requestGrant 为本地定时触发的执行向面板申请凭证，日志 ID 由 Agent 生成并在上报结果时沿用
+func (r *sdkRelay) requestGrant(req *executor.ExecutionRequest) (logID, panelToken string, ok bool) {
+	if !r.agent.panelSupports(constant.AgentCapSDKGrant) {
+		return "", "", false
+	}
+	call := &models.AgentSDKGrantRequest{RequestID: utils.GenerateID(), TaskID: req.TaskID, LogID: utils.GenerateID()}
+	ch := make(chan *models.AgentSDKGrantResponse, 1)
+	r.mu.Lock()
+	r.grantWaiters[call.RequestID] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.grantWaiters, call.RequestID)
+		r.mu.Unlock()
+	}()
+
+	if err := r.agent.sendWSMessage(WSTypeSDKGrantRequest, call); err != nil {
+		logger.Warnf("任务 #%s 申请 SDK 凭证失败，脚本将按任务配置直连面板: %v", req.TaskID, err)
+		return "", "", false
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			logger.Warnf("任务 #%s 申请 SDK 凭证被拒绝: %s", req.TaskID, resp.Error)
+			return "", "", false
+		}
+		token, err := r.agent.decryptValue(resp.Token)
+		if err != nil || token == "" {
+			logger.Warnf("任务 #%s 的 SDK 凭证无法解密: %v", req.TaskID, err)
+			return "", "", false
+		}
+		return call.LogID, token, true
+	case <-time.After(sdkGrantTimeout):
+		logger.Warnf("任务 #%s 等待面板签发 SDK 凭证超时，脚本将按任务配置直连面板", req.TaskID)
+		return "", "", false
+	}
+}
+
+// handleGrant 将面板签发的凭证交给等待中的申请
+func (r *sdkRelay) handleGrant(data json.RawMessage) {
+	if r == nil {
+		return
+	}
+	var resp models.AgentSDKGrantResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		logger.Errorf("解析 SDK 凭证失败: %v", err)
+		return
+	}
+	r.mu.Lock()
+	ch, ok := r.grantWaiters[resp.RequestID]
+	r.mu.Unlock()
+	if ok {
+		ch <- &resp
+	}
+}
+
+// runLogID 本地定时触发的执行申请凭证时生成的日志 ID，没有申请过时为空
+func (r *sdkRelay) runLogID(req *executor.ExecutionRequest) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[req]
+}
+
+// revoke 任务执行结束后吊销运行凭证
+func (r *sdkRelay) revoke(req *executor.ExecutionRequest) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.panel, req.LogID)
+	delete(r.runs, req)
+	if token, ok := r.tokens[req]; ok {
+		delete(r.grants, token)
+		delete(r.tokens, req)
+	}
+}
+
+func (r *sdkRelay) lookup(token string) (sdkGrant, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	grant, ok := r.grants[token]
+	return grant, ok
+}
+
+// requestToken 取出脚本携带的运行凭证，OpenAPI 使用 Authorization，通知使用 notify-token
+func requestToken(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return req.Header.Get("notify-token")
+}
+
+// writeSDKError 按面板接口的格式返回错误，SDK 据此抛出异常
+func writeSDKError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utils.Response{Code: code, Msg: msg})
+}
+
+func (r *sdkRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	grant, ok := r.lookup(requestToken(req))
+	if !ok {
+		writeSDKError(w, 401, "运行凭证无效或任务已结束")
+		return
+	}
+	if !agentproto.SDKRelayAllowed(req.URL.Path) {
+		writeSDKError(w, 403, "不允许转发该接口")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, sdkRelayMaxBody))
+	if err != nil {
+		writeSDKError(w, 400, err.Error())
+		return
+	}
+
+	resp, err := r.forward(&models.AgentSDKRequest{
+		TaskID: grant.TaskID,
+		LogID:  grant.LogID,
+		Token:  grant.PanelToken,
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Body:   body,
+	})
+	if err != nil {
+		writeSDKError(w, 502, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// forward 通过 WebSocket 把调用交给面板并等待结果
+func (r *sdkRelay) forward(call *models.AgentSDKRequest) (*models.AgentSDKResponse, error) {
+	call.RequestID = utils.GenerateID()
+	ch := make(chan *models.AgentSDKResponse, 1)
+	r.mu.Lock()
+	r.waiters[call.RequestID] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.waiters, call.RequestID)
+		r.mu.Unlock()
+	}()
+
+	if err := r.agent.sendWSMessage(WSTypeSDKRequest, call); err != nil {
+		return nil, fmt.Errorf("面板不可达: %v", err)
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-time.After(sdkRelayTimeout):
+		return nil, fmt.Errorf("等待面板响应超时")
+	}
+}
+
+// handleResponse 将面板返回的结果交给等待中的调用
+func (r *sdkRelay) handleResponse(data json.RawMessage) {
+	if r == nil {
+		return
+	}
+	var resp models.AgentSDKResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		logger.Errorf("解析 SDK 调用结果失败: %v", err)
+		return
+	}
+	r.mu.Lock()
+	ch, ok := r.waiters[resp.RequestID]
+	r.mu.Unlock()
+	if ok {
+		ch <- &resp
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+	"github.com/gorilla/websocket"
+)
+
+func relayEnv(req *executor.ExecutionRequest, key string) string {
+	for _, kv := range req.Envs {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func callRelay(t *testing.T, url, token string) utils.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求转发端点失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var body utils.Response
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body
+}
+
+func TestSDKRelayGrant(t *testing.T) {
+	a := &Agent{}
+	legacy := agentproto.Legacy()
+	a.panel.Store(&legacy)
+	relay, err := startSDKRelay(a)
+	if err != nil {
+		t.Fatalf("启动转发端点失败: %v", err)
+	}
+	defer relay.Close()
+
+	// 旧版面板不支持转发，保留任务自身配置的变量
+	req := &executor.ExecutionRequest{TaskID: "t1", LogID: "l1", Envs: []string{"BHPKG_NOTIFY_URL=http://panel"}}
+	relay.issue(req)
+	if len(req.Envs) != 1 {
+		t.Fatalf("旧版面板不应注入变量: %v", req.Envs)
+	}
+
+	current := agentproto.Negotiate(agentproto.Local())
+	a.panel.Store(&current)
+
+	// 面板下发的执行没有附带凭证时不注入
+	relay.issue(req)
+	if len(req.Envs) != 1 {
+		t.Fatalf("没有面板凭证时不应注入变量: %v", req.Envs)
+	}
+
+	relay.accept(req.LogID, "panel-token")
+	relay.issue(req)
+	if grant, _ := relay.lookup(relayEnv(req, "BHPKG_OPENAPI_TOKEN")); grant.PanelToken != "panel-token" {
+		t.Errorf("运行凭证应关联面板签发的凭证: %+v", grant)
+	}
+	token := relayEnv(req, "BHPKG_OPENAPI_TOKEN")
+	if token == "" || relayEnv(req, "BHPKG_NOTIFY_TOKEN") != token || !slices.Contains(req.Secrets, token) {
+		t.Fatalf("运行凭证未注入或未脱敏: %v", req.Envs)
+	}
+	envURL := relayEnv(req, "BHPKG_OPENAPI_URL")
+	if !strings.HasPrefix(envURL, "http://127.0.0.1:") || !strings.HasSuffix(envURL, "/open2api/v1/env") {
+		t.Fatalf("转发地址不正确: %s", envURL)
+	}
+	base := strings.TrimSuffix(envURL, "/open2api/v1/env")
+
+	if got := callRelay(t, envURL+"/all", "wrong"); got.Code != 401 {
+		t.Errorf("错误凭证应被拒绝: %+v", got)
+	}
+	if got := callRelay(t, base+"/api/v1/settings", token); got.Code != 403 {
+		t.Errorf("SDK 以外的接口应被拒绝: %+v", got)
+	}
+	// 未连接面板时返回错误而不是挂起
+	if got := callRelay(t, envURL+"/all", token); got.Code != 502 {
+		t.Errorf("面板不可达时应返回 502: %+v", got)
+	}
+
+	relay.revoke(req)
+	if _, ok := relay.panel[req.LogID]; ok {
+		t.Error("执行结束后应丢弃面板凭证")
+	}
+	if got := callRelay(t, envURL+"/all", token); got.Code != 401 {
+		t.Errorf("执行结束后凭证应失效: %+v", got)
+	}
+}
+
+func TestSDKRelayRequestsGrantForCronRun(t *testing.T) {
+	calls := make(chan models.AgentSDKGrantRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var msg WSMessage
+		if conn.ReadJSON(&msg) == nil && msg.Type == WSTypeSDKGrantRequest {
+			var call models.AgentSDKGrantRequest
+			json.Unmarshal(msg.Data, &call)
+			calls <- call
+		}
+		conn.ReadMessage()
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("连接测试面板失败: %v", err)
+	}
+	defer conn.Close()
+
+	a := &Agent{wsConn: conn}
+	current := agentproto.Negotiate(agentproto.Local())
+	a.panel.Store(&current)
+	relay, err := startSDKRelay(a)
+	if err != nil {
+		t.Fatalf("启动转发端点失败: %v", err)
+	}
+	defer relay.Close()
+
+	// 面板收到申请后签发凭证
+	go func() {
+		call := <-calls
+		if call.TaskID != "t1" || call.LogID == "" {
+			t.Errorf("凭证申请内容不正确: %+v", call)
+		}
+		data, _ := json.Marshal(models.AgentSDKGrantResponse{RequestID: call.RequestID, Token: "cron-token"})
+		relay.handleGrant(data)
+	}()
+
+	// 本地定时触发的执行没有日志 ID，开始时向面板申请凭证
+	req := &executor.ExecutionRequest{TaskID: "t1"}
+	relay.issue(req)
+	grant, ok := relay.lookup(relayEnv(req, "BHPKG_OPENAPI_TOKEN"))
+	if !ok || grant.PanelToken != "cron-token" {
+		t.Fatalf("应使用面板签发的凭证: %+v", grant)
+	}
+	if grant.LogID == "" || relay.runLogID(req) != grant.LogID {
+		t.Errorf("结果应沿用申请凭证时的日志 ID: grant=%s run=%s", grant.LogID, relay.runLogID(req))
+	}
+
+	relay.revoke(req)
+	if relay.runLogID(req) != "" {
+		t.Error("执行结束后应丢弃日志 ID")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/utils"
+	"github.com/engigu/baihu-panel/internal/windows"
+
+	"github.com/creack/pty"
+)
+
+// maxTerminals Agent 同时运行的终端会话上限
+const maxTerminals = 5
+
+// terminalMessage 终端会话消息，与面板的 AgentTerminalMessage 对应
+type terminalMessage struct {
+	SessionID string `json:"session_id"`
+	Data      string `json:"data,omitempty"`
+	Rows      uint16 `json:"rows,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// terminalPTY 伪终端，Unix 下为 PTY，Windows 下为 ConPTY
+type terminalPTY interface {
+	io.ReadWriteCloser
+	Resize(rows, cols uint16) error
+}
+
+type unixPTY struct {
+	ptmx *os.File
+	cmd  *exec.Cmd
+}
+
+func (p *unixPTY) Read(b []byte) (int, error)  { return p.ptmx.Read(b) }
+func (p *unixPTY) Write(b []byte) (int, error) { return p.ptmx.Write(b) }
+
+func (p *unixPTY) Resize(rows, cols uint16) error {
+	return pty.Setsize(p.ptmx, &pty.Winsize{Rows: rows, Cols: cols})
+}
+
+func (p *unixPTY) Close() error {
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+	err := p.ptmx.Close()
+	p.cmd.Wait()
+	return err
+}
+
+type conPTY struct {
+	*windows.ConPTYSession
+}
+
+func (p *conPTY) Resize(rows, cols uint16) error {
+	return p.ConPTYSession.Resize(cols, rows)
+}
+
+// startTerminal 在脚本目录中启动交互式 Shell
+func startTerminal(rows, cols uint16) (terminalPTY, error) {
+	if rows == 0 || cols == 0 {
+		rows, cols = 24, 80
+	}
+	workDir, _ := filepath.Abs(scriptsDir)
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		workDir, _ = os.Getwd()
+	}
+	env := append(os.Environ(), "TERM=xterm-256color")
+
+	if windows.IsWindows() {
+		if !windows.HasConPTYSupport() {
+			return nil, fmt.Errorf("当前 Windows 版本不支持 ConPTY，需要 Windows 10 1809 及以上")
+		}
+		session, err := windows.NewConPTYSession("pwsh.exe -NoLogo", cols, rows, windows.FixPathEnv(env), workDir)
+		if err != nil {
+			return nil, err
+		}
+		return &conPTY{session}, nil
+	}
+
+	cmd := utils.NewShellCmd()
+	cmd.Dir = workDir
+	cmd.Env = env
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: rows, Cols: cols})
+	if err != nil {
+		return nil, err
+	}
+	return &unixPTY{ptmx: ptmx, cmd: cmd}, nil
+}
+
+// utf8Chunker 切分输出时保留末尾不完整的 UTF-8 字符，与下一段输出拼接后再发送
+type utf8Chunker struct {
+	remainder []byte
+}
+
+func (c *utf8Chunker) Split(data []byte) string {
+	chunk := append(c.remainder, data...)
+	c.remainder = nil
+	cut := len(chunk)
+	for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(chunk[i]) {
+			if !utf8.FullRune(chunk[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut < len(chunk) {
+		c.remainder = append([]byte(nil), chunk[cut:]...)
+	}
+	return string(chunk[:cut])
+}
+
+// Flush 返回剩余的字节
+func (c *utf8Chunker) Flush() string {
+	s := string(c.remainder)
+	c.remainder = nil
+	return s
+}
+
+// terminalManager Agent 上的终端会话
+type terminalManager struct {
+	mu       sync.Mutex
+	sessions map[string]terminalPTY
+}
+
+func newTerminalManager() *terminalManager {
+	return &terminalManager{sessions: make(map[string]terminalPTY)}
+}
+
+func (m *terminalManager) get(id string) terminalPTY {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[id]
+}
+
+// remove 移除并关闭会话，返回会话是否存在
+func (m *terminalManager) remove(id string) bool {
+	m.mu.Lock()
+	t, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if ok {
+		t.Close()
+	}
+	return ok
+}
+
+// CloseAll 关闭所有会话，与面板断开连接时调用
+func (m *terminalManager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]terminalPTY)
+	m.mu.Unlock()
+	for id, t := range sessions {
+		t.Close()
+		logger.Infof("[Terminal] 与面板断开，关闭终端会话 %s", id)
+	}
+}
+
+// handleTerminalMessage 处理面板下发的终端消息
+func (a *Agent) handleTerminalMessage(msgType string, data json.RawMessage) {
+	var msg terminalMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.SessionID == "" {
+		return
+	}
+
+	switch msgType {
+	case WSTypeTerminalOpen:
+		a.openTerminal(&msg)
+	case WSTypeTerminalInput:
+		if t := a.terminals.get(msg.SessionID); t != nil {
+			t.Write([]byte(msg.Data))
+		}
+	case WSTypeTerminalResize:
+		if t := a.terminals.get(msg.SessionID); t != nil && msg.Rows > 0 && msg.Cols > 0 {
+			t.Resize(msg.Rows, msg.Cols)
+		}
+	case WSTypeTerminalClose:
+		if a.terminals.remove(msg.SessionID) {
+			logger.Infof("[Terminal] 面板关闭终端会话 %s", msg.SessionID)
+		}
+	}
+}
+
+func (a *Agent) openTerminal(msg *terminalMessage) {
+	a.terminals.mu.Lock()
+	if len(a.terminals.sessions) >= maxTerminals {
+		a.terminals.mu.Unlock()
+		a.sendWSMessage(WSTypeTerminalExit, terminalMessage{SessionID: msg.SessionID, Error: fmt.Sprintf("Agent 终端会话已达上限 (%d)", maxTerminals)})
+		return
+	}
+	t, err := startTerminal(msg.Rows, msg.Cols)
+	if err != nil {
+		a.terminals.mu.Unlock()
+		logger.Warnf("[Terminal] 启动终端失败: %v", err)
+		a.sendWSMessage(WSTypeTerminalExit, terminalMessage{SessionID: msg.SessionID, Error: "启动终端失败: " + err.Error()})
+		return
+	}
+	a.terminals.sessions[msg.SessionID] = t
+	a.terminals.mu.Unlock()
+	logger.Infof("[Terminal] 打开终端会话 %s", msg.SessionID)
+
+	go func() {
+		var chunker utf8Chunker
+		buf := make([]byte, 4096)
+		for {
+			n, err := t.Read(buf)
+			if n > 0 {
+				if text := chunker.Split(buf[:n]); text != "" {
+					a.sendWSMessage(WSTypeTerminalOutput, terminalMessage{SessionID: msg.SessionID, Data: text})
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		if rest := chunker.Flush(); rest != "" {
+			a.sendWSMessage(WSTypeTerminalOutput, terminalMessage{SessionID: msg.SessionID, Data: rest})
+		}
+		// Shell 自行退出时通知面板，面板主动关闭的会话无需再通知
+		if a.terminals.remove(msg.SessionID) {
+			logger.Infof("[Terminal] 终端会话 %s 已退出", msg.SessionID)
+			a.sendWSMessage(WSTypeTerminalExit, terminalMessage{SessionID: msg.SessionID})
+		}
+	}()
+}
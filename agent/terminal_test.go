@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestUTF8ChunkerKeepsPartialRune(t *testing.T) {
+	var c utf8Chunker
+	data := []byte("ab中文")
+	// 在“中”字中间切开
+	first := c.Split(data[:3])
+	second := c.Split(data[3:])
+	if first != "ab" || second != "中文" {
+		t.Fatalf("got %q + %q", first, second)
+	}
+	if rest := c.Flush(); rest != "" {
+		t.Fatalf("unexpected remainder %q", rest)
+	}
+
+	// 非法字节不应被无限保留
+	if out := c.Split([]byte{0xff, 0xfe}); out != "\xff\xfe" {
+		t.Fatalf("got %q", out)
+	}
+}
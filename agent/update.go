@@ -2,7 +2,10 @@ package main
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -12,88 +15,151 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/engigu/baihu-panel/internal/agentsign"
 )
 
+// updateConfirmTimeout 新版本须在此时间内连上面板，否则自动回滚到旧版本
+const updateConfirmTimeout = 3 * time.Minute
+
+// updateState 自更新过程中落盘的状态，新版本启动后据此确认更新或回滚
+type updateState struct {
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Target      string `json:"target"`   // 被替换的可执行文件
+	Backup      string `json:"backup"`   // 旧版本备份
+	Deadline    int64  `json:"deadline"` // 确认期限（Unix 秒）
+	Attempts    int    `json:"attempts"` // 新版本启动次数，大于 1 说明新版本在确认前退出过
+	RolledBack  bool   `json:"rolled_back"`
+	Reported    bool   `json:"reported"` // 回滚结果已上报面板
+	Error       string `json:"error,omitempty"`
+}
+
+func getUpdateStateFile() string {
+	return filepath.Join(dataDir, "update.json")
+}
+
+// loadUpdateState 读取自更新状态，没有进行中的更新时返回 nil
+func loadUpdateState() *updateState {
+	data, err := os.ReadFile(getUpdateStateFile())
+	if err != nil {
+		return nil
+	}
+	var state updateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Warnf("读取自更新状态失败: %v", err)
+		return nil
+	}
+	return &state
+}
+
+func saveUpdateState(state *updateState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(dataDir, 0755)
+	tmp := getUpdateStateFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, getUpdateStateFile())
+}
+
+// updatePublicKey 编译时内置的公钥优先，配置文件不能替换它，否则能改配置的人就能推送任意更新
+// 仅在未内置公钥的构建中使用配置文件中的公钥
+func (a *Agent) updatePublicKey() string {
+	if UpdatePublicKey != "" {
+		if a.config.UpdatePublicKey != "" && a.config.UpdatePublicKey != UpdatePublicKey {
+			log.Warnf("配置文件中的 update_public_key 与内置公钥不一致，已忽略，使用内置公钥校验更新")
+		}
+		return UpdatePublicKey
+	}
+	if a.config.UpdatePublicKey != "" {
+		log.Warnf("当前构建未内置自更新公钥，使用配置文件中的 update_public_key 校验更新，建议使用内置公钥的正式构建")
+	}
+	return a.config.UpdatePublicKey
+}
+
 // selfUpdate 自动更新
 func (a *Agent) selfUpdate() {
+	if !a.updating.CompareAndSwap(false, true) {
+		log.Info("已有更新正在进行，忽略本次更新")
+		return
+	}
+	defer a.updating.Store(false)
+
+	version, err := a.installUpdate()
+	if err != nil {
+		log.Errorf("自动更新失败: %v", err)
+		a.sendWSMessage(WSTypeUpdateResult, map[string]interface{}{
+			"from_version": Version,
+			"version":      version,
+			"success":      false,
+			"error":        err.Error(),
+		})
+	}
+}
+
+// installUpdate 下载并校验新版本，替换成功后重启，只有失败时才会返回
+func (a *Agent) installUpdate() (string, error) {
 	// 获取当前可执行文件路径
 	exePath, err := os.Executable()
 	if err != nil {
-		log.Errorf("获取可执行文件路径失败: %v", err)
-		return
+		return "", fmt.Errorf("获取可执行文件路径失败: %v", err)
 	}
 	exePath, _ = filepath.Abs(exePath)
 
+	// 未固定签名公钥时无法确认发布包来源，拒绝更新
+	publicKey := a.updatePublicKey()
+	if publicKey == "" {
+		return "", fmt.Errorf("未配置自更新签名公钥，拒绝更新")
+	}
+
 	// 下载新版本 tar.gz
 	downloadURL := a.config.ServerURL + "/api/agent/download?os=" + runtime.GOOS + "&arch=" + runtime.GOARCH
 	req, err := http.NewRequest("GET", downloadURL, nil)
 	if err != nil {
-		log.Errorf("创建下载请求失败: %v", err)
-		return
+		return "", fmt.Errorf("创建下载请求失败: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+a.config.Token)
 
 	client := &http.Client{Timeout: 5 * time.Minute}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Errorf("下载新版本失败: %v", err)
-		return
+		return "", fmt.Errorf("下载新版本失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Errorf("下载新版本失败: HTTP %d", resp.StatusCode)
-		return
+		return "", fmt.Errorf("下载新版本失败: HTTP %d", resp.StatusCode)
 	}
 
-	// 读取 tar.gz 内容
-	gzReader, err := gzip.NewReader(resp.Body)
+	version := resp.Header.Get("X-Agent-Version")
+	pkg, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("解压 gzip 失败: %v", err)
-		return
+		return version, fmt.Errorf("下载新版本失败: %v", err)
 	}
-	defer gzReader.Close()
 
-	tarReader := tar.NewReader(gzReader)
+	// 替换前校验发布包
+	if err := verifyPackage(publicKey, pkg, resp.Header.Get("X-Agent-Sha256"), resp.Header.Get("X-Agent-Signature")); err != nil {
+		return version, fmt.Errorf("发布包校验失败: %v", err)
+	}
 
-	// 解压并找到二进制文件
-	var newBinary []byte
 	binaryName := "baihu-agent"
 	if runtime.GOOS == "windows" {
 		binaryName = "baihu-agent.exe"
 	}
-
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Errorf("读取 tar 失败: %v", err)
-			return
-		}
-
-		if header.Typeflag == tar.TypeReg && header.Name == binaryName {
-			newBinary, err = io.ReadAll(tarReader)
-			if err != nil {
-				log.Errorf("读取二进制文件失败: %v", err)
-				return
-			}
-			break
-		}
-	}
-
-	if newBinary == nil {
-		log.Errorf("tar.gz 中未找到 %s", binaryName)
-		return
+	newBinary, err := extractBinary(pkg, binaryName)
+	if err != nil {
+		return version, err
 	}
 
 	// 保存到临时文件（放到 data 目录）
 	os.MkdirAll(dataDir, 0755)
 	tmpFile := filepath.Join(dataDir, binaryName+".new")
 	if err := os.WriteFile(tmpFile, newBinary, 0755); err != nil {
-		log.Errorf("保存新版本失败: %v", err)
-		return
+		return version, fmt.Errorf("保存新版本失败: %v", err)
 	}
 
 	// 计算基础路径（去掉所有 .bak 后缀）
@@ -103,35 +169,190 @@ func (a *Agent) selfUpdate() {
 	}
 	backupFile := basePath + ".bak"
 
-	// 如果当前运行的就是 .bak 文件，直接删除它（更新后会用新版本）
-	// 否则需要备份当前文件
+	// 如果当前运行的就是 .bak 文件，它本身就是旧版本的备份
+	// 否则需要备份当前文件，新版本异常时据此回滚
 	if exePath != backupFile {
 		os.Remove(backupFile)
 		if err := os.Rename(exePath, backupFile); err != nil {
-			log.Errorf("备份旧版本失败: %v", err)
 			os.Remove(tmpFile)
-			return
+			return version, fmt.Errorf("备份旧版本失败: %v", err)
 		}
 	}
 
 	// 替换为新版本（放到 basePath，即不带 .bak 的路径）
 	if err := os.Rename(tmpFile, basePath); err != nil {
-		log.Errorf("替换新版本失败: %v", err)
 		if exePath != backupFile {
 			os.Rename(backupFile, exePath) // 恢复旧版本
 		}
-		return
+		return version, fmt.Errorf("替换新版本失败: %v", err)
 	}
 
-	// 如果之前运行的是 .bak 文件，现在可以删除它了
-	if exePath == backupFile {
-		os.Remove(exePath)
+	state := &updateState{
+		FromVersion: Version,
+		ToVersion:   version,
+		Target:      basePath,
+		Backup:      backupFile,
+		Deadline:    time.Now().Add(updateConfirmTimeout).Unix(),
+	}
+	if err := saveUpdateState(state); err != nil {
+		log.Warnf("保存自更新状态失败，新版本异常时将无法自动回滚: %v", err)
 	}
 
-	log.Info("更新完成，正在重启...")
+	log.Infof("已更新到 %s，正在重启...", version)
 
-	// 重启服务
+	// 重启服务，成功时不会返回
 	a.restart()
+
+	// 重启失败时当前进程仍是旧版本，恢复旧文件，避免下次启动运行未经确认的新版本
+	if err := rollbackFiles(state); err != nil {
+		log.Errorf("回滚失败: %v", err)
+	}
+	os.Remove(getUpdateStateFile())
+	return version, fmt.Errorf("重启新版本失败")
+}
+
+// verifyPackage 校验发布包 SHA256 和签名；未固定签名公钥时一律拒绝
+func verifyPackage(publicKey string, pkg []byte, checksum, signature string) error {
+	if checksum == "" {
+		return fmt.Errorf("面板未提供发布包 SHA256，请先升级面板")
+	}
+	if publicKey == "" {
+		return fmt.Errorf("未配置自更新签名公钥")
+	}
+	return agentsign.Verify(publicKey, pkg, checksum, signature)
+}
+
+// extractBinary 从 tar.gz 中解压出 Agent 可执行文件
+func extractBinary(pkg []byte, binaryName string) ([]byte, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(pkg))
+	if err != nil {
+		return nil, fmt.Errorf("解压 gzip 失败: %v", err)
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 tar 失败: %v", err)
+		}
+
+		if header.Typeflag == tar.TypeReg && header.Name == binaryName {
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("读取二进制文件失败: %v", err)
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("tar.gz 中未找到 %s", binaryName)
+}
+
+// checkPendingUpdate 启动时检查上次自更新：新版本须在期限内连上面板，否则回滚
+func (a *Agent) checkPendingUpdate() {
+	state := loadUpdateState()
+	if state == nil {
+		return
+	}
+	if state.RolledBack {
+		a.failedUpdateVersion = state.ToVersion
+		return
+	}
+
+	state.Attempts++
+	if state.Attempts > 1 {
+		a.rollbackUpdate(state, "新版本在连接面板前退出")
+		return
+	}
+	remaining := time.Until(time.Unix(state.Deadline, 0))
+	if remaining <= 0 {
+		a.rollbackUpdate(state, "新版本未在期限内连接面板")
+		return
+	}
+	if err := saveUpdateState(state); err != nil {
+		log.Warnf("保存自更新状态失败: %v", err)
+	}
+
+	log.Infof("已从 %s 更新到 %s，需在 %v 内连接面板，否则回滚", state.FromVersion, state.ToVersion, remaining.Round(time.Second))
+	a.updateMu.Lock()
+	a.updateTimer = time.AfterFunc(remaining, func() {
+		a.rollbackUpdate(state, "新版本未在期限内连接面板")
+	})
+	a.updateMu.Unlock()
+}
+
+// confirmUpdate 连接面板后确认新版本可用，或上报上次的回滚结果
+func (a *Agent) confirmUpdate() {
+	a.updateMu.Lock()
+	defer a.updateMu.Unlock()
+
+	state := loadUpdateState()
+	if state == nil || state.Reported {
+		return
+	}
+
+	result := map[string]interface{}{
+		"from_version": state.FromVersion,
+		"version":      state.ToVersion,
+		"success":      !state.RolledBack,
+		"error":        state.Error,
+	}
+	if state.RolledBack {
+		// 保留状态文件，避免自动更新反复安装同一个异常版本
+		state.Reported = true
+		saveUpdateState(state)
+	} else {
+		if a.updateTimer != nil {
+			a.updateTimer.Stop()
+		}
+		a.updateConfirmed = true
+		os.Remove(getUpdateStateFile())
+		log.Infof("新版本 %s 已连接面板，更新完成", state.ToVersion)
+	}
+	a.sendWSMessage(WSTypeUpdateResult, result)
+}
+
+// rollbackUpdate 恢复旧版本并重启
+func (a *Agent) rollbackUpdate(state *updateState, reason string) {
+	a.updateMu.Lock()
+	if a.updateConfirmed {
+		a.updateMu.Unlock()
+		return
+	}
+	a.updateMu.Unlock()
+
+	log.Errorf("%s，回滚到 %s", reason, state.FromVersion)
+	if err := rollbackFiles(state); err != nil {
+		log.Errorf("回滚失败: %v", err)
+		os.Remove(getUpdateStateFile())
+		return
+	}
+	state.RolledBack = true
+	state.Error = reason
+	if err := saveUpdateState(state); err != nil {
+		log.Warnf("保存自更新状态失败: %v", err)
+	}
+	restartBinary(state.Target)
+}
+
+// rollbackFiles 将新版本移到 .failed，再把备份恢复到原路径
+func rollbackFiles(state *updateState) error {
+	if _, err := os.Stat(state.Backup); err != nil {
+		return fmt.Errorf("旧版本备份不存在: %v", err)
+	}
+	failed := state.Target + ".failed"
+	os.Remove(failed)
+	if err := os.Rename(state.Target, failed); err != nil {
+		return fmt.Errorf("移除新版本失败: %v", err)
+	}
+	if err := os.Rename(state.Backup, state.Target); err != nil {
+		os.Rename(failed, state.Target)
+		return fmt.Errorf("恢复旧版本失败: %v", err)
+	}
+	return nil
 }
 
 // restart 重启服务
@@ -143,19 +364,25 @@ func (a *Agent) restart() {
 	for strings.HasSuffix(basePath, ".bak") {
 		basePath = strings.TrimSuffix(basePath, ".bak")
 	}
+	restartBinary(basePath)
+}
 
+// restartBinary 以 path 处的可执行文件重启服务
+func restartBinary(path string) {
 	// 删除 PID 文件，避免新进程检测到旧 PID 而拒绝启动
 	removePidFile()
 
 	if runtime.GOOS == "windows" {
 		// Windows: 启动新进程后退出
-		cmd := exec.Command(basePath, "start")
+		cmd := exec.Command(path, "start")
 		cmd.Start()
 		os.Exit(0)
 	} else {
 		// Linux/macOS: 使用 exec 替换当前进程，直接运行（不需要 daemon）
 		// 因为 syscall.Exec 会替换当前进程，当前进程本身就是 daemon
 		// --restart 标记告诉新进程这是重启，只输出到文件
-		syscall.Exec(basePath, []string{basePath, "run", "--restart"}, os.Environ())
+		if err := syscall.Exec(path, []string{path, "run", "--restart"}, os.Environ()); err != nil {
+			log.Errorf("重启失败: %v", err)
+		}
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentsign"
+	"go.uber.org/zap"
+)
+
+func buildPackage(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "config.example.ini", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestVerifyAndExtractPackage(t *testing.T) {
+	pub, priv, err := agentsign.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := buildPackage(t, "baihu-agent", []byte("new binary"))
+	sig, _ := agentsign.Sign(priv, pkg)
+
+	if err := verifyPackage(pub, pkg, agentsign.Checksum(pkg), sig); err != nil {
+		t.Fatalf("verify signed package: %v", err)
+	}
+	if err := verifyPackage(pub, pkg, agentsign.Checksum(pkg), ""); err == nil {
+		t.Error("unsigned package should be rejected when a key is pinned")
+	}
+	if err := verifyPackage("", pkg, agentsign.Checksum(pkg), sig); err == nil {
+		t.Error("package should be rejected when no key is pinned")
+	}
+	if err := verifyPackage(pub, pkg, "", sig); err == nil {
+		t.Error("package without checksum should be rejected")
+	}
+	tampered := append([]byte{}, pkg...)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := verifyPackage(pub, tampered, agentsign.Checksum(pkg), sig); err == nil {
+		t.Error("tampered package should be rejected")
+	}
+
+	bin, err := extractBinary(pkg, "baihu-agent")
+	if err != nil || string(bin) != "new binary" {
+		t.Fatalf("extractBinary = %q, %v", bin, err)
+	}
+	if _, err := extractBinary(pkg, "baihu-agent.exe"); err == nil {
+		t.Error("missing binary should be an error")
+	}
+}
+
+func TestRollbackFiles(t *testing.T) {
+	dir := t.TempDir()
+	state := &updateState{
+		Target: filepath.Join(dir, "baihu-agent"),
+		Backup: filepath.Join(dir, "baihu-agent.bak"),
+	}
+	os.WriteFile(state.Target, []byte("new"), 0755)
+	os.WriteFile(state.Backup, []byte("old"), 0755)
+
+	if err := rollbackFiles(state); err != nil {
+		t.Fatalf("rollbackFiles: %v", err)
+	}
+	if data, _ := os.ReadFile(state.Target); string(data) != "old" {
+		t.Errorf("target = %q, want old", data)
+	}
+	if data, _ := os.ReadFile(state.Target + ".failed"); string(data) != "new" {
+		t.Errorf("failed = %q, want new", data)
+	}
+
+	// 备份已不存在时不能回滚，也不应动当前文件
+	if err := rollbackFiles(state); err == nil {
+		t.Error("rollback without backup should fail")
+	}
+	if data, _ := os.ReadFile(state.Target); string(data) != "old" {
+		t.Errorf("target changed after failed rollback: %q", data)
+	}
+}
+
+func TestUpdatePublicKeyPrefersCompiledKey(t *testing.T) {
+	saved, savedLog := UpdatePublicKey, log
+	defer func() { UpdatePublicKey, log = saved, savedLog }()
+	log = zap.NewNop().Sugar()
+
+	a := &Agent{config: &Config{UpdatePublicKey: "config-key"}}
+
+	UpdatePublicKey = "compiled-key"
+	if got := a.updatePublicKey(); got != "compiled-key" {
+		t.Errorf("updatePublicKey() = %q, want compiled key", got)
+	}
+
+	UpdatePublicKey = ""
+	if got := a.updatePublicKey(); got != "config-key" {
+		t.Errorf("updatePublicKey() without compiled key = %q, want config key", got)
+	}
+}
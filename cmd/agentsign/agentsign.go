@@ -0,0 +1,110 @@
+package agentsign
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/engigu/baihu-panel/cmd/clibase"
+	"github.com/engigu/baihu-panel/internal/agentsign"
+)
+
+// 打印主帮助
+func printMainHelp() {
+	fmt.Fprintf(os.Stderr, "\n白虎面板 Agent 发布包签名工具\n\n")
+	fmt.Fprintf(os.Stderr, "用法:\n")
+	fmt.Fprintf(os.Stderr, "  baihu agentsign <子命令> [参数]\n\n")
+	fmt.Fprintf(os.Stderr, "可用子命令:\n")
+	fmt.Fprintf(os.Stderr, "  keygen     生成 ed25519 签名密钥对\n")
+	fmt.Fprintf(os.Stderr, "  sign       为 Agent 发布包生成 .sig 签名文件\n\n")
+	fmt.Fprintf(os.Stderr, "使用 'baihu agentsign <子命令> --help' 查看具体子命令的参数说明和示例。\n\n")
+}
+
+// Run 签名命令入口
+func Run(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		printMainHelp()
+		return
+	}
+
+	switch args[0] {
+	case "keygen":
+		runKeygen(args[1:])
+	case "sign":
+		runSign(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", args[0])
+		printMainHelp()
+	}
+}
+
+func runKeygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	outPtr := fs.String("out", "agent-sign.key", "私钥保存路径")
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板 Agent 签名密钥生成工具", "baihu agentsign keygen [参数]", "  baihu agentsign keygen -out /secure/agent-sign.key", fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+
+	if _, err := os.Stat(*outPtr); err == nil {
+		fmt.Printf(">> 私钥文件 %s 已存在，为避免覆盖已发布的密钥，请先手动移除\n", *outPtr)
+		os.Exit(1)
+	}
+
+	pub, priv, err := agentsign.GenerateKey()
+	if err != nil {
+		fmt.Printf(">> 生成密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outPtr, []byte(priv+"\n"), 0600); err != nil {
+		fmt.Printf(">> 保存私钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf(">> 私钥已保存到 %s，请妥善保管\n", *outPtr)
+	fmt.Printf(">> 公钥: %s\n", pub)
+	fmt.Println(">> 构建 Agent 时通过 AGENT_UPDATE_PUBKEY 写入公钥；未内置公钥的自编译 Agent 可在配置中设置 update_public_key")
+}
+
+func runSign(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPtr := fs.String("key", "agent-sign.key", "私钥文件路径")
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板 Agent 发布包签名工具", "baihu agentsign sign [参数] <发布包...>", "  baihu agentsign sign -key agent-sign.key data/agent/*.tar.gz", fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	key, err := os.ReadFile(*keyPtr)
+	if err != nil {
+		fmt.Printf(">> 读取私钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, file := range fs.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Printf(">> 读取 %s 失败: %v\n", file, err)
+			os.Exit(1)
+		}
+		sig, err := agentsign.Sign(strings.TrimSpace(string(key)), data)
+		if err != nil {
+			fmt.Printf(">> 签名 %s 失败: %v\n", file, err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(file+agentsign.SignatureSuffix, []byte(sig+"\n"), 0644); err != nil {
+			fmt.Printf(">> 写入 %s%s 失败: %v\n", file, agentsign.SignatureSuffix, err)
+			os.Exit(1)
+		}
+		fmt.Printf(">> 已签名 %s (sha256 %s)\n", file, agentsign.Checksum(data))
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/services"
 	"github.com/engigu/baihu-panel/internal/services/deps"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
 	"github.com/engigu/baihu-panel/internal/utils"
 )
 
@@ -42,7 +43,7 @@ func Run(args []string) {
 		return
 	}
 
-	logOutput, err := utils.DecompressFromBase64(string(log.Output))
+	logOutput, err := tasks.LoadTaskLogOutput(&log)
 	if err != nil {
 		fmt.Printf(">> 解压日志失败: %v\n", err)
 		return
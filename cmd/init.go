@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"github.com/engigu/baihu-panel/cmd/agentsign"
 	"github.com/engigu/baihu-panel/cmd/builtininstall"
 	"github.com/engigu/baihu-panel/cmd/completion"
 	"github.com/engigu/baihu-panel/cmd/depinstall"
+	"github.com/engigu/baihu-panel/cmd/logindex"
+	"github.com/engigu/baihu-panel/cmd/logstore"
 	"github.com/engigu/baihu-panel/cmd/reposync"
 	"github.com/engigu/baihu-panel/cmd/resetpwd"
 	"github.com/engigu/baihu-panel/cmd/restore"
@@ -24,6 +27,8 @@ func InitHandlers() {
 	RegisterHandler("builtininstall", builtininstall.Run)
 	RegisterHandler("completion", completion.Run)
 	RegisterHandler("depinstall", depinstall.Run)
+	RegisterHandler("logindex", logindex.Run)
+	RegisterHandler("logstore", logstore.Run)
 	RegisterHandler("reposync", reposync.Run)
 	RegisterHandler("resetpwd", resetpwd.Run)
 	RegisterHandler("restore", restore.Run)
@@ -31,6 +36,7 @@ func InitHandlers() {
 	RegisterHandler("webui", webui.Run)
 
 	// 轻量级命令显式标记 RequireContext = false
+	RegisterHandlerWithConfig("agentsign", agentsign.Run, false)
 	RegisterHandlerWithConfig("version", version.Run, false)
 	RegisterHandlerWithConfig("-v", version.Run, false)
 	RegisterHandlerWithConfig("-V", version.Run, false)
@@ -0,0 +1,82 @@
+package logindex
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/engigu/baihu-panel/cmd/clibase"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+)
+
+// 打印主帮助
+func printMainHelp() {
+	fmt.Fprintf(os.Stderr, "\n白虎面板日志检索索引管理工具\n\n")
+	fmt.Fprintf(os.Stderr, "用法:\n")
+	fmt.Fprintf(os.Stderr, "  baihu logindex <子命令> [参数]\n\n")
+	fmt.Fprintf(os.Stderr, "可用子命令:\n")
+	fmt.Fprintf(os.Stderr, "  rebuild    为已有的任务日志重建全文检索索引\n")
+	fmt.Fprintf(os.Stderr, "  prune      清理日志已删除但仍残留的索引记录\n\n")
+	fmt.Fprintf(os.Stderr, "使用 'baihu logindex <子命令> --help' 查看具体子命令的参数说明和示例。\n\n")
+}
+
+// Run 日志索引命令入口
+func Run(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		printMainHelp()
+		return
+	}
+
+	switch args[0] {
+	case "rebuild":
+		runRebuild(args[1:])
+	case "prune":
+		runPrune(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", args[0])
+		printMainHelp()
+	}
+}
+
+func runRebuild(args []string) {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	taskIDPtr := fs.String("task-id", "", "仅重建指定任务的日志索引")
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板日志检索索引重建工具", "baihu logindex rebuild [参数]", "  baihu logindex rebuild\n  baihu logindex rebuild -task-id a1b2c3d4", fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+
+	clibase.InitContext(false)
+
+	start := time.Now()
+	fmt.Println(">> 正在重建日志检索索引，日志较多时可能需要一些时间，请勿中断...")
+	done, failed, err := tasks.NewLogSearchService().Rebuild(*taskIDPtr, func(done, failed int) {
+		fmt.Printf("\r>> 已处理 %d 条日志 (失败 %d 条)", done, failed)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf(">> 重建索引失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf(">> 重建完成：成功 %d 条，失败 %d 条，耗时 %v\n", done, failed, time.Since(start).Round(time.Millisecond))
+}
+
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板日志检索索引清理工具", "baihu logindex prune", "  baihu logindex prune", nil)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+
+	clibase.InitContext(false)
+
+	removed := tasks.NewLogSearchService().PruneOrphans()
+	fmt.Printf(">> 已清理 %d 条残留索引记录\n", removed)
+}
@@ -0,0 +1,125 @@
+package logstore
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/engigu/baihu-panel/cmd/clibase"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logstore"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+)
+
+// 打印主帮助
+func printMainHelp() {
+	fmt.Fprintf(os.Stderr, "\n白虎面板任务日志存储管理工具\n\n")
+	fmt.Fprintf(os.Stderr, "用法:\n")
+	fmt.Fprintf(os.Stderr, "  baihu logstore <子命令> [参数]\n\n")
+	fmt.Fprintf(os.Stderr, "可用子命令:\n")
+	fmt.Fprintf(os.Stderr, "  migrate    将已有任务日志迁移到指定存储后端 (db/fs/s3)\n")
+	fmt.Fprintf(os.Stderr, "  stats      查看各存储后端中的日志数量\n\n")
+	fmt.Fprintf(os.Stderr, "使用 'baihu logstore <子命令> --help' 查看具体子命令的参数说明和示例。\n\n")
+}
+
+// Run 日志存储命令入口
+func Run(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		printMainHelp()
+		return
+	}
+
+	switch args[0] {
+	case "migrate":
+		runMigrate(args[1:])
+	case "stats":
+		runStats(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", args[0])
+		printMainHelp()
+	}
+}
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	toPtr := fs.String("to", "", "目标存储后端 (db/fs/s3)，默认使用配置文件 [log_storage] 中的 type")
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板任务日志存储迁移工具", "baihu logstore migrate [参数]", "  baihu logstore migrate\n  baihu logstore migrate -to fs\n  baihu logstore migrate -to db", fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+
+	clibase.InitContext(false)
+
+	var target logstore.Store
+	switch *toPtr {
+	case "":
+		target = logstore.Current()
+	case logstore.TypeDB:
+		target = nil
+	default:
+		store, err := logstore.Open(*toPtr)
+		if err != nil {
+			fmt.Printf(">> 打开目标存储失败: %v\n", err)
+			os.Exit(1)
+		}
+		target = store
+	}
+
+	targetName := logstore.TypeDB
+	if target != nil {
+		targetName = target.Name()
+	}
+
+	start := time.Now()
+	fmt.Printf(">> 正在将任务日志迁移到 %s，日志较多时可能需要一些时间，中断后可重复执行...\n", targetName)
+	result, err := tasks.MigrateTaskLogStorage(target, func(done int) {
+		fmt.Printf("\r>> 已处理 %d 条日志", done)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf(">> 迁移失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf(">> 迁移完成：迁移 %d 条，跳过 %d 条（无日志内容），失败 %d 条，耗时 %v\n",
+		result.Migrated, result.Skipped, result.Failed, time.Since(start).Round(time.Millisecond))
+	if target != nil && *toPtr != "" && target != logstore.Current() {
+		fmt.Printf(">> 提示：新产生的日志仍写入当前配置的后端，如需切换请修改配置文件 [log_storage] type = %s\n", targetName)
+	}
+}
+
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = func() {
+		clibase.PrintSubCommandUsage("白虎面板任务日志存储统计", "baihu logstore stats", "  baihu logstore stats", nil)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+
+	clibase.InitContext(false)
+
+	var rows []struct {
+		Storage string
+		Count   int64
+	}
+	database.DB.Model(&models.TaskLog{}).Select("storage, COUNT(*) AS count").Group("storage").Scan(&rows)
+
+	current := logstore.TypeDB
+	if store := logstore.Current(); store != nil {
+		current = store.Name()
+	}
+	fmt.Printf(">> 当前配置的存储后端: %s\n", current)
+	for _, row := range rows {
+		name := row.Storage
+		if name == "" {
+			name = logstore.TypeDB
+		}
+		fmt.Printf("   %-4s %d 条\n", name, row.Count)
+	}
+}
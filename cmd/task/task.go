@@ -10,6 +10,7 @@ import (
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
 	"github.com/engigu/baihu-panel/internal/utils"
 )
 
@@ -312,7 +313,7 @@ func runStatus(args []string) {
 	fmt.Println("[日志输出内容]")
 
 	// 解压
-	decompressed, err := utils.DecompressFromBase64(string(taskLog.Output))
+	decompressed, err := tasks.LoadTaskLogOutput(&taskLog)
 	if err != nil {
 		fmt.Printf("[无法解压日志输出: %v]\n", err)
 	} else {
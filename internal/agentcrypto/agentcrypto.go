@@ -0,0 +1,183 @@
+// Package agentcrypto 面板下发给 Agent 的环境变量与机密的端到端加密
+// Agent 持有 X25519 私钥并向面板上报公钥，面板为每个值生成临时密钥对，经 HKDF-SHA256 派生 AES-256-GCM 密钥加密，
+// 密文形如 e2e:v1:<base64(临时公钥|nonce|密文)>，只有 Agent 进程内能解出明文，面板前的 TLS 终止点无法读取
+package agentcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Prefix 加密值的前缀，不带前缀的值按明文处理以兼容未上报公钥的旧版 Agent
+const Prefix = "e2e:v1:"
+
+const (
+	keySize   = 32
+	nonceSize = 12
+	hkdfInfo  = "baihu-agent-e2e-v1"
+)
+
+// GenerateKey 生成 base64 编码的 X25519 密钥对
+func GenerateKey() (publicKey, privateKey string, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return encode(priv.PublicKey().Bytes()), encode(priv.Bytes()), nil
+}
+
+// PublicKey 由私钥推出公钥
+func PublicKey(privateKey string) (string, error) {
+	priv, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return encode(priv.PublicKey().Bytes()), nil
+}
+
+// ValidPublicKey 校验 Agent 上报的公钥
+func ValidPublicKey(publicKey string) bool {
+	_, err := parsePublicKey(publicKey)
+	return err == nil
+}
+
+// Fingerprint 公钥指纹，用于界面展示与日志
+func Fingerprint(publicKey string) string {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key.Bytes())
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// IsEncrypted 值是否为加密格式
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt 使用 Agent 公钥加密，空值原样返回
+func Encrypt(publicKey, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	recipient, err := parsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := append(ephemeral.PublicKey().Bytes(), nonce...)
+	out = aead.Seal(out, nonce, []byte(plaintext), nil)
+	return Prefix + encode(out), nil
+}
+
+// Decrypt 使用 Agent 私钥解密，不带前缀的值视为明文原样返回
+func Decrypt(privateKey, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	priv, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil || len(data) < keySize+nonceSize {
+		return "", fmt.Errorf("密文格式错误")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(data[:keySize])
+	if err != nil {
+		return "", fmt.Errorf("密文格式错误")
+	}
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(shared, ephemeral.Bytes(), priv.PublicKey().Bytes())
+	if err != nil {
+		return "", err
+	}
+	nonce := data[keySize : keySize+nonceSize]
+	plaintext, err := aead.Open(nil, nonce, data[keySize+nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败，密钥不匹配或数据被篡改")
+	}
+	return string(plaintext), nil
+}
+
+// EncryptValues 逐个加密，任一失败时返回错误，避免部分明文下发
+func EncryptValues(publicKey string, values []string) ([]string, error) {
+	sealed := make([]string, len(values))
+	for i, v := range values {
+		s, err := Encrypt(publicKey, v)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i] = s
+	}
+	return sealed, nil
+}
+
+// newAEAD 由共享密钥派生 AES-256-GCM，盐值绑定临时公钥与接收方公钥
+func newAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key, err := hkdf.Key(sha256.New, shared, salt, hkdfInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func parsePublicKey(publicKey string) (*ecdh.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("无效的 X25519 公钥")
+	}
+	key, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 X25519 公钥")
+	}
+	return key, nil
+}
+
+func parsePrivateKey(privateKey string) (*ecdh.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("无效的 X25519 私钥")
+	}
+	key, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 X25519 私钥")
+	}
+	return key, nil
+}
+
+func encode(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
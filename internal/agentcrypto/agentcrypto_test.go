@@ -0,0 +1,47 @@
+package agentcrypto
+
+import "testing"
+
+func TestEncryptAndDecrypt(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	if derived, _ := PublicKey(priv); derived != pub {
+		t.Errorf("由私钥推出的公钥不一致: %s != %s", derived, pub)
+	}
+
+	sealed, err := Encrypt(pub, "API_TOKEN=secret")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Fatalf("密文缺少前缀: %s", sealed)
+	}
+	if again, _ := Encrypt(pub, "API_TOKEN=secret"); again == sealed {
+		t.Error("每次加密应使用不同的临时密钥")
+	}
+	if plain, err := Decrypt(priv, sealed); err != nil || plain != "API_TOKEN=secret" {
+		t.Errorf("解密结果 = %q, %v", plain, err)
+	}
+
+	_, otherPriv, _ := GenerateKey()
+	if _, err := Decrypt(otherPriv, sealed); err == nil {
+		t.Error("其它密钥不应能解密")
+	}
+	tampered := sealed[:len(sealed)-4] + "AAAA"
+	if _, err := Decrypt(priv, tampered); err == nil {
+		t.Error("被篡改的密文应当解密失败")
+	}
+
+	// 空值与明文兼容旧版面板
+	if v, _ := Encrypt(pub, ""); v != "" {
+		t.Errorf("空值应原样返回: %q", v)
+	}
+	if v, err := Decrypt(priv, "plain"); err != nil || v != "plain" {
+		t.Errorf("明文应原样返回: %q, %v", v, err)
+	}
+	if _, err := Encrypt("invalid", "x"); err == nil {
+		t.Error("无效公钥应当报错")
+	}
+}
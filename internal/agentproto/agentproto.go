@@ -0,0 +1,125 @@
+// Package agentproto 面板与 Agent 的协议版本与能力协商
+// Agent 连接后发送 hello 上报自身的协议版本与能力，面板在 connected 消息中附带自身的版本与能力，
+// 双方只使用对端声明支持的功能；未握手的旧版本按 constant.AgentProtocolLegacy 处理，不具备任何可选能力
+package agentproto
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// Hello 握手内容，Agent 的 hello 消息与面板的 connected 消息共用
+type Hello struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+// Feature 依赖 Agent 能力的功能
+type Feature struct {
+	Capability string `json:"capability"`
+	Label      string `json:"label"`
+}
+
+// FeatureStatus 某个 Agent 对功能的支持情况，不支持时界面提示需要升级
+type FeatureStatus struct {
+	Feature
+	Supported bool `json:"supported"`
+}
+
+// Features 所有可选能力，顺序即界面展示顺序
+var Features = []Feature{
+	{constant.AgentCapFileSync, "脚本文件同步"},
+	{constant.AgentCapTerminal, "远程终端"},
+	{constant.AgentCapMise, "运行时与依赖安装"},
+	{constant.AgentCapLogStream, "实时日志分流"},
+	{constant.AgentCapMetrics, "主机资源监控"},
+	{constant.AgentCapInlineTask, "按标签选择器派发"},
+	{constant.AgentCapSelfUpdate, "签名更新与失败回滚"},
+	{constant.AgentCapE2E, "机密端到端加密"},
+	{constant.AgentCapSDKRelay, "脚本 SDK 本地转发"},
+	{constant.AgentCapResultAck, "离线结果确认补传"},
+	{constant.AgentCapSDKGrant, "定时执行 SDK 转发"},
+}
+
+// Label 能力对应的功能名称
+func Label(capability string) string {
+	for _, f := range Features {
+		if f.Capability == capability {
+			return f.Label
+		}
+	}
+	return capability
+}
+
+// Local 当前版本的握手内容，面板与 Agent 同源构建，具备全部能力
+func Local() Hello {
+	caps := make([]string, len(Features))
+	for i, f := range Features {
+		caps[i] = f.Capability
+	}
+	return Hello{ProtocolVersion: constant.AgentProtocolVersion, Capabilities: caps}
+}
+
+// Peer 对端的协商结果
+type Peer struct {
+	ProtocolVersion int
+	Capabilities    []string
+}
+
+// Legacy 未发送握手信息的旧版本
+func Legacy() Peer {
+	return Peer{ProtocolVersion: constant.AgentProtocolLegacy}
+}
+
+// Negotiate 由对端的握手内容得到协商结果，忽略本端不认识的能力
+func Negotiate(remote Hello) Peer {
+	peer := Legacy()
+	if remote.ProtocolVersion > peer.ProtocolVersion {
+		peer.ProtocolVersion = remote.ProtocolVersion
+	}
+	for _, f := range Features {
+		if slices.Contains(remote.Capabilities, f.Capability) {
+			peer.Capabilities = append(peer.Capabilities, f.Capability)
+		}
+	}
+	return peer
+}
+
+// Supports 对端是否具备某项能力
+func (p Peer) Supports(capability string) bool {
+	return slices.Contains(p.Capabilities, capability)
+}
+
+// Statuses 逐项列出功能支持情况
+func (p Peer) Statuses() []FeatureStatus {
+	result := make([]FeatureStatus, len(Features))
+	for i, f := range Features {
+		result[i] = FeatureStatus{Feature: f, Supported: p.Supports(f.Capability)}
+	}
+	return result
+}
+
+// SDKRelayPaths Agent 可以代任务脚本转发的 SDK 接口（通知、任务、环境变量），相对面板根路径
+var SDKRelayPaths = []string{
+	"/api/v1/notify/send",
+	"/open2api/v1/env",
+	"/open2api/v1/tasks",
+	"/open2api/v1/execute",
+}
+
+// SDKRelayAllowed 路径是否在可转发的 SDK 接口范围内
+func SDKRelayAllowed(p string) bool {
+	if p == "" {
+		return false
+	}
+	clean := path.Clean("/" + p)
+	for _, prefix := range SDKRelayPaths {
+		if clean == prefix || strings.HasPrefix(clean, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
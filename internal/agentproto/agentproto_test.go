@@ -0,0 +1,109 @@
+package agentproto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// 各版本握手消息样本：旧版面板的 connected 不带协议字段，旧版 Agent 不发送 hello
+var helloFixtures = []struct {
+	name     string
+	payload  string
+	version  int
+	supports []string
+	lacks    []string
+}{
+	{
+		name:    "v1 connected",
+		payload: `{"agent_id":"a1","name":"agent-1","is_new_agent":false,"machine_id":"m1","scheduler_config":{"worker_count":4}}`,
+		version: constant.AgentProtocolLegacy,
+		lacks:   []string{constant.AgentCapFileSync, constant.AgentCapTerminal, constant.AgentCapInlineTask},
+	},
+	{
+		name:     "v2 hello",
+		payload:  `{"protocol_version":2,"capabilities":["file_sync","terminal","mise","log_stream","metrics","inline_task","self_update","e2e"]}`,
+		version:  2,
+		supports: []string{constant.AgentCapFileSync, constant.AgentCapTerminal, constant.AgentCapE2E},
+	},
+	{
+		name:     "v2 hello without terminal",
+		payload:  `{"protocol_version":2,"capabilities":["file_sync","mise"]}`,
+		version:  2,
+		supports: []string{constant.AgentCapFileSync, constant.AgentCapMise},
+		lacks:    []string{constant.AgentCapTerminal, constant.AgentCapE2E},
+	},
+	{
+		name:     "future hello",
+		payload:  `{"protocol_version":9,"capabilities":["terminal","quantum_tunnel"],"extra":{"x":1}}`,
+		version:  9,
+		supports: []string{constant.AgentCapTerminal},
+		lacks:    []string{"quantum_tunnel"},
+	},
+}
+
+func TestNegotiateFixtures(t *testing.T) {
+	for _, tc := range helloFixtures {
+		t.Run(tc.name, func(t *testing.T) {
+			var hello Hello
+			if err := json.Unmarshal([]byte(tc.payload), &hello); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			peer := Negotiate(hello)
+			if peer.ProtocolVersion != tc.version {
+				t.Errorf("协议版本 = %d, 期望 %d", peer.ProtocolVersion, tc.version)
+			}
+			for _, c := range tc.supports {
+				if !peer.Supports(c) {
+					t.Errorf("应支持 %s", c)
+				}
+			}
+			for _, c := range tc.lacks {
+				if peer.Supports(c) {
+					t.Errorf("不应支持 %s", c)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalAndStatuses(t *testing.T) {
+	local := Negotiate(Local())
+	if local.ProtocolVersion != constant.AgentProtocolVersion {
+		t.Errorf("本端协议版本 = %d", local.ProtocolVersion)
+	}
+	for _, s := range local.Statuses() {
+		if !s.Supported {
+			t.Errorf("当前版本应具备 %s", s.Capability)
+		}
+	}
+
+	legacy := Legacy().Statuses()
+	if len(legacy) != len(Features) {
+		t.Fatalf("功能列表长度 = %d", len(legacy))
+	}
+	for _, s := range legacy {
+		if s.Supported || s.Label == "" {
+			t.Errorf("旧版本不应具备 %+v", s)
+		}
+	}
+	if Label(constant.AgentCapTerminal) != "远程终端" || Label("unknown") != "unknown" {
+		t.Error("功能名称不正确")
+	}
+}
+
+func TestSDKRelayAllowed(t *testing.T) {
+	allowed := []string{"/api/v1/notify/send", "/open2api/v1/env", "/open2api/v1/env/all", "/open2api/v1/tasks/stop/l1", "/open2api/v1/execute/task/t1"}
+	for _, p := range allowed {
+		if !SDKRelayAllowed(p) {
+			t.Errorf("%s 应允许转发", p)
+		}
+	}
+	denied := []string{"", "/api/v1/settings", "/open2api/v1/scripts", "/open2api/v1/envx", "/open2api/v1/env/../../../api/v1/users"}
+	for _, p := range denied {
+		if SDKRelayAllowed(p) {
+			t.Errorf("%s 不应允许转发", p)
+		}
+	}
+}
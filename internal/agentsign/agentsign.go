@@ -0,0 +1,65 @@
+// Package agentsign Agent 发布包的 ed25519 签名与校验
+// 签名对象为发布包 SHA256 摘要，签名以 base64 保存在发布包旁的 .sig 文件中，Agent 内置公钥校验后才会替换自身
+package agentsign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// SignatureSuffix 签名文件后缀，如 baihu-agent-linux-amd64.tar.gz.sig
+const SignatureSuffix = ".sig"
+
+// GenerateKey 生成 base64 编码的 ed25519 密钥对
+func GenerateKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// Checksum 计算发布包的 SHA256（十六进制）
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// message 签名内容，加上前缀避免同一密钥的签名被挪作他用
+func message(checksum string) []byte {
+	return []byte("baihu-agent-sha256:" + strings.ToLower(checksum))
+}
+
+// Sign 使用私钥为发布包签名，返回 base64 编码的签名
+func Sign(privateKey string, data []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("无效的 ed25519 私钥")
+	}
+	sig := ed25519.Sign(ed25519.PrivateKey(key), message(Checksum(data)))
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Verify 校验发布包的 SHA256 与签名
+func Verify(publicKey string, data []byte, checksum, signature string) error {
+	if actual := Checksum(data); !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("SHA256 校验失败: 期望 %s，实际 %s", checksum, actual)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("无效的 ed25519 公钥")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("缺少或无效的签名")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), message(checksum), sig) {
+		return fmt.Errorf("签名校验失败")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package agentsign
+
+import "testing"
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	data := []byte("baihu-agent package")
+	sig, err := Sign(priv, data)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+
+	if err := Verify(pub, data, Checksum(data), sig); err != nil {
+		t.Errorf("合法的发布包应当通过校验: %v", err)
+	}
+	if err := Verify(pub, []byte("tampered"), Checksum(data), sig); err == nil {
+		t.Error("内容被篡改时应当校验失败")
+	}
+	tampered := []byte("tampered")
+	if err := Verify(pub, tampered, Checksum(tampered), sig); err == nil {
+		t.Error("摘要与签名不匹配时应当校验失败")
+	}
+	otherPub, _, _ := GenerateKey()
+	if err := Verify(otherPub, data, Checksum(data), sig); err == nil {
+		t.Error("非固定公钥签名的发布包应当校验失败")
+	}
+	if err := Verify(pub, data, Checksum(data), ""); err == nil {
+		t.Error("缺少签名时应当校验失败")
+	}
+}
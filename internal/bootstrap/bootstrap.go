@@ -11,6 +11,7 @@ import (
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/executor"
 	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/logstore"
 	"github.com/engigu/baihu-panel/internal/router"
 	"github.com/engigu/baihu-panel/internal/services"
 	"github.com/engigu/baihu-panel/internal/tunnel"
@@ -97,6 +98,10 @@ func (a *App) initConfigWithPath(path string) {
 	}
 
 	a.setupBaihuBin()
+
+	if err := logstore.Init(cfg.LogStorage.LogStoreConfig()); err != nil {
+		logger.Fatalf("Failed to init log storage: %v", err)
+	}
 }
 
 func (a *App) setupBaihuBin() {
@@ -57,6 +57,33 @@ var Commands = []CommandSpec{
 		Name:        "depinstall",
 		Description: "一键补全指定任务日志中的缺失依赖包",
 	},
+	{
+		Name:        "logindex",
+		Description: "重建或清理任务日志全文检索索引",
+		SubCommands: map[string]string{
+			"rebuild": "为已有的任务日志重建检索索引",
+			"prune":   "清理日志已删除但仍残留的索引记录",
+		},
+		Flags: []string{"--task-id"},
+	},
+	{
+		Name:        "logstore",
+		Description: "迁移或统计任务日志存储后端",
+		SubCommands: map[string]string{
+			"migrate": "将已有任务日志迁移到指定存储后端",
+			"stats":   "查看各存储后端中的日志数量",
+		},
+		Flags: []string{"--to"},
+	},
+	{
+		Name:        "agentsign",
+		Description: "生成 Agent 发布包签名密钥并为发布包签名",
+		SubCommands: map[string]string{
+			"keygen": "生成 ed25519 签名密钥对",
+			"sign":   "为 Agent 发布包生成 .sig 签名文件",
+		},
+		Flags: []string{"--out", "--key"},
+	},
 	{
 		Name:        "version",
 		Description: "查看当前系统版本号 (同 -v, -V)",
@@ -19,6 +19,8 @@ const (
 	SectionScheduler    = "scheduler"
 	SectionSecurity     = "security"
 	SectionNotify       = "notify"
+	SectionAgentAlert   = "agent_alert"
+	SectionAgent        = "agent"
 
 	// Site Settings Key 常量
 	KeyTitle        = "title"
@@ -52,6 +54,20 @@ const (
 	KeyWorkerCount  = "worker_count"
 	KeyQueueSize    = "queue_size"
 	KeyRateInterval = "rate_interval"
+	// 广播运行同时执行的 Agent 数上限（未单独指定时使用）
+	KeyBroadcastParallel = "broadcast_parallel"
+
+	// Agent 告警阈值 Key 常量，值为 0 时不告警
+	KeyAgentAlertCPUPercent     = "cpu_percent"
+	KeyAgentAlertMemPercent     = "mem_percent"
+	KeyAgentAlertDiskPercent    = "disk_percent"
+	KeyAgentAlertOfflineMinutes = "offline_minutes"
+	// 同一 Agent 同一指标两次告警的最小间隔（分钟）
+	KeyAgentAlertCooldownMinutes = "cooldown_minutes"
+
+	// Agent Settings Key 常量
+	// 新 Agent 通过令牌注册后需管理员审批才能接收任务
+	KeyAgentRequireApproval = "require_approval"
 
 	// Notify Settings Key 常量
 	KeyNotifyChannels = "channels"
@@ -72,6 +88,18 @@ const (
 	KeyNotifyTemplateTaskFailedText       = "notify_template_task_failed_text"
 	KeyNotifyTemplateTaskTimeoutTitle     = "notify_template_task_timeout_title"
 	KeyNotifyTemplateTaskTimeoutText      = "notify_template_task_timeout_text"
+	KeyNotifyTemplateAgentResourceAlertTitle = "notify_template_agent_resource_alert_title"
+	KeyNotifyTemplateAgentResourceAlertText  = "notify_template_agent_resource_alert_text"
+	KeyNotifyTemplateAgentOfflineTitle       = "notify_template_agent_offline_title"
+	KeyNotifyTemplateAgentOfflineText        = "notify_template_agent_offline_text"
+	KeyNotifyTemplateAgentPendingTitle       = "notify_template_agent_pending_title"
+	KeyNotifyTemplateAgentPendingText        = "notify_template_agent_pending_text"
+	KeyNotifyTemplateAgentReviewedTitle      = "notify_template_agent_reviewed_title"
+	KeyNotifyTemplateAgentReviewedText       = "notify_template_agent_reviewed_text"
+	KeyNotifyTemplateRemoteTaskSuccessTitle  = "notify_template_remote_task_success_title"
+	KeyNotifyTemplateRemoteTaskSuccessText   = "notify_template_remote_task_success_text"
+	KeyNotifyTemplateRemoteTaskFailedTitle   = "notify_template_remote_task_failed_title"
+	KeyNotifyTemplateRemoteTaskFailedText    = "notify_template_remote_task_failed_text"
 
 	// 事件绑定类型
 	BindingTypeSystem = "system"
@@ -96,6 +124,14 @@ const (
 	EventNotifySent   = "notify_sent"
 	EventAppLogAdded  = "app_log_added"
 	EventBackupRestored = "backup_restored"
+	EventAgentCommandOutput = "agent_command_output" // Agent 一次性命令的实时输出，推送给前端
+	EventAgentResourceAlert = "agent_resource_alert" // Agent 资源使用超过阈值
+	EventAgentOffline       = "agent_offline"        // Agent 离线超过设定时长
+	EventAgentPending       = "agent_pending"        // 新 Agent 注册后等待审批
+	EventAgentReviewed      = "agent_reviewed"       // 管理员通过或拒绝了 Agent 注册
+	EventDataChanged        = "data_changed"         // 任务或环境变量被新建、修改或删除
+	EventRemoteTaskSuccess  = "remote_task_success"  // 主节点触发的子节点任务执行成功
+	EventRemoteTaskFailed   = "remote_task_failed"   // 主节点触发的子节点任务执行失败、超时或中断
 
 	// WebSocket 消息类型
 	WSTypeHeartbeat     = "heartbeat"
@@ -112,6 +148,44 @@ const (
 	WSTypeFetchTasks    = "fetch_tasks"
 	WSTypeTaskHeartbeat = "task_heartbeat"
 	WSTypeStop          = "stop"
+	WSTypeFileSync      = "file_sync"   // Agent 执行前请求任务所需的脚本文件
+	WSTypeFileBundle    = "file_bundle" // 面板返回文件清单及 Agent 缺少的内容
+	WSTypeTerminalOpen   = "terminal_open"   // 面板请求在 Agent 上打开终端会话
+	WSTypeTerminalInput  = "terminal_input"  // 终端输入
+	WSTypeTerminalResize = "terminal_resize" // 终端窗口大小变化
+	WSTypeTerminalClose  = "terminal_close"  // 面板关闭终端会话
+	WSTypeTerminalOutput = "terminal_output" // Agent 返回终端输出
+	WSTypeTerminalExit   = "terminal_exit"   // Agent 上的终端进程已退出
+	WSTypeRuntimes      = "runtimes"       // Agent 上报已安装的 mise 运行时
+	WSTypeFetchRuntimes = "fetch_runtimes" // 面板请求 Agent 重新上报运行时
+	WSTypeCommand       = "command"        // 面板下发一次性命令，如安装依赖
+	WSTypeCommandOutput = "command_output" // 一次性命令的实时输出
+	WSTypeCommandResult = "command_result" // 一次性命令的执行结果
+	WSTypeUpdateResult  = "update_result"  // Agent 上报自更新结果（新版本连接成功或已回滚）
+	WSTypeRotateKey     = "rotate_key"     // 面板要求 Agent 轮换端到端加密密钥
+	WSTypeHello         = "hello"          // Agent 连接后上报协议版本与能力
+	WSTypeSDKRequest    = "sdk_request"    // Agent 转发任务脚本的 SDK 调用
+	WSTypeSDKResponse   = "sdk_response"   // 面板返回 SDK 调用结果
+	WSTypeTaskResultAck = "task_result_ack" // 面板确认已保存 Agent 补传的任务结果
+	WSTypeSDKGrantRequest = "sdk_grant_request" // Agent 本地定时触发的执行申请 SDK 转发凭证
+	WSTypeSDKGrant        = "sdk_grant"         // 面板返回签发的 SDK 转发凭证
+
+	// Agent 协议版本，双方握手时互报版本与能力；未发送 hello 的旧版 Agent 视为版本 1，不具备下列能力
+	AgentProtocolVersion = 2
+	AgentProtocolLegacy  = 1
+
+	// Agent 能力，面板只向具备对应能力的 Agent 使用相关功能
+	AgentCapFileSync   = "file_sync"   // 执行前从面板同步脚本文件
+	AgentCapTerminal   = "terminal"    // 远程终端
+	AgentCapMise       = "mise"        // 上报 mise 运行时、执行依赖安装等一次性命令
+	AgentCapLogStream  = "log_stream"  // 实时日志区分 stdout/stderr/system
+	AgentCapMetrics    = "metrics"     // 心跳上报主机资源
+	AgentCapInlineTask = "inline_task" // 执行随指令下发、不在本地任务列表中的任务（标签选择器派发）
+	AgentCapSelfUpdate = "self_update" // 校验更新包签名，失败自动回滚并上报结果
+	AgentCapE2E        = "e2e"         // 变量与机密端到端加密
+	AgentCapSDKRelay   = "sdk_relay"   // 本地转发任务脚本的 SDK 调用
+	AgentCapResultAck  = "result_ack"  // 面板确认补传结果后 Agent 才删除本地缓存
+	AgentCapSDKGrant   = "sdk_grant"   // 为 Agent 本地定时触发的执行签发 SDK 转发凭证
 
 	// 任务状态
 	TaskStatusSuccess   = "success"
@@ -138,6 +212,46 @@ const (
 	AgentStatusOnline  = "online"
 	AgentStatusOffline = "offline"
 
+	// Agent 注册审批状态，空值为开启审批前注册的 Agent，视为已通过
+	AgentApprovalPending  = "pending"
+	AgentApprovalApproved = "approved"
+	AgentApprovalRejected = "rejected"
+
+	// Agent 选择策略（任务按标签选择器路由时使用）
+	AgentStrategyRoundRobin = "round_robin" // 轮询
+	AgentStrategyLeastBusy  = "least_busy"  // 最空闲（依据 Agent 上报的 Worker 状态）
+	AgentStrategyRandom     = "random"      // 随机
+
+	// 任务故障转移目标：指定的 Agent 不可用时按任务配置的顺序依次尝试
+	FailoverTargetAgent = "agent" // 改由备用 Agent 执行
+	FailoverTargetLocal = "local" // 改由面板本机执行
+	FailoverTargetWait  = "wait"  // 等待原 Agent 恢复，最多等待指定分钟数
+
+	// 托管同步的资源类型
+	ManagedKindTask   = "task"
+	ManagedKindEnv    = "env"
+	ManagedKindScript = "script" // 托管任务引用的脚本目录文件
+
+	// 托管同步计划中每个资源的动作
+	ManagedActionNone     = "none"     // 与主节点一致
+	ManagedActionCreate   = "create"   // 子节点上不存在，新建
+	ManagedActionUpdate   = "update"   // 主节点已修改，更新子节点
+	ManagedActionRestore  = "restore"  // 子节点副本被修改或删除，以主节点覆盖
+	ManagedActionDrift    = "drift"    // 子节点副本被修改或删除，仅报告
+	ManagedActionConflict = "conflict" // 主节点与子节点都被修改，仅报告
+	ManagedActionRelease  = "release"  // 已移出托管范围，子节点副本保留但不再同步
+	ManagedActionSkip     = "skip"     // 机密变量等不支持同步的资源
+
+	// 托管资源在子节点上的同步状态
+	ManagedStatusSynced   = "synced"
+	ManagedStatusDrift    = "drift"
+	ManagedStatusConflict = "conflict"
+	ManagedStatusError    = "error"
+
+	// Agent 分批升级阶段，升级与目标状态沿用任务状态 pending/running/success/failed/cancelled
+	AgentRolloutStageCanary = "canary" // 只升级金丝雀 Agent
+	AgentRolloutStageAll    = "all"    // 金丝雀验证通过后升级其余 Agent
+
 	// AppLog 分类
 	LogCategoryDefault      = "default"
 	LogCategorySystemNotice = "system_notice"
@@ -145,6 +259,7 @@ const (
 	LogCategoryLoginLog     = "login_log"
 	LogCategorySchedulerLog = "scheduler_log"
 	LogCategoryFilterLog    = "filter_log"
+	LogCategoryAuditLog     = "audit_log" // 敏感操作审计，如打开 Agent 远程终端
 
 	// AppLog 级别
 	LogLevelInfo    = "info"
@@ -224,6 +339,18 @@ var DefaultSettings = map[string]map[string]string{
 		KeyWorkerCount:  "4",
 		KeyQueueSize:    "100",
 		KeyRateInterval: "200",
+		// 广播运行默认并行数
+		KeyBroadcastParallel: "5",
+	},
+	SectionAgentAlert: {
+		KeyAgentAlertCPUPercent:      "0",
+		KeyAgentAlertMemPercent:      "90",
+		KeyAgentAlertDiskPercent:     "90",
+		KeyAgentAlertOfflineMinutes:  "10",
+		KeyAgentAlertCooldownMinutes: "60",
+	},
+	SectionAgent: {
+		KeyAgentRequireApproval: "false",
 	},
 	SectionNotify: {
 		KeyNotifyPrefix: "[白虎面板]",
@@ -241,5 +368,19 @@ var DefaultSettings = map[string]map[string]string{
 		KeyNotifyTemplateTaskFailedText:   "任务 #{{task_id}} {{task_name}}\n状态: 失败\n执行时间: {{start_time}}\n原因: {{error}}\n最后输出: {{output}}",
 		KeyNotifyTemplateTaskTimeoutTitle: "任务[{{task_name}}] 超时",
 		KeyNotifyTemplateTaskTimeoutText:  "任务 #{{task_id}} {{task_name}}\n状态: 超时\n耗时: {{duration}}ms\n最后输出: {{output}}",
+		// Agent
+		KeyNotifyTemplateAgentResourceAlertTitle: "Agent[{{agent_name}}] {{metric_label}}过高",
+		KeyNotifyTemplateAgentResourceAlertText:  "Agent #{{agent_id}} {{agent_name}}\n{{metric_label}}: {{value}}%（阈值 {{threshold}}%）\n{{detail}}",
+		KeyNotifyTemplateAgentOfflineTitle:       "Agent[{{agent_name}}] 离线",
+		KeyNotifyTemplateAgentOfflineText:        "Agent #{{agent_id}} {{agent_name}}\n已离线 {{minutes}} 分钟\n最后心跳: {{last_seen}}",
+		KeyNotifyTemplateAgentPendingTitle:       "新 Agent[{{hostname}}] 等待审批",
+		KeyNotifyTemplateAgentPendingText:        "Agent #{{agent_id}} 通过令牌注册，审批通过前不会收到任务\n主机名: {{hostname}}\nIP: {{ip}}\n系统: {{os}}/{{arch}}\n机器码: {{machine_id}}",
+		KeyNotifyTemplateAgentReviewedTitle:      "Agent[{{agent_name}}] 审批{{result}}",
+		KeyNotifyTemplateAgentReviewedText:       "Agent #{{agent_id}} {{agent_name}}\n审批结果: {{result}}\n操作人: {{operator}} ({{operator_ip}})\n主机名: {{hostname}}\nIP: {{ip}}",
+		// 子节点任务
+		KeyNotifyTemplateRemoteTaskSuccessTitle: "子节点[{{node_name}}] 任务[{{task_name}}] 成功",
+		KeyNotifyTemplateRemoteTaskSuccessText:  "子节点 {{node_name}} 任务 #{{child_task_id}} {{task_name}}\n状态: 成功\n耗时: {{duration}}ms\n执行结果: {{output}}",
+		KeyNotifyTemplateRemoteTaskFailedTitle:  "子节点[{{node_name}}] 任务[{{task_name}}] {{status_label}}",
+		KeyNotifyTemplateRemoteTaskFailedText:   "子节点 {{node_name}} 任务 #{{child_task_id}} {{task_name}}\n状态: {{status_label}}\n执行时间: {{start_time}}\n原因: {{error}}\n最后输出: {{output}}",
 	},
 }
@@ -12,6 +12,8 @@ const (
 	KeyInterconnectParentURL   = "interconnect_parent_url"
 	KeyInterconnectParentToken = "interconnect_parent_token"
 	KeyInterconnectRole        = "interconnect_role"
+	// KeyInterconnectForwardTargets 子节点允许主节点端口转发连接的目标 IP 或网段，留空时只允许本机回环地址
+	KeyInterconnectForwardTargets = "interconnect_forward_targets"
 
 	// 互联角色
 	InterconnectRoleMaster = "master"
@@ -1,14 +1,24 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/agentsign"
 	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/eventbus"
 	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/middleware"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/models/vo"
 	"github.com/engigu/baihu-panel/internal/services"
@@ -28,6 +38,10 @@ type AgentController struct {
 	agentService    *services.AgentService
 	wsManager       *services.AgentWSManager
 	settingsService *services.SettingsService
+	fileSyncService *services.FileSyncService
+
+	sdkHandler http.Handler // 处理 Agent 转发的 SDK 调用，即面板自身的路由
+	sdkPrefix  string       // 面板的 URL 前缀
 }
 
 // NewAgentController 创建 Agent 控制器
@@ -36,13 +50,85 @@ func NewAgentController(settingsService *services.SettingsService) *AgentControl
 		agentService:    services.NewAgentService(),
 		wsManager:       services.GetAgentWSManager(),
 		settingsService: settingsService,
+		fileSyncService: services.NewFileSyncService(),
 	}
 }
 
+// SetSDKHandler 设置处理 Agent 转发 SDK 调用的路由，路由创建后调用
+func (c *AgentController) SetSDKHandler(handler http.Handler, urlPrefix string) {
+	c.sdkHandler = handler
+	c.sdkPrefix = urlPrefix
+}
+
 // List 获取 Agent 列表
 func (c *AgentController) List(ctx *gin.Context) {
 	agents := c.agentService.List()
-	utils.Success(ctx, vo.ToAgentVOListFromModels(agents))
+	utils.Success(ctx, c.withLoad(vo.ToAgentVOListFromModels(agents)))
+}
+
+// MatchSelector 预览标签选择器匹配到的 Agent
+func (c *AgentController) MatchSelector(ctx *gin.Context) {
+	selector, err := tasks.ParseAgentSelector(ctx.Query("selector"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	matched := make([]models.Agent, 0)
+	for _, agent := range c.agentService.List() {
+		if selector.Matches(agent.Labels) {
+			matched = append(matched, agent)
+		}
+	}
+	utils.Success(ctx, c.withLoad(vo.ToAgentVOListFromModels(matched)))
+}
+
+// withLoad 补充在线 Agent 最近上报的调度器负载与主机资源
+func (c *AgentController) withLoad(agents []*vo.AgentVO) []*vo.AgentVO {
+	for _, a := range agents {
+		if load, ok := c.wsManager.GetAgentLoad(a.ID); ok {
+			a.Load = &load
+		}
+		a.Metrics = c.wsManager.GetAgentMetrics(a.ID)
+	}
+	return agents
+}
+
+// GetMetricsHistory 获取 Agent 历史指标
+// @Summary 获取 Agent 历史指标
+// @Description 返回 Agent 心跳上报的 CPU、内存、磁盘、平均负载与调度器历史指标（每个点含平均值与最大值）。6 小时内为 1 分钟分辨率，更早为 10 分钟分辨率，最多保留 3 天，面板重启后重新记录
+// @Tags Agent
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Agent ID"
+// @Param range query string false "时间范围，如 1h、6h、3d，默认 1h"
+// @Param from query int false "开始时间（Unix 秒），指定后忽略 range"
+// @Param to query int false "结束时间（Unix 秒），默认当前时间"
+// @Param metrics query string false "逗号分隔的指标名称，默认全部"
+// @Success 200 {object} utils.Response{data=services.HostHistory}
+// @Failure 400 {object} utils.Response
+// @Router /agents/{id}/metrics [get]
+func (c *AgentController) GetMetricsHistory(ctx *gin.Context) {
+	agent := c.agentService.GetByID(ctx.Param("id"))
+	if agent == nil {
+		utils.NotFound(ctx, "Agent 不存在")
+		return
+	}
+	from, to, err := historyWindow(ctx)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	var names []string
+	if v := ctx.Query("metrics"); v != "" {
+		names = strings.Split(v, ",")
+	}
+	history, err := services.GetAgentMetricsService().History(agent.ID, from, to, names)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	utils.Success(ctx, history)
 }
 
 // getActiveSchedulerConfig 获取 Agent 的实际调度配置（若为空或零值，则使用系统默认的 settings）
@@ -81,6 +167,7 @@ func (c *AgentController) Update(ctx *gin.Context) {
 		Description     string                     `json:"description"`
 		Enabled         bool                       `json:"enabled"`
 		SchedulerConfig *vo.AgentSchedulerConfigVO `json:"scheduler_config"`
+		Labels          *models.AgentLabels        `json:"labels"` // 为空时保留原有标签
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -105,7 +192,16 @@ func (c *AgentController) Update(ctx *gin.Context) {
 		schedulerConfig.StrictQueue = req.SchedulerConfig.StrictQueue
 	}
 
-	if err := c.agentService.Update(id, req.Name, req.Description, req.Enabled, schedulerConfig); err != nil {
+	labels := oldAgent.Labels
+	if req.Labels != nil {
+		if err := tasks.ValidateAgentLabels(*req.Labels); err != nil {
+			utils.BadRequest(ctx, err.Error())
+			return
+		}
+		labels = *req.Labels
+	}
+
+	if err := c.agentService.Update(id, req.Name, req.Description, req.Enabled, schedulerConfig, labels); err != nil {
 		utils.ServerError(ctx, err.Error())
 		return
 	}
@@ -155,10 +251,132 @@ func (c *AgentController) Delete(ctx *gin.Context) {
 		utils.BadRequest(ctx, err.Error())
 		return
 	}
+	services.GetAgentMetricsService().Remove(id)
+	services.GetAgentRolloutService().RemoveAgent(id)
 
 	utils.SuccessMsg(ctx, "删除成功")
 }
 
+// ApproveAgent 通过 Agent 注册审批
+func (c *AgentController) ApproveAgent(ctx *gin.Context) {
+	c.reviewAgent(ctx, true)
+}
+
+// RejectAgent 拒绝 Agent 注册
+func (c *AgentController) RejectAgent(ctx *gin.Context) {
+	c.reviewAgent(ctx, false)
+}
+
+func (c *AgentController) reviewAgent(ctx *gin.Context, approve bool) {
+	id := ctx.Param("id")
+	if id == "" {
+		utils.BadRequest(ctx, "无效的 ID")
+		return
+	}
+
+	agent, err := c.agentService.Review(id, approve)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	result := "通过"
+	if approve {
+		// 通过：解除连接的等待状态并下发任务
+		if ac := c.wsManager.GetConnection(id); ac != nil {
+			ac.SetPending(false)
+			c.wsManager.SendToAgent(id, services.WSTypeEnabled, map[string]interface{}{
+				"message": "Agent 注册已通过审批",
+			})
+			c.wsManager.BroadcastTasks(id)
+		}
+	} else {
+		result = "拒绝"
+		// 拒绝：通知 Agent 后断开连接，之后的重连会被拒绝
+		if ac := c.wsManager.GetConnection(id); ac != nil {
+			ac.SetPending(true)
+			c.wsManager.SendToAgent(id, services.WSTypeDisabled, map[string]interface{}{
+				"message": "Agent 注册已被拒绝",
+			})
+			time.AfterFunc(time.Second, ac.Close)
+		}
+	}
+
+	username := ctx.GetString("username")
+	services.NewAppLogService().AddAuditLog(
+		fmt.Sprintf("%s Agent 注册: %s", result, agent.Name),
+		fmt.Sprintf("用户 %s 从 %s %s了 Agent #%s (%s, %s, 机器码 %s) 的注册", username, ctx.ClientIP(), result, agent.ID, agent.Hostname, agent.IP, agent.MachineID),
+		agent.ID,
+	)
+	eventbus.DefaultBus.Publish(eventbus.Event{
+		Type: constant.EventAgentReviewed,
+		Payload: map[string]interface{}{
+			"agent_id":    agent.ID,
+			"agent_name":  agent.Name,
+			"hostname":    agent.Hostname,
+			"ip":          agent.IP,
+			"result":      result,
+			"operator":    username,
+			"operator_ip": ctx.ClientIP(),
+		},
+	})
+
+	utils.SuccessMsg(ctx, "已"+result)
+}
+
+// RotateKey 要求在线 Agent 轮换端到端加密密钥，新公钥随下一次心跳上报
+func (c *AgentController) RotateKey(ctx *gin.Context) {
+	id := ctx.Param("id")
+	agent := c.agentService.GetByID(id)
+	if agent == nil {
+		utils.NotFound(ctx, "Agent 不存在")
+		return
+	}
+	if !c.wsManager.IsAgentOnline(id) {
+		utils.BadRequest(ctx, "Agent 不在线，无法轮换密钥")
+		return
+	}
+	if !c.wsManager.SupportsCapability(id, constant.AgentCapE2E) {
+		utils.BadRequest(ctx, "Agent 版本过旧，不支持机密端到端加密，请先升级 Agent")
+		return
+	}
+	challenge, err := c.agentService.BeginKeyRotation(agent)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	if err := c.wsManager.SendToAgent(id, services.WSTypeRotateKey, map[string]interface{}{"challenge": challenge}); err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	services.NewAppLogService().AddAuditLog(
+		fmt.Sprintf("轮换 Agent 密钥: %s", agent.Name),
+		fmt.Sprintf("用户 %s 从 %s 要求 Agent #%s (%s) 轮换端到端加密密钥，原公钥指纹 %s", ctx.GetString("username"), ctx.ClientIP(), agent.ID, agent.Name, agentcrypto.Fingerprint(agent.PublicKey)),
+		agent.ID,
+	)
+	utils.SuccessMsg(ctx, "已通知 Agent 轮换密钥")
+}
+
+// ApproveKey 批准 Agent 上报的新公钥，用于 Agent 丢失密钥文件等无法证明持有旧私钥的情况
+func (c *AgentController) ApproveKey(ctx *gin.Context) {
+	agent, err := c.agentService.ApprovePendingKey(ctx.Param("id"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	if c.wsManager.IsAgentOnline(agent.ID) {
+		go c.wsManager.BroadcastTasks(agent.ID)
+	}
+
+	services.NewAppLogService().AddAuditLog(
+		fmt.Sprintf("批准 Agent 新公钥: %s", agent.Name),
+		fmt.Sprintf("用户 %s 从 %s 批准 Agent #%s (%s) 的新公钥，指纹 %s", ctx.GetString("username"), ctx.ClientIP(), agent.ID, agent.Name, agentcrypto.Fingerprint(agent.PublicKey)),
+		agent.ID,
+	)
+	utils.SuccessMsg(ctx, "已批准新公钥")
+}
+
 // RegenerateToken 重新生成 Token
 func (c *AgentController) RegenerateToken(ctx *gin.Context) {
 	id := ctx.Param("id")
@@ -235,6 +453,11 @@ func (c *AgentController) Heartbeat(ctx *gin.Context) {
 	needUpdate := c.agentService.CheckNeedUpdate(req.Version, req.BuildTime)
 	forceUpdate := agent.ForceUpdate
 
+	if !agent.Approved() {
+		// 审批通过前不推送更新包
+		needUpdate, forceUpdate = false, false
+	}
+
 	// 如果强制更新已触发，重置标志
 	if forceUpdate && needUpdate {
 		c.agentService.ClearForceUpdate(agent.ID)
@@ -282,6 +505,11 @@ func (c *AgentController) GetTasks(ctx *gin.Context) {
 		return
 	}
 
+	if !agent.Approved() {
+		utils.Forbidden(ctx, "Agent 尚未通过注册审批")
+		return
+	}
+
 	tasks := c.agentService.GetTasks(agent.ID)
 	utils.Success(ctx, gin.H{
 		"agent_id": agent.ID,
@@ -308,6 +536,11 @@ func (c *AgentController) ReportResult(ctx *gin.Context) {
 		return
 	}
 
+	if !agent.Approved() {
+		utils.Forbidden(ctx, "Agent 尚未通过注册审批")
+		return
+	}
+
 	var result models.AgentTaskResult
 	if err := ctx.ShouldBindJSON(&result); err != nil {
 		utils.BadRequest(ctx, "参数错误")
@@ -349,6 +582,12 @@ func (c *AgentController) Download(ctx *gin.Context) {
 		return
 	}
 
+	// Agent 自更新前据此校验发布包，签名由 baihu agentsign sign 生成
+	ctx.Header("X-Agent-Version", c.agentService.GetLatestVersion())
+	ctx.Header("X-Agent-Sha256", agentsign.Checksum(data))
+	if sig := c.agentService.GetAgentSignature(filename); sig != "" {
+		ctx.Header("X-Agent-Signature", sig)
+	}
 	ctx.Header("Content-Disposition", "attachment; filename="+filename)
 	ctx.Header("Content-Type", "application/gzip")
 	ctx.Header("Content-Length", strconv.Itoa(len(data)))
@@ -382,6 +621,61 @@ func (c *AgentController) ForceUpdate(ctx *gin.Context) {
 	utils.SuccessMsg(ctx, "已标记强制更新，Agent 下次心跳时将自动更新")
 }
 
+// ========== 分批升级 ==========
+
+// ListRollouts 获取最近的分批升级记录
+func (c *AgentController) ListRollouts(ctx *gin.Context) {
+	utils.Success(ctx, services.GetAgentRolloutService().List(20))
+}
+
+// CreateRollout 创建分批升级，先升级金丝雀 Agent
+func (c *AgentController) CreateRollout(ctx *gin.Context) {
+	var req struct {
+		CanaryPercent int      `json:"canary_percent"`
+		CanaryIDs     []string `json:"canary_ids"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "参数错误")
+		return
+	}
+
+	rollout, err := services.GetAgentRolloutService().Create(req.CanaryPercent, req.CanaryIDs)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	utils.Success(ctx, rollout)
+}
+
+// GetRollout 获取分批升级详情
+func (c *AgentController) GetRollout(ctx *gin.Context) {
+	detail, err := services.GetAgentRolloutService().Detail(ctx.Param("id"))
+	if err != nil {
+		utils.NotFound(ctx, err.Error())
+		return
+	}
+	utils.Success(ctx, detail)
+}
+
+// PromoteRollout 金丝雀验证通过后升级其余 Agent
+func (c *AgentController) PromoteRollout(ctx *gin.Context) {
+	force := ctx.Query("force") == "true"
+	if err := services.GetAgentRolloutService().Promote(ctx.Param("id"), force); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	utils.SuccessMsg(ctx, "已开始升级其余 Agent")
+}
+
+// CancelRollout 取消分批升级
+func (c *AgentController) CancelRollout(ctx *gin.Context) {
+	if err := services.GetAgentRolloutService().Cancel(ctx.Param("id")); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+	utils.SuccessMsg(ctx, "已取消升级")
+}
+
 // ========== WebSocket ==========
 
 // WSConnect Agent WebSocket 连接
@@ -427,7 +721,14 @@ func (c *AgentController) WSConnect(ctx *gin.Context) {
 	if agent == nil {
 		logger.Infof("[AgentWS] 尝试注册新 Agent")
 		var err error
-		agent, isNewAgent, err = c.agentService.RegisterByToken(token, machineID, ip)
+		agent, isNewAgent, err = c.agentService.RegisterByToken(&models.AgentRegisterRequest{
+			Token:     token,
+			MachineID: machineID,
+			Hostname:  ctx.Query("hostname"),
+			OS:        ctx.Query("os"),
+			Arch:      ctx.Query("arch"),
+			Version:   ctx.Query("version"),
+		}, ip)
 		if err != nil {
 			c.wsManager.RecordConnectFail(ip)
 			logger.Warnf("[AgentWS] 注册失败: %v, IP=%s, token=%s", err, ip, token[:8]+"...")
@@ -444,6 +745,16 @@ func (c *AgentController) WSConnect(ctx *gin.Context) {
 		return
 	}
 
+	if agent.Approval == constant.AgentApprovalRejected {
+		c.wsManager.RecordConnectFail(ip)
+		logger.Warnf("[AgentWS] Agent #%s 注册已被拒绝, IP=%s", agent.ID, ip)
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Agent 注册已被拒绝"})
+		return
+	}
+
+	// 新版 Agent 连接时上报端到端加密公钥，首次上报即固定，之后的变化须经证明或批准
+	c.agentService.SetPublicKey(agent, ctx.Query("public_key"), "")
+
 	logger.Infof("[AgentWS] 准备升级连接: Agent #%s, IP=%s", agent.ID, ip)
 	conn, err := agentUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
@@ -457,6 +768,8 @@ func (c *AgentController) WSConnect(ctx *gin.Context) {
 
 	// 注册连接
 	ac := c.wsManager.Register(agent.ID, conn, ip)
+	pending := !agent.Approved()
+	ac.SetPending(pending)
 
 	// 更新 Agent 状态
 	c.agentService.Heartbeat(token, ip, "", "", "", "", "")
@@ -469,6 +782,9 @@ func (c *AgentController) WSConnect(ctx *gin.Context) {
 		"is_new_agent":     isNewAgent,
 		"machine_id":       machineID,
 		"scheduler_config": schedCfg,
+		"pending_approval": pending,
+		"protocol_version": constant.AgentProtocolVersion,
+		"capabilities":     agentproto.Local().Capabilities,
 	})
 
 	logger.Infof("[AgentWS] Agent #%s 连接成功 (配置: %v)", agent.ID, schedCfg)
@@ -477,8 +793,10 @@ func (c *AgentController) WSConnect(ctx *gin.Context) {
 	go c.wsWritePump(ac)
 	go c.wsReadPump(ac, agent)
 
-	// 主动推送任务列表
-	go c.wsManager.BroadcastTasks(agent.ID)
+	// 主动推送任务列表，等待审批的 Agent 审批通过后再推送
+	if !pending {
+		go c.wsManager.BroadcastTasks(agent.ID)
+	}
 }
 
 // wsReadPump 读取消息
@@ -561,7 +879,15 @@ func (c *AgentController) wsWritePump(ac *services.AgentConnection) {
 
 // handleWSMessage 处理 WebSocket 消息
 func (c *AgentController) handleWSMessage(ac *services.AgentConnection, agent *models.Agent, msg *services.WSMessage) {
+	// 等待审批的 Agent 只保持握手与心跳
+	if ac.Pending() && msg.Type != services.WSTypeHeartbeat && msg.Type != services.WSTypeHello {
+		return
+	}
+
 	switch msg.Type {
+	case services.WSTypeHello:
+		c.handleHello(ac, agent, msg.Data)
+
 	case services.WSTypeHeartbeat:
 		c.handleHeartbeat(ac, agent, msg.Data)
 
@@ -576,9 +902,151 @@ func (c *AgentController) handleWSMessage(ac *services.AgentConnection, agent *m
 
 	case services.WSTypeTaskHeartbeat: // 任务心跳
 		c.handleTaskHeartbeat(agent, msg.Data)
+
+	case services.WSTypeFileSync: // 文件同步，计算哈希与压缩可能较慢，不阻塞读循环
+		go c.handleFileSync(agent, msg.Data)
+
+	case services.WSTypeSDKRequest: // 任务脚本的 SDK 调用，不阻塞读循环
+		go c.handleSDKRequest(agent, msg.Data)
+
+	case services.WSTypeSDKGrantRequest:
+		c.handleSDKGrantRequest(agent, msg.Data)
+
+	case services.WSTypeTerminalOutput, services.WSTypeTerminalExit: // 远程终端
+		c.wsManager.HandleTerminalMessage(agent.ID, msg.Type, msg.Data)
+
+	case services.WSTypeCommandOutput, services.WSTypeCommandResult: // 一次性命令（远程安装依赖等）
+		c.wsManager.HandleCommandMessage(agent.ID, msg.Type, msg.Data)
+
+	case services.WSTypeRuntimes:
+		c.wsManager.UpdateAgentRuntimes(agent.ID, msg.Data)
+
+	case services.WSTypeUpdateResult:
+		c.handleUpdateResult(agent, msg.Data)
 	}
 }
 
+// handleUpdateResult 处理 Agent 上报的自更新结果（校验失败、新版本连接成功或已回滚）
+func (c *AgentController) handleUpdateResult(agent *models.Agent, data json.RawMessage) {
+	var result struct {
+		FromVersion string `json:"from_version"`
+		Version     string `json:"version"`
+		Success     bool   `json:"success"`
+		Error       string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return
+	}
+	if result.Success {
+		logger.Infof("[AgentWS] Agent #%s 已从 %s 更新到 %s", agent.ID, result.FromVersion, result.Version)
+	} else {
+		logger.Warnf("[AgentWS] Agent #%s 更新到 %s 失败: %s", agent.ID, result.Version, result.Error)
+	}
+	services.GetAgentRolloutService().HandleUpdateResult(agent.ID, result.Success, result.Version, result.Error)
+}
+
+// handleFileSync 返回任务所需文件的清单及 Agent 缺少的内容
+func (c *AgentController) handleFileSync(agent *models.Agent, data json.RawMessage) {
+	var req struct {
+		RequestID string   `json:"request_id"`
+		TaskID    string   `json:"task_id"`
+		Have      []string `json:"have"` // Agent 本地已缓存的内容哈希
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		logger.Errorf("[AgentWS] 解析文件同步请求失败: %v", err)
+		return
+	}
+
+	bundle := c.fileSyncService.Bundle(agent, req.TaskID, req.Have)
+	bundle.RequestID = req.RequestID
+	if bundle.Error != "" {
+		logger.Warnf("[AgentWS] Agent #%s 同步任务 #%s 文件失败: %s", agent.ID, req.TaskID, bundle.Error)
+	} else {
+		logger.Infof("[AgentWS] Agent #%s 同步任务 #%s 文件: 共 %d 个，下发 %d 个", agent.ID, req.TaskID, len(bundle.Files), len(bundle.Blobs))
+	}
+	c.wsManager.SendToAgent(agent.ID, services.WSTypeFileBundle, bundle)
+}
+
+// handleSDKRequest 处理 Agent 代任务脚本转发的 SDK 调用，按面板自身的接口处理后原样返回
+func (c *AgentController) handleSDKRequest(agent *models.Agent, data json.RawMessage) {
+	var req models.AgentSDKRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		logger.Errorf("[AgentWS] 解析 SDK 调用失败: %v", err)
+		return
+	}
+
+	resp := c.serveSDKRequest(agent, &req)
+	resp.RequestID = req.RequestID
+	c.wsManager.SendToAgent(agent.ID, services.WSTypeSDKResponse, resp)
+}
+
+// handleSDKGrantRequest 为 Agent 本地定时触发的执行签发 SDK 转发凭证，与执行指令中的凭证一样按 Agent 公钥加密
+func (c *AgentController) handleSDKGrantRequest(agent *models.Agent, data json.RawMessage) {
+	var req models.AgentSDKGrantRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		logger.Errorf("[AgentWS] 解析 SDK 凭证申请失败: %v", err)
+		return
+	}
+
+	resp := models.AgentSDKGrantResponse{RequestID: req.RequestID}
+	token, err := tasks.IssueAgentSDKGrant(agent.ID, req.TaskID, req.LogID)
+	if err == nil {
+		// 重新读取公钥，连接期间 Agent 可能已轮换密钥
+		if current := c.agentService.GetByID(agent.ID); current != nil && current.PublicKey != "" {
+			sealed, sealErr := agentcrypto.Encrypt(current.PublicKey, token)
+			if sealErr != nil {
+				tasks.RevokeSDKGrant(token)
+				token, err = "", sealErr
+			} else {
+				token = sealed
+			}
+		}
+	}
+	if err != nil {
+		logger.Warnf("[AgentWS] 拒绝 Agent #%s 为任务 #%s 申请 SDK 凭证: %v", agent.ID, req.TaskID, err)
+		resp.Error = err.Error()
+	} else {
+		resp.Token = token
+	}
+	c.wsManager.SendToAgent(agent.ID, services.WSTypeSDKGrant, resp)
+}
+
+func (c *AgentController) serveSDKRequest(agent *models.Agent, req *models.AgentSDKRequest) *models.AgentSDKResponse {
+	reject := func(code int, msg string) *models.AgentSDKResponse {
+		body, _ := json.Marshal(utils.Response{Code: code, Msg: msg})
+		return &models.AgentSDKResponse{Status: http.StatusOK, Body: body}
+	}
+
+	// 只接受面板为这台 Agent 上仍在进行的执行签发的凭证
+	grant, ok := tasks.LookupSDKGrant(req.Token)
+	if !ok || grant.AgentID != agent.ID || grant.LogID != req.LogID {
+		logger.Warnf("[AgentWS] Agent #%s 转发的 SDK 调用凭证无效: 任务 #%s 执行 #%s", agent.ID, req.TaskID, req.LogID)
+		return reject(401, "运行凭证无效或任务已结束")
+	}
+
+	target, err := url.Parse(req.Path)
+	if err != nil || !agentproto.SDKRelayAllowed(target.Path) {
+		logger.Warnf("[AgentWS] Agent #%s 转发了不允许的 SDK 调用: %s %s", agent.ID, req.Method, req.Path)
+		return reject(403, "不允许转发该接口")
+	}
+	if c.sdkHandler == nil {
+		return reject(503, "面板未就绪")
+	}
+
+	ctx := middleware.WithSDKRelay(context.Background(), grant)
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, c.sdkPrefix+target.RequestURI(), bytes.NewReader(req.Body))
+	if err != nil {
+		return reject(400, err.Error())
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.RemoteAddr = "127.0.0.1:0"
+
+	rec := httptest.NewRecorder()
+	c.sdkHandler.ServeHTTP(rec, httpReq)
+	logger.Infof("[AgentWS] Agent #%s 任务 #%s 转发 SDK 调用 %s %s: %d", agent.ID, grant.TaskID, req.Method, target.Path, rec.Code)
+	return &models.AgentSDKResponse{Status: rec.Code, Body: rec.Body.Bytes()}
+}
+
 // handleTaskHeartbeat 处理任务心跳
 func (c *AgentController) handleTaskHeartbeat(_ *models.Agent, data json.RawMessage) {
 	var req struct {
@@ -613,10 +1081,27 @@ func (c *AgentController) handleHeartbeat(ac *services.AgentConnection, agent *m
 		OS         string `json:"os"`
 		Arch       string `json:"arch"`
 		AutoUpdate bool   `json:"auto_update"`
+
+		Load      *models.AgentLoad        `json:"load"`       // 调度器负载，旧版 Agent 不上报
+		Metrics   *models.AgentHostMetrics `json:"metrics"`    // 主机资源，旧版 Agent 不上报
+		PublicKey string                   `json:"public_key"` // 端到端加密公钥，旧版 Agent 不上报
+		KeyProof  string                   `json:"key_proof"`  // 轮换后回传的挑战明文，证明持有旧私钥
 	}
 	json.Unmarshal(data, &req)
 
 	ac.UpdatePing()
+	if req.Load != nil {
+		ac.SetLoad(*req.Load)
+	}
+	if req.Metrics != nil {
+		ac.SetMetrics(*req.Metrics)
+	}
+	services.GetAgentMetricsService().Record(agent, req.Metrics, req.Load)
+
+	// 公钥轮换后用新公钥重新下发任务
+	if c.agentService.SetPublicKey(agent, req.PublicKey, req.KeyProof) {
+		go c.wsManager.BroadcastTasks(agent.ID)
+	}
 
 	// 更新 Agent 信息（使用连接时保存的 IP）
 	c.agentService.Heartbeat(agent.Token, ac.IP, req.Version, req.BuildTime, req.Hostname, req.OS, req.Arch)
@@ -625,6 +1110,15 @@ func (c *AgentController) handleHeartbeat(ac *services.AgentConnection, agent *m
 	latestVersion := c.agentService.GetLatestVersion()
 	needUpdate := c.agentService.CheckNeedUpdate(req.Version, req.BuildTime)
 	forceUpdate := agent.ForceUpdate
+	if !forceUpdate {
+		// 分批升级进行中时由升级计划决定哪些 Agent 更新
+		needUpdate = services.GetAgentRolloutService().Heartbeat(agent.ID, needUpdate)
+	}
+
+	if ac.Pending() {
+		// 审批通过前不推送更新包
+		needUpdate, forceUpdate = false, false
+	}
 
 	if forceUpdate && needUpdate {
 		c.agentService.ClearForceUpdate(agent.ID)
@@ -641,6 +1135,20 @@ func (c *AgentController) handleHeartbeat(ac *services.AgentConnection, agent *m
 	c.wsManager.SendToAgent(agent.ID, services.WSTypeHeartbeatAck, response)
 }
 
+// handleHello 记录 Agent 握手上报的协议版本与能力
+func (c *AgentController) handleHello(ac *services.AgentConnection, agent *models.Agent, data json.RawMessage) {
+	var hello agentproto.Hello
+	if err := json.Unmarshal(data, &hello); err != nil {
+		return
+	}
+	peer := agentproto.Negotiate(hello)
+	ac.SetPeer(peer)
+	if err := c.agentService.SetProtocol(agent.ID, peer); err != nil {
+		logger.Warnf("[AgentWS] 保存 Agent #%s 协议信息失败: %v", agent.ID, err)
+	}
+	logger.Infof("[AgentWS] Agent #%s 握手: 协议版本 %d，能力 %v", agent.ID, peer.ProtocolVersion, peer.Capabilities)
+}
+
 // handleTaskResult 处理任务结果
 func (c *AgentController) handleTaskResult(agent *models.Agent, data json.RawMessage) {
 	var result models.AgentTaskResult
@@ -649,7 +1157,16 @@ func (c *AgentController) handleTaskResult(agent *models.Agent, data json.RawMes
 	}
 
 	result.AgentID = agent.ID
-	c.agentService.ReportResult(&result)
+	// 执行已结束，吊销 Agent 为其申请的 SDK 凭证
+	tasks.RevokeSDKGrantsForLog(agent.ID, result.LogID)
+	if err := c.agentService.ReportResult(&result); err != nil {
+		logger.Errorf("[AgentWS] 保存 Agent #%s 任务结果失败: %v", agent.ID, err)
+		return
+	}
+	// 补传的结果保存成功后才确认，Agent 收到确认再删除本地缓存
+	if result.SpooledAt > 0 && result.LogID != "" {
+		c.wsManager.SendToAgent(agent.ID, services.WSTypeTaskResultAck, map[string]string{"log_id": result.LogID})
+	}
 }
 
 // handleTaskLog 处理 Agent 发送的实时日志
@@ -657,6 +1174,7 @@ func (c *AgentController) handleTaskLog(_ *models.Agent, data json.RawMessage) {
 	var logMsg struct {
 		LogID   string `json:"log_id"`
 		Content string `json:"content"`
+		Stream  string `json:"stream"` // 可选，stdout/stderr/system，缺省为 stdout
 	}
 	if err := json.Unmarshal(data, &logMsg); err != nil {
 		logger.Errorf("[AgentWS] 解析日志消息失败: %v", err)
@@ -665,7 +1183,8 @@ func (c *AgentController) handleTaskLog(_ *models.Agent, data json.RawMessage) {
 
 	tl := tasks.GetActiveLog(logMsg.LogID)
 	if tl != nil {
-		tl.Write([]byte(logMsg.Content))
+		stream, _, _ := tasks.ParseLogStream(logMsg.Stream)
+		tl.Stream(stream).Write([]byte(logMsg.Content))
 	} else {
 		logger.Warnf("[AgentWS] 收到任务日志 but could not find active TinyLog: LogID=%s, ContentSize=%d", logMsg.LogID, len(logMsg.Content))
 	}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/services"
+	"github.com/engigu/baihu-panel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// HandleAgentWebSocket 在 Agent 上打开远程终端，会话经由 Agent 已有的 WebSocket 连接复用
+// 与本机终端使用相同的前端协议：文本为输入，{"type":"resize"} 为调整窗口大小
+func (tc *TerminalController) HandleAgentWebSocket(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	writeError := func(msg string) {
+		conn.WriteMessage(websocket.TextMessage, []byte("\r\n\033[1;31m"+msg+"\033[0m\r\n"))
+	}
+
+	if constant.DemoMode {
+		conn.WriteMessage(websocket.TextMessage, []byte("\r\n\033[1;33m[演示模式] 终端功能已禁用\033[0m\r\n"))
+		return
+	}
+
+	agent := services.NewAgentService().GetByID(c.Param("id"))
+	if agent == nil {
+		writeError("Agent 不存在")
+		return
+	}
+	if !utils.DerefBool(agent.Enabled, true) {
+		writeError("Agent 已禁用")
+		return
+	}
+
+	wsManager := services.GetAgentWSManager()
+	session, err := wsManager.OpenTerminal(agent.ID, 24, 80)
+	if err != nil {
+		writeError(err.Error())
+		return
+	}
+
+	// 审计：记录谁在何时从哪里打开了哪个 Agent 的终端
+	username := c.GetString("username")
+	startedAt := time.Now()
+	appLogService := services.NewAppLogService()
+	appLogService.AddAuditLog(
+		fmt.Sprintf("打开 Agent 终端: %s", agent.Name),
+		fmt.Sprintf("用户 %s 从 %s 打开了 Agent #%s (%s) 的远程终端，会话 %s", username, c.ClientIP(), agent.ID, agent.Name, session.ID),
+		agent.ID,
+	)
+	defer func() {
+		appLogService.AddAuditLog(
+			fmt.Sprintf("关闭 Agent 终端: %s", agent.Name),
+			fmt.Sprintf("用户 %s 关闭了 Agent #%s (%s) 的远程终端，会话 %s，持续 %s", username, agent.ID, agent.Name, session.ID, time.Since(startedAt).Round(time.Second)),
+			agent.ID,
+		)
+	}()
+
+	conn.SetReadLimit(constant.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(constant.PongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(constant.PongWait))
+		return nil
+	})
+
+	conn.WriteMessage(websocket.TextMessage, []byte("__PTY_MODE__"))
+
+	var connMu sync.Mutex
+	writeMessage := func(messageType int, data []byte) error {
+		connMu.Lock()
+		defer connMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteMessage(messageType, data)
+	}
+
+	// 转发 Agent 输出，会话结束（进程退出或 Agent 断开）时关闭浏览器连接
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		ticker := time.NewTicker(constant.PingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case data := <-session.Output:
+				if writeMessage(websocket.TextMessage, []byte(data)) != nil {
+					return
+				}
+			case <-ticker.C:
+				if writeMessage(websocket.PingMessage, nil) != nil {
+					return
+				}
+			case <-session.Done:
+				// 先输出已到达的内容
+			drain:
+				for {
+					select {
+					case data := <-session.Output:
+						writeMessage(websocket.TextMessage, []byte(data))
+					default:
+						break drain
+					}
+				}
+				if session.ExitErr != "" {
+					writeMessage(websocket.TextMessage, []byte("\r\n\033[1;31m"+session.ExitErr+"\033[0m\r\n"))
+				} else {
+					writeMessage(websocket.TextMessage, []byte("\r\n\033[1;33m[终端会话已结束]\033[0m\r\n"))
+				}
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		if len(message) > 0 && message[0] == '{' {
+			var resizeMsg struct {
+				Type string `json:"type"`
+				Rows uint16 `json:"rows"`
+				Cols uint16 `json:"cols"`
+			}
+			if err := json.Unmarshal(message, &resizeMsg); err == nil && resizeMsg.Type == "resize" {
+				wsManager.ResizeTerminal(session, resizeMsg.Rows, resizeMsg.Cols)
+				continue
+			}
+		}
+
+		// Ctrl+C 等控制字符原样转发，由 Agent 端的 PTY 转换为信号
+		wsManager.SendTerminalInput(session, string(message))
+	}
+
+	wsManager.CloseTerminal(session)
+	<-relayDone
+}
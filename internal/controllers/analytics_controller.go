@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+	"github.com/engigu/baihu-panel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnalyticsController struct {
+	analyticsService *tasks.TaskAnalyticsService
+}
+
+func NewAnalyticsController(analyticsService *tasks.TaskAnalyticsService) *AnalyticsController {
+	return &AnalyticsController{analyticsService: analyticsService}
+}
+
+// GetTaskAnalytics 获取任务运行分析
+// @Summary 获取任务运行分析
+// @Description 返回任务最近 24 小时、7 天、30 天的成功率、耗时分位数（p50/p95/max）与波动度，以及每日成功率趋势和星期×小时的失败热力图
+// @Tags 运行分析
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "任务ID"
+// @Param days query int false "每日趋势与热力图覆盖的天数，默认 30，最大 365"
+// @Success 200 {object} utils.Response{data=tasks.TaskAnalytics}
+// @Failure 404 {object} utils.Response
+// @Router /analytics/tasks/{id} [get]
+func (ac *AnalyticsController) GetTaskAnalytics(c *gin.Context) {
+	result, err := ac.analyticsService.TaskAnalytics(c.Param("id"), utils.ToInt(c.Query("days"), 30))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	if result == nil {
+		utils.NotFound(c, "任务不存在")
+		return
+	}
+	utils.Success(c, result)
+}
+
+// GetTagAnalytics 获取标签运行分析
+// @Summary 获取标签运行分析
+// @Description 合并带有该标签的全部任务，返回与单个任务相同结构的运行分析
+// @Tags 运行分析
+// @Produce json
+// @Security BearerAuth
+// @Param tag path string true "标签名"
+// @Param days query int false "每日趋势与热力图覆盖的天数，默认 30，最大 365"
+// @Success 200 {object} utils.Response{data=tasks.TaskAnalytics}
+// @Router /analytics/tags/{tag} [get]
+func (ac *AnalyticsController) GetTagAnalytics(c *gin.Context) {
+	result, err := ac.analyticsService.TagAnalytics(c.Param("tag"), utils.ToInt(c.Query("days"), 30))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, result)
+}
+
+// GetRanking 获取任务运行排行
+// @Summary 获取任务运行排行
+// @Description 按失败次数、失败率、平均耗时或波动度列出最近若干天内的任务，失败率与波动度排行只统计至少运行 3 次的任务
+// @Tags 运行分析
+// @Produce json
+// @Security BearerAuth
+// @Param sort query string false "排行方式：failures、failure_rate、slowest、flaky，默认 failures"
+// @Param days query int false "统计天数，默认 30，最大 365"
+// @Param tag query string false "只在该标签的任务中排行"
+// @Param limit query int false "返回的任务数，默认 10，最大 100"
+// @Success 200 {object} utils.Response{data=[]tasks.AnalyticsRankItem}
+// @Failure 400 {object} utils.Response
+// @Router /analytics/ranking [get]
+func (ac *AnalyticsController) GetRanking(c *gin.Context) {
+	items, err := ac.analyticsService.Ranking(utils.ToInt(c.Query("days"), 30), c.Query("sort"), c.Query("tag"), utils.ToInt(c.Query("limit"), 10))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, items)
+}
+
+// Rebuild 重建运行预聚合
+// @Summary 重建运行预聚合
+// @Description 清空并根据现存的运行日志重新计算分析所用的小时预聚合，已被清理的日志无法计入
+// @Tags 运行分析
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response
+// @Router /analytics/rebuild [post]
+func (ac *AnalyticsController) Rebuild(c *gin.Context) {
+	if err := ac.analyticsService.Rebuild(); err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessMsg(c, "重建完成")
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/models/vo"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+	"github.com/engigu/baihu-panel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BroadcastController struct {
+	broadcastService *tasks.BroadcastService
+}
+
+func NewBroadcastController(broadcastService *tasks.BroadcastService) *BroadcastController {
+	return &BroadcastController{broadcastService: broadcastService}
+}
+
+// Start 发起广播运行
+// @Summary 发起广播运行
+// @Description 在所有匹配选择器的在线 Agent 上同时执行任务，每个 Agent 生成一条子日志，按并行上限分批派发
+// @Tags 广播运行
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body vo.BroadcastStartReq true "广播参数"
+// @Success 200 {object} utils.Response{data=vo.BroadcastRunVO}
+// @Failure 400 {object} utils.Response
+// @Router /broadcasts [post]
+func (bc *BroadcastController) Start(c *gin.Context) {
+	var req vo.BroadcastStartReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+	run, err := bc.broadcastService.Start(req.TaskID, req.Selector, req.MaxParallel)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	names := bc.broadcastService.TaskNames([]models.BroadcastRun{*run})
+	utils.Success(c, vo.ToBroadcastRunVO(run, names[run.TaskID]))
+}
+
+// List 广播运行列表
+// @Summary 广播运行列表
+// @Description 分页返回广播运行，按创建时间倒序
+// @Tags 广播运行
+// @Produce json
+// @Security BearerAuth
+// @Param task_id query string false "只看该任务的广播运行"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} utils.Response{data=utils.PaginationData{data=[]vo.BroadcastRunVO}}
+// @Router /broadcasts [get]
+func (bc *BroadcastController) List(c *gin.Context) {
+	p := utils.ParsePagination(c)
+	runs, total, err := bc.broadcastService.List(c.Query("task_id"), p.Page, p.PageSize)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	names := bc.broadcastService.TaskNames(runs)
+	items := make([]*vo.BroadcastRunVO, len(runs))
+	for i := range runs {
+		items[i] = vo.ToBroadcastRunVO(&runs[i], names[runs[i].TaskID])
+	}
+	utils.PaginatedResponse(c, items, total, p)
+}
+
+// Detail 广播运行详情
+// @Summary 广播运行详情
+// @Description 返回广播运行的聚合状态与每个 Agent 的子日志（不含输出，输出通过日志详情获取）
+// @Tags 广播运行
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "广播运行ID"
+// @Success 200 {object} utils.Response{data=vo.BroadcastRunDetailVO}
+// @Failure 404 {object} utils.Response
+// @Router /broadcasts/{id} [get]
+func (bc *BroadcastController) Detail(c *gin.Context) {
+	detail, err := bc.broadcastService.Detail(c.Param("id"))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	if detail == nil {
+		utils.NotFound(c, "广播运行不存在")
+		return
+	}
+	names := bc.broadcastService.TaskNames([]models.BroadcastRun{*detail.Run})
+	utils.Success(c, vo.BroadcastRunDetailVO{
+		Run:  vo.ToBroadcastRunVO(detail.Run, names[detail.Run.TaskID]),
+		Logs: vo.ToTaskLogVOListFromModels(detail.Logs),
+	})
+}
+
+// Stop 停止广播运行
+// @Summary 停止广播运行
+// @Description 向正在执行的 Agent 下发停止指令，尚未派发的目标直接标记为取消
+// @Tags 广播运行
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "广播运行ID"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response
+// @Router /broadcasts/{id}/stop [post]
+func (bc *BroadcastController) Stop(c *gin.Context) {
+	if err := bc.broadcastService.Stop(c.Param("id")); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessMsg(c, "已停止")
+}
@@ -28,7 +28,7 @@ func NewDependencyController() *DependencyController {
 func (c *DependencyController) List(ctx *gin.Context) {
 	language := ctx.Query("language")
 	langVersion := ctx.Query("lang_version")
-	deps, err := c.service.List(language, langVersion)
+	deps, err := c.service.List(language, langVersion, ctx.Query("agent_id"))
 	if err != nil {
 		utils.ServerError(ctx, "获取依赖列表失败")
 		return
@@ -44,6 +44,7 @@ func (c *DependencyController) Create(ctx *gin.Context) {
 		Version     string `json:"version"`
 		Language    string `json:"language" binding:"required"`
 		LangVersion string `json:"lang_version"`
+		AgentID     string `json:"agent_id"`
 		Remark      string `json:"remark"`
 	}
 
@@ -57,6 +58,7 @@ func (c *DependencyController) Create(ctx *gin.Context) {
 		Version:     req.Version,
 		Language:    req.Language,
 		LangVersion: req.LangVersion,
+		AgentID:     req.AgentID,
 		Remark:      req.Remark,
 	}
 
@@ -90,6 +92,7 @@ func (c *DependencyController) Install(ctx *gin.Context) {
 		Version     string `json:"version"`
 		Language    string `json:"language"`
 		LangVersion string `json:"lang_version"`
+		AgentID     string `json:"agent_id"` // 在指定 Agent 上安装
 		Remark      string `json:"remark"`
 	}
 
@@ -107,11 +110,17 @@ func (c *DependencyController) Install(ctx *gin.Context) {
 		langVersion = ctx.Query("lang_version")
 	}
 
+	agentID := req.AgentID
+	if agentID == "" {
+		agentID = ctx.Query("agent_id")
+	}
+
 	dep := &models.Dependency{
 		Name:        req.Name,
 		Version:     req.Version,
 		Language:    language,
 		LangVersion: langVersion,
+		AgentID:     agentID,
 		Remark:      req.Remark,
 	}
 
@@ -194,15 +203,7 @@ func (c *DependencyController) Uninstall(ctx *gin.Context) {
 	force := ctx.Query("force") == "true"
 
 	// 获取依赖信息
-	deps, _ := c.service.List("", "")
-	var dep *models.Dependency
-	for i := range deps {
-		if deps[i].ID == id {
-			dep = &deps[i]
-			break
-		}
-	}
-
+	dep := c.service.GetByID(id)
 	if dep == nil {
 		utils.NotFound(ctx, "依赖不存在")
 		return
@@ -230,15 +231,7 @@ func (c *DependencyController) Reinstall(ctx *gin.Context) {
 	}
 
 	// 获取依赖信息
-	deps, _ := c.service.List("", "")
-	var dep *models.Dependency
-	for i := range deps {
-		if deps[i].ID == id {
-			dep = &deps[i]
-			break
-		}
-	}
-
+	dep := c.service.GetByID(id)
 	if dep == nil {
 		utils.NotFound(ctx, "依赖不存在")
 		return
@@ -264,7 +257,7 @@ func (c *DependencyController) ReinstallAll(ctx *gin.Context) {
 		return
 	}
 
-	deps, err := c.service.List(language, langVersion)
+	deps, err := c.service.List(language, langVersion, ctx.Query("agent_id"))
 	if err != nil {
 		utils.ServerError(ctx, "获取依赖列表失败")
 		return
@@ -3,6 +3,7 @@ package controllers
 import (
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/middleware"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/models/vo"
 	"github.com/engigu/baihu-panel/internal/services"
@@ -120,6 +121,12 @@ func (ec *EnvController) GetEnvVars(c *gin.Context) {
 // @Success 200 {object} utils.Response{data=[]vo.EnvVO}
 // @Router /env/all [get]
 func (ec *EnvController) GetAllEnvVars(c *gin.Context) {
+	// Agent 转发的脚本调用只返回所属任务可访问的变量
+	if grant, ok := middleware.SDKRelayGrant(c); ok {
+		all, ids := grant.EnvScope()
+		utils.Success(c, vo.ToEnvVOListFromModels(ec.envService.GetEnvVarsInScope(all, ids)))
+		return
+	}
 	userID := c.GetString("userID")
 	envVars := ec.envService.GetEnvVarsByUserID(userID)
 	utils.Success(c, vo.ToEnvVOListFromModels(envVars))
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/federation"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/services"
 	"github.com/engigu/baihu-panel/internal/tunnel"
@@ -391,6 +392,243 @@ func (ic *InterconnectController) SyncTask(c *gin.Context) {
 	utils.Success(c, results)
 }
 
+// FederatedTasks 聚合所有在线子节点的任务列表
+func (ic *InterconnectController) FederatedTasks(c *gin.Context) {
+	limit := federatedLimit(c, 50)
+	utils.Success(c, federation.GetService().Tasks(c.Query("name"), c.Query("tags"), limit))
+}
+
+// FederatedFailures 聚合所有在线子节点最近的失败执行，status 可选 failed（默认）或 timeout
+func (ic *InterconnectController) FederatedFailures(c *gin.Context) {
+	status := c.DefaultQuery("status", constant.TaskStatusFailed)
+	if status != constant.TaskStatusFailed && status != constant.TaskStatusTimeout {
+		utils.BadRequest(c, "无效的状态")
+		return
+	}
+	utils.Success(c, federation.GetService().Failures(status, federatedLimit(c, 50)))
+}
+
+// FederatedLogSearch 在所有在线子节点上检索日志，参数与 /logs/search 一致
+func (ic *InterconnectController) FederatedLogSearch(c *gin.Context) {
+	if strings.TrimSpace(c.Query("keyword")) == "" {
+		utils.BadRequest(c, "检索关键字不能为空")
+		return
+	}
+	query := c.Request.URL.Query()
+	utils.Success(c, federation.GetService().SearchLogs(query, federatedLimit(c, 20)))
+}
+
+// federatedLimit 读取 limit 参数，限制在 1~100 之间
+func federatedLimit(c *gin.Context, def int) int {
+	limit := utils.ToInt(c.Query("limit"), def)
+	if limit <= 0 || limit > 100 {
+		return def
+	}
+	return limit
+}
+
+// GetManagedSyncs 获取托管同步规则列表
+func (ic *InterconnectController) GetManagedSyncs(c *gin.Context) {
+	utils.Success(c, federation.GetManagedSyncService().ListRules())
+}
+
+// SaveManagedSync 新建或更新托管同步规则
+func (ic *InterconnectController) SaveManagedSync(c *gin.Context) {
+	var rule models.ManagedSync
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	rule.ID = c.Param("id")
+	if rule.ID != "" {
+		if _, err := federation.GetManagedSyncService().GetRule(rule.ID); err != nil {
+			utils.NotFound(c, err.Error())
+			return
+		}
+	}
+	if err := federation.GetManagedSyncService().SaveRule(&rule); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, rule)
+}
+
+// DeleteManagedSync 删除托管同步规则，子节点上已同步的副本保留
+func (ic *InterconnectController) DeleteManagedSync(c *gin.Context) {
+	if err := federation.GetManagedSyncService().DeleteRule(c.Param("id")); err != nil {
+		utils.ServerError(c, "删除托管同步规则失败")
+		return
+	}
+	utils.Success(c, nil)
+}
+
+// PlanManagedSync 预览托管同步规则在各子节点上的同步动作，不做任何修改
+func (ic *InterconnectController) PlanManagedSync(c *gin.Context) {
+	rule, err := federation.GetManagedSyncService().GetRule(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+	utils.Success(c, federation.GetManagedSyncService().Plan(rule))
+}
+
+// RunManagedSync 立即执行一次托管同步，返回各子节点的执行结果
+func (ic *InterconnectController) RunManagedSync(c *gin.Context) {
+	rule, err := federation.GetManagedSyncService().GetRule(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+	plans, _ := federation.GetManagedSyncService().Sync(rule)
+	utils.Success(c, plans)
+}
+
+// GetManagedSyncStates 获取托管同步规则的漂移与冲突报告
+func (ic *InterconnectController) GetManagedSyncStates(c *gin.Context) {
+	utils.Success(c, federation.GetManagedSyncService().States(c.Param("id")))
+}
+
+// GetForwards 获取端口转发列表及运行状态、流量统计
+func (ic *InterconnectController) GetForwards(c *gin.Context) {
+	utils.Success(c, tunnel.GetForwardManager().List())
+}
+
+// SaveForward 新建或更新端口转发
+func (ic *InterconnectController) SaveForward(c *gin.Context) {
+	var forward models.TunnelForward
+	if err := c.ShouldBindJSON(&forward); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	forward.ID = c.Param("id")
+	if err := tunnel.GetForwardManager().Save(&forward); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, forward)
+}
+
+// ToggleForward 启用或停用端口转发
+func (ic *InterconnectController) ToggleForward(c *gin.Context) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if err := tunnel.GetForwardManager().SetEnabled(c.Param("id"), req.Enabled); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, nil)
+}
+
+// DeleteForward 删除端口转发，活跃连接会被断开
+func (ic *InterconnectController) DeleteForward(c *gin.Context) {
+	if err := tunnel.GetForwardManager().Delete(c.Param("id")); err != nil {
+		utils.ServerError(c, "删除端口转发失败")
+		return
+	}
+	utils.Success(c, nil)
+}
+
+// RunRemoteTask 在子节点上执行任务，日志通过 StreamRemoteRun 实时转发
+func (ic *InterconnectController) RunRemoteTask(c *gin.Context) {
+	var req struct {
+		Envs map[string]string `json:"envs"`
+	}
+	c.ShouldBindJSON(&req)
+	run, err := federation.GetRemoteRunService().Run(c.Param("id"), c.Param("task_id"), req.Envs, c.GetString("username"))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, run)
+}
+
+// GetRemoteRuns 分页获取远程执行记录
+func (ic *InterconnectController) GetRemoteRuns(c *gin.Context) {
+	p := utils.ParsePagination(c)
+	runs, total := federation.GetRemoteRunService().List(c.Query("node_id"), p)
+	utils.PaginatedResponse(c, runs, total, p)
+}
+
+// GetRemoteRun 获取远程执行记录及保存的输出
+func (ic *InterconnectController) GetRemoteRun(c *gin.Context) {
+	run, err := federation.GetRemoteRunService().Get(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+	utils.Success(c, run)
+}
+
+// StreamRemoteRun 以 SSE 转发子节点的实时日志，帧格式与 /logs/sse 一致
+func (ic *InterconnectController) StreamRemoteRun(c *gin.Context) {
+	svc := federation.GetRemoteRunService()
+	run, err := svc.Get(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	history, frames, cancel, ok := svc.Subscribe(run.ID)
+	if !ok {
+		// 已结束，从本地记录返回保存的输出
+		if run, err = svc.Get(run.ID); err == nil {
+			sendRemoteRunFinish(c, run)
+		}
+		return
+	}
+	defer cancel()
+
+	c.SSEvent("message", gin.H{
+		"type": "log",
+		"text": "[System] 已连接子节点 " + run.NodeName + " 的日志...\n" + history,
+	})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return false
+			}
+			c.SSEvent("message", frame)
+			c.Writer.Flush()
+			return frame.Type != "finish"
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func sendRemoteRunFinish(c *gin.Context, run *models.RemoteRun) {
+	text := string(run.Output)
+	if run.Error != "" {
+		text += "\n[System] " + run.Error + "\n"
+	}
+	endTime := ""
+	if run.FinishedAt != nil {
+		endTime = run.FinishedAt.Time().Format("2006-01-02 15:04:05")
+	}
+	c.SSEvent("message", gin.H{
+		"type":      "finish",
+		"text":      text,
+		"status":    run.Status,
+		"duration":  run.Duration,
+		"end_time":  endTime,
+		"exit_code": run.ExitCode,
+	})
+	c.Writer.Flush()
+}
+
 // HandleTunnel 接受子节点 WebSocket 连接请求
 func (ic *InterconnectController) HandleTunnel(c *gin.Context) {
 	tunnel.HandleTunnel(c)
@@ -1,18 +1,31 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/models/vo"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
 	"github.com/engigu/baihu-panel/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-type LogController struct{}
+type LogController struct {
+	searchService *tasks.LogSearchService
+	viewService   *tasks.LogViewService
+}
 
 func NewLogController() *LogController {
-	return &LogController{}
+	return &LogController{
+		searchService: tasks.NewLogSearchService(),
+		viewService:   tasks.NewLogViewService(),
+	}
 }
 
 // GetLogs 获取任务日志列表
@@ -123,6 +136,13 @@ func (lc *LogController) GetLogDetail(c *gin.Context) {
 		return
 	}
 
+	output, err := tasks.LoadTaskLogEncoded(&log)
+	if err != nil {
+		utils.ServerError(c, "读取日志内容失败: "+err.Error())
+		return
+	}
+	log.Output = models.BigText(output)
+
 	utils.Success(c, vo.ToTaskLogVO(&log))
 }
 
@@ -139,8 +159,12 @@ func (lc *LogController) ClearLogs(c *gin.Context) {
 
 	query := database.DB.Model(&models.TaskLog{})
 	if req.TaskID != nil && *req.TaskID != "" {
+		tasks.DeleteStoredTaskLogs("task_id = ?", *req.TaskID)
+		tasks.RemoveLogChunksWhere("task_id = ?", *req.TaskID)
 		query = query.Where("task_id = ?", *req.TaskID)
 	} else {
+		tasks.DeleteStoredTaskLogs("1 = 1")
+		tasks.RemoveLogChunks()
 		query = query.Where("1 = 1") // Allow delete all without GORM safety block
 	}
 
@@ -148,6 +172,11 @@ func (lc *LogController) ClearLogs(c *gin.Context) {
 		utils.ServerError(c, "清空日志失败")
 		return
 	}
+	taskID := ""
+	if req.TaskID != nil {
+		taskID = *req.TaskID
+	}
+	_ = lc.searchService.DeleteIndexByTask(taskID)
 
 	utils.SuccessMsg(c, "日志清空成功")
 }
@@ -160,10 +189,205 @@ func (lc *LogController) DeleteLog(c *gin.Context) {
 		return
 	}
 
+	tasks.DeleteStoredTaskLogs("id = ?", id)
 	if err := database.DB.Where("id = ?", id).Delete(&models.TaskLog{}).Error; err != nil {
 		utils.ServerError(c, "删除日志失败")
 		return
 	}
+	_ = lc.searchService.DeleteIndex(id)
+	tasks.RemoveLogChunks(id)
 
 	utils.SuccessMsg(c, "日志已删除")
 }
+
+// SearchLogs 全文检索日志内容
+// @Summary 全文检索日志内容
+// @Description 按关键字或正则表达式检索已结束任务的日志内容，返回匹配行片段，支持按任务、状态、Agent 及时间范围筛选
+// @Tags 日志管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param keyword query string true "关键字或正则表达式"
+// @Param regex query bool false "是否按正则表达式匹配"
+// @Param task_id query string false "任务 ID"
+// @Param status query string false "状态"
+// @Param agent_id query string false "Agent ID，local 表示仅本地执行"
+// @Param start_time query string false "开始时间 (2006-01-02 15:04:05 或 2006-01-02)"
+// @Param end_time query string false "结束时间 (2006-01-02 15:04:05 或 2006-01-02)"
+// @Param before query string false "分页游标，取上一次返回的 next_cursor"
+// @Param limit query int false "返回条数，默认 20，最大 100"
+// @Success 200 {object} utils.Response{data=tasks.LogSearchResult}
+// @Router /logs/search [get]
+func (lc *LogController) SearchLogs(c *gin.Context) {
+	startTime, err := parseSearchTime(c.Query("start_time"), false)
+	if err != nil {
+		utils.BadRequest(c, "开始时间格式无效")
+		return
+	}
+	endTime, err := parseSearchTime(c.Query("end_time"), true)
+	if err != nil {
+		utils.BadRequest(c, "结束时间格式无效")
+		return
+	}
+
+	result, err := lc.searchService.Search(tasks.LogSearchQuery{
+		Keyword:   c.Query("keyword"),
+		Regex:     c.Query("regex") == "true" || c.Query("regex") == "1",
+		TaskID:    c.Query("task_id"),
+		Status:    c.Query("status"),
+		AgentID:   c.Query("agent_id"),
+		StartTime: startTime,
+		EndTime:   endTime,
+		Before:    c.Query("before"),
+		Limit:     utils.ToInt(c.Query("limit"), 20),
+	})
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// parseSearchTime 解析检索时间参数，仅包含日期时 endOfDay 决定取当天开始或结束
+func parseSearchTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(models.TimeFormat, value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+// GetLogLines 按行号区间读取日志
+// @Summary 按行号区间读取日志
+// @Description 从指定行开始读取若干行日志，已结束的日志按需解压分块缓存，运行中的日志读取实时内容
+// @Tags 日志管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "日志ID"
+// @Param start query int false "起始行号（从 1 开始），默认 1"
+// @Param limit query int false "读取行数，默认 500，最大 5000"
+// @Param format query string false "输出格式: raw(默认，保留 ANSI)、plain(去除 ANSI)、html(ANSI 转 HTML)"
+// @Success 200 {object} utils.Response{data=tasks.LogLinesResult}
+// @Failure 404 {object} utils.Response
+// @Router /logs/{id}/lines [get]
+func (lc *LogController) GetLogLines(c *gin.Context) {
+	result, err := lc.viewService.Lines(c.Param("id"), utils.ToInt(c.Query("start"), 1), utils.ToInt(c.Query("limit"), 0), logViewOptions(c))
+	lc.respondLogView(c, result, err)
+}
+
+// GetLogHead 读取日志开头若干行
+// @Summary 读取日志开头若干行
+// @Tags 日志管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "日志ID"
+// @Param n query int false "行数，默认 500，最大 5000"
+// @Param format query string false "输出格式: raw、plain、html"
+// @Param stream query string false "只返回指定输出流: stdout、stderr、system"
+// @Param timestamps query string false "时间戳显示方式: relative、absolute"
+// @Success 200 {object} utils.Response{data=tasks.LogLinesResult}
+// @Router /logs/{id}/head [get]
+func (lc *LogController) GetLogHead(c *gin.Context) {
+	result, err := lc.viewService.Head(c.Param("id"), utils.ToInt(c.Query("n"), 0), logViewOptions(c))
+	lc.respondLogView(c, result, err)
+}
+
+// GetLogTail 读取日志末尾若干行
+// @Summary 读取日志末尾若干行
+// @Tags 日志管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "日志ID"
+// @Param n query int false "行数，默认 500，最大 5000"
+// @Param format query string false "输出格式: raw、plain、html"
+// @Param stream query string false "只返回指定输出流: stdout、stderr、system"
+// @Param timestamps query string false "时间戳显示方式: relative、absolute"
+// @Success 200 {object} utils.Response{data=tasks.LogLinesResult}
+// @Router /logs/{id}/tail [get]
+func (lc *LogController) GetLogTail(c *gin.Context) {
+	result, err := lc.viewService.Tail(c.Param("id"), utils.ToInt(c.Query("n"), 0), logViewOptions(c))
+	lc.respondLogView(c, result, err)
+}
+
+// GrepLog 在单条日志内检索
+// @Summary 在单条日志内检索
+// @Description 按关键字或正则表达式检索单条日志，返回匹配行及其上下文
+// @Tags 日志管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "日志ID"
+// @Param keyword query string true "关键字或正则表达式"
+// @Param regex query bool false "是否按正则表达式匹配"
+// @Param ignore_case query bool false "是否忽略大小写"
+// @Param context query int false "匹配行前后的上下文行数，最大 10"
+// @Param limit query int false "返回匹配数，默认 100，最大 1000"
+// @Param format query string false "输出格式: raw、plain、html"
+// @Param stream query string false "只返回指定输出流: stdout、stderr、system"
+// @Param timestamps query string false "时间戳显示方式: relative、absolute"
+// @Success 200 {object} utils.Response{data=tasks.LogGrepResult}
+// @Router /logs/{id}/grep [get]
+func (lc *LogController) GrepLog(c *gin.Context) {
+	result, err := lc.viewService.Grep(c.Param("id"), tasks.LogGrepQuery{
+		Keyword:        c.Query("keyword"),
+		Regex:          c.Query("regex") == "true" || c.Query("regex") == "1",
+		IgnoreCase:     c.Query("ignore_case") == "true" || c.Query("ignore_case") == "1",
+		Context:        utils.ToInt(c.Query("context"), 0),
+		Limit:          utils.ToInt(c.Query("limit"), 0),
+		LogViewOptions: logViewOptions(c),
+	})
+	lc.respondLogView(c, result, err)
+}
+
+// DownloadLog 流式下载日志全文
+// @Summary 下载日志全文
+// @Description 以流的方式下载日志原文，运行中的日志返回当前已输出的内容
+// @Tags 日志管理
+// @Produce plain
+// @Security BearerAuth
+// @Param id path string true "日志ID"
+// @Router /logs/{id}/download [get]
+func (lc *LogController) DownloadLog(c *gin.Context) {
+	taskLog, rc, err := lc.viewService.OpenDownload(c.Param("id"))
+	if err != nil {
+		lc.respondLogView(c, nil, err)
+		return
+	}
+	defer rc.Close()
+
+	filename := fmt.Sprintf("task_%s_%s.log", taskLog.TaskID, taskLog.ID)
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, rc)
+}
+
+func logViewOptions(c *gin.Context) tasks.LogViewOptions {
+	return tasks.LogViewOptions{
+		Format:     c.Query("format"),
+		Stream:     c.Query("stream"),
+		Timestamps: c.Query("timestamps"),
+	}
+}
+
+func (lc *LogController) respondLogView(c *gin.Context, result interface{}, err error) {
+	if err != nil {
+		if errors.Is(err, tasks.ErrLogNotFound) {
+			utils.NotFound(c, err.Error())
+		} else {
+			utils.BadRequest(c, err.Error())
+		}
+		return
+	}
+	utils.Success(c, result)
+}
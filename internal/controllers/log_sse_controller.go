@@ -3,15 +3,17 @@ package controllers
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/services/tasks"
-	"github.com/engigu/baihu-panel/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+const logSSEHeartbeat = 15 * time.Second // 日志流心跳间隔
+
 type LogSSEController struct{}
 
 func NewLogSSEController() *LogSSEController {
@@ -39,7 +41,7 @@ func (lc *LogSSEController) StreamLog(c *gin.Context) {
 	if res.Error == nil && res.RowsAffected > 0 {
 		if taskLog.Status != "running" {
 			// 已结束，直接返回全量日志以及 finish 结构帧
-			content, err := utils.DecompressFromBase64(string(taskLog.Output))
+			content, err := tasks.LoadTaskLogOutput(&taskLog)
 			if err != nil {
 				content = "解压日志失败: " + err.Error()
 			}
@@ -93,9 +95,15 @@ func (lc *LogSSEController) StreamLog(c *gin.Context) {
 	sub := tl.Subscribe()
 	defer tl.Unsubscribe(sub)
 
-	// 推送更新
+	// 推送更新，长时间无输出时发送注释帧作为心跳，便于订阅方判断连接是否存活
+	heartbeat := time.NewTicker(logSSEHeartbeat)
+	defer heartbeat.Stop()
 	c.Stream(func(w io.Writer) bool {
 		select {
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+			c.Writer.Flush()
+			return true
 		case data, ok := <-sub:
 			if !ok {
 				// 任务结束，读取库内落库后的最终真实数据，下发统一的 finish 帧
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/metrics"
+	"github.com/engigu/baihu-panel/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	metricsService *services.MetricsService
+}
+
+func NewMetricsController(metricsService *services.MetricsService) *MetricsController {
+	return &MetricsController{metricsService: metricsService}
+}
+
+// Metrics 输出 Prometheus 指标
+// @Summary Prometheus 指标
+// @Description 以 Prometheus 文本格式输出调度器、任务、Agent、通知及 Go 运行时指标，需在配置中开启并携带指标 Token
+// @Tags 系统监控
+// @Produce plain
+// @Param Authorization header string false "Bearer <token>"
+// @Param token query string false "指标 Token（无法设置请求头时使用）"
+// @Router /metrics [get]
+func (mc *MetricsController) Metrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := mc.metricsService.WriteMetrics(c.Writer); err != nil {
+		logger.Warnf("[Metrics] 输出指标失败: %v", err)
+	}
+}
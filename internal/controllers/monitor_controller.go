@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/engigu/baihu-panel/internal/services"
@@ -14,12 +17,14 @@ import (
 )
 
 type MonitorController struct {
-	executorService *tasks.ExecutorService
+	executorService    *tasks.ExecutorService
+	hostHistoryService *services.HostHistoryService
 }
 
-func NewMonitorController(executorService *tasks.ExecutorService) *MonitorController {
+func NewMonitorController(executorService *tasks.ExecutorService, hostHistoryService *services.HostHistoryService) *MonitorController {
 	return &MonitorController{
-		executorService: executorService,
+		executorService:    executorService,
+		hostHistoryService: hostHistoryService,
 	}
 }
 
@@ -35,6 +40,104 @@ func (mc *MonitorController) GetSystemMonitor(c *gin.Context) {
 	utils.Success(c, data)
 }
 
+// historyWindow 解析历史查询的时间窗口：优先使用 from/to（Unix 秒），否则使用 range（如 1h、24h、7d），默认最近 1 小时
+func historyWindow(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的结束时间: %s", v)
+		}
+		to = time.Unix(sec, 0)
+	}
+	if v := c.Query("from"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的开始时间: %s", v)
+		}
+		from := time.Unix(sec, 0)
+		if !from.Before(to) {
+			return time.Time{}, time.Time{}, fmt.Errorf("开始时间须早于结束时间")
+		}
+		return from, to, nil
+	}
+
+	span := c.DefaultQuery("range", "1h")
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(span, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(span)
+	}
+	if err != nil || d <= 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("无效的时间范围: %s", span)
+	}
+	return to.Add(-d), to, nil
+}
+
+// GetHostHistory 获取主机历史指标
+// @Summary 获取主机历史指标
+// @Description 返回 CPU、内存、磁盘、网络与调度器的历史指标（每个点含平均值与最大值）。24 小时内为 1 分钟分辨率，更早为 1 小时分辨率，最多保留 30 天
+// @Tags 系统监控
+// @Produce json
+// @Security BearerAuth
+// @Param range query string false "时间范围，如 1h、24h、7d，默认 1h"
+// @Param from query int false "开始时间（Unix 秒），指定后忽略 range"
+// @Param to query int false "结束时间（Unix 秒），默认当前时间"
+// @Param metrics query string false "逗号分隔的指标名称，默认全部"
+// @Success 200 {object} utils.Response{data=services.HostHistory}
+// @Failure 400 {object} utils.Response
+// @Router /monitor/history [get]
+func (mc *MonitorController) GetHostHistory(c *gin.Context) {
+	from, to, err := historyWindow(c)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	var names []string
+	if v := c.Query("metrics"); v != "" {
+		names = strings.Split(v, ",")
+	}
+	history, err := mc.hostHistoryService.History(from, to, names)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, history)
+}
+
+// GetHostHistoryMarkers 获取历史时间窗口内的任务运行标记
+// @Summary 获取任务运行标记
+// @Description 返回与时间窗口有交集的任务运行区间，用于叠加在历史指标图表上定位尖峰
+// @Tags 系统监控
+// @Produce json
+// @Security BearerAuth
+// @Param range query string false "时间范围，如 1h、24h、7d，默认 1h"
+// @Param from query int false "开始时间（Unix 秒），指定后忽略 range"
+// @Param to query int false "结束时间（Unix 秒），默认当前时间"
+// @Param task_id query string false "只返回指定任务"
+// @Success 200 {object} utils.Response{data=[]services.TaskRunMarker}
+// @Failure 400 {object} utils.Response
+// @Router /monitor/history/markers [get]
+func (mc *MonitorController) GetHostHistoryMarkers(c *gin.Context) {
+	from, to, err := historyWindow(c)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	markers, err := mc.hostHistoryService.Markers(from, to, c.Query("task_id"))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, markers)
+}
+
 // MonitorSSE Server-Sent Events 获取系统监控数据
 func (mc *MonitorController) MonitorSSE(c *gin.Context) {
 	// 设置 SSE 响应头
@@ -292,6 +292,8 @@ func (sc *SettingsController) UpdateSchedulerSettings(c *gin.Context) {
 		WorkerCount  string `json:"worker_count"`
 		QueueSize    string `json:"queue_size"`
 		RateInterval string `json:"rate_interval"`
+
+		BroadcastParallel string `json:"broadcast_parallel"` // 可选，为空时保持不变
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -323,6 +325,15 @@ func (sc *SettingsController) UpdateSchedulerSettings(c *gin.Context) {
 		constant.KeyRateInterval: req.RateInterval,
 	}
 
+	if req.BroadcastParallel != "" {
+		var broadcastParallel int
+		if _, err := fmt.Sscanf(req.BroadcastParallel, "%d", &broadcastParallel); err != nil || broadcastParallel < 1 || broadcastParallel > tasks.MaxBroadcastParallel {
+			utils.BadRequest(c, fmt.Sprintf("广播并行数必须在 1 至 %d 之间", tasks.MaxBroadcastParallel))
+			return
+		}
+		values[constant.KeyBroadcastParallel] = req.BroadcastParallel
+	}
+
 	if err := sc.settingsService.SetSection(constant.SectionScheduler, values); err != nil {
 		utils.ServerError(c, "保存失败")
 		return
@@ -476,9 +487,13 @@ func (sc *SettingsController) GetLoginLogs(c *gin.Context) {
 	})
 }
 
-// CreateBackup 创建备份
+// CreateBackup 创建备份，include_logs=false 时不包含任务执行日志
 func (sc *SettingsController) CreateBackup(c *gin.Context) {
-	_, err := sc.backupService.CreateBackup()
+	includeLogs := true
+	if v, err := strconv.ParseBool(c.Query("include_logs")); err == nil {
+		includeLogs = v
+	}
+	_, err := sc.backupService.CreateBackup(services.BackupOptions{IncludeLogs: includeLogs})
 	if err != nil {
 		utils.ServerError(c, "创建备份失败: "+err.Error())
 		return
@@ -578,6 +593,15 @@ func (sc *SettingsController) UpdateSectionSettings(c *gin.Context) {
 		return
 	}
 
+	if section == constant.SectionInterconnect {
+		if targets, ok := values[constant.KeyInterconnectForwardTargets]; ok {
+			if _, err := tunnel.ParseForwardTargets(targets); err != nil {
+				utils.BadRequest(c, "允许转发的目标无效: "+err.Error())
+				return
+			}
+		}
+	}
+
 	if err := sc.settingsService.SetSection(section, values); err != nil {
 		utils.ServerError(c, "更新失败")
 		return
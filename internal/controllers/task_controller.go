@@ -22,6 +22,7 @@ type TaskController struct {
 	taskService     *tasks.TaskService
 	executorService *tasks.ExecutorService
 	agentWSManager  *services.AgentWSManager
+	usageService    *tasks.TaskUsageService
 }
 
 func NewTaskController(taskService *tasks.TaskService, executorService *tasks.ExecutorService) *TaskController {
@@ -29,9 +30,36 @@ func NewTaskController(taskService *tasks.TaskService, executorService *tasks.Ex
 		taskService:     taskService,
 		executorService: executorService,
 		agentWSManager:  services.GetAgentWSManager(),
+		usageService:    tasks.NewTaskUsageService(),
 	}
 }
 
+// normalizeAgentRouting 校验 Agent 标签选择器与选择策略
+// 指定了 agent_id 时任务固定在该 Agent 上执行，选择器不生效，一并清空
+func normalizeAgentRouting(agentID *string, selector, strategy string) (string, string, error) {
+	selector = strings.TrimSpace(selector)
+	if (agentID != nil && *agentID != "") || selector == "" {
+		return "", "", nil
+	}
+	if _, err := tasks.ParseAgentSelector(selector); err != nil {
+		return "", "", err
+	}
+	strategy, err := tasks.NormalizeAgentStrategy(strategy)
+	if err != nil {
+		return "", "", err
+	}
+	return selector, strategy, nil
+}
+
+// normalizeSyncFiles 校验需同步到 Agent 的脚本路径，统一保存为逗号分隔的相对路径
+func normalizeSyncFiles(syncFiles string) (string, error) {
+	paths, err := services.NormalizeSyncPaths((&models.Task{SyncFiles: syncFiles}).SyncFileList())
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(paths, ","), nil
+}
+
 // resolveWorkDir 将相对路径转换为绝对路径
 func resolveWorkDir(workDir string) string {
 	if workDir == "" {
@@ -132,9 +160,25 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		}
 	}
 
+	agentSelector, agentStrategy, err := normalizeAgentRouting(req.AgentID, req.AgentSelector, req.AgentStrategy)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	syncFiles, err := normalizeSyncFiles(req.SyncFiles)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	failover, err := tasks.NormalizeFailover(req.AgentID, req.Failover)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
 	// 转换为绝对路径（Agent 任务保持原样）
 	workDir := req.WorkDir
-	if req.AgentID == nil || *req.AgentID == "" {
+	if (req.AgentID == nil || *req.AgentID == "") && agentSelector == "" {
 		workDir = resolveWorkDir(req.WorkDir)
 	}
 
@@ -196,6 +240,10 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		Envs:          req.Envs,
 		Languages:     req.Languages,
 		AgentID:       req.AgentID,
+		AgentSelector: agentSelector,
+		AgentStrategy: agentStrategy,
+		SyncFiles:     syncFiles,
+		Failover:      failover,
 		TriggerType:   req.TriggerType,
 		RetryCount:    req.RetryCount,
 		RetryInterval: req.RetryInterval,
@@ -261,6 +309,10 @@ func (tc *TaskController) BulkSaveTask(c *gin.Context) {
 			Envs:          req.Envs,
 			Languages:     req.Languages,
 			AgentID:       req.AgentID,
+			AgentSelector: req.AgentSelector,
+			AgentStrategy: req.AgentStrategy,
+			SyncFiles:     req.SyncFiles,
+			Failover:      req.Failover,
 			TriggerType:   req.TriggerType,
 			RetryCount:    req.RetryCount,
 			RetryInterval: req.RetryInterval,
@@ -411,9 +463,25 @@ func (tc *TaskController) UpdateTask(c *gin.Context) {
 		}
 	}
 
+	agentSelector, agentStrategy, err := normalizeAgentRouting(req.AgentID, req.AgentSelector, req.AgentStrategy)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	syncFiles, err := normalizeSyncFiles(req.SyncFiles)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	failover, err := tasks.NormalizeFailover(req.AgentID, req.Failover)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
 	// 转换为绝对路径（Agent 任务保持原样）
 	workDir := req.WorkDir
-	if req.AgentID == nil || *req.AgentID == "" {
+	if (req.AgentID == nil || *req.AgentID == "") && agentSelector == "" {
 		workDir = resolveWorkDir(req.WorkDir)
 	}
 
@@ -493,6 +561,10 @@ func (tc *TaskController) UpdateTask(c *gin.Context) {
 		Envs:          req.Envs,
 		Languages:     req.Languages,
 		AgentID:       req.AgentID,
+		AgentSelector: agentSelector,
+		AgentStrategy: agentStrategy,
+		SyncFiles:     syncFiles,
+		Failover:      failover,
 		TriggerType:   req.TriggerType,
 		RetryCount:    req.RetryCount,
 		RetryInterval: req.RetryInterval,
@@ -778,6 +850,66 @@ func (tc *TaskController) GetTags(c *gin.Context) {
 	utils.Success(c, tags)
 }
 
+// usageDays 解析资源统计的天数窗口，默认 7 天，最多 90 天
+func usageDays(c *gin.Context) int {
+	days := utils.ToInt(c.DefaultQuery("days", "7"), 7)
+	if days <= 0 {
+		days = 7
+	}
+	if days > 90 {
+		days = 90
+	}
+	return days
+}
+
+// GetTaskUsage 获取任务资源占用趋势
+// @Summary 获取任务资源占用趋势
+// @Description 返回任务最近若干天内每次运行的 CPU 时间、峰值内存与磁盘 I/O，以及汇总统计
+// @Tags 任务管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "任务ID"
+// @Param days query int false "统计天数，默认 7，最大 90"
+// @Param limit query int false "最多返回的运行次数，默认 1000"
+// @Success 200 {object} utils.Response{data=tasks.UsageTrend}
+// @Failure 404 {object} utils.Response
+// @Router /tasks/{id}/usage [get]
+func (tc *TaskController) GetTaskUsage(c *gin.Context) {
+	id := c.Param("id")
+	if tc.taskService.GetTaskByID(id) == nil {
+		utils.NotFound(c, "任务不存在")
+		return
+	}
+
+	trend, err := tc.usageService.Trend(id, usageDays(c), utils.ToInt(c.Query("limit"), 0))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, trend)
+}
+
+// GetUsageRanking 获取任务资源占用排行
+// @Summary 获取任务资源占用排行
+// @Description 按累计 CPU 时间、峰值内存或磁盘 I/O 对最近若干天内的任务排序
+// @Tags 任务管理
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "统计天数，默认 7，最大 90"
+// @Param sort query string false "排序方式：cpu、rss、io，默认 cpu"
+// @Param limit query int false "返回的任务数，默认 100"
+// @Success 200 {object} utils.Response{data=[]tasks.UsageRankItem}
+// @Failure 400 {object} utils.Response
+// @Router /tasks/usage/ranking [get]
+func (tc *TaskController) GetUsageRanking(c *gin.Context) {
+	items, err := tc.usageService.Ranking(usageDays(c), c.Query("sort"), utils.ToInt(c.Query("limit"), 0))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, items)
+}
+
 // SyncRepoTasks 增量同步仓库任务状态（供本地 reposync 进程调用）
 func (tc *TaskController) SyncRepoTasks(c *gin.Context) {
 	var req struct {
@@ -838,6 +970,10 @@ func (tc *TaskController) ToggleTask(c *gin.Context) {
 		Envs:          string(task.Envs),
 		Languages:     task.Languages,
 		AgentID:       task.AgentID,
+		AgentSelector: task.AgentSelector,
+		AgentStrategy: task.AgentStrategy,
+		SyncFiles:     task.SyncFiles,
+		Failover:      task.Failover,
 		TriggerType:   task.TriggerType,
 		RetryCount:    task.RetryCount,
 		RetryInterval: task.RetryInterval,
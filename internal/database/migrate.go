@@ -17,6 +17,7 @@ var allModels = []interface{}{
 	&models.User{},
 	&models.Task{},
 	&models.TaskLog{},
+	&models.TaskLogIndex{},
 	&models.Script{},
 	&models.EnvironmentVariable{},
 	&models.Setting{},
@@ -31,6 +32,15 @@ var allModels = []interface{}{
 	&models.DataRelation{},
 	&models.DataStorage{},
 	&models.InterconnectNode{},
+	&models.HostMetricPoint{},
+	&models.TaskRunRollup{},
+	&models.BroadcastRun{},
+	&models.AgentRollout{},
+	&models.AgentRolloutTarget{},
+	&models.ManagedSync{},
+	&models.ManagedSyncState{},
+	&models.TunnelForward{},
+	&models.RemoteRun{},
 }
 
 func Migrate() error {
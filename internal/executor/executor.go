@@ -13,6 +13,7 @@ import (
 	"github.com/creack/pty"
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/utils"
 	"github.com/engigu/baihu-panel/internal/windows"
 )
@@ -62,6 +63,7 @@ type Result struct {
 	ExitCode  int
 	StartTime time.Time
 	EndTime   time.Time
+	Usage     *models.ResourceUsage // 进程树资源占用，进程未能启动时为空
 }
 
 // Hooks 执行钩子接口
@@ -363,6 +365,7 @@ func ExecuteWithHooks(ctx context.Context, req Request, stdout, stderr io.Writer
 		StartTime: start,
 		EndTime:   end,
 		Duration:  end.Sub(start).Milliseconds(),
+		Usage:     collectResourceUsage(cmd.ProcessState),
 	}
 
 	if err != nil {
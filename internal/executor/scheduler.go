@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/utils"
 )
 
@@ -82,22 +83,25 @@ type ExecutionRequest struct {
 
 // ExecutionMetadata 执行额外元数据
 type ExecutionMetadata struct {
-	GoID       int64 // 关联的 goroutine ID
-	RetryIndex int   // 当前重试索引
+	GoID       int64  // 关联的 goroutine ID
+	RetryIndex int    // 当前重试索引
+	AgentID    string // 按选择器路由或故障转移时实际执行的 Agent ID
+	Failover   string // 故障转移原因，AgentID 为空时表示转由面板本机执行
 }
 
 // ExecutionResult 执行结果（标准接口）
 type ExecutionResult struct {
-	TaskID    string    // 任务 ID
-	LogID     string    // 日志 ID
-	Success   bool      // 是否成功
-	Output    string    // 输出内容
-	Error     string    // 错误信息
-	Status    string    // 状态: success, failed, timeout, cancelled
-	Duration  int64     // 执行时长（毫秒）
-	ExitCode  int       // 退出码
-	StartTime time.Time // 开始时间
-	EndTime   time.Time // 结束时间
+	TaskID    string                // 任务 ID
+	LogID     string                // 日志 ID
+	Success   bool                  // 是否成功
+	Output    string                // 输出内容
+	Error     string                // 错误信息
+	Status    string                // 状态: success, failed, timeout, cancelled
+	Duration  int64                 // 执行时长（毫秒）
+	ExitCode  int                   // 退出码
+	StartTime time.Time             // 开始时间
+	EndTime   time.Time             // 结束时间
+	Usage     *models.ResourceUsage // 进程树资源占用
 }
 
 // SchedulerEventHandler 调度器事件处理器（标准接口）
@@ -563,6 +567,7 @@ func (s *Scheduler) executeTask(req *ExecutionRequest) (*ExecutionResult, error)
 		result.ExitCode = execResult.ExitCode
 		result.StartTime = execResult.StartTime
 		result.EndTime = execResult.EndTime
+		result.Usage = execResult.Usage
 	} else {
 		result.Success = false
 		result.Status = constant.TaskStatusFailed
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+// collectResourceUsage 从子进程退出状态中读取 rusage
+// wait4 返回的 rusage 已累加了子进程回收过的全部子孙进程；脱离进程组后未被回收的后台进程无法统计
+// ru_maxrss 是子进程及其子孙中单个进程的峰值，不是整个进程树同时占用的内存
+func collectResourceUsage(ps *os.ProcessState) *models.ResourceUsage {
+	if ps == nil {
+		return nil
+	}
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return nil
+	}
+
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		// Linux/BSD 下 ru_maxrss 的单位为 KB，macOS 为字节
+		maxRSS *= 1024
+	}
+	return &models.ResourceUsage{
+		UserCPU:    ps.UserTime().Milliseconds(),
+		SystemCPU:  ps.SystemTime().Milliseconds(),
+		MaxRSS:     maxRSS,
+		ReadBytes:  int64(ru.Inblock) * 512,
+		WriteBytes: int64(ru.Oublock) * 512,
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestCollectResourceUsage(t *testing.T) {
+	if collectResourceUsage(nil) != nil {
+		t.Error("未运行的进程不应有资源占用")
+	}
+
+	// 子进程再派生的子孙进程被回收后同样计入
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done; sh -c 'head -c 1048576 /dev/zero > /dev/null'")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("无法运行 sh: %v", err)
+	}
+	usage := collectResourceUsage(cmd.ProcessState)
+	if usage == nil {
+		t.Fatal("应采集到资源占用")
+	}
+	if usage.MaxRSS < 1024 {
+		t.Errorf("峰值内存应换算为字节: %d", usage.MaxRSS)
+	}
+	if usage.UserCPU+usage.SystemCPU <= 0 {
+		t.Errorf("应记录 CPU 时间: %+v", usage)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package executor
+
+import (
+	"os"
+
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+// collectResourceUsage Windows 下仅能获取 CPU 时间
+func collectResourceUsage(ps *os.ProcessState) *models.ResourceUsage {
+	if ps == nil {
+		return nil
+	}
+	return &models.ResourceUsage{
+		UserCPU:   ps.UserTime().Milliseconds(),
+		SystemCPU: ps.SystemTime().Milliseconds(),
+	}
+}
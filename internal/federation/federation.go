@@ -0,0 +1,338 @@
+// Package federation 主节点对子节点的跨节点能力
+// 聚合查询：通过互联隧道并发请求所有在线子节点，结果短暂缓存，响应慢或离线的节点不阻塞整体结果；
+// 托管同步：按标签把任务与环境变量持续同步到子节点，并检测子节点上的修改
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/tunnel"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	cacheTTL     = 15 * time.Second // 子节点结果的缓存时间
+	cacheMaxAge  = 5 * time.Minute  // 超过该时间的缓存不再作为降级结果
+	nodeWait     = 3 * time.Second  // 单次聚合等待子节点响应的时间，超时的节点使用旧缓存
+	fetchTimeout = 15 * time.Second // 后台请求子节点的超时时间
+)
+
+// 子节点在聚合结果中的状态
+const (
+	NodeOK      = "ok"
+	NodeOffline = "offline"
+	NodeTimeout = "timeout"
+	NodeError   = "error"
+)
+
+// Node 单个子节点在本次聚合中的情况
+type Node struct {
+	NodeID    string `json:"node_id"`
+	NodeName  string `json:"node_name"`
+	Status    string `json:"status"`
+	Msg       string `json:"msg,omitempty"`
+	Total     int64  `json:"total"`                // 子节点上符合条件的总数
+	More      bool   `json:"more,omitempty"`       // 子节点还有未返回的结果
+	Stale     bool   `json:"stale,omitempty"`      // 子节点未及时响应，结果来自过期缓存
+	FetchedAt string `json:"fetched_at,omitempty"` // 结果的获取时间
+}
+
+// Result 跨节点聚合结果，每一项都带有 node_id 与 node_name
+type Result struct {
+	Items []map[string]interface{} `json:"items"`
+	Nodes []Node                   `json:"nodes"`
+}
+
+// cacheEntry 子节点单次请求的缓存
+type cacheEntry struct {
+	data json.RawMessage
+	err  error
+	at   time.Time
+}
+
+// nodePage 从子节点响应中提取的列表
+type nodePage struct {
+	items []map[string]interface{}
+	total int64
+	more  bool
+}
+
+// Service 跨节点聚合服务
+type Service struct {
+	mu       sync.Mutex
+	cache    map[string]*cacheEntry
+	inflight map[string]chan struct{}
+	fetch    func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (json.RawMessage, error)
+	wait     time.Duration
+}
+
+var (
+	service     *Service
+	serviceOnce sync.Once
+)
+
+// GetService 获取跨节点聚合服务单例
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		service = newService()
+	})
+	return service
+}
+
+func newService() *Service {
+	return &Service{
+		cache:    make(map[string]*cacheEntry),
+		inflight: make(map[string]chan struct{}),
+		fetch:    fetchNodeAPI,
+		wait:     nodeWait,
+	}
+}
+
+// Tasks 聚合各子节点的任务列表，每个节点最多返回 limit 条
+func (s *Service) Tasks(name, tags string, limit int) *Result {
+	query := url.Values{"page": {"1"}, "page_size": {fmt.Sprint(limit)}}
+	if name != "" {
+		query.Set("name", name)
+	}
+	if tags != "" {
+		query.Set("tags", tags)
+	}
+	return s.collect("/api/v1/tasks", query, parsePaginated, 0, "")
+}
+
+// Failures 聚合各子节点最近的失败执行，按开始时间倒序取前 limit 条
+func (s *Service) Failures(status string, limit int) *Result {
+	query := url.Values{"page": {"1"}, "page_size": {fmt.Sprint(limit)}, "status": {status}}
+	return s.collect("/api/v1/logs", query, parsePaginated, limit, "start_time")
+}
+
+// SearchLogs 在各子节点上执行日志全文检索，按时间倒序取前 limit 条
+// query 原样透传给子节点的 /api/v1/logs/search
+func (s *Service) SearchLogs(query url.Values, limit int) *Result {
+	query.Set("limit", fmt.Sprint(limit))
+	query.Del("before")
+	return s.collect("/api/v1/logs/search", query, parseSearchHits, limit, "created_at")
+}
+
+// collect 并发请求所有子节点并合并结果；sortKey 非空时按该字段倒序合并，limit 大于 0 时截断
+func (s *Service) collect(path string, query url.Values, parse func(json.RawMessage) (*nodePage, error), limit int, sortKey string) *Result {
+	var nodes []*models.InterconnectNode
+	database.DB.Order("name ASC").Find(&nodes)
+
+	result := &Result{Items: make([]map[string]interface{}, 0), Nodes: make([]Node, len(nodes))}
+	pages := make([]*nodePage, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		result.Nodes[i] = Node{NodeID: node.ID, NodeName: node.Name, Status: NodeOffline}
+		if !nodeOnline(node) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, node *models.InterconnectNode) {
+			defer wg.Done()
+			info := &result.Nodes[i]
+			entry, stale := s.query(node, path, query)
+			if entry == nil {
+				info.Status, info.Msg = NodeTimeout, "节点响应超时"
+				return
+			}
+			info.Stale = stale
+			info.FetchedAt = entry.at.Format(models.TimeFormat)
+			if entry.err != nil {
+				info.Status, info.Msg = NodeError, entry.err.Error()
+				return
+			}
+			page, err := parse(entry.data)
+			if err != nil {
+				info.Status, info.Msg = NodeError, err.Error()
+				return
+			}
+			info.Status, info.Total, info.More = NodeOK, page.total, page.more
+			pages[i] = page
+		}(i, node)
+	}
+	wg.Wait()
+
+	for i, page := range pages {
+		if page == nil {
+			continue
+		}
+		for _, item := range page.items {
+			item["node_id"] = nodes[i].ID
+			item["node_name"] = nodes[i].Name
+			result.Items = append(result.Items, item)
+		}
+	}
+	if sortKey != "" {
+		sort.SliceStable(result.Items, func(a, b int) bool {
+			return fmt.Sprint(result.Items[a][sortKey]) > fmt.Sprint(result.Items[b][sortKey])
+		})
+	}
+	if limit > 0 && len(result.Items) > limit {
+		result.Items = result.Items[:limit]
+	}
+	return result
+}
+
+// nodeOnline 节点是否在线，隧道节点还要求隧道已建立
+func nodeOnline(node *models.InterconnectNode) bool {
+	if node.Status != "online" {
+		return false
+	}
+	if strings.HasPrefix(node.URL, "tunnel://") {
+		return tunnel.GetSession(node.ID) != nil
+	}
+	return true
+}
+
+// query 返回子节点的结果：缓存有效时直接使用，否则发起（或复用进行中的）请求并最多等待 s.wait；
+// 超时的节点返回过期缓存并标记 stale，没有缓存时返回 nil，请求在后台继续完成后写入缓存
+func (s *Service) query(node *models.InterconnectNode, path string, query url.Values) (*cacheEntry, bool) {
+	key := node.ID + " " + path + "?" + query.Encode()
+
+	s.mu.Lock()
+	cached := s.cache[key]
+	if cached != nil && time.Since(cached.at) < cacheTTL {
+		s.mu.Unlock()
+		return cached, false
+	}
+	done, running := s.inflight[key]
+	if !running {
+		done = make(chan struct{})
+		s.inflight[key] = done
+		go s.refresh(key, node, path, query, done)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.cache[key], false
+	case <-time.After(s.wait):
+		if cached != nil && time.Since(cached.at) < cacheMaxAge {
+			return cached, true
+		}
+		return nil, false
+	}
+}
+
+// refresh 请求子节点并写入缓存，顺带清理过期缓存
+func (s *Service) refresh(key string, node *models.InterconnectNode, path string, query url.Values, done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	data, err := s.fetch(ctx, node, path, query)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.cache {
+		if now.Sub(e.at) > cacheMaxAge {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = &cacheEntry{data: data, err: err, at: now}
+	delete(s.inflight, key)
+	close(done)
+}
+
+// fetchNodeAPI 以 GET 请求子节点接口
+func fetchNodeAPI(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (json.RawMessage, error) {
+	return callNode(ctx, node, http.MethodGet, path, query, nil)
+}
+
+// callNode 请求子节点接口，隧道节点经 tunnel.ProxyHTTP 转发，直连节点直接请求，返回响应中的 data
+func callNode(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error) {
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var status int
+	var respBody []byte
+	if strings.HasPrefix(node.URL, "tunnel://") {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = req
+		if err := tunnel.ProxyHTTP(node.ID, c, path); err != nil {
+			return nil, err
+		}
+		status, respBody = rec.Code, rec.Body.Bytes()
+	} else {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(node.URL, "/")+target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+node.Token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("节点不可达: %v", err)
+		}
+		defer resp.Body.Close()
+		status = resp.StatusCode
+		if respBody, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("节点返回 HTTP %d", status)
+	}
+	var resp struct {
+		Code int             `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("解析节点响应失败")
+	}
+	if resp.Code != 200 {
+		return nil, fmt.Errorf("%s", resp.Msg)
+	}
+	return resp.Data, nil
+}
+
+// parsePaginated 解析分页接口的结果
+func parsePaginated(data json.RawMessage) (*nodePage, error) {
+	var resp struct {
+		Data  []map[string]interface{} `json:"data"`
+		Total int64                    `json:"total"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("解析节点数据失败")
+	}
+	return &nodePage{items: resp.Data, total: resp.Total, more: resp.Total > int64(len(resp.Data))}, nil
+}
+
+// parseSearchHits 解析日志检索接口的结果
+func parseSearchHits(data json.RawMessage) (*nodePage, error) {
+	var result struct {
+		Hits       []map[string]interface{} `json:"hits"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析节点数据失败")
+	}
+	return &nodePage{items: result.Hits, total: int64(len(result.Hits)), more: result.NextCursor != ""}, nil
+}
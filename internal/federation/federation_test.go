@@ -0,0 +1,135 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupNodes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("无法开启 SQLite 内存测试库: %v", err)
+	}
+	database.DB = db
+	if err := db.AutoMigrate(&models.InterconnectNode{}); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+	db.Create(&models.InterconnectNode{ID: "n1", Name: "a-node", URL: "http://a", Status: "online"})
+	db.Create(&models.InterconnectNode{ID: "n2", Name: "b-node", URL: "http://b", Status: "online"})
+	db.Create(&models.InterconnectNode{ID: "n3", Name: "c-node", URL: "http://c", Status: "offline"})
+	db.Create(&models.InterconnectNode{ID: "n4", Name: "d-node", URL: "tunnel://d", Status: "online"})
+}
+
+func logsPage(times ...string) json.RawMessage {
+	items := make([]map[string]interface{}, len(times))
+	for i, ts := range times {
+		items[i] = map[string]interface{}{"id": fmt.Sprint(i), "status": "failed", "start_time": ts}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"data": items, "total": 10})
+	return data
+}
+
+func TestFailuresMerge(t *testing.T) {
+	setupNodes(t)
+	s := newService()
+	s.fetch = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (json.RawMessage, error) {
+		if query.Get("status") != "failed" || path != "/api/v1/logs" {
+			t.Errorf("请求参数不正确: %s %v", path, query)
+		}
+		switch node.ID {
+		case "n1":
+			return logsPage("2026-01-03 10:00:00", "2026-01-01 10:00:00"), nil
+		case "n2":
+			return logsPage("2026-01-02 10:00:00"), nil
+		}
+		t.Errorf("离线节点 %s 不应被请求", node.ID)
+		return nil, nil
+	}
+
+	result := s.Failures("failed", 2)
+	if len(result.Items) != 2 {
+		t.Fatalf("应按 limit 截断合并结果: %d", len(result.Items))
+	}
+	if result.Items[0]["node_id"] != "n1" || result.Items[1]["node_id"] != "n2" || result.Items[1]["node_name"] != "b-node" {
+		t.Errorf("合并结果应按开始时间倒序并带节点信息: %v", result.Items)
+	}
+	want := map[string]string{"n1": NodeOK, "n2": NodeOK, "n3": NodeOffline, "n4": NodeOffline}
+	for _, n := range result.Nodes {
+		if n.Status != want[n.NodeID] {
+			t.Errorf("节点 %s 状态应为 %s，实际 %s", n.NodeID, want[n.NodeID], n.Status)
+		}
+	}
+	if !result.Nodes[0].More || result.Nodes[0].Total != 10 {
+		t.Errorf("应返回子节点的总数: %+v", result.Nodes[0])
+	}
+}
+
+func TestSlowNodeDoesNotBlock(t *testing.T) {
+	setupNodes(t)
+	s := newService()
+	s.wait = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	s.fetch = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (json.RawMessage, error) {
+		calls.Add(1)
+		if node.ID == "n2" {
+			<-release
+			return logsPage("2026-01-05 10:00:00"), nil
+		}
+		return nil, fmt.Errorf("节点返回 HTTP 401")
+	}
+
+	start := time.Now()
+	result := s.Failures("failed", 10)
+	if time.Since(start) > time.Second {
+		t.Fatal("慢节点阻塞了聚合结果")
+	}
+	if result.Nodes[0].Status != NodeError || result.Nodes[1].Status != NodeTimeout {
+		t.Fatalf("节点状态不正确: %+v", result.Nodes)
+	}
+
+	// 慢节点完成后结果写入缓存，之后的请求直接使用缓存
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		pending := len(s.inflight)
+		s.mu.Unlock()
+		if pending == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	before := calls.Load()
+	result = s.Failures("failed", 10)
+	if len(result.Items) != 1 || result.Items[0]["node_id"] != "n2" || calls.Load() != before {
+		t.Fatalf("应使用慢节点的缓存结果: %v", result.Items)
+	}
+
+	// 缓存过期后节点再次变慢，返回过期缓存并标记
+	s.mu.Lock()
+	for _, e := range s.cache {
+		e.at = e.at.Add(-cacheTTL)
+	}
+	s.mu.Unlock()
+	s.fetch = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (json.RawMessage, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	result = s.Failures("failed", 10)
+	if len(result.Items) != 1 || !result.Nodes[1].Stale {
+		t.Errorf("超时的节点应返回过期缓存: %+v", result.Nodes)
+	}
+}
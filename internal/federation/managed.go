@@ -0,0 +1,557 @@
+package federation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services"
+	"github.com/engigu/baihu-panel/internal/services/relation"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+const (
+	managedReconcileSpec = "@every 10m"     // 定期对账，发现子节点上的修改
+	managedDebounce      = 5 * time.Second  // 数据变更后合并短时间内的多次修改再同步
+	managedNodeTimeout   = 30 * time.Second // 单个子节点导出或导入的超时时间
+)
+
+// PlanItem 托管资源在某个子节点上的同步动作
+type PlanItem struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodePlan 单个子节点的同步计划，Error 非空表示无法获取子节点现状
+type NodePlan struct {
+	NodeID   string     `json:"node_id"`
+	NodeName string     `json:"node_name"`
+	Error    string     `json:"error,omitempty"`
+	Items    []PlanItem `json:"items"`
+}
+
+// managedResource 主节点上的托管资源
+type managedResource struct {
+	kind string
+	id   string
+	name string
+	hash string
+	skip string // 不支持同步的原因
+}
+
+// desiredState 规则当前应同步的资源与对应的导出数据
+type desiredState struct {
+	resources []managedResource
+	export    *models.ExportData
+	scripts   map[string]string // 托管任务引用的脚本：相对脚本目录的路径 -> 内容
+}
+
+// ManagedSyncService 托管同步：把带指定标签的任务、任务引用的脚本与环境变量持续同步到子节点
+// 子节点副本的 ID 与主节点一致，每次同步成功后记录内容指纹，对比主节点、子节点与上次同步的指纹区分主节点修改、子节点漂移与双方冲突
+type ManagedSyncService struct {
+	mu       sync.Mutex // 同一时间只执行一次同步
+	timerMu  sync.Mutex
+	debounce *time.Timer
+	call     func(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error)
+}
+
+var (
+	managedSyncService     *ManagedSyncService
+	managedSyncServiceOnce sync.Once
+)
+
+// GetManagedSyncService 获取托管同步服务单例
+func GetManagedSyncService() *ManagedSyncService {
+	managedSyncServiceOnce.Do(func() {
+		managedSyncService = &ManagedSyncService{call: callNode}
+	})
+	return managedSyncService
+}
+
+// Start 数据变更时同步，并定期对账
+func (s *ManagedSyncService) Start() {
+	eventbus.DefaultBus.Subscribe(constant.EventDataChanged, func(eventbus.Event) { s.schedule() })
+	executor.GetSysCron().AddJob(managedReconcileSpec, s.SyncAll)
+}
+
+// schedule 合并短时间内的多次变更后执行一次同步
+func (s *ManagedSyncService) schedule() {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	if s.debounce != nil {
+		s.debounce.Stop()
+	}
+	s.debounce = time.AfterFunc(managedDebounce, s.SyncAll)
+}
+
+// SyncAll 同步所有启用的规则
+func (s *ManagedSyncService) SyncAll() {
+	var rules []models.ManagedSync
+	database.DB.Where("enabled = ? OR enabled IS NULL", true).Find(&rules)
+	for i := range rules {
+		if _, err := s.Sync(&rules[i]); err != nil {
+			logger.Warnf("[ManagedSync] 规则 %s 同步失败: %v", rules[i].Name, err)
+		}
+	}
+}
+
+// ListRules 获取托管同步规则列表
+func (s *ManagedSyncService) ListRules() []models.ManagedSync {
+	rules := make([]models.ManagedSync, 0)
+	database.DB.Order("created_at DESC").Find(&rules)
+	return rules
+}
+
+// GetRule 根据 ID 获取托管同步规则
+func (s *ManagedSyncService) GetRule(id string) (*models.ManagedSync, error) {
+	var rule models.ManagedSync
+	if err := database.DB.Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, fmt.Errorf("规则不存在")
+	}
+	return &rule, nil
+}
+
+// SaveRule 新建或更新托管同步规则，保存后尽快执行一次同步
+func (s *ManagedSyncService) SaveRule(rule *models.ManagedSync) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.NodeIDs = strings.Join(splitList(rule.NodeIDs), ",")
+	switch {
+	case rule.Name == "":
+		return fmt.Errorf("规则名称不能为空")
+	case rule.TaskTag == "" && rule.EnvTag == "":
+		return fmt.Errorf("任务标签与环境变量标签至少指定一个")
+	case rule.NodeIDs == "":
+		return fmt.Errorf("至少选择一个子节点")
+	}
+	if rule.Enabled == nil {
+		rule.Enabled = utils.BoolPtr(true)
+	}
+
+	var err error
+	if rule.ID == "" {
+		rule.ID = utils.GenerateID()
+		rule.LastRunAt, rule.LastError = nil, ""
+		err = database.DB.Create(rule).Error
+	} else {
+		err = database.DB.Model(&models.ManagedSync{}).Where("id = ?", rule.ID).Updates(map[string]interface{}{
+			"name": rule.Name, "task_tag": rule.TaskTag, "env_tag": rule.EnvTag,
+			"node_ids": rule.NodeIDs, "overwrite": rule.Overwrite, "enabled": rule.Enabled,
+		}).Error
+		// 移出规则的子节点不再跟踪，子节点上的副本保留
+		database.DB.Where("sync_id = ? AND node_id NOT IN ?", rule.ID, splitList(rule.NodeIDs)).Delete(&models.ManagedSyncState{})
+	}
+	if err == nil && *rule.Enabled {
+		s.schedule()
+	}
+	return err
+}
+
+// DeleteRule 删除托管同步规则及其同步状态，子节点上的副本保留
+func (s *ManagedSyncService) DeleteRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	database.DB.Where("sync_id = ?", id).Delete(&models.ManagedSyncState{})
+	return database.DB.Where("id = ?", id).Delete(&models.ManagedSync{}).Error
+}
+
+// States 规则在各子节点上的同步状态，未同步成功的排在前面，用于漂移与冲突报告
+func (s *ManagedSyncService) States(id string) []models.ManagedSyncState {
+	states := make([]models.ManagedSyncState, 0)
+	database.DB.Where("sync_id = ?", id).
+		Order(fmt.Sprintf("CASE WHEN status = '%s' THEN 1 ELSE 0 END, node_id, kind, name", constant.ManagedStatusSynced)).
+		Find(&states)
+	return states
+}
+
+// Plan 预览规则在各子节点上的同步动作，不做任何修改
+func (s *ManagedSyncService) Plan(rule *models.ManagedSync) []NodePlan {
+	desired := s.desired(rule)
+	nodes := s.nodes(rule)
+	plans := make([]NodePlan, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *models.InterconnectNode) {
+			defer wg.Done()
+			plans[i] = s.planNode(rule, node, desired)
+		}(i, node)
+	}
+	wg.Wait()
+	return plans
+}
+
+// Sync 按计划把主节点的修改推送到各子节点，并记录每个资源的同步状态
+func (s *ManagedSyncService) Sync(rule *models.ManagedSync) ([]NodePlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	desired := s.desired(rule)
+	plans := make([]NodePlan, 0)
+	var failed []string
+	for _, node := range s.nodes(rule) {
+		plan := s.planNode(rule, node, desired)
+		if plan.Error == "" {
+			if err := s.apply(rule, node, desired, plan.Items); err != nil {
+				plan.Error = err.Error()
+			}
+		}
+		if plan.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", node.Name, plan.Error))
+		}
+		plans = append(plans, plan)
+	}
+
+	now := models.Now()
+	lastError := truncateMessage(strings.Join(failed, "；"), 500)
+	database.DB.Model(&models.ManagedSync{}).Where("id = ?", rule.ID).
+		Updates(map[string]interface{}{"last_run_at": &now, "last_error": lastError})
+	if lastError != "" {
+		return plans, fmt.Errorf("%s", lastError)
+	}
+	return plans, nil
+}
+
+// nodes 规则的目标子节点
+func (s *ManagedSyncService) nodes(rule *models.ManagedSync) []*models.InterconnectNode {
+	ids := splitList(rule.NodeIDs)
+	nodes := make([]*models.InterconnectNode, 0, len(ids))
+	if len(ids) > 0 {
+		database.DB.Where("id IN ?", ids).Order("name ASC").Find(&nodes)
+	}
+	return nodes
+}
+
+// desired 主节点上应同步的资源：带任务标签的任务（含仓库子任务）及其引用的脚本、带变量标签的环境变量以及托管任务依赖的环境变量
+// 机密变量以面板自身的密钥加密，无法在子节点上解密，不参与同步；目录等无法同步的脚本只报告
+func (s *ManagedSyncService) desired(rule *models.ManagedSync) *desiredState {
+	var taskIDs, envIDs []string
+	if rule.TaskTag != "" {
+		taskIDs = relation.DataRelation.GetDataIDsByTag(constant.RelationTypeTaskTag, rule.TaskTag)
+	}
+	if rule.EnvTag != "" {
+		envIDs = relation.DataRelation.GetDataIDsByTag(constant.RelationTypeEnvTag, rule.EnvTag)
+	}
+	export := services.NewDataService().ExportBusinessData(taskIDs, envIDs)
+
+	state := &desiredState{export: export, scripts: map[string]string{}}
+	scripts := map[string]bool{}
+	for _, task := range export.Tasks {
+		state.resources = append(state.resources, managedResource{
+			kind: constant.ManagedKindTask, id: task.ID, name: task.Name, hash: taskFingerprint(task),
+		})
+		for _, rel := range taskScripts(task) {
+			if scripts[rel] {
+				continue
+			}
+			scripts[rel] = true
+			res, content := scriptResource(rel, task.Name)
+			if res.skip == "" {
+				state.scripts[rel] = content
+			}
+			state.resources = append(state.resources, res)
+		}
+	}
+	envs := export.Envs[:0]
+	for _, env := range export.Envs {
+		res := managedResource{kind: constant.ManagedKindEnv, id: env.ID, name: env.Name}
+		if env.Type == constant.EnvTypeSecret {
+			res.skip = "机密变量不会同步，需要在子节点上单独创建"
+		} else {
+			res.hash = envFingerprint(env)
+			envs = append(envs, env)
+		}
+		state.resources = append(state.resources, res)
+	}
+	export.Envs = envs
+	return state
+}
+
+// planNode 对比主节点、子节点现状与上次同步的指纹，得到每个资源的动作
+func (s *ManagedSyncService) planNode(rule *models.ManagedSync, node *models.InterconnectNode, desired *desiredState) NodePlan {
+	plan := NodePlan{NodeID: node.ID, NodeName: node.Name, Items: make([]PlanItem, 0)}
+	if !nodeOnline(node) {
+		plan.Error = "节点离线"
+		return plan
+	}
+	remote, err := s.remoteFingerprints(node, desired)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	var states []models.ManagedSyncState
+	database.DB.Where("sync_id = ? AND node_id = ?", rule.ID, node.ID).Find(&states)
+	synced := make(map[string]string, len(states))
+	for _, st := range states {
+		synced[st.Kind+":"+st.ResourceID] = st.Hash
+	}
+
+	managed := make(map[string]bool, len(desired.resources))
+	for _, res := range desired.resources {
+		key := res.kind + ":" + res.id
+		managed[key] = true
+		item := PlanItem{Kind: res.kind, ID: res.id, Name: res.name}
+		if res.skip != "" {
+			item.Action, item.Reason = constant.ManagedActionSkip, res.skip
+			plan.Items = append(plan.Items, item)
+			continue
+		}
+		current, exists := remote[key]
+		last, tracked := synced[key]
+		item.Action, item.Reason = diffAction(res.hash, current, exists, last, tracked, rule.Overwrite)
+		plan.Items = append(plan.Items, item)
+	}
+
+	for _, st := range states {
+		if !managed[st.Kind+":"+st.ResourceID] {
+			plan.Items = append(plan.Items, PlanItem{
+				Kind: st.Kind, ID: st.ResourceID, Name: st.Name,
+				Action: constant.ManagedActionRelease, Reason: "已移出托管范围，子节点上的副本保留",
+			})
+		}
+	}
+	return plan
+}
+
+// diffAction 三方对比：master 为主节点当前指纹，current 为子节点当前指纹，last 为上次同步成功时的指纹
+func diffAction(master, current string, exists bool, last string, tracked bool, overwrite bool) (string, string) {
+	if exists && current == master {
+		return constant.ManagedActionNone, ""
+	}
+	var action, reason string
+	switch {
+	case !exists && !tracked:
+		return constant.ManagedActionCreate, ""
+	case !exists:
+		action, reason = constant.ManagedActionDrift, "子节点上的副本已被删除"
+	case !tracked:
+		action, reason = constant.ManagedActionConflict, "子节点上已存在不同的同名副本"
+	case current == last:
+		return constant.ManagedActionUpdate, ""
+	case master == last:
+		action, reason = constant.ManagedActionDrift, "子节点上的副本已被修改"
+	default:
+		action, reason = constant.ManagedActionConflict, "主节点与子节点都修改了该资源"
+	}
+	if overwrite {
+		return constant.ManagedActionRestore, reason + "，以主节点为准覆盖"
+	}
+	return action, reason
+}
+
+// remoteFingerprints 通过子节点的导出接口读取托管资源的副本并计算指纹
+func (s *ManagedSyncService) remoteFingerprints(node *models.InterconnectNode, desired *desiredState) (map[string]string, error) {
+	req := struct {
+		TaskIDs []string `json:"task_ids"`
+		EnvIDs  []string `json:"env_ids"`
+	}{}
+	for _, res := range desired.resources {
+		switch {
+		case res.skip != "":
+		case res.kind == constant.ManagedKindTask:
+			req.TaskIDs = append(req.TaskIDs, res.id)
+		case res.kind == constant.ManagedKindScript:
+		default:
+			req.EnvIDs = append(req.EnvIDs, res.id)
+		}
+	}
+	body, _ := json.Marshal(req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), managedNodeTimeout)
+	defer cancel()
+	data, err := s.call(ctx, node, "POST", "/api/v1/system/export", nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("读取子节点数据失败: %v", err)
+	}
+	var export models.ExportData
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("解析子节点数据失败: %v", err)
+	}
+
+	result := make(map[string]string, len(export.Tasks)+len(export.Envs))
+	for _, task := range export.Tasks {
+		result[constant.ManagedKindTask+":"+task.ID] = taskFingerprint(task)
+	}
+	for _, env := range export.Envs {
+		result[constant.ManagedKindEnv+":"+env.ID] = envFingerprint(env)
+	}
+	for _, res := range desired.resources {
+		if res.kind == constant.ManagedKindScript && res.skip == "" {
+			if hash, ok := s.remoteScript(ctx, node, res.id); ok {
+				result[constant.ManagedKindScript+":"+res.id] = hash
+			}
+		}
+	}
+	return result, nil
+}
+
+// apply 推送需要新建、更新或覆盖的资源，并更新同步状态
+func (s *ManagedSyncService) apply(rule *models.ManagedSync, node *models.InterconnectNode, desired *desiredState, items []PlanItem) error {
+	hashes := make(map[string]string, len(desired.resources))
+	for _, res := range desired.resources {
+		hashes[res.kind+":"+res.id] = res.hash
+	}
+
+	push := map[string]bool{}
+	for _, item := range items {
+		switch item.Action {
+		case constant.ManagedActionCreate, constant.ManagedActionUpdate, constant.ManagedActionRestore:
+			push[item.Kind+":"+item.ID] = true
+		}
+	}
+
+	var pushErr error
+	if len(push) > 0 {
+		pushErr = s.push(node, desired, push)
+	}
+
+	now := models.Now()
+	for _, item := range items {
+		key := item.Kind + ":" + item.ID
+		where := database.DB.Where("sync_id = ? AND node_id = ? AND kind = ? AND resource_id = ?", rule.ID, node.ID, item.Kind, item.ID)
+		switch item.Action {
+		case constant.ManagedActionSkip:
+			continue
+		case constant.ManagedActionRelease:
+			where.Delete(&models.ManagedSyncState{})
+			continue
+		}
+
+		state := models.ManagedSyncState{SyncID: rule.ID, NodeID: node.ID, Kind: item.Kind, ResourceID: item.ID, Name: item.Name}
+		where.Limit(1).Find(&state)
+		if state.ID == "" {
+			state.ID = utils.GenerateID()
+		}
+		state.Name = item.Name
+		state.Message = item.Reason
+		switch {
+		case push[key] && pushErr != nil:
+			state.Status, state.Message = constant.ManagedStatusError, truncateMessage(pushErr.Error(), 500)
+		case push[key] || item.Action == constant.ManagedActionNone:
+			state.Status, state.Hash, state.SyncedAt = constant.ManagedStatusSynced, hashes[key], &now
+		case item.Action == constant.ManagedActionDrift:
+			state.Status = constant.ManagedStatusDrift
+		default:
+			state.Status = constant.ManagedStatusConflict
+		}
+		database.DB.Save(&state)
+	}
+	return pushErr
+}
+
+// push 先通过文件接口写入选中的脚本，再通过子节点的导入接口写入选中的任务与变量，同时带上这些任务的标签定义与通知规则
+func (s *ManagedSyncService) push(node *models.InterconnectNode, desired *desiredState, push map[string]bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), managedNodeTimeout)
+	defer cancel()
+	rels := make([]string, 0, len(desired.scripts))
+	for rel := range desired.scripts {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		if push[constant.ManagedKindScript+":"+rel] {
+			if err := s.pushScript(ctx, node, rel, desired.scripts[rel]); err != nil {
+				return err
+			}
+		}
+	}
+
+	export := desired.export
+	data := models.NewExportData()
+	taskIDs := map[string]bool{}
+	for _, task := range export.Tasks {
+		if push[constant.ManagedKindTask+":"+task.ID] {
+			data.Tasks = append(data.Tasks, task)
+			taskIDs[task.ID] = true
+		}
+	}
+	for _, env := range export.Envs {
+		if push[constant.ManagedKindEnv+":"+env.ID] {
+			data.Envs = append(data.Envs, env)
+		}
+	}
+	for _, binding := range export.Bindings {
+		if taskIDs[binding.DataID] {
+			data.Bindings = append(data.Bindings, binding)
+		}
+	}
+	if len(data.Tasks) == 0 && len(data.Envs) == 0 {
+		return nil
+	}
+	data.Tags = export.Tags
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := s.call(ctx, node, "POST", "/api/v1/system/import", nil, body); err != nil {
+		return fmt.Errorf("写入子节点失败: %v", err)
+	}
+	return nil
+}
+
+// taskFingerprint 任务内容指纹，忽略运行状态与时间戳
+func taskFingerprint(task models.Task) string {
+	task.RunningGo = ""
+	task.LastRun, task.NextRun = nil, nil
+	task.CreatedAt, task.UpdatedAt = models.LocalTime{}, models.LocalTime{}
+	task.Tags = sortedList(task.Tags)
+	task.Envs = models.BigText(sortedList(string(task.Envs)))
+	return fingerprint(task)
+}
+
+// envFingerprint 环境变量内容指纹，忽略所属用户与时间戳（导入时归属子节点的管理员）
+func envFingerprint(env models.EnvironmentVariable) string {
+	env.UserID = ""
+	env.CreatedAt, env.UpdatedAt = models.LocalTime{}, models.LocalTime{}
+	return fingerprint(env)
+}
+
+func fingerprint(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// splitList 拆分逗号分隔的列表并去除空项
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// sortedList 排序逗号分隔的列表，关联关系的加载顺序不影响指纹
+func sortedList(value string) string {
+	items := splitList(value)
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// truncateMessage 截断过长的错误信息，按字符截断避免破坏多字节字符
+func truncateMessage(msg string, max int) string {
+	if runes := []rune(msg); len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+	return msg
+}
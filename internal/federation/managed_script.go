@@ -0,0 +1,132 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+const managedScriptMaxSize = 1 << 20 // 单个托管脚本的大小上限，超过的需在子节点上单独准备
+
+// taskScripts 任务引用的脚本目录中的文件：同步文件列表以及命令中指向脚本目录的路径，返回相对脚本目录的路径
+func taskScripts(task models.Task) []string {
+	scriptsDir := utils.ResolveAbsScriptsDir()
+	workDir := scriptsDir
+	if task.WorkDir != "" {
+		workDir = strings.Replace(task.WorkDir, constant.ScriptsDirPlaceholder, scriptsDir, 1)
+		if !filepath.IsAbs(workDir) {
+			workDir = filepath.Join(scriptsDir, workDir)
+		}
+	}
+
+	seen := map[string]bool{}
+	var result []string
+	add := func(rel string) {
+		if rel = filepath.ToSlash(filepath.Clean(rel)); rel != "." && !seen[rel] {
+			seen[rel] = true
+			result = append(result, rel)
+		}
+	}
+
+	// 同步文件列表中的路径（含目录）都视为依赖
+	for _, p := range task.SyncFileList() {
+		if rel, ok := scriptsRel(scriptsDir, filepath.Join(scriptsDir, p)); ok {
+			add(rel)
+		}
+	}
+	// 命令中存在于脚本目录内的文件
+	for _, field := range strings.Fields(string(task.Command)) {
+		field = strings.Trim(field, `"'`)
+		if field == "" || strings.HasPrefix(field, "-") {
+			continue
+		}
+		path := strings.Replace(field, constant.ScriptsDirPlaceholder, scriptsDir, 1)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if rel, ok := scriptsRel(scriptsDir, path); ok {
+			add(rel)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// scriptsRel 路径相对脚本目录的位置，不在脚本目录内时返回 false
+func scriptsRel(scriptsDir, path string) (string, bool) {
+	rel, err := filepath.Rel(scriptsDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// scriptResource 读取主节点上的脚本作为托管资源，目录、二进制或过大的文件只报告不同步
+func scriptResource(rel string, taskName string) (managedResource, string) {
+	res := managedResource{kind: constant.ManagedKindScript, id: rel, name: rel}
+	fullPath := filepath.Join(utils.ResolveAbsScriptsDir(), filepath.FromSlash(rel))
+	info, err := os.Stat(fullPath)
+	switch {
+	case err != nil:
+		res.skip = fmt.Sprintf("任务 %s 引用的脚本在主节点上不存在", taskName)
+	case info.IsDir():
+		res.skip = fmt.Sprintf("任务 %s 引用的是目录，目录不会同步，需要在子节点上单独准备", taskName)
+	case info.Size() > managedScriptMaxSize:
+		res.skip = fmt.Sprintf("任务 %s 引用的脚本超过 1MB，需要在子节点上单独准备", taskName)
+	}
+	if res.skip != "" {
+		return res, ""
+	}
+	if isBin, _ := utils.IsBinaryFile(fullPath); isBin {
+		res.skip = fmt.Sprintf("任务 %s 引用的是二进制文件，需要在子节点上单独准备", taskName)
+		return res, ""
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		res.skip = fmt.Sprintf("读取任务 %s 引用的脚本失败: %v", taskName, err)
+		return res, ""
+	}
+	res.hash = fingerprint(string(content))
+	return res, string(content)
+}
+
+// remoteScript 读取子节点上的脚本指纹，读取失败视为不存在
+func (s *ManagedSyncService) remoteScript(ctx context.Context, node *models.InterconnectNode, rel string) (string, bool) {
+	data, err := s.call(ctx, node, "GET", "/api/v1/files/content", url.Values{"path": {rel}}, nil)
+	if err != nil {
+		return "", false
+	}
+	var file struct {
+		Content  string `json:"content"`
+		IsBinary bool   `json:"isBinary"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", false
+	}
+	if file.IsBinary {
+		return "binary", true
+	}
+	return fingerprint(file.Content), true
+}
+
+// pushScript 通过子节点的文件接口写入脚本
+func (s *ManagedSyncService) pushScript(ctx context.Context, node *models.InterconnectNode, rel, content string) error {
+	body, _ := json.Marshal(map[string]string{"path": rel, "content": content})
+	if _, err := s.call(ctx, node, "POST", "/api/v1/files/content", nil, body); err != nil {
+		return fmt.Errorf("写入子节点脚本 %s 失败: %v", rel, err)
+	}
+	return nil
+}
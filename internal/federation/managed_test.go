@@ -0,0 +1,209 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestDiffAction(t *testing.T) {
+	cases := []struct {
+		name      string
+		current   string
+		exists    bool
+		last      string
+		tracked   bool
+		overwrite bool
+		want      string
+	}{
+		{"一致", "m", true, "", false, false, constant.ManagedActionNone},
+		{"新建", "", false, "", false, false, constant.ManagedActionCreate},
+		{"主节点修改", "old", true, "old", true, false, constant.ManagedActionUpdate},
+		{"子节点修改", "edited", true, "m", true, false, constant.ManagedActionDrift},
+		{"子节点删除", "", false, "m", true, false, constant.ManagedActionDrift},
+		{"双方修改", "edited", true, "old", true, false, constant.ManagedActionConflict},
+		{"已存在不同副本", "other", true, "", false, false, constant.ManagedActionConflict},
+		{"覆盖子节点修改", "edited", true, "old", true, true, constant.ManagedActionRestore},
+	}
+	for _, c := range cases {
+		if got, _ := diffAction("m", c.current, c.exists, c.last, c.tracked, c.overwrite); got != c.want {
+			t.Errorf("%s: 期望 %s，实际 %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestManagedSyncDrift(t *testing.T) {
+	setupNodes(t)
+	if err := database.DB.AutoMigrate(&models.ManagedSync{}, &models.ManagedSyncState{}); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+	rule := &models.ManagedSync{ID: "r1", Name: "rule", TaskTag: "prod", NodeIDs: "n1"}
+	database.DB.Create(rule)
+
+	task := models.Task{ID: "t1", Name: "backup", Command: "echo 1", Tags: "prod"}
+	env := models.EnvironmentVariable{ID: "e1", Name: "TOKEN", Value: "abc"}
+	secret := models.EnvironmentVariable{ID: "e2", Name: "SECRET", Type: constant.EnvTypeSecret}
+	desired := &desiredState{
+		export: &models.ExportData{Tasks: []models.Task{task}, Envs: []models.EnvironmentVariable{env}},
+		resources: []managedResource{
+			{kind: constant.ManagedKindTask, id: task.ID, name: task.Name, hash: taskFingerprint(task)},
+			{kind: constant.ManagedKindEnv, id: env.ID, name: env.Name, hash: envFingerprint(env)},
+			{kind: constant.ManagedKindEnv, id: secret.ID, name: secret.Name, skip: "机密变量不会同步"},
+		},
+	}
+
+	// 模拟子节点：导出返回当前副本，导入写入副本
+	child := models.NewExportData()
+	imports := 0
+	s := &ManagedSyncService{call: func(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error) {
+		if path == "/api/v1/system/import" {
+			imports++
+			var data models.ExportData
+			json.Unmarshal(body, &data)
+			if len(data.Tasks) > 0 {
+				child.Tasks = data.Tasks
+			}
+			if len(data.Envs) > 0 {
+				child.Envs = data.Envs
+			}
+			return nil, nil
+		}
+		return json.Marshal(child)
+	}}
+	node := &models.InterconnectNode{ID: "n1", Name: "a-node", Status: "online"}
+	actions := func() map[string]string {
+		plan := s.planNode(rule, node, desired)
+		if plan.Error != "" {
+			t.Fatalf("生成同步计划失败: %s", plan.Error)
+		}
+		result := map[string]string{}
+		for _, item := range plan.Items {
+			result[item.ID] = item.Action
+		}
+		if err := s.apply(rule, node, desired, plan.Items); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		return result
+	}
+
+	got := actions()
+	if got["t1"] != constant.ManagedActionCreate || got["e1"] != constant.ManagedActionCreate || got["e2"] != constant.ManagedActionSkip || imports != 1 {
+		t.Fatalf("首次同步应新建副本并跳过机密变量: %v", got)
+	}
+	if got = actions(); got["t1"] != constant.ManagedActionNone || imports != 1 {
+		t.Fatalf("无变化时不应推送: %v", got)
+	}
+
+	// 子节点修改了任务：报告漂移且不覆盖
+	child.Tasks[0].Command = "echo edited"
+	if got = actions(); got["t1"] != constant.ManagedActionDrift || imports != 1 {
+		t.Fatalf("子节点修改应报告漂移: %v", got)
+	}
+	var state models.ManagedSyncState
+	database.DB.Where("resource_id = ?", "t1").First(&state)
+	if state.Status != constant.ManagedStatusDrift {
+		t.Errorf("同步状态应为漂移: %+v", state)
+	}
+
+	// 开启覆盖后以主节点为准恢复
+	rule.Overwrite = true
+	if got = actions(); got["t1"] != constant.ManagedActionRestore || child.Tasks[0].Command != "echo 1" {
+		t.Fatalf("开启覆盖后应恢复子节点副本: %v %s", got, child.Tasks[0].Command)
+	}
+
+	// 移出托管范围后释放同步状态
+	desired.resources = desired.resources[1:]
+	if got = actions(); got["t1"] != constant.ManagedActionRelease {
+		t.Fatalf("移出托管范围的资源应释放: %v", got)
+	}
+	var count int64
+	database.DB.Model(&models.ManagedSyncState{}).Where("resource_id = ?", "t1").Count(&count)
+	if count != 0 {
+		t.Error("释放后应删除同步状态")
+	}
+}
+
+func TestManagedSyncScripts(t *testing.T) {
+	setupNodes(t)
+	if err := database.DB.AutoMigrate(&models.ManagedSync{}, &models.ManagedSyncState{}); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+	scriptsDir := t.TempDir()
+	t.Setenv("BH_SCRIPTS_DIR", scriptsDir)
+	os.MkdirAll(filepath.Join(scriptsDir, "jobs"), 0755)
+	os.MkdirAll(filepath.Join(scriptsDir, "lib"), 0755)
+	os.WriteFile(filepath.Join(scriptsDir, "jobs", "backup.py"), []byte("print(1)\n"), 0644)
+
+	task := models.Task{ID: "t1", Name: "backup", Command: "python3 jobs/backup.py --full missing.py", SyncFiles: "lib"}
+	if got := taskScripts(task); len(got) != 2 || got[0] != "jobs/backup.py" || got[1] != "lib" {
+		t.Fatalf("任务引用的脚本不正确: %v", got)
+	}
+
+	rule := &models.ManagedSync{ID: "r1", Name: "rule", TaskTag: "prod", NodeIDs: "n1"}
+	desired := &desiredState{export: &models.ExportData{Tasks: []models.Task{task}}, scripts: map[string]string{}}
+	desired.resources = append(desired.resources, managedResource{kind: constant.ManagedKindTask, id: task.ID, name: task.Name, hash: taskFingerprint(task)})
+	for _, rel := range taskScripts(task) {
+		res, content := scriptResource(rel, task.Name)
+		if res.skip == "" {
+			desired.scripts[rel] = content
+		}
+		desired.resources = append(desired.resources, res)
+	}
+
+	// 模拟子节点：文件接口读写脚本，导出接口返回已导入的任务
+	child := models.NewExportData()
+	files := map[string]string{}
+	s := &ManagedSyncService{call: func(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error) {
+		switch path {
+		case "/api/v1/files/content":
+			if method == "POST" {
+				var req map[string]string
+				json.Unmarshal(body, &req)
+				files[req["path"]] = req["content"]
+				return nil, nil
+			}
+			content, ok := files[query.Get("path")]
+			if !ok {
+				return nil, fmt.Errorf("文件不存在")
+			}
+			return json.Marshal(map[string]interface{}{"content": content, "isBinary": false})
+		case "/api/v1/system/import":
+			var data models.ExportData
+			json.Unmarshal(body, &data)
+			child.Tasks = data.Tasks
+			return nil, nil
+		}
+		return json.Marshal(child)
+	}}
+	node := &models.InterconnectNode{ID: "n1", Name: "a-node", Status: "online"}
+	plan := s.planNode(rule, node, desired)
+	actions := map[string]PlanItem{}
+	for _, item := range plan.Items {
+		actions[item.ID] = item
+	}
+	if actions["jobs/backup.py"].Action != constant.ManagedActionCreate || actions["lib"].Action != constant.ManagedActionSkip {
+		t.Fatalf("脚本应同步，目录应在报告中标出: %+v", plan.Items)
+	}
+	if err := s.apply(rule, node, desired, plan.Items); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if files["jobs/backup.py"] != "print(1)\n" || len(child.Tasks) != 1 {
+		t.Fatalf("脚本与任务应写入子节点: %v %d", files, len(child.Tasks))
+	}
+
+	// 子节点修改脚本后报告漂移
+	files["jobs/backup.py"] = "print(2)\n"
+	for _, item := range s.planNode(rule, node, desired).Items {
+		if item.ID == "jobs/backup.py" && item.Action != constant.ManagedActionDrift {
+			t.Errorf("子节点修改脚本应报告漂移: %+v", item)
+		}
+	}
+}
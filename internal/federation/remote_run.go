@@ -0,0 +1,511 @@
+package federation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/tunnel"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+const (
+	remoteRunOutputLimit  = 64 * 1024        // 本地保存的输出末尾字节数
+	remoteRunLogWait      = 2 * time.Minute  // 等待子节点任务出队并创建日志的最长时间
+	remoteRunReconnect    = 3 * time.Second  // 日志流断开后的重连间隔
+	remoteRunMaxReconnect = 10               // 连续重连失败次数上限
+	remoteRunCallTimeout  = 15 * time.Second // 触发执行、查询日志等普通请求的超时时间
+	remoteRunIdleTimeout  = time.Minute      // 日志流超过该时间没有任何数据（含心跳）视为连接失效
+)
+
+// RunFrame 转发给前端的日志帧，格式与子节点 /logs/sse 一致
+type RunFrame struct {
+	Type     string `json:"type"` // log 或 finish
+	Text     string `json:"text"`
+	Status   string `json:"status,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	EndTime  string `json:"end_time,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// runStream 进行中的远程执行，缓存输出并分发给订阅者
+type runStream struct {
+	mu     sync.Mutex
+	output []byte
+	subs   map[chan RunFrame]struct{}
+}
+
+// RemoteRunService 在子节点上触发任务执行，经隧道订阅子节点的日志流并转发，执行结束后在本地保存结果摘要并发出通知事件
+type RemoteRunService struct {
+	mu     sync.Mutex
+	active map[string]*runStream
+	call   func(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error)
+	stream func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (io.ReadCloser, error)
+	poll   time.Duration
+	idle   time.Duration
+}
+
+var (
+	remoteRunService     *RemoteRunService
+	remoteRunServiceOnce sync.Once
+)
+
+// GetRemoteRunService 获取远程执行服务单例
+func GetRemoteRunService() *RemoteRunService {
+	remoteRunServiceOnce.Do(func() {
+		remoteRunService = &RemoteRunService{
+			active: make(map[string]*runStream),
+			call:   callNode,
+			stream: streamNode,
+			poll:   time.Second,
+			idle:   remoteRunIdleTimeout,
+		}
+	})
+	return remoteRunService
+}
+
+// CleanupInterrupted 面板重启后无法继续跟踪的远程执行标记为失败
+func (s *RemoteRunService) CleanupInterrupted() {
+	now := models.Now()
+	database.DB.Model(&models.RemoteRun{}).
+		Where("status IN ?", []string{constant.TaskStatusQueued, constant.TaskStatusRunning}).
+		Updates(map[string]interface{}{"status": constant.TaskStatusFailed, "error": "面板重启，已停止跟踪子节点上的执行", "finished_at": &now})
+}
+
+// Run 在子节点上执行任务，立即返回执行记录，日志在后台持续转发
+func (s *RemoteRunService) Run(nodeID, taskID string, envs map[string]string, operator string) (*models.RemoteRun, error) {
+	var node models.InterconnectNode
+	if err := database.DB.Where("id = ?", nodeID).First(&node).Error; err != nil {
+		return nil, errors.New("子节点不存在")
+	}
+	if !nodeOnline(&node) {
+		return nil, errors.New("子节点离线")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteRunCallTimeout)
+	defer cancel()
+
+	data, err := s.call(ctx, &node, "GET", "/api/v1/tasks/"+url.PathEscape(taskID), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取子节点任务失败: %v", err)
+	}
+	var task struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(data, &task)
+
+	// 记录触发前最新的日志，旧版本子节点不返回日志 ID 时以之后出现的新日志作为本次执行
+	baseline, err := s.latestLog(ctx, &node, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"envs": envs})
+	data, err = s.call(ctx, &node, "POST", "/api/v1/execute/task/"+url.PathEscape(taskID), nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("触发子节点执行失败: %v", err)
+	}
+	var result struct {
+		Success   bool   `json:"success"`
+		Error     string `json:"error"`
+		LogID     string `json:"log_id"`
+		QueuedLog string `json:"queued_log_id"`
+	}
+	json.Unmarshal(data, &result)
+	if !result.Success {
+		return nil, fmt.Errorf("子节点拒绝执行: %s", result.Error)
+	}
+	if result.LogID == "" {
+		result.LogID = result.QueuedLog
+	}
+
+	run := &models.RemoteRun{
+		ID:        utils.GenerateID(),
+		NodeID:    node.ID,
+		NodeName:  node.Name,
+		TaskID:    taskID,
+		TaskName:  task.Name,
+		LogID:     result.LogID,
+		Status:    constant.TaskStatusQueued,
+		Operator:  operator,
+		StartedAt: models.Now(),
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.active[run.ID] = &runStream{subs: make(map[chan RunFrame]struct{})}
+	s.mu.Unlock()
+
+	// 后台跟踪使用独立副本，避免与返回给调用方的记录并发读写
+	tracked := *run
+	go s.follow(&tracked, &node, baseline)
+	return run, nil
+}
+
+// List 分页获取远程执行记录，列表不返回输出内容
+func (s *RemoteRunService) List(nodeID string, p utils.Pagination) ([]models.RemoteRun, int64) {
+	query := database.DB.Model(&models.RemoteRun{})
+	if nodeID != "" {
+		query = query.Where("node_id = ?", nodeID)
+	}
+	var total int64
+	query.Count(&total)
+
+	var runs []models.RemoteRun
+	query.Omit("output").Order("started_at DESC").Offset(p.Offset()).Limit(p.PageSize).Find(&runs)
+	return runs, total
+}
+
+// Get 获取远程执行记录
+func (s *RemoteRunService) Get(id string) (*models.RemoteRun, error) {
+	var run models.RemoteRun
+	if err := database.DB.Where("id = ?", id).First(&run).Error; err != nil {
+		return nil, errors.New("执行记录不存在")
+	}
+	return &run, nil
+}
+
+// Subscribe 订阅进行中的远程执行，返回已缓存的输出与后续日志帧；执行已结束时 ok 为 false
+func (s *RemoteRunService) Subscribe(runID string) (history string, frames <-chan RunFrame, cancel func(), ok bool) {
+	s.mu.Lock()
+	rs := s.active[runID]
+	s.mu.Unlock()
+	if rs == nil {
+		return "", nil, nil, false
+	}
+
+	ch := make(chan RunFrame, 64)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	history = string(rs.output)
+	rs.subs[ch] = struct{}{}
+	return history, ch, func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if _, exists := rs.subs[ch]; exists {
+			delete(rs.subs, ch)
+			close(ch)
+		}
+	}, true
+}
+
+// follow 等待子节点开始执行后持续转发日志直到结束
+func (s *RemoteRunService) follow(run *models.RemoteRun, node *models.InterconnectNode, baseline string) {
+	logID, err := s.waitLog(node, run.TaskID, run.LogID, baseline)
+	if err != nil {
+		s.finish(run, RunFrame{Type: "finish", Status: constant.TaskStatusFailed}, err.Error())
+		return
+	}
+	run.LogID = logID
+	run.Status = constant.TaskStatusRunning
+	database.DB.Model(&models.RemoteRun{}).Where("id = ?", run.ID).
+		Updates(map[string]interface{}{"log_id": logID, "status": constant.TaskStatusRunning})
+
+	failures := 0
+	cursor := &streamCursor{}
+	for {
+		received, final, err := s.readStream(run, node, logID, cursor)
+		if final != nil {
+			s.finish(run, *final, "")
+			return
+		}
+		if received {
+			failures = 0
+		}
+		if failures++; failures > remoteRunMaxReconnect {
+			s.finish(run, RunFrame{Type: "finish", Status: constant.TaskStatusFailed}, fmt.Sprintf("与子节点的日志连接中断: %v", err))
+			return
+		}
+		s.publish(run.ID, RunFrame{Type: "log", Text: "\n[System] 与子节点的日志连接中断，正在重连...\n"})
+		time.Sleep(remoteRunReconnect)
+	}
+}
+
+// latestLog 子节点上该任务最新的日志 ID
+func (s *RemoteRunService) latestLog(ctx context.Context, node *models.InterconnectNode, taskID string) (string, error) {
+	data, err := s.call(ctx, node, "GET", "/api/v1/logs", url.Values{"task_id": {taskID}, "page": {"1"}, "page_size": {"1"}}, nil)
+	if err != nil {
+		return "", fmt.Errorf("获取子节点日志失败: %v", err)
+	}
+	page, err := parsePaginated(data)
+	if err != nil {
+		return "", err
+	}
+	if len(page.items) == 0 {
+		return "", nil
+	}
+	id, _ := page.items[0]["id"].(string)
+	return id, nil
+}
+
+// waitLog 等待子节点创建本次执行的日志：已知日志 ID 时轮询该日志，否则轮询日志列表直到出现新日志
+func (s *RemoteRunService) waitLog(node *models.InterconnectNode, taskID, logID, baseline string) (string, error) {
+	deadline := time.Now().Add(remoteRunLogWait)
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), remoteRunCallTimeout)
+		if logID != "" {
+			_, err := s.call(ctx, node, "GET", "/api/v1/logs/"+url.PathEscape(logID), nil, nil)
+			cancel()
+			if err == nil {
+				return logID, nil
+			}
+			time.Sleep(s.poll)
+			continue
+		}
+		id, err := s.latestLog(ctx, node, taskID)
+		cancel()
+		if err == nil && id != "" && id != baseline {
+			return id, nil
+		}
+		time.Sleep(s.poll)
+	}
+	return "", errors.New("等待子节点开始执行超时，任务可能仍在队列中")
+}
+
+// streamCursor 记录已从子节点收到的日志，重连时据此去掉子节点重放的部分
+type streamCursor struct {
+	seen    string // 已收到的子节点输出末尾，不含连接提示
+	resumed bool   // 之前的连接已收到过连接提示，本次为重连
+}
+
+// add 记录收到的子节点输出
+func (c *streamCursor) add(text string) {
+	c.seen += text
+	if over := len(c.seen) - remoteRunOutputLimit; over > 0 {
+		c.seen = c.seen[over:]
+	}
+}
+
+// unseen 去掉重放内容中已经收到过的开头部分：重放从某一行的行首开始，取与已收到输出末尾重叠最长的位置
+func (c *streamCursor) unseen(replay string) string {
+	for k := min(len(c.seen), len(replay)); k > 0; k-- {
+		start := len(c.seen) - k
+		if (start == 0 || c.seen[start-1] == '\n') && c.seen[start:] == replay[:k] {
+			return replay[k:]
+		}
+	}
+	return replay
+}
+
+// readStream 读取一次子节点日志流，返回是否收到过数据以及结束帧；超过空闲时间没有数据时断开。
+// 子节点每次连接都会先推送连接提示和最近 100 行日志，已结束的日志则直接推送包含完整输出的结束帧，
+// 重连时跳过连接提示，并只转发重放内容中尚未收到的部分
+func (s *RemoteRunService) readStream(run *models.RemoteRun, node *models.InterconnectNode, logID string, cursor *streamCursor) (bool, *RunFrame, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	body, err := s.stream(ctx, node, "/api/v1/logs/sse", url.Values{"log_id": {logID}})
+	if err != nil {
+		return false, nil, err
+	}
+	defer body.Close()
+
+	var idle atomic.Bool
+	timer := time.AfterFunc(s.idle, func() {
+		idle.Store(true)
+		cancel()
+		body.Close()
+	})
+	defer timer.Stop()
+
+	received := false
+	resuming := cursor.resumed
+	frames := 0
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			// 日志帧与心跳都表明连接存活
+			received = true
+			timer.Reset(s.idle)
+		}
+		if data, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "data:"); ok {
+			var frame RunFrame
+			if json.Unmarshal([]byte(strings.TrimSpace(data)), &frame) == nil {
+				frames++
+				if frame.Type == "finish" {
+					if resuming && frames == 1 {
+						frame.Text = cursor.unseen(frame.Text)
+					}
+					return received, &frame, nil
+				}
+				banner := frames == 1 && strings.HasPrefix(frame.Text, "[System] 连接成功")
+				switch {
+				case banner:
+					cursor.resumed = true
+				case resuming && frames == 2:
+					frame.Text = cursor.unseen(frame.Text)
+					cursor.add(frame.Text)
+				default:
+					cursor.add(frame.Text)
+				}
+				if frame.Text != "" && !(banner && resuming) {
+					s.publish(run.ID, frame)
+				}
+			}
+		}
+		if err != nil {
+			if idle.Load() {
+				err = fmt.Errorf("日志流超过 %s 没有数据", s.idle)
+			} else if err == io.EOF {
+				err = errors.New("日志流已关闭")
+			}
+			return received, nil, err
+		}
+	}
+}
+
+// publish 缓存输出并分发给订阅者，订阅者处理不过来时丢弃该帧
+func (s *RemoteRunService) publish(runID string, frame RunFrame) {
+	s.mu.Lock()
+	rs := s.active[runID]
+	s.mu.Unlock()
+	if rs == nil {
+		return
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.output = append(rs.output, frame.Text...)
+	if over := len(rs.output) - remoteRunOutputLimit; over > 0 {
+		rs.output = rs.output[over:]
+	}
+	for ch := range rs.subs {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+// finish 保存执行结果摘要，结束订阅并发出通知事件
+func (s *RemoteRunService) finish(run *models.RemoteRun, frame RunFrame, errMsg string) {
+	if errMsg != "" {
+		frame.Text = "\n[System] " + errMsg + "\n"
+	}
+	s.publish(run.ID, frame)
+
+	s.mu.Lock()
+	rs := s.active[run.ID]
+	delete(s.active, run.ID)
+	s.mu.Unlock()
+
+	var output string
+	if rs != nil {
+		rs.mu.Lock()
+		output = strings.ToValidUTF8(string(rs.output), "")
+		for ch := range rs.subs {
+			close(ch)
+		}
+		rs.subs = map[chan RunFrame]struct{}{}
+		rs.mu.Unlock()
+	}
+
+	now := models.Now()
+	run.Status = frame.Status
+	if run.Status == "" {
+		run.Status = constant.TaskStatusSuccess
+	}
+	run.ExitCode, run.Duration = frame.ExitCode, frame.Duration
+	run.Error = truncateMessage(errMsg, 500)
+	run.Output = models.BigText(output)
+	run.FinishedAt = &now
+	database.DB.Model(&models.RemoteRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"status": run.Status, "exit_code": run.ExitCode, "duration": run.Duration,
+		"error": run.Error, "output": run.Output, "finished_at": run.FinishedAt,
+	})
+	logger.Infof("[RemoteRun] 子节点 %s 任务 #%s %s 执行结束: %s", run.NodeName, run.TaskID, run.TaskName, run.Status)
+
+	event := constant.EventRemoteTaskFailed
+	if run.Status == constant.TaskStatusSuccess {
+		event = constant.EventRemoteTaskSuccess
+	}
+	// 不使用 task_id 字段，避免按主节点任务 ID 匹配通知绑定
+	eventbus.DefaultBus.Publish(eventbus.Event{
+		Type: event,
+		Payload: map[string]interface{}{
+			"run_id":        run.ID,
+			"node_id":       run.NodeID,
+			"node_name":     run.NodeName,
+			"child_task_id": run.TaskID,
+			"task_name":     run.TaskName,
+			"log_id":        run.LogID,
+			"status":        run.Status,
+			"status_label":  statusLabel(run.Status),
+			"start_time":    run.StartedAt.Time().Format("2006-01-02 15:04:05"),
+			"duration":      run.Duration,
+			"exit_code":     run.ExitCode,
+			"error":         run.Error,
+			"output":        output,
+		},
+	})
+}
+
+func statusLabel(status string) string {
+	switch status {
+	case constant.TaskStatusSuccess:
+		return "成功"
+	case constant.TaskStatusTimeout:
+		return "超时"
+	case constant.TaskStatusCancelled:
+		return "已取消"
+	default:
+		return "失败"
+	}
+}
+
+// streamNode 打开子节点的流式接口，隧道节点经 yamux 会话直接请求
+func streamNode(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (io.ReadCloser, error) {
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var client *http.Client
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(node.URL, "tunnel://") {
+		sess := tunnel.GetSession(node.ID)
+		if sess == nil {
+			return nil, errors.New("节点离线或隧道未建立")
+		}
+		if req, err = http.NewRequestWithContext(ctx, "GET", "http://tunnel.local"+target, nil); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+sess.Token)
+		req.Header.Set("X-Tunnel-Proxy", "true")
+		client = &http.Client{Transport: sess.Transport}
+	} else {
+		if req, err = http.NewRequestWithContext(ctx, "GET", strings.TrimRight(node.URL, "/")+target, nil); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+node.Token)
+		client = http.DefaultClient
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("节点不可达: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("节点返回 HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
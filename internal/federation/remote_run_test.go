@@ -0,0 +1,181 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestRemoteRunRelay(t *testing.T) {
+	setupNodes(t)
+	if err := database.DB.AutoMigrate(&models.RemoteRun{}); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+
+	events := make(chan eventbus.Event, 1)
+	eventbus.DefaultBus.Subscribe(constant.EventRemoteTaskFailed, func(e eventbus.Event) { events <- e })
+
+	// 模拟子节点：触发执行后返回预留的日志 ID l3，同时日志列表出现并发执行的日志 l2，日志流先推送输出再结束
+	triggered := make(chan struct{})
+	release := make(chan struct{})
+	s := &RemoteRunService{active: make(map[string]*runStream), poll: 10 * time.Millisecond, idle: time.Second}
+	s.call = func(ctx context.Context, node *models.InterconnectNode, method, path string, query url.Values, body []byte) (json.RawMessage, error) {
+		switch {
+		case path == "/api/v1/tasks/t1":
+			return json.RawMessage(`{"id":"t1","name":"backup"}`), nil
+		case path == "/api/v1/logs":
+			select {
+			case <-triggered:
+				return json.RawMessage(`{"data":[{"id":"l2"}],"total":3}`), nil
+			default:
+				return json.RawMessage(`{"data":[{"id":"l1"}],"total":1}`), nil
+			}
+		case path == "/api/v1/logs/l3":
+			return json.RawMessage(`{"id":"l3"}`), nil
+		case path == "/api/v1/execute/task/t1" && method == "POST":
+			if !strings.Contains(string(body), `"FOO":"bar"`) {
+				t.Errorf("应传递环境变量: %s", body)
+			}
+			close(triggered)
+			return json.RawMessage(`{"task_id":"t1","queued_log_id":"l3","success":true,"status":"queued"}`), nil
+		}
+		t.Errorf("意外的请求 %s %s", method, path)
+		return nil, nil
+	}
+	s.stream = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (io.ReadCloser, error) {
+		if query.Get("log_id") != "l3" {
+			t.Errorf("应订阅本次执行的日志: %v", query)
+		}
+		r, w := io.Pipe()
+		go func() {
+			io.WriteString(w, "event:message\ndata:{\"type\":\"log\",\"text\":\"step 1\\n\"}\n\n")
+			<-release
+			io.WriteString(w, "event:message\ndata:{\"type\":\"finish\",\"text\":\"done\\n\",\"status\":\"failed\",\"duration\":1200,\"exit_code\":2}\n\n")
+			w.Close()
+		}()
+		return r, nil
+	}
+
+	if _, err := s.Run("n3", "t1", nil, "admin"); err == nil {
+		t.Error("离线子节点应拒绝执行")
+	}
+	run, err := s.Run("n1", "t1", map[string]string{"FOO": "bar"}, "admin")
+	if err != nil {
+		t.Fatalf("远程执行失败: %v", err)
+	}
+	if run.TaskName != "backup" || run.LogID != "l3" || run.Status != constant.TaskStatusQueued {
+		t.Errorf("执行记录不正确: %+v", run)
+	}
+
+	_, frames, cancel, ok := s.Subscribe(run.ID)
+	if !ok {
+		t.Fatal("进行中的执行应可订阅")
+	}
+	defer cancel()
+	if frame := <-frames; frame.Text != "step 1\n" {
+		t.Errorf("应转发子节点日志: %+v", frame)
+	}
+	close(release)
+
+	var last RunFrame
+	for frame := range frames {
+		last = frame
+	}
+	if last.Type != "finish" || last.ExitCode != 2 {
+		t.Errorf("应转发结束帧: %+v", last)
+	}
+
+	select {
+	case e := <-events:
+		payload := e.Payload.(map[string]interface{})
+		if payload["node_name"] != "a-node" || payload["child_task_id"] != "t1" || payload["status_label"] != "失败" {
+			t.Errorf("通知事件内容不正确: %v", payload)
+		}
+		if _, exists := payload["task_id"]; exists {
+			t.Error("通知事件不应包含 task_id，以免匹配主节点任务的绑定")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("执行结束后应发出通知事件")
+	}
+
+	saved, _ := s.Get(run.ID)
+	if saved.LogID != "l3" || saved.Status != constant.TaskStatusFailed || saved.ExitCode != 2 || saved.Duration != 1200 ||
+		string(saved.Output) != "step 1\ndone\n" || saved.FinishedAt == nil {
+		t.Errorf("本地保存的结果不正确: %+v", saved)
+	}
+	if _, _, _, ok := s.Subscribe(run.ID); ok {
+		t.Error("已结束的执行不应再可订阅")
+	}
+}
+
+func TestRemoteRunStreamIdle(t *testing.T) {
+	// 子节点连接仍在但不再推送任何数据
+	s := &RemoteRunService{active: make(map[string]*runStream), idle: 50 * time.Millisecond}
+	s.stream = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (io.ReadCloser, error) {
+		r, w := io.Pipe()
+		go func() {
+			io.WriteString(w, ": ping\n\n")
+			<-ctx.Done()
+			w.Close()
+		}()
+		return r, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		received, final, err := s.readStream(&models.RemoteRun{ID: "r1"}, &models.InterconnectNode{ID: "n1"}, "l1", &streamCursor{})
+		if !received || final != nil {
+			t.Errorf("心跳应视为收到数据且不应产生结束帧: %v %+v", received, final)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "没有数据") {
+			t.Errorf("空闲超时应返回错误: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("日志流空闲时应断开而不是一直等待")
+	}
+}
+
+func TestRemoteRunStreamReconnect(t *testing.T) {
+	// 子节点每次连接都推送连接提示和最近的日志，第三次连接时日志已结束，直接推送包含完整输出的结束帧
+	banner := `data:{"type":"log","text":"[System] 连接成功，正在监听日志... (LogID: l1)\n"}` + "\n\n"
+	conns := []string{
+		banner + `data:{"type":"log","text":"line1\nline2\n"}` + "\n\n" + `data:{"type":"log","text":"line3\n"}` + "\n\n",
+		banner + `data:{"type":"log","text":"line2\nline3\nline4\n"}` + "\n\n" + `data:{"type":"log","text":"line5\n"}` + "\n\n",
+		`data:{"type":"finish","text":"line1\nline2\nline3\nline4\nline5\nline6\n","status":"success"}` + "\n\n",
+	}
+	s := &RemoteRunService{active: map[string]*runStream{"r1": {subs: make(map[chan RunFrame]struct{})}}, idle: time.Second}
+	s.stream = func(ctx context.Context, node *models.InterconnectNode, path string, query url.Values) (io.ReadCloser, error) {
+		body := conns[0]
+		conns = conns[1:]
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+
+	run, node, cursor := &models.RemoteRun{ID: "r1"}, &models.InterconnectNode{ID: "n1"}, &streamCursor{}
+	for i := 0; i < 2; i++ {
+		if _, final, err := s.readStream(run, node, "l1", cursor); final != nil || err == nil {
+			t.Fatalf("第 %d 次连接应在日志流关闭后返回错误: %+v %v", i+1, final, err)
+		}
+	}
+	_, final, _ := s.readStream(run, node, "l1", cursor)
+	if final == nil || final.Text != "line6\n" {
+		t.Fatalf("结束帧应只保留未收到的输出: %+v", final)
+	}
+
+	want := "[System] 连接成功，正在监听日志... (LogID: l1)\nline1\nline2\nline3\nline4\nline5\n"
+	if got := string(s.active["r1"].output); got != want {
+		t.Errorf("重连后不应重复保存子节点重放的日志:\n%q\n%q", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package logstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSStore 本地文件系统日志存储
+type FSStore struct {
+	root string
+}
+
+// NewFSStore 创建文件系统存储，root 为日志根目录
+func NewFSStore(root string) (*FSStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("文件系统日志存储未配置 path")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	return &FSStore{root: abs}, nil
+}
+
+func (s *FSStore) Name() string {
+	return TypeFS
+}
+
+// resolve 将 key 转换为根目录下的绝对路径，拒绝越出根目录的 key
+func (s *FSStore) resolve(key string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	if p != s.root && !strings.HasPrefix(p, s.root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("非法的日志 key: %s", key)
+	}
+	return p, nil
+}
+
+func (s *FSStore) Put(key string, data []byte) error {
+	p, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免进程中断留下半截文件
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *FSStore) Get(key string) ([]byte, error) {
+	p, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FSStore) Delete(key string) error {
+	p, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package logstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Store S3 兼容对象存储（使用 AWS Signature V4 签名，无需额外 SDK）
+type S3Store struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewS3Store 创建 S3 存储
+func NewS3Store(cfg Config) (*S3Store, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 日志存储需要配置 endpoint 与 bucket")
+	}
+	if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3 日志存储需要配置 access_key 与 secret_key")
+	}
+	if cfg.S3Region == "" {
+		cfg.S3Region = "us-east-1"
+	}
+	cfg.S3Endpoint = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(cfg.S3Endpoint, "https://"), "http://"), "/")
+	cfg.S3Prefix = strings.Trim(cfg.S3Prefix, "/")
+	return &S3Store{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return TypeS3
+}
+
+func (s *S3Store) Put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s.errorFrom(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, s.errorFrom(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *S3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s.errorFrom(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) errorFrom(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 请求失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// objectURL 构造对象地址，返回请求 URL、Host 与规范化 URI
+func (s *S3Store) objectURL(key string) (string, string, string) {
+	scheme := "http"
+	if s.cfg.S3UseSSL {
+		scheme = "https"
+	}
+	objectKey := key
+	if s.cfg.S3Prefix != "" {
+		objectKey = s.cfg.S3Prefix + "/" + key
+	}
+
+	host := s.cfg.S3Endpoint
+	uri := "/" + encodePath(objectKey)
+	if s.cfg.S3PathStyle {
+		uri = "/" + s.cfg.S3Bucket + uri
+	} else {
+		host = s.cfg.S3Bucket + "." + host
+	}
+	return scheme + "://" + host + uri, host, uri
+}
+
+// do 发送带 SigV4 签名的请求
+func (s *S3Store) do(method, key string, body []byte) (*http.Response, error) {
+	rawURL, host, uri := s.objectURL(key)
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/zstd")
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{method, uri, "", canonicalHeaders, signedHeaders, payloadHash}, "\n")
+
+	scope := dateStamp + "/" + s.cfg.S3Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.S3SecretKey), dateStamp)
+	signingKey = hmacSHA256(signingKey, s.cfg.S3Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.S3AccessKey, scope, signedHeaders, signature))
+
+	return s.client.Do(req)
+}
+
+// encodePath 按 S3 规范对对象 key 的每一段进行 URI 编码，保留分隔符 /
+func encodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,131 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/systime"
+)
+
+// 存储后端类型
+const (
+	TypeDB = "db" // 默认：日志压缩后存放在数据库 TaskLog.Output 字段中
+	TypeFS = "fs" // 本地文件系统，每条日志一个 zstd 文件，按日期分目录
+	TypeS3 = "s3" // S3 兼容对象存储
+)
+
+// ErrNotFound 日志对象不存在
+var ErrNotFound = errors.New("日志对象不存在")
+
+// Store 日志存储后端接口，存取的数据均为完整的 zstd 压缩帧
+type Store interface {
+	// Name 返回后端类型名称，会记录在 TaskLog.Storage 中用于读取时定位后端
+	Name() string
+	// Put 写入（或覆盖）指定 key 的日志对象
+	Put(key string, data []byte) error
+	// Get 读取指定 key 的日志对象，不存在时返回 ErrNotFound
+	Get(key string) ([]byte, error)
+	// Delete 删除指定 key 的日志对象，对象不存在时不返回错误
+	Delete(key string) error
+}
+
+// Config 日志存储配置
+type Config struct {
+	Type        string // db, fs, s3
+	Path        string // fs: 日志根目录
+	S3Endpoint  string // s3: 服务地址，如 s3.amazonaws.com、minio.local:9000
+	S3Region    string // s3: 区域，默认 us-east-1
+	S3Bucket    string // s3: 存储桶
+	S3AccessKey string // s3: Access Key
+	S3SecretKey string // s3: Secret Key
+	S3Prefix    string // s3: 对象 key 前缀
+	S3UseSSL    bool   // s3: 是否使用 HTTPS
+	S3PathStyle bool   // s3: 是否使用路径风格访问 (MinIO 等通常需要开启)
+}
+
+var (
+	mu       sync.RWMutex
+	config   Config
+	current  Store
+	backends = make(map[string]Store)
+)
+
+// Init 根据配置初始化日志存储后端，type 为空或 db 时日志继续保存在数据库中
+func Init(cfg Config) error {
+	store, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+	current = store
+	if store != nil {
+		backends[store.Name()] = store
+		logger.Infof("[LogStore] 任务日志存储后端: %s", store.Name())
+	}
+	return nil
+}
+
+// New 根据配置创建存储后端实例，db 类型返回 nil
+func New(cfg Config) (Store, error) {
+	switch cfg.Type {
+	case "", TypeDB:
+		return nil, nil
+	case TypeFS:
+		return NewFSStore(cfg.Path)
+	case TypeS3:
+		return NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("不支持的日志存储类型: %s", cfg.Type)
+	}
+}
+
+// Current 返回当前用于写入新日志的后端，nil 表示写入数据库
+func Current() Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Open 按名称获取后端，用于读取或删除历史日志
+// 切换存储类型后，旧后端会按同一份配置按需创建，保证历史日志仍可读取
+func Open(name string) (Store, error) {
+	mu.RLock()
+	s, ok := backends[name]
+	cfg := config
+	mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	cfg.Type = name
+	s, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("日志存储后端 %s 不是外部存储", name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if existing, ok := backends[name]; ok {
+		return existing, nil
+	}
+	backends[name] = s
+	return s, nil
+}
+
+// KeyFor 生成日志对象 key，按日期分片：2006/01/02/<logID>.zst
+func KeyFor(logID string, t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return path.Join(systime.InCST(t).Format("2006/01/02"), logID+".zst")
+}
@@ -0,0 +1,42 @@
+package logstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyFor(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 10, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	if got := KeyFor("abc", ts); got != "2024/03/05/abc.zst" {
+		t.Fatalf("unexpected key: %s", got)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	store, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "2024/03/05/abc.zst"
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Put(key, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Get(key)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("unexpected get result: %q %v", data, err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("delete missing object should not fail: %v", err)
+	}
+
+	if err := store.Put("../escape.zst", []byte("x")); err == nil {
+		t.Fatal("expected error for key outside root")
+	}
+}
@@ -0,0 +1,281 @@
+// Package metrics 轻量的 Prometheus 文本格式指标输出（exposition format 0.0.4）
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus 文本格式的响应类型
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Sample 单个样本
+type Sample struct {
+	Labels []string // 与 Family.LabelNames 一一对应的标签值
+	Value  float64
+}
+
+// Family 同名指标的集合
+type Family struct {
+	Name       string
+	Help       string
+	Type       string
+	LabelNames []string
+	Samples    []Sample
+
+	histogram []histSample // 直方图的 _bucket/_sum/_count 样本
+}
+
+// Collector 指标采集器，每次输出时调用
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc 函数形式的采集器
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册采集器
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText 以 Prometheus 文本格式输出全部指标，按指标名称排序
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		writeFamily(bw, f)
+	}
+	return bw.Flush()
+}
+
+func writeFamily(w *bufio.Writer, f Family) {
+	if f.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+	for _, s := range f.Samples {
+		writeSample(w, f.Name, f.LabelNames, s.Labels, s.Value)
+	}
+	for _, s := range f.histogram {
+		writeSample(w, f.Name+s.suffix, s.labelNames, s.labelValues, s.value)
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, ln := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			v := ""
+			if i < len(labelValues) {
+				v = labelValues[i]
+			}
+			w.WriteString(ln)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(v))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// labelKey 将标签值拼接为 map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	name, help string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// NewCounterVec 创建带标签的计数器
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labelNames: labelNames, values: make(map[string]*Sample)}
+}
+
+// Add 为指定标签的计数器增加 delta
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := labelKey(labelValues)
+	s, ok := c.values[key]
+	if !ok {
+		s = &Sample{Labels: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.Value += delta
+}
+
+// Inc 指定标签的计数器加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter, LabelNames: c.labelNames}
+	for _, s := range c.values {
+		f.Samples = append(f.Samples, *s)
+	}
+	sortSamples(f.Samples)
+	return []Family{f}
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	name, help string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // 落入各桶的计数（非累计，不含 +Inf）
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec 创建带标签的直方图，buckets 为递增的上界
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{name: name, help: help, labelNames: labelNames, buckets: b, values: make(map[string]*histogram)}
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := labelKey(labelValues)
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) Collect() []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// 直方图的 _bucket/_sum/_count 需连续输出在同一 TYPE 之下，_bucket 额外带 le 标签
+	bucketLabels := append(append([]string(nil), h.labelNames...), "le")
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	var samples []histSample
+	for _, k := range keys {
+		hist := h.values[k]
+		var cumulative uint64
+		for i, ub := range h.buckets {
+			cumulative += hist.counts[i]
+			samples = append(samples, histSample{"_bucket", bucketLabels, append(append([]string(nil), hist.labels...), formatValue(ub)), float64(cumulative)})
+		}
+		samples = append(samples,
+			histSample{"_bucket", bucketLabels, append(append([]string(nil), hist.labels...), "+Inf"), float64(hist.count)},
+			histSample{"_sum", h.labelNames, hist.labels, hist.sum},
+			histSample{"_count", h.labelNames, hist.labels, float64(hist.count)},
+		)
+	}
+	f.histogram = samples
+	return []Family{f}
+}
+
+// histSample 直方图的单行样本
+type histSample struct {
+	suffix      string
+	labelNames  []string
+	labelValues []string
+	value       float64
+}
+
+func sortSamples(samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool { return labelKey(samples[i].Labels) < labelKey(samples[j].Labels) })
+}
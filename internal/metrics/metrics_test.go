@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	reg := NewRegistry()
+	runs := NewCounterVec("test_runs_total", "Runs.", "task", "status")
+	runs.Inc("a\"b", "ok")
+	runs.Add(2, "a\"b", "ok")
+	dur := NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 5}, "task")
+	dur.Observe(0.5, "x")
+	dur.Observe(3, "x")
+	dur.Observe(10, "x")
+	reg.Register(runs)
+	reg.Register(dur)
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{task="x",le="1"} 1
+test_duration_seconds_bucket{task="x",le="5"} 2
+test_duration_seconds_bucket{task="x",le="+Inf"} 3
+test_duration_seconds_sum{task="x"} 13.5
+test_duration_seconds_count{task="x"} 3
+# HELP test_runs_total Runs.
+# TYPE test_runs_total counter
+test_runs_total{task="a\"b",status="ok"} 3
+`
+	if b.String() != want {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
@@ -126,7 +126,7 @@ func AdminRequired() gin.HandlerFunc {
 func OpenapiRequired() gin.HandlerFunc {
 	settingsSvc := services.NewSettingsService()
 	return func(c *gin.Context) {
-		if checkOpenapiToken(c, settingsSvc) {
+		if allowSDKRelay(c) || checkOpenapiToken(c, settingsSvc) {
 			return
 		}
 		utils.Unauthorized(c, "无效的 OpenAPI 令牌")
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/engigu/baihu-panel/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsTokenAuth 指标接口 Token 认证中间件，未开启指标接口时按不存在处理
+// 抓取端只识别 HTTP 状态码，因此认证失败直接返回 401 而非统一的 JSON 响应
+func MetricsTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := services.GetConfig().Metrics
+		if !cfg.Enabled {
+			c.String(http.StatusNotFound, "404 Not Found")
+			c.Abort()
+			return
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if token == "" {
+			token = c.Query("token")
+		}
+		if token == "" || cfg.Token == "" {
+			c.String(http.StatusUnauthorized, "缺少指标 Token")
+			c.Abort()
+			return
+		}
+
+		// 使用恒定时间比较防止时序攻击
+		h1 := sha256.Sum256([]byte(token))
+		h2 := sha256.Sum256([]byte(cfg.Token))
+		if subtle.ConstantTimeCompare(h1[:], h2[:]) != 1 {
+			c.String(http.StatusUnauthorized, "指标 Token 无效")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
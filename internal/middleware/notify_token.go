@@ -12,6 +12,12 @@ import (
 // NotifyTokenAuth 通知 Token 认证中间件
 func NotifyTokenAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Agent 转发的脚本调用已由运行凭证校验
+		if _, ok := SDKRelayGrant(c); ok {
+			c.Next()
+			return
+		}
+
 		token := c.GetHeader("notify-token")
 		if token == "" {
 			utils.Unauthorized(c, "缺少通知 Token")
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+	"github.com/engigu/baihu-panel/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type sdkRelayKey struct{}
+
+// WithSDKRelay 标记 Agent 代任务脚本转发的 SDK 调用
+// 转发请求由面板在进程内构造，外部请求无法携带该标记；凭证已在构造前校验
+func WithSDKRelay(ctx context.Context, grant tasks.SDKGrant) context.Context {
+	return context.WithValue(ctx, sdkRelayKey{}, grant)
+}
+
+// SDKRelayGrant 转发 SDK 调用所用的凭证
+func SDKRelayGrant(c *gin.Context) (tasks.SDKGrant, bool) {
+	grant, ok := c.Request.Context().Value(sdkRelayKey{}).(tasks.SDKGrant)
+	return grant, ok && grant.TaskID != ""
+}
+
+// allowSDKRelay 转发的 SDK 调用只能操作所属任务及其关联的环境变量，不以管理员身份放行
+// 返回 true 表示已处理该请求
+func allowSDKRelay(c *gin.Context) bool {
+	grant, ok := SDKRelayGrant(c)
+	if !ok {
+		return false
+	}
+	if !sdkRelayPermitted(c, grant) {
+		utils.Forbidden(c, "运行凭证无权访问该接口")
+		c.Abort()
+		return true
+	}
+	c.Set("username", "task:"+grant.TaskID)
+	c.Next()
+	return true
+}
+
+// sdkRelayPermitted 按路由判断调用是否落在凭证所属任务的范围内
+func sdkRelayPermitted(c *gin.Context, grant tasks.SDKGrant) bool {
+	method := c.Request.Method
+	// 面板配置了 URL 前缀时路由带前缀
+	route := c.FullPath()
+	if i := strings.Index(route, "/open2api/v1/"); i > 0 {
+		route = route[i:]
+	}
+	switch route {
+	case "/open2api/v1/env/all":
+		// 环境变量列表按凭证范围过滤
+		return method == http.MethodGet
+	case "/open2api/v1/env/:id":
+		return method != http.MethodPost && grant.AllowsEnv(c.Param("id"))
+	case "/open2api/v1/tasks/:id":
+		return (method == http.MethodGet || method == http.MethodPut) && c.Param("id") == grant.TaskID
+	case "/open2api/v1/tasks/stop/:logID":
+		return c.Param("logID") == grant.LogID
+	case "/open2api/v1/execute/task/:id":
+		return c.Param("id") == grant.TaskID
+	}
+	return false
+}
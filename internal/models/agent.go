@@ -9,6 +9,40 @@ import (
 	"github.com/engigu/baihu-panel/internal/constant"
 )
 
+// AgentCapabilities Agent 握手时上报的能力列表
+type AgentCapabilities []string
+
+// Value 序列化为数据库字符串
+func (c AgentCapabilities) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan 反序列化数据库字符串为能力列表
+func (c *AgentCapabilities) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		str, ok := value.(string)
+		if !ok {
+			return errors.New("invalid type for AgentCapabilities")
+		}
+		bytes = []byte(str)
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, c)
+}
+
 // AgentSchedulerConfig Agent 调度器配置
 type AgentSchedulerConfig struct {
 	WorkerCount  int           `json:"worker_count"`
@@ -43,6 +77,104 @@ func (c *AgentSchedulerConfig) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, c)
 }
 
+// AgentLabels Agent 标签（键值对），用于任务按选择器路由
+type AgentLabels map[string]string
+
+// Value 序列化为数据库字符串
+func (l AgentLabels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan 反序列化数据库字符串为标签
+func (l *AgentLabels) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		str, ok := value.(string)
+		if !ok {
+			return errors.New("invalid type for AgentLabels")
+		}
+		bytes = []byte(str)
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, l)
+}
+
+// AgentRuntime Agent 上通过 mise 安装的语言运行时
+type AgentRuntime struct {
+	Plugin  string `json:"plugin"`
+	Version string `json:"version"`
+}
+
+// AgentRuntimes Agent 上报的运行时列表
+type AgentRuntimes []AgentRuntime
+
+// Value 序列化为数据库字符串
+func (r AgentRuntimes) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan 反序列化数据库字符串为运行时列表
+func (r *AgentRuntimes) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		str, ok := value.(string)
+		if !ok {
+			return errors.New("invalid type for AgentRuntimes")
+		}
+		bytes = []byte(str)
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// AgentLoad Agent 心跳上报的调度器负载
+type AgentLoad struct {
+	WorkerCount  int `json:"worker_count"`  // Worker 总数
+	BusyWorkers  int `json:"busy_workers"`  // 忙碌的 Worker 数
+	QueueSize    int `json:"queue_size"`    // 队列等待数
+	RunningTasks int `json:"running_tasks"` // 正在运行的任务数
+}
+
+// AgentHostMetrics Agent 心跳上报的主机资源
+type AgentHostMetrics struct {
+	CPUPercent  float64 `json:"cpu_percent"`  // CPU 使用率（%）
+	MemTotal    uint64  `json:"mem_total"`    // 内存总量（字节）
+	MemUsed     uint64  `json:"mem_used"`     // 已用内存（字节）
+	MemPercent  float64 `json:"mem_percent"`  // 内存使用率（%）
+	DiskPath    string  `json:"disk_path"`    // 统计磁盘使用的路径（Agent 工作目录所在分区）
+	DiskTotal   uint64  `json:"disk_total"`   // 磁盘总量（字节）
+	DiskUsed    uint64  `json:"disk_used"`    // 磁盘已用（字节）
+	DiskPercent float64 `json:"disk_percent"` // 磁盘使用率（%）
+	Load1       float64 `json:"load1"`        // 1 分钟平均负载，Windows 下为 0
+	Load5       float64 `json:"load5"`
+	Load15      float64 `json:"load15"`
+	Uptime      uint64  `json:"uptime"` // 系统运行时间（秒）
+}
+
 // Agent 远程执行代理
 type Agent struct {
 	ID              string               `json:"id" gorm:"primaryKey;size:20"`
@@ -60,7 +192,16 @@ type Agent struct {
 	Arch            string               `json:"arch" gorm:"size:20"`                           // 架构
 	ForceUpdate     bool                 `json:"force_update" gorm:"default:false"`             // 强制更新标志
 	Enabled         *bool                `json:"enabled" gorm:"default:true"`                   // 是否启用
+	Approval        string               `json:"approval" gorm:"size:20;default:''"`            // 注册审批状态: constant.AgentApproval*
+	PublicKey       string               `json:"public_key" gorm:"size:64;default:''"`          // Agent 上报的 X25519 公钥，下发的变量与机密用其加密
+	PublicKeyAt     *LocalTime           `json:"public_key_at"`                                 // 公钥上报（轮换）时间
+	PendingKey      string               `json:"-" gorm:"size:64;default:''"`                   // 未经旧私钥证明的新公钥，管理员批准后才替换
+	KeyChallenge    string               `json:"-" gorm:"size:64;default:''"`                   // 轮换挑战的 SHA256，Agent 须用旧私钥解出挑战才能直接替换公钥
+	Protocol        int                  `json:"protocol" gorm:"default:0"`                     // 握手上报的协议版本，0 表示未握手的旧版 Agent
+	Capabilities    AgentCapabilities    `json:"capabilities" gorm:"type:text"`                 // 握手上报的能力: constant.AgentCap*
 	SchedulerConfig AgentSchedulerConfig `json:"scheduler_config" gorm:"type:text"`             // 调度配置，以 JSON 字符串形式存储在 Text 类型字段中
+	Labels          AgentLabels          `json:"labels" gorm:"type:text"`                       // 标签，任务可通过标签选择器路由到匹配的 Agent
+	Runtimes        AgentRuntimes        `json:"runtimes" gorm:"type:text"`                     // Agent 上报的 mise 运行时
 	CreatedAt       LocalTime            `json:"created_at"`
 	UpdatedAt       LocalTime            `json:"updated_at"`
 }
@@ -69,6 +210,11 @@ func (Agent) TableName() string {
 	return constant.TablePrefix + "agents"
 }
 
+// Approved 是否已通过注册审批，审批前不下发任务与变量
+func (a *Agent) Approved() bool {
+	return a.Approval == "" || a.Approval == constant.AgentApprovalApproved
+}
+
 // AgentToken Agent 令牌
 type AgentToken struct {
 	ID        string     `json:"id" gorm:"primaryKey;size:20"`
@@ -101,6 +247,7 @@ type AgentTask struct {
 	RandomRange int                 `json:"random_range"`
 	Secrets     []string            `json:"secrets"`
 	Enabled     bool                `json:"enabled"`
+	SyncFiles   []string            `json:"sync_files,omitempty"` // 执行前需从面板同步的脚本文件或目录
 }
 
 func (t AgentTask) GetID() string {
@@ -135,6 +282,55 @@ func (t AgentTask) GetSecrets() []string {
 	return t.Secrets
 }
 
+// AgentFile 同步给 Agent 的文件清单项，内容按 SHA-256 寻址
+type AgentFile struct {
+	Path string `json:"path"` // 相对脚本目录的路径，以 / 分隔
+	Hash string `json:"hash"` // 内容的 SHA-256（十六进制）
+	Size int64  `json:"size"`
+	Mode uint32 `json:"mode"` // 文件权限位
+}
+
+// AgentFileBundle 文件同步响应：任务所需文件的完整清单，以及 Agent 缓存中缺少的内容
+type AgentFileBundle struct {
+	RequestID string            `json:"request_id"`
+	TaskID    string            `json:"task_id"`
+	Files     []AgentFile       `json:"files"`
+	Blobs     map[string][]byte `json:"blobs"` // 哈希 -> zstd 压缩后的内容
+	Error     string            `json:"error,omitempty"`
+}
+
+// AgentSDKRequest Agent 代任务脚本转发的 SDK 调用
+type AgentSDKRequest struct {
+	RequestID string `json:"request_id"`
+	TaskID    string `json:"task_id"`
+	LogID     string `json:"log_id"`
+	Token     string `json:"token"` // 面板随执行指令签发的 SDK 转发凭证
+	Method    string `json:"method"`
+	Path      string `json:"path"` // 相对面板根路径，含查询参数
+	Body      []byte `json:"body"`
+}
+
+// AgentSDKResponse 面板返回的 SDK 调用结果
+type AgentSDKResponse struct {
+	RequestID string `json:"request_id"`
+	Status    int    `json:"status"`
+	Body      []byte `json:"body"`
+}
+
+// AgentSDKGrantRequest Agent 本地定时触发的执行开始时申请 SDK 转发凭证
+type AgentSDKGrantRequest struct {
+	RequestID string `json:"request_id"`
+	TaskID    string `json:"task_id"`
+	LogID     string `json:"log_id"` // Agent 为本次执行生成的日志 ID，上报结果时沿用
+}
+
+// AgentSDKGrantResponse 面板签发的 SDK 转发凭证，Agent 上报了公钥时加密下发
+type AgentSDKGrantResponse struct {
+	RequestID string `json:"request_id"`
+	Token     string `json:"token,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
 // AgentTaskResult Agent 上报的任务执行结果
 type AgentTaskResult struct {
 	TaskID    string `json:"task_id"`
@@ -148,6 +344,10 @@ type AgentTaskResult struct {
 	ExitCode  int    `json:"exit_code"`
 	StartTime int64  `json:"start_time"` // Unix 时间戳
 	EndTime   int64  `json:"end_time"`   // Unix 时间戳
+
+	Usage *ResourceUsage `json:"usage,omitempty"` // 进程树资源占用，旧版 Agent 不上报
+
+	SpooledAt int64 `json:"spooled_at,omitempty"` // Agent 断线期间缓存结果的时间，非 0 表示重连后补传
 }
 
 // AgentRegisterRequest Agent 注册请求
@@ -156,6 +356,23 @@ type AgentRegisterRequest struct {
 	Hostname  string `json:"hostname"`
 	Version   string `json:"version"`
 	BuildTime string `json:"build_time"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
 	Token     string `json:"token"`      // 注册令牌
 	MachineID string `json:"machine_id"` // 机器识别码
 }
+
+// AgentCommand 面板下发给 Agent 执行的一次性命令，如远程安装依赖
+type AgentCommand struct {
+	RequestID string `json:"request_id"`
+	Command   string `json:"command"`
+	Timeout   int    `json:"timeout"` // 超时时间（秒）
+}
+
+// AgentCommandResult Agent 执行一次性命令的结果
+type AgentCommandResult struct {
+	RequestID string `json:"request_id"`
+	ExitCode  int    `json:"exit_code"`
+	Output    string `json:"output"`
+	Error     string `json:"error,omitempty"`
+}
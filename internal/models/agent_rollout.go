@@ -0,0 +1,36 @@
+package models
+
+import "github.com/engigu/baihu-panel/internal/constant"
+
+// AgentRollout Agent 分批升级：先升级金丝雀 Agent，确认后再升级其余 Agent
+type AgentRollout struct {
+	ID            string     `json:"id" gorm:"primaryKey;size:20"`
+	Version       string     `json:"version" gorm:"size:50"`      // 目标版本
+	CanaryPercent int        `json:"canary_percent"`              // 随机抽取的金丝雀比例
+	Stage         string     `json:"stage" gorm:"size:20"`        // 阶段: canary, all
+	Status        string     `json:"status" gorm:"size:20;index"` // 状态: running, success, cancelled
+	EndTime       *LocalTime `json:"end_time"`
+	CreatedAt     LocalTime  `json:"created_at"`
+	UpdatedAt     LocalTime  `json:"updated_at"`
+}
+
+func (AgentRollout) TableName() string {
+	return constant.TablePrefix + "agent_rollouts"
+}
+
+// AgentRolloutTarget 分批升级中的单个 Agent
+type AgentRolloutTarget struct {
+	ID          string     `json:"id" gorm:"primaryKey;size:20"`
+	RolloutID   string     `json:"rollout_id" gorm:"size:20;index"`
+	AgentID     string     `json:"agent_id" gorm:"size:20;index"`
+	Canary      bool       `json:"canary"`
+	Status      string     `json:"status" gorm:"size:20"`       // 状态: pending, running, success, failed, cancelled
+	FromVersion string     `json:"from_version" gorm:"size:50"` // 升级前版本
+	Error       string     `json:"error" gorm:"size:500"`
+	StartTime   *LocalTime `json:"start_time"`
+	UpdatedAt   LocalTime  `json:"updated_at"`
+}
+
+func (AgentRolloutTarget) TableName() string {
+	return constant.TablePrefix + "agent_rollout_targets"
+}
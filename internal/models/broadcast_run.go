@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// BroadcastRun 广播运行：同一任务同时派发到多个 Agent，每个 Agent 对应一条子日志（TaskLog.RunID）
+type BroadcastRun struct {
+	ID          string     `json:"id" gorm:"primaryKey;size:20"`
+	TaskID      string     `json:"task_id" gorm:"size:20;index"`
+	Selector    string     `json:"selector" gorm:"size:255"`    // 匹配目标 Agent 的标签选择器
+	MaxParallel int        `json:"max_parallel"`                // 同时执行的 Agent 数上限
+	Status      string     `json:"status" gorm:"size:20;index"` // 聚合状态: running, success, failed, cancelled
+	Total       int        `json:"total"`                       // 目标 Agent 数
+	Success     int        `json:"success"`
+	Failed      int        `json:"failed"` // 含超时
+	Cancelled   int        `json:"cancelled"`
+	StartTime   *LocalTime `json:"start_time"`
+	EndTime     *LocalTime `json:"end_time"`
+	CreatedAt   LocalTime  `json:"created_at"`
+}
+
+func (BroadcastRun) TableName() string {
+	return constant.TablePrefix + "broadcast_runs"
+}
+
+// Summary 聚合状态描述，如 "全部成功 (5)"、"2 个失败，共 5 个"
+func (r *BroadcastRun) Summary() string {
+	done := r.Success + r.Failed + r.Cancelled
+	switch {
+	case r.Status == constant.TaskStatusRunning:
+		return fmt.Sprintf("运行中 %d/%d", done, r.Total)
+	case r.Success == r.Total:
+		return fmt.Sprintf("全部成功 (%d)", r.Total)
+	case r.Failed > 0 && r.Cancelled > 0:
+		return fmt.Sprintf("%d 个失败，%d 个取消，共 %d 个", r.Failed, r.Cancelled, r.Total)
+	case r.Failed > 0:
+		return fmt.Sprintf("%d 个失败，共 %d 个", r.Failed, r.Total)
+	default:
+		return fmt.Sprintf("%d 个取消，共 %d 个", r.Cancelled, r.Total)
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// HostMetricPoint 主机历史指标的持久化点，每个层级按槽位循环覆盖，总行数固定
+type HostMetricPoint struct {
+	ID         string  `json:"id" gorm:"primaryKey;size:20"` // 分辨率秒数-槽位，如 60-123
+	Resolution int     `json:"resolution" gorm:"index"`      // 分辨率（秒）
+	Time       int64   `json:"time"`                         // 时间桶起点（Unix 秒）
+	Count      int     `json:"count"`                        // 参与聚合的采样数
+	Values     BigText `json:"values"`                       // JSON：{"avg":{指标:值},"max":{指标:值}}
+}
+
+func (HostMetricPoint) TableName() string {
+	return constant.TablePrefix + "host_metric_points"
+}
@@ -0,0 +1,41 @@
+package models
+
+import "github.com/engigu/baihu-panel/internal/constant"
+
+// ManagedSync 托管同步规则：主节点上带指定标签的任务与环境变量持续同步到所选子节点
+type ManagedSync struct {
+	ID        string     `json:"id" gorm:"primaryKey;size:20"`
+	Name      string     `json:"name" gorm:"size:255;not null"`
+	TaskTag   string     `json:"task_tag" gorm:"size:100;default:''"` // 任务标签，为空表示不同步任务
+	EnvTag    string     `json:"env_tag" gorm:"size:100;default:''"`  // 环境变量标签，托管任务依赖的环境变量会一并同步
+	NodeIDs   string     `json:"node_ids" gorm:"type:text"`           // 目标子节点 ID，逗号分隔
+	Overwrite bool       `json:"overwrite"`                           // 子节点上的托管副本被修改时以主节点为准覆盖，否则仅报告
+	Enabled   *bool      `json:"enabled" gorm:"default:true"`
+	LastRunAt *LocalTime `json:"last_run_at"`
+	LastError string     `json:"last_error" gorm:"size:500;default:''"`
+	CreatedAt LocalTime  `json:"created_at"`
+	UpdatedAt LocalTime  `json:"updated_at"`
+}
+
+func (ManagedSync) TableName() string {
+	return constant.TablePrefix + "managed_syncs"
+}
+
+// ManagedSyncState 托管资源在某个子节点上的同步状态
+type ManagedSyncState struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:20"`
+	SyncID     string     `json:"sync_id" gorm:"size:20;index"`
+	NodeID     string     `json:"node_id" gorm:"size:20;index"`
+	Kind       string     `json:"kind" gorm:"size:10"` // 资源类型: task, env
+	ResourceID string     `json:"resource_id" gorm:"size:20"`
+	Name       string     `json:"name" gorm:"size:255"`
+	Hash       string     `json:"-" gorm:"size:64"`      // 最近一次同步成功时的内容指纹
+	Status     string     `json:"status" gorm:"size:20"` // 状态: synced, drift, conflict, error
+	Message    string     `json:"message" gorm:"size:500;default:''"`
+	SyncedAt   *LocalTime `json:"synced_at"`
+	UpdatedAt  LocalTime  `json:"updated_at"`
+}
+
+func (ManagedSyncState) TableName() string {
+	return constant.TablePrefix + "managed_sync_states"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "github.com/engigu/baihu-panel/internal/constant"
+
+// RemoteRun 主节点触发的子节点任务执行，执行结束后保存结果摘要
+type RemoteRun struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:20"`
+	NodeID     string     `json:"node_id" gorm:"size:20;index"`
+	NodeName   string     `json:"node_name" gorm:"size:255"`
+	TaskID     string     `json:"task_id" gorm:"size:20;index"` // 子节点上的任务 ID
+	TaskName   string     `json:"task_name" gorm:"size:255"`
+	LogID      string     `json:"log_id" gorm:"size:20"`       // 子节点上的执行日志 ID
+	Status     string     `json:"status" gorm:"size:20;index"` // 状态: queued, running, success, failed, timeout, cancelled
+	ExitCode   int        `json:"exit_code"`
+	Duration   int64      `json:"duration"`                         // 执行耗时（毫秒）
+	Error      string     `json:"error" gorm:"size:500;default:''"` // 触发或转发失败的原因
+	Output     BigText    `json:"output,omitempty"`                 // 输出末尾部分
+	Operator   string     `json:"operator" gorm:"size:100;default:''"`
+	StartedAt  LocalTime  `json:"started_at"`
+	FinishedAt *LocalTime `json:"finished_at"`
+}
+
+func (RemoteRun) TableName() string {
+	return constant.TablePrefix + "remote_runs"
+}
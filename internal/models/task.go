@@ -4,6 +4,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strings"
+
 	"github.com/engigu/baihu-panel/internal/constant"
 )
 
@@ -35,6 +37,45 @@ func (t *TaskLanguages) Scan(v interface{}) error {
 	return json.Unmarshal(data, t)
 }
 
+// FailoverTarget 任务指定的 Agent 不可用时依次尝试的故障转移目标
+type FailoverTarget struct {
+	Type    string `json:"type"`               // constant.FailoverTargetAgent, constant.FailoverTargetLocal, constant.FailoverTargetWait
+	AgentID string `json:"agent_id,omitempty"` // Type 为 agent 时的备用 Agent
+	Minutes int    `json:"minutes,omitempty"`  // Type 为 wait 时等待原 Agent 恢复的最长分钟数
+}
+
+// TaskFailover 故障转移链，处理 JSON 序列化
+type TaskFailover []FailoverTarget
+
+func (t TaskFailover) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *TaskFailover) Scan(v interface{}) error {
+	if v == nil {
+		*t = nil
+		return nil
+	}
+	var data []byte
+	switch s := v.(type) {
+	case string:
+		data = []byte(s)
+	case []byte:
+		data = s
+	default:
+		return fmt.Errorf("invalid type for TaskFailover: %T", v)
+	}
+	if len(data) == 0 {
+		*t = nil
+		return nil
+	}
+	return json.Unmarshal(data, t)
+}
+
 // CleanConfig 清理配置结构
 type CleanConfig struct {
 	Type string `json:"type"` // "day" 或 "count"
@@ -64,8 +105,9 @@ type RepoConfig struct {
 
 // TaskConfig  任务配置  RepoConfig+TaskConfig=task.config
 type TaskConfig struct {
-	Concurrency int  `json:"$task_concurrency"` // 0: disable concurrency, 1: enable concurrency
-	AllEnvs     bool `json:"$task_all_envs"`    // 开启则注入全部环境变量
+	Concurrency  int  `json:"$task_concurrency"`   // 0: disable concurrency, 1: enable concurrency
+	AllEnvs      bool `json:"$task_all_envs"`      // 开启则注入全部环境变量
+	SplitStreams bool `json:"$task_split_streams"` // 开启则分别记录 stdout/stderr（以管道方式执行，不再分配伪终端）
 }
 
 // Task 代表一个计划任务
@@ -88,9 +130,13 @@ type Task struct {
 	Envs           BigText       `json:"envs" gorm:"-"`                              // 环境变量ID列表，逗号分隔
 	Languages      TaskLanguages `json:"languages" gorm:"type:text"`                 // 针对本地任务的语言配置列表
 	AgentID        *string       `json:"agent_id" gorm:"size:20;index"`              // Agent ID，为空表示本地执行
+	AgentSelector  string        `json:"agent_selector" gorm:"size:255;default:''"`  // Agent 标签选择器，如 env=prod,role=worker；AgentID 为空时生效
+	AgentStrategy  string        `json:"agent_strategy" gorm:"size:20;default:''"`   // 选择器匹配多个 Agent 时的选择策略，默认轮询
+	Failover       TaskFailover  `json:"failover" gorm:"type:text"`                  // AgentID 指定的 Agent 不可用时依次尝试的故障转移目标
 	RetryCount     int           `json:"retry_count" gorm:"default:0"`               // 失败重试次数
 	RetryInterval  int           `json:"retry_interval" gorm:"default:0"`            // 失败重试间隔(秒)
 	RandomRange    int           `json:"random_range" gorm:"default:0"`              // 随机延迟范围(秒)
+	SyncFiles      string        `json:"sync_files" gorm:"type:text"`                // Agent 执行前需同步的脚本文件或目录，相对脚本目录，逗号或换行分隔
 	Enabled        *bool         `json:"enabled" gorm:"default:true"`
 	RunningGo      BigText       `json:"running_go"` // 正在运行的 go routine id 数组 (JSON)
 	RuntimeEnvs    []string      `json:"-" gorm:"-"` // 运行时环境变量（非持久化）
@@ -114,6 +160,17 @@ func (Task) TableName() string {
 	return constant.TablePrefix + "tasks"
 }
 
+// SyncFileList 需同步到 Agent 的脚本路径列表
+func (t *Task) SyncFileList() []string {
+	var paths []string
+	for _, p := range strings.FieldsFunc(t.SyncFiles, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
 func (t *Task) GetID() string {
 	return t.ID
 }
@@ -158,8 +215,19 @@ func (t *Task) GetSecrets() []string {
 	return t.RuntimeSecrets
 }
 
+// GetUseMise 本机任务始终经由 mise 执行，Agent 任务配置了语言时在 Agent 上经由 mise 执行
 func (t *Task) GetUseMise() bool {
-	return t.AgentID == nil || *t.AgentID == ""
+	return t.IsLocal() || len(t.Languages) > 0
+}
+
+// IsLocal 是否在本机执行（未指定 Agent 且未配置选择器）
+func (t *Task) IsLocal() bool {
+	return (t.AgentID == nil || *t.AgentID == "") && t.AgentSelector == ""
+}
+
+// UsesAgentSelector 是否按标签选择器路由到 Agent 执行
+func (t *Task) UsesAgentSelector() bool {
+	return (t.AgentID == nil || *t.AgentID == "") && t.AgentSelector != ""
 }
 
 func (t *Task) UseMise() bool {
@@ -177,18 +245,40 @@ func (t *Task) GetRandomRange() int {
 
 // TaskLog 代表任务执行的日志记录
 type TaskLog struct {
-	ID        string     `json:"id" gorm:"primaryKey;size:20"`
-	TaskID    string     `json:"task_id" gorm:"size:20;index"`
-	AgentID   *string    `json:"agent_id" gorm:"size:20;index"` // Agent ID，为空表示本地执行
-	Command   BigText    `json:"command"`
-	Output    BigText    `json:"-"`                           // gzip+base64 压缩后的日志
-	Error     BigText    `json:"error"`                       // 额外的系统错误信息
-	Status    string     `json:"status" gorm:"size:20;index"` // success, failed
-	Duration  int64      `json:"duration"`                    // 执行耗时（毫秒）
-	ExitCode  int        `json:"exit_code"`
-	StartTime *LocalTime `json:"start_time"`
-	EndTime   *LocalTime `json:"end_time"`
-	CreatedAt LocalTime  `json:"created_at"`
+	ID         string     `json:"id" gorm:"primaryKey;size:20"`
+	TaskID     string     `json:"task_id" gorm:"size:20;index"`
+	AgentID    *string    `json:"agent_id" gorm:"size:20;index"`          // Agent ID，为空表示本地执行
+	RunID      string     `json:"run_id" gorm:"size:20;index;default:''"` // 所属广播运行 ID，普通运行为空
+	Command    BigText    `json:"command"`
+	Output     BigText    `json:"-"`                                 // zstd+base64 压缩后的日志，外部存储时为空
+	Storage    string     `json:"storage" gorm:"size:20;default:''"` // 日志存储后端，为空表示保存在 Output 字段
+	StorageKey string     `json:"storage_key" gorm:"size:255"`       // 外部存储中的对象 key
+	LineMeta   BigText    `json:"-"`                                 // 每行的输出流与时间戳（压缩编码），旧日志为空
+	Error      BigText    `json:"error"`                             // 额外的系统错误信息
+	Status     string     `json:"status" gorm:"size:20;index"`       // success, failed
+	Duration   int64      `json:"duration"`                          // 执行耗时（毫秒）
+	ExitCode   int        `json:"exit_code"`
+	StartTime  *LocalTime `json:"start_time"`
+	EndTime    *LocalTime `json:"end_time"`
+	CreatedAt  LocalTime  `json:"created_at"`
+	SyncedLate bool       `json:"synced_late" gorm:"default:false"`    // Agent 断线期间执行，重连后补传的结果
+	Failover   string     `json:"failover" gorm:"size:500;default:''"` // 故障转移原因，为空表示在任务指定的目标上执行
+
+	ResourceUsage `gorm:"embedded"` // 进程树资源占用，旧日志或无法采集时为 0
+}
+
+// ResourceUsage 任务进程树的资源占用（取自子进程退出时的 rusage，包含已被回收的全部子孙进程）
+type ResourceUsage struct {
+	UserCPU    int64 `json:"user_cpu"`                      // 用户态 CPU 时间（毫秒）
+	SystemCPU  int64 `json:"system_cpu"`                    // 内核态 CPU 时间（毫秒）
+	MaxRSS     int64 `json:"max_rss" gorm:"column:max_rss"` // 进程树中单个进程的峰值常驻内存（字节），不是整个进程树的内存之和
+	ReadBytes  int64 `json:"read_bytes"`                    // 块设备读取字节数
+	WriteBytes int64 `json:"write_bytes"`                   // 块设备写入字节数
+}
+
+// IsZero 是否未采集到资源占用
+func (u ResourceUsage) IsZero() bool {
+	return u == ResourceUsage{}
 }
 
 func (TaskLog) TableName() string {
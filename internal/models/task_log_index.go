@@ -0,0 +1,21 @@
+package models
+
+import (
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// TaskLogIndex 任务日志全文检索索引（每条已结束的执行日志对应一行）
+type TaskLogIndex struct {
+	ID        string    `json:"id" gorm:"primaryKey;size:20"`   // 与 TaskLog.ID 一致
+	TaskID    string    `json:"task_id" gorm:"size:20;index"`   // 任务 ID
+	AgentID   string    `json:"agent_id" gorm:"size:20;index"`  // Agent ID，为空表示本地执行
+	Status    string    `json:"status" gorm:"size:20;index"`    // 执行状态
+	Tokens    BigText   `json:"-"`                              // 去重后的小写词元，以空格分隔并首尾补空格
+	Truncated bool      `json:"truncated" gorm:"default:false"` // 词元是否因超出上限被截断（截断的日志在检索时始终作为候选）
+	LineCount int       `json:"line_count" gorm:"default:0"`    // 日志总行数
+	CreatedAt LocalTime `json:"created_at" gorm:"index"`        // 日志创建时间，用于时间范围筛选
+}
+
+func (TaskLogIndex) TableName() string {
+	return constant.TablePrefix + "task_log_index"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+// TaskRunRollup 任务运行的小时级预聚合（每个任务每小时一行），供分析接口使用，不随运行日志清理而删除
+type TaskRunRollup struct {
+	ID          string  `json:"id" gorm:"primaryKey;size:20"`
+	TaskID      string  `json:"task_id" gorm:"size:20;uniqueIndex:idx_task_hour"`
+	Hour        int64   `json:"hour" gorm:"uniqueIndex:idx_task_hour;index"` // 小时起点（Unix 秒）
+	Runs        int64   `json:"runs" gorm:"default:0"`
+	Success     int64   `json:"success" gorm:"default:0"`
+	Failed      int64   `json:"failed" gorm:"default:0"`    // 失败与超时
+	Cancelled   int64   `json:"cancelled" gorm:"default:0"` // 手动停止
+	Flips       int64   `json:"flips" gorm:"default:0"`     // 结果与上一次运行不同（成功/失败互相切换）的次数
+	DurationSum int64   `json:"duration_sum" gorm:"default:0"`
+	DurationMax int64   `json:"duration_max" gorm:"default:0"`
+	Histogram   BigText `json:"histogram"` // 耗时分桶计数，格式：桶序号:次数,桶序号:次数
+}
+
+func (TaskRunRollup) TableName() string {
+	return constant.TablePrefix + "task_run_rollups"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "github.com/engigu/baihu-panel/internal/constant"
+
+// TunnelForward 隧道端口转发：主节点上的监听端口经互联隧道转发到子节点可访问的 host:port
+type TunnelForward struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:20"`
+	Name       string    `json:"name" gorm:"size:255;not null"`
+	NodeID     string    `json:"node_id" gorm:"size:20;index"`
+	ListenPort int       `json:"listen_port" gorm:"uniqueIndex"`       // 主节点监听端口
+	TargetHost string    `json:"target_host" gorm:"size:255;not null"` // 从子节点访问的目标地址
+	TargetPort int       `json:"target_port"`
+	BindAddr   string    `json:"bind_addr" gorm:"size:64;default:''"` // 主节点监听地址，为空时只监听 127.0.0.1
+	Allowlist  string    `json:"allowlist" gorm:"type:text"`          // 允许连接的来源 IP 或 CIDR，逗号分隔，为空时拒绝所有连接
+	Enabled    *bool     `json:"enabled" gorm:"default:true"`
+	Remark     string    `json:"remark" gorm:"size:500;default:''"`
+	CreatedAt  LocalTime `json:"created_at"`
+	UpdatedAt  LocalTime `json:"updated_at"`
+}
+
+func (TunnelForward) TableName() string {
+	return constant.TablePrefix + "tunnel_forwards"
+}
@@ -3,29 +3,42 @@ package vo
 import (
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+	"github.com/engigu/baihu-panel/internal/agentproto"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/utils"
 )
 
 // AgentVO 代理视图对象
 type AgentVO struct {
-	ID              string                  `json:"id"`
-	Name            string                  `json:"name"`
-	Description     string                  `json:"description"`
-	Status          string                  `json:"status"`
-	LastSeen        *models.LocalTime       `json:"last_seen"`
-	IP              string                  `json:"ip"`
-	Version         string                  `json:"version"`
-	BuildTime       string                  `json:"build_time"`
-	Hostname        string                  `json:"hostname"`
-	OS              string                  `json:"os"`
-	Arch            string                  `json:"arch"`
-	ForceUpdate     bool                    `json:"force_update"`
-	Enabled         bool                    `json:"enabled"`
-	SchedulerConfig *AgentSchedulerConfigVO `json:"scheduler_config"`
-	CreatedAt       models.LocalTime        `json:"created_at"`
-	UpdatedAt       models.LocalTime        `json:"updated_at"`
-	// 隐藏 Token 和 MachineID
+	ID              string                     `json:"id"`
+	Name            string                     `json:"name"`
+	Description     string                     `json:"description"`
+	Status          string                     `json:"status"`
+	LastSeen        *models.LocalTime          `json:"last_seen"`
+	IP              string                     `json:"ip"`
+	Version         string                     `json:"version"`
+	BuildTime       string                     `json:"build_time"`
+	Hostname        string                     `json:"hostname"`
+	OS              string                     `json:"os"`
+	Arch            string                     `json:"arch"`
+	ForceUpdate     bool                       `json:"force_update"`
+	Enabled         bool                       `json:"enabled"`
+	Approval        string                     `json:"approval"`             // 注册审批状态，空值视为已通过
+	MachineID       string                     `json:"machine_id,omitempty"` // 仅未通过审批时返回，供管理员核对
+	KeyFingerprint  string                     `json:"key_fingerprint"`      // 端到端加密公钥指纹，为空表示旧版 Agent 明文下发
+	PublicKeyAt     *models.LocalTime          `json:"public_key_at"`
+	PendingKeyPrint string                     `json:"pending_key_fingerprint"` // 待管理员批准的新公钥指纹
+	Protocol        int                        `json:"protocol"`                // 协议版本，未握手的旧版 Agent 为 1
+	Features        []agentproto.FeatureStatus `json:"features"`                // 逐项功能支持情况，不支持的提示需要升级
+	SchedulerConfig *AgentSchedulerConfigVO    `json:"scheduler_config"`
+	Labels          models.AgentLabels         `json:"labels"`
+	Runtimes        models.AgentRuntimes       `json:"runtimes"`          // Agent 上报的 mise 运行时
+	Load            *models.AgentLoad          `json:"load,omitempty"`    // 最近一次心跳上报的负载，仅在线 Agent 有值
+	Metrics         *models.AgentHostMetrics   `json:"metrics,omitempty"` // 最近一次心跳上报的主机资源，仅在线 Agent 有值
+	CreatedAt       models.LocalTime           `json:"created_at"`
+	UpdatedAt       models.LocalTime           `json:"updated_at"`
+	// 隐藏 Token，MachineID 仅审批时展示
 }
 
 // ToAgentVO 将 Agent 模型转换为 AgentVO
@@ -43,6 +56,19 @@ func ToAgentVO(agent *models.Agent) *AgentVO {
 			StrictQueue:  agent.SchedulerConfig.StrictQueue,
 		}
 	}
+	labels := agent.Labels
+	if labels == nil {
+		labels = models.AgentLabels{}
+	}
+	runtimes := agent.Runtimes
+	if runtimes == nil {
+		runtimes = models.AgentRuntimes{}
+	}
+	peer := agentproto.Negotiate(agentproto.Hello{ProtocolVersion: agent.Protocol, Capabilities: agent.Capabilities})
+	machineID := ""
+	if !agent.Approved() {
+		machineID = agent.MachineID
+	}
 	return &AgentVO{
 		ID:              agent.ID,
 		Name:            agent.Name,
@@ -57,7 +83,16 @@ func ToAgentVO(agent *models.Agent) *AgentVO {
 		Arch:            agent.Arch,
 		ForceUpdate:     agent.ForceUpdate,
 		Enabled:         utils.DerefBool(agent.Enabled, true),
+		Approval:        agent.Approval,
+		MachineID:       machineID,
+		KeyFingerprint:  agentcrypto.Fingerprint(agent.PublicKey),
+		PublicKeyAt:     agent.PublicKeyAt,
+		PendingKeyPrint: agentcrypto.Fingerprint(agent.PendingKey),
+		Protocol:        peer.ProtocolVersion,
+		Features:        peer.Statuses(),
 		SchedulerConfig: schedulerConfigVO,
+		Labels:          labels,
+		Runtimes:        runtimes,
 		CreatedAt:       agent.CreatedAt,
 		UpdatedAt:       agent.UpdatedAt,
 	}
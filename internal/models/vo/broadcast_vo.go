@@ -0,0 +1,31 @@
+package vo
+
+import "github.com/engigu/baihu-panel/internal/models"
+
+// BroadcastStartReq 广播运行请求
+type BroadcastStartReq struct {
+	TaskID      string `json:"task_id" binding:"required" example:"abc123"`
+	Selector    string `json:"selector" example:"role=edge"` // 为空时使用任务自身的 Agent 选择器
+	MaxParallel int    `json:"max_parallel" example:"5"`     // 同时执行的 Agent 数，0 表示使用系统设置
+}
+
+// BroadcastRunVO 广播运行视图对象
+type BroadcastRunVO struct {
+	models.BroadcastRun
+	TaskName string `json:"task_name"`
+	Summary  string `json:"summary"` // 聚合状态描述，如 "全部成功 (5)"、"2 个失败，共 5 个"
+}
+
+// BroadcastRunDetailVO 广播运行详情
+type BroadcastRunDetailVO struct {
+	Run  *BroadcastRunVO `json:"run"`
+	Logs []*TaskLogVO    `json:"logs"`
+}
+
+// ToBroadcastRunVO 将 BroadcastRun 模型转换为 BroadcastRunVO
+func ToBroadcastRunVO(run *models.BroadcastRun, taskName string) *BroadcastRunVO {
+	if run == nil {
+		return nil
+	}
+	return &BroadcastRunVO{BroadcastRun: *run, TaskName: taskName, Summary: run.Summary()}
+}
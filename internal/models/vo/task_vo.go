@@ -1,6 +1,7 @@
 package vo
 
 import (
+	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/executor"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/utils"
@@ -23,6 +24,10 @@ type TaskCreateReq struct {
 	Envs          string               `json:"envs" example:"{\"ENV_VAR\":\"value\"}"`
 	Languages     models.TaskLanguages `json:"languages"`
 	AgentID       *string              `json:"agent_id" example:"agent-1"`
+	AgentSelector string               `json:"agent_selector" example:"env=prod,role=worker"` // Agent 标签选择器，agent_id 为空时生效
+	AgentStrategy string               `json:"agent_strategy" example:"round_robin"`          // 选择策略: round_robin, least_busy, random
+	SyncFiles     string               `json:"sync_files" example:"lib/,main.py"`             // Agent 执行前同步的脚本文件或目录，逗号或换行分隔
+	Failover      models.TaskFailover  `json:"failover"`                                      // agent_id 指定的 Agent 不可用时依次尝试的故障转移目标
 	TriggerType   string               `json:"trigger_type" example:"cron"`
 	RetryCount    int                  `json:"retry_count" example:"3"`
 	RetryInterval int                  `json:"retry_interval" example:"60"`
@@ -48,6 +53,10 @@ type TaskUpdateReq struct {
 	Enabled       bool                 `json:"enabled" example:"true"`
 	Languages     models.TaskLanguages `json:"languages"`
 	AgentID       *string              `json:"agent_id" example:"agent-1"`
+	AgentSelector string               `json:"agent_selector" example:"env=prod,role=worker"` // Agent 标签选择器，agent_id 为空时生效
+	AgentStrategy string               `json:"agent_strategy" example:"round_robin"`          // 选择策略: round_robin, least_busy, random
+	SyncFiles     string               `json:"sync_files" example:"lib/,main.py"`             // Agent 执行前同步的脚本文件或目录，逗号或换行分隔
+	Failover      models.TaskFailover  `json:"failover"`                                      // agent_id 指定的 Agent 不可用时依次尝试的故障转移目标
 	TriggerType   string               `json:"trigger_type" example:"cron"`
 	RetryCount    int                  `json:"retry_count" example:"3"`
 	RetryInterval int                  `json:"retry_interval" example:"60"`
@@ -74,6 +83,10 @@ type TaskVO struct {
 	Envs          string               `json:"envs"`
 	Languages     models.TaskLanguages `json:"languages"`
 	AgentID       *string              `json:"agent_id"`
+	AgentSelector string               `json:"agent_selector"`
+	AgentStrategy string               `json:"agent_strategy"`
+	SyncFiles     string               `json:"sync_files"`
+	Failover      models.TaskFailover  `json:"failover"`
 	RepoTaskID    string               `json:"repo_task_id"`
 	Enabled       bool                 `json:"enabled"`
 	RetryCount    int                  `json:"retry_count"`
@@ -110,6 +123,10 @@ func ToTaskVO(task *models.Task) *TaskVO {
 		Envs:          string(task.Envs),
 		Languages:     task.Languages,
 		AgentID:       task.AgentID,
+		AgentSelector: task.AgentSelector,
+		AgentStrategy: task.AgentStrategy,
+		SyncFiles:     task.SyncFiles,
+		Failover:      task.Failover,
 		RepoTaskID:    task.RepoTaskID,
 		Enabled:       utils.DerefBool(task.Enabled, true),
 		RetryCount:    task.RetryCount,
@@ -157,6 +174,7 @@ type TaskLogVO struct {
 	TaskName  string            `json:"task_name"`
 	TaskType  string            `json:"task_type"`
 	AgentID   *string           `json:"agent_id"`
+	RunID     string            `json:"run_id,omitempty"` // 所属广播运行 ID
 	Command   string            `json:"command"`
 	Error     string            `json:"error"`
 	Status    string            `json:"status"`
@@ -166,6 +184,10 @@ type TaskLogVO struct {
 	EndTime   *models.LocalTime `json:"end_time"`
 	CreatedAt models.LocalTime  `json:"created_at"`
 	Output    string            `json:"output,omitempty"`
+
+	Usage      *models.ResourceUsage `json:"usage,omitempty"`       // 进程树资源占用，未采集时为空
+	SyncedLate bool                  `json:"synced_late,omitempty"` // Agent 断线期间执行，重连后补传
+	Failover   string                `json:"failover,omitempty"`    // 故障转移原因，AgentID 为实际执行的目标
 }
 
 // ToTaskLogVO 将 TaskLog 模型转换为 TaskLogVO
@@ -175,10 +197,11 @@ func ToTaskLogVO(log *models.TaskLog) *TaskLogVO {
 	if log == nil {
 		return nil
 	}
-	return &TaskLogVO{
+	vo := &TaskLogVO{
 		ID:        log.ID,
 		TaskID:    log.TaskID,
 		AgentID:   log.AgentID,
+		RunID:     log.RunID,
 		Command:   string(log.Command),
 		Error:     string(log.Error),
 		Status:    log.Status,
@@ -188,7 +211,15 @@ func ToTaskLogVO(log *models.TaskLog) *TaskLogVO {
 		EndTime:   log.EndTime,
 		CreatedAt: log.CreatedAt,
 		Output:    string(log.Output),
+
+		SyncedLate: log.SyncedLate,
+		Failover:   log.Failover,
+	}
+	if !log.ResourceUsage.IsZero() {
+		usage := log.ResourceUsage
+		vo.Usage = &usage
 	}
+	return vo
 }
 
 // ToTaskLogVOList 将 TaskLog 模型列表转换为 TaskLogVO 列表
@@ -216,6 +247,7 @@ func ToTaskLogVOListFromModels(logs []models.TaskLog) []*TaskLogVO {
 type ExecutionResultVO struct {
 	TaskID    string `json:"task_id"`
 	LogID     string `json:"log_id,omitempty"`
+	QueuedLog string `json:"queued_log_id,omitempty"` // 排队中的执行出队后使用的日志 ID，此时日志尚未创建
 	Success   bool   `json:"success"`
 	Status    string `json:"status"`
 	Output    string `json:"output,omitempty"`
@@ -241,6 +273,9 @@ func ToExecutionResultVO(res *executor.ExecutionResult) *ExecutionResultVO {
 		Duration: res.Duration,
 		ExitCode: res.ExitCode,
 	}
+	if res.Status == constant.TaskStatusQueued {
+		vo.LogID, vo.QueuedLog = "", res.LogID
+	}
 	if !res.StartTime.IsZero() {
 		vo.StartTime = res.StartTime.Format("2006-01-02 15:04:05")
 	}
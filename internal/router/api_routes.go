@@ -83,6 +83,8 @@ func initAuthorizedAPIRoutes(api *gin.RouterGroup, c *Controllers) {
 			registerInterconnectRoutes(adminOnly, c)
 			registerSystemRoutes(adminOnly, c)
 			registerTagRoutes(adminOnly, c)
+			registerAnalyticsRoutes(adminOnly, c)
+			registerBroadcastRoutes(adminOnly, c)
 		}
 	}
 
@@ -101,6 +103,26 @@ func registerDashboardRoutes(g *gin.RouterGroup, c *Controllers) {
 	g.GET("/taskstats", c.Dashboard.GetTaskStats)
 }
 
+func registerAnalyticsRoutes(g *gin.RouterGroup, c *Controllers) {
+	analytics := g.Group("/analytics")
+	{
+		analytics.GET("/tasks/:id", c.Analytics.GetTaskAnalytics)
+		analytics.GET("/tags/:tag", c.Analytics.GetTagAnalytics)
+		analytics.GET("/ranking", c.Analytics.GetRanking)
+		analytics.POST("/rebuild", c.Analytics.Rebuild)
+	}
+}
+
+func registerBroadcastRoutes(g *gin.RouterGroup, c *Controllers) {
+	broadcasts := g.Group("/broadcasts")
+	{
+		broadcasts.POST("", c.Broadcast.Start)
+		broadcasts.GET("", c.Broadcast.List)
+		broadcasts.GET("/:id", c.Broadcast.Detail)
+		broadcasts.POST("/:id/stop", c.Broadcast.Stop)
+	}
+}
+
 func registerTaskRoutes(g *gin.RouterGroup, c *Controllers) {
 	tasks := g.Group("/tasks")
 	{
@@ -114,6 +136,8 @@ func registerTaskRoutes(g *gin.RouterGroup, c *Controllers) {
 		tasks.DELETE("/batch-by-query", c.Task.BatchDeleteByQuery)
 		tasks.POST("/stop/:logID", c.Task.StopTask)
 		tasks.GET("/tags", c.Task.GetTags)
+		tasks.GET("/usage/ranking", c.Task.GetUsageRanking)
+		tasks.GET("/:id/usage", c.Task.GetTaskUsage)
 	}
 
 	execution := g.Group("/execute")
@@ -175,13 +199,20 @@ func registerLogRoutes(g *gin.RouterGroup, c *Controllers) {
 		logs.GET("", c.Log.GetLogs)
 		logs.POST("/clear", c.Log.ClearLogs)
 		logs.GET("/sse", c.LogSSE.StreamLog)
+		logs.GET("/search", c.Log.SearchLogs)
 		logs.GET("/:id", c.Log.GetLogDetail)
+		logs.GET("/:id/lines", c.Log.GetLogLines)
+		logs.GET("/:id/head", c.Log.GetLogHead)
+		logs.GET("/:id/tail", c.Log.GetLogTail)
+		logs.GET("/:id/grep", c.Log.GrepLog)
+		logs.GET("/:id/download", c.Log.DownloadLog)
 		logs.DELETE("/:id", c.Log.DeleteLog)
 	}
 }
 
 func registerTerminalRoutes(g *gin.RouterGroup, c *Controllers) {
 	g.GET("/terminal/ws", c.Terminal.HandleWebSocket)
+	g.GET("/terminal/agent/:id/ws", c.Terminal.HandleAgentWebSocket)
 	// g.POST("/terminal/exec", c.Terminal.ExecuteShellCommand) // 暂未使用，已注释
 	g.GET("/terminal/cmds", c.Terminal.GetCommands)
 }
@@ -235,14 +266,26 @@ func registerAgentRoutes(g *gin.RouterGroup, c *Controllers) {
 	{
 		agents.GET("", c.Agent.List)
 		agents.GET("/version", c.Agent.GetVersion)
+		agents.GET("/match", c.Agent.MatchSelector)
 		agents.PUT("/:id", c.Agent.Update)
 		agents.DELETE("/:id", c.Agent.Delete)
 		agents.POST("/:id/token", c.Agent.RegenerateToken)
 		agents.POST("/:id/update", c.Agent.ForceUpdate)
+		agents.POST("/:id/approve", c.Agent.ApproveAgent)
+		agents.POST("/:id/reject", c.Agent.RejectAgent)
+		agents.POST("/:id/rotate-key", c.Agent.RotateKey)
+		agents.POST("/:id/approve-key", c.Agent.ApproveKey)
+		agents.GET("/:id/metrics", c.Agent.GetMetricsHistory)
 		// 令牌管理
 		agents.GET("/tokens", c.Agent.ListTokens)
 		agents.POST("/tokens", c.Agent.CreateToken)
 		agents.DELETE("/tokens/:id", c.Agent.DeleteToken)
+		// 分批升级
+		agents.GET("/rollouts", c.Agent.ListRollouts)
+		agents.POST("/rollouts", c.Agent.CreateRollout)
+		agents.GET("/rollouts/:id", c.Agent.GetRollout)
+		agents.POST("/rollouts/:id/promote", c.Agent.PromoteRollout)
+		agents.POST("/rollouts/:id/cancel", c.Agent.CancelRollout)
 	}
 
 	// Agent API（供前端调用，保持在 v1 下）
@@ -304,6 +347,8 @@ func registerMonitorRoutes(g *gin.RouterGroup, c *Controllers) {
 	{
 		monitor.GET("", c.Monitor.GetSystemMonitor)
 		monitor.GET("/sse", c.Monitor.MonitorSSE)
+		monitor.GET("/history", c.Monitor.GetHostHistory)
+		monitor.GET("/history/markers", c.Monitor.GetHostHistoryMarkers)
 	}
 }
 
@@ -337,9 +382,28 @@ func registerInterconnectRoutes(g *gin.RouterGroup, c *Controllers) {
 		interconnect.PUT("/nodes/:id", c.Interconnect.UpdateNode)
 		interconnect.DELETE("/nodes/:id", c.Interconnect.DeleteNode)
 		interconnect.GET("/nodes/:id/status", c.Interconnect.GetNodeStatus)
+		interconnect.POST("/nodes/:id/tasks/:task_id/run", c.Interconnect.RunRemoteTask)
 		interconnect.POST("/sync/script", c.Interconnect.SyncScript)
 		interconnect.POST("/sync/env", c.Interconnect.SyncEnv)
 		interconnect.POST("/sync/task", c.Interconnect.SyncTask)
+		interconnect.GET("/federated/tasks", c.Interconnect.FederatedTasks)
+		interconnect.GET("/federated/failures", c.Interconnect.FederatedFailures)
+		interconnect.GET("/federated/logs/search", c.Interconnect.FederatedLogSearch)
+		interconnect.GET("/managed", c.Interconnect.GetManagedSyncs)
+		interconnect.POST("/managed", c.Interconnect.SaveManagedSync)
+		interconnect.PUT("/managed/:id", c.Interconnect.SaveManagedSync)
+		interconnect.DELETE("/managed/:id", c.Interconnect.DeleteManagedSync)
+		interconnect.GET("/managed/:id/plan", c.Interconnect.PlanManagedSync)
+		interconnect.POST("/managed/:id/sync", c.Interconnect.RunManagedSync)
+		interconnect.GET("/managed/:id/states", c.Interconnect.GetManagedSyncStates)
+		interconnect.GET("/forwards", c.Interconnect.GetForwards)
+		interconnect.POST("/forwards", c.Interconnect.SaveForward)
+		interconnect.PUT("/forwards/:id", c.Interconnect.SaveForward)
+		interconnect.PUT("/forwards/:id/enabled", c.Interconnect.ToggleForward)
+		interconnect.DELETE("/forwards/:id", c.Interconnect.DeleteForward)
+		interconnect.GET("/remote-runs", c.Interconnect.GetRemoteRuns)
+		interconnect.GET("/remote-runs/:id", c.Interconnect.GetRemoteRun)
+		interconnect.GET("/remote-runs/:id/stream", c.Interconnect.StreamRemoteRun)
 		
 		interconnect.GET("/child/status", c.Interconnect.GetChildStatus)
 		
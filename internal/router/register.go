@@ -3,6 +3,7 @@ package router
 import (
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/controllers"
+	"github.com/engigu/baihu-panel/internal/federation"
 	"github.com/engigu/baihu-panel/internal/services"
 	"github.com/engigu/baihu-panel/internal/services/tasks"
 )
@@ -41,8 +42,34 @@ func RegisterControllers() *Controllers {
 	// 启动计划任务
 	executorService.StartCron()
 
+	metricsService := services.NewMetricsService(executorService)
+
+	// 广播运行：启动时将上次未结束的运行标记为失败
+	broadcastService := tasks.NewBroadcastService(executorService)
+	_ = broadcastService.CleanupInterrupted()
+
+	// 首次升级时从历史日志回填运行分析的预聚合
+	analyticsService := tasks.NewTaskAnalyticsService()
+	go analyticsService.EnsureRollups()
+
+	// 开始采样主机历史指标
+	hostHistoryService := services.NewHostHistoryService(executorService)
+	hostHistoryService.Start()
+
+	// 记录 Agent 上报的主机指标并检查告警阈值
+	services.GetAgentMetricsService().Start()
+
+	// 恢复进行中的 Agent 分批升级
+	services.GetAgentRolloutService().Start()
+
+	// 托管同步：数据变更时及定期把托管资源同步到子节点
+	federation.GetManagedSyncService().Start()
+
+	// 远程执行：启动时将上次未跟踪完的执行标记为失败
+	federation.GetRemoteRunService().CleanupInterrupted()
+
 	// 初始化所有关注系统总线的服务
-	setupEventHandlers(appLogService, notifyService, loginLogService, systemWSManager, executorService)
+	setupEventHandlers(appLogService, notifyService, loginLogService, systemWSManager, executorService, metricsService)
 	startAppLogCleanup(appLogService)
 
 	taskController := controllers.NewTaskController(taskService, executorService)
@@ -68,10 +95,13 @@ func RegisterControllers() *Controllers {
 		AppLog:       controllers.NewAppLogController(),
 		SystemWS:     controllers.NewSystemWSController(),
 		WebUI:        controllers.NewWebUIController(services.NewWebUIService(settingsService)),
-		Monitor:      controllers.NewMonitorController(executorService),
+		Monitor:      controllers.NewMonitorController(executorService, hostHistoryService),
 		Interconnect: controllers.NewInterconnectController(interconnectService),
 		Data:         controllers.NewDataController(taskController, envController),
 		Tag:          controllers.NewTagController(services.NewTagService()),
+		Metrics:      controllers.NewMetricsController(metricsService),
+		Analytics:    controllers.NewAnalyticsController(analyticsService),
+		Broadcast:    controllers.NewBroadcastController(broadcastService),
 	}
 }
 
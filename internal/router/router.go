@@ -35,6 +35,9 @@ type Controllers struct {
 	Interconnect *controllers.InterconnectController
 	Data         *controllers.DataController
 	Tag          *controllers.TagController
+	Metrics      *controllers.MetricsController
+	Analytics    *controllers.AnalyticsController
+	Broadcast    *controllers.BroadcastController
 }
 
 func Setup(c *Controllers) *gin.Engine {
@@ -79,6 +82,9 @@ func Setup(c *Controllers) *gin.Engine {
 	initAgentAPIRoutes(root, c)
 	initOpenAPIV1Routes(root, c)
 
+	// 5. [ location /metrics ] Prometheus 指标 (独立 Token 认证)
+	root.GET("/metrics", middleware.MetricsTokenAuth(), c.Metrics.Metrics)
+
 	// =========================================================================
 	// [ location / ] 全局 404 兜底与 SPA 渲染
 	// 对应 Nginx: try_files $uri $uri/ /index.html;
@@ -116,5 +122,8 @@ func Setup(c *Controllers) *gin.Engine {
 		serveSPA(ctx, urlPrefix, 200)
 	})
 
+	// Agent 转发的任务脚本 SDK 调用按面板自身的路由处理
+	c.Agent.SetSDKHandler(router, urlPrefix)
+
 	return router
 }
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// agentCommandWaiter 等待 Agent 返回一次性命令结果
+type agentCommandWaiter struct {
+	agentID string
+	ch      chan *models.AgentCommandResult
+}
+
+var (
+	agentCommandWaiters = make(map[string]*agentCommandWaiter)
+	agentCommandMu      sync.Mutex
+)
+
+// RunCommand 在 Agent 上执行一次性命令并等待结果，执行过程中的输出实时推送给前端
+func (m *AgentWSManager) RunCommand(agentID, command string, timeout time.Duration) (*models.AgentCommandResult, error) {
+	if err := m.requireCapability(agentID, constant.AgentCapMise); err != nil {
+		return nil, err
+	}
+
+	requestID := utils.GenerateID()
+	waiter := &agentCommandWaiter{agentID: agentID, ch: make(chan *models.AgentCommandResult, 1)}
+	agentCommandMu.Lock()
+	agentCommandWaiters[requestID] = waiter
+	agentCommandMu.Unlock()
+	defer func() {
+		agentCommandMu.Lock()
+		delete(agentCommandWaiters, requestID)
+		agentCommandMu.Unlock()
+	}()
+
+	if err := m.SendToAgent(agentID, WSTypeCommand, models.AgentCommand{
+		RequestID: requestID,
+		Command:   command,
+		Timeout:   int(timeout / time.Second),
+	}); err != nil {
+		return nil, err
+	}
+
+	// Agent 端自行按 timeout 终止命令，这里多等一会儿以便收到结果
+	select {
+	case result := <-waiter.ch:
+		return result, nil
+	case <-time.After(timeout + 30*time.Second):
+		return nil, fmt.Errorf("等待 Agent 返回结果超时")
+	}
+}
+
+// HandleCommandMessage 处理 Agent 返回的一次性命令输出与结果，只接受发起请求的 Agent 的消息
+func (m *AgentWSManager) HandleCommandMessage(agentID, msgType string, data json.RawMessage) {
+	var msg struct {
+		models.AgentCommandResult
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	agentCommandMu.Lock()
+	waiter, ok := agentCommandWaiters[msg.RequestID]
+	agentCommandMu.Unlock()
+	if !ok || waiter.agentID != agentID {
+		return
+	}
+
+	switch msgType {
+	case WSTypeCommandOutput:
+		GetSystemWSManager().Broadcast(constant.EventAgentCommandOutput, map[string]interface{}{
+			"agent_id":   agentID,
+			"request_id": msg.RequestID,
+			"data":       msg.Data,
+		})
+	case WSTypeCommandResult:
+		result := msg.AgentCommandResult
+		select {
+		case waiter.ch <- &result:
+		default:
+		}
+	}
+}
+
+// UpdateAgentRuntimes 保存 Agent 上报的 mise 运行时
+func (m *AgentWSManager) UpdateAgentRuntimes(agentID string, data json.RawMessage) {
+	var msg struct {
+		Runtimes models.AgentRuntimes `json:"runtimes"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if msg.Runtimes == nil {
+		msg.Runtimes = models.AgentRuntimes{}
+	}
+	if err := database.DB.Model(&models.Agent{}).Where("id = ?", agentID).Update("runtimes", msg.Runtimes).Error; err != nil {
+		logger.Warnf("[AgentWS] 保存 Agent #%s 运行时失败: %v", agentID, err)
+	}
+}
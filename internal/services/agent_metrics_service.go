@@ -0,0 +1,285 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/timeseries"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// Agent 历史指标名称，与主机历史指标同名的含义相同
+const (
+	AgentMetricLoad5  = "load5"  // 5 分钟平均负载
+	AgentMetricLoad15 = "load15" // 15 分钟平均负载
+)
+
+var agentMetricNames = []string{
+	HostMetricCPUPercent, HostMetricLoad1, AgentMetricLoad5, AgentMetricLoad15,
+	HostMetricMemPercent, HostMetricMemUsed, HostMetricDiskPercent, HostMetricDiskUsed,
+	HostMetricQueueDepth, HostMetricRunningTasks, HostMetricBusyWorkers,
+}
+
+// agentMetricTiers Agent 指标只保存在内存中：1 分钟分辨率保留 6 小时，10 分钟分辨率保留 3 天
+var agentMetricTiers = []timeseries.Tier{
+	{Resolution: time.Minute, Capacity: 6 * 60},
+	{Resolution: 10 * time.Minute, Capacity: 3 * 24 * 6},
+}
+
+// agentOfflineCheckSpec 检查 Agent 离线时长的间隔
+const agentOfflineCheckSpec = "@every 1m"
+
+// agentResourceRule 资源告警规则
+type agentResourceRule struct {
+	metric  string
+	label   string
+	key     string
+	value   func(m *models.AgentHostMetrics) float64
+	current func(m *models.AgentHostMetrics) string
+}
+
+var agentResourceRules = []agentResourceRule{
+	{
+		metric: HostMetricCPUPercent, label: "CPU 使用率", key: constant.KeyAgentAlertCPUPercent,
+		value: func(m *models.AgentHostMetrics) float64 { return m.CPUPercent },
+		current: func(m *models.AgentHostMetrics) string {
+			return fmt.Sprintf("负载 %.2f / %.2f / %.2f", m.Load1, m.Load5, m.Load15)
+		},
+	},
+	{
+		metric: HostMetricMemPercent, label: "内存使用率", key: constant.KeyAgentAlertMemPercent,
+		value: func(m *models.AgentHostMetrics) float64 { return m.MemPercent },
+		current: func(m *models.AgentHostMetrics) string {
+			return fmt.Sprintf("已用 %s / %s", formatBytes(m.MemUsed), formatBytes(m.MemTotal))
+		},
+	},
+	{
+		metric: HostMetricDiskPercent, label: "磁盘使用率", key: constant.KeyAgentAlertDiskPercent,
+		value: func(m *models.AgentHostMetrics) float64 { return m.DiskPercent },
+		current: func(m *models.AgentHostMetrics) string {
+			return fmt.Sprintf("%s 已用 %s / %s", m.DiskPath, formatBytes(m.DiskUsed), formatBytes(m.DiskTotal))
+		},
+	},
+}
+
+// formatBytes 以易读的单位显示字节数
+func formatBytes(v uint64) string {
+	switch {
+	case v >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(v)/(1<<30))
+	case v >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(v)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KB", float64(v)/(1<<10))
+	}
+}
+
+// alertLimiter 按冷却时间限制同一告警的发送频率，指标在阈值附近反复波动时也不会重复通知
+type alertLimiter struct {
+	lastSent map[string]time.Time
+}
+
+// Allow 判断 key 对应的告警此刻能否发送，能发送时记录发送时间
+func (l *alertLimiter) Allow(key string, now time.Time, cooldown time.Duration) bool {
+	if l.lastSent == nil {
+		l.lastSent = make(map[string]time.Time)
+	}
+	if last, ok := l.lastSent[key]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	l.lastSent[key] = now
+	return true
+}
+
+// Reset 清除 key 的发送记录
+func (l *alertLimiter) Reset(key string) {
+	delete(l.lastSent, key)
+}
+
+// AgentMetricsService Agent 主机指标服务
+// 记录 Agent 心跳上报的资源与调度器负载，按阈值发布资源告警与离线告警事件，由通知系统推送
+type AgentMetricsService struct {
+	settingsService *SettingsService
+
+	mu      sync.Mutex
+	stores  map[string]*timeseries.Store
+	limiter alertLimiter
+	offline map[string]bool // 已发送过离线告警的 Agent，重新上线后清除
+}
+
+var (
+	agentMetricsServiceInstance *AgentMetricsService
+	agentMetricsServiceOnce     sync.Once
+)
+
+// GetAgentMetricsService 获取 Agent 指标服务单例
+func GetAgentMetricsService() *AgentMetricsService {
+	agentMetricsServiceOnce.Do(func() {
+		agentMetricsServiceInstance = &AgentMetricsService{
+			settingsService: NewSettingsService(),
+			stores:          make(map[string]*timeseries.Store),
+			offline:         make(map[string]bool),
+		}
+	})
+	return agentMetricsServiceInstance
+}
+
+// AgentMetricNames 支持查询的 Agent 指标名称
+func AgentMetricNames() []string {
+	return append([]string(nil), agentMetricNames...)
+}
+
+// Start 开始定时检查 Agent 离线时长
+// 启动前已离线超过阈值的 Agent 视为已告警，避免每次重启面板都重复通知
+func (s *AgentMetricsService) Start() {
+	threshold := s.offlineThreshold()
+	if threshold > 0 {
+		s.mu.Lock()
+		for _, agent := range s.offlineAgents(time.Now().Add(-threshold)) {
+			s.offline[agent.ID] = true
+		}
+		s.mu.Unlock()
+	}
+	executor.GetSysCron().AddJob(agentOfflineCheckSpec, s.checkOffline)
+}
+
+// Record 记录一次心跳上报的指标并检查资源阈值，旧版 Agent 不上报主机资源时只清除离线告警状态
+func (s *AgentMetricsService) Record(agent *models.Agent, metrics *models.AgentHostMetrics, load *models.AgentLoad) {
+	s.mu.Lock()
+	delete(s.offline, agent.ID)
+	s.mu.Unlock()
+	if metrics == nil {
+		return
+	}
+
+	now := time.Now()
+	values := []float64{
+		metrics.CPUPercent, metrics.Load1, metrics.Load5, metrics.Load15,
+		metrics.MemPercent, float64(metrics.MemUsed), metrics.DiskPercent, float64(metrics.DiskUsed),
+		0, 0, 0,
+	}
+	if load != nil {
+		values[8], values[9], values[10] = float64(load.QueueSize), float64(load.RunningTasks), float64(load.BusyWorkers)
+	}
+
+	s.mu.Lock()
+	store, ok := s.stores[agent.ID]
+	if !ok {
+		store = timeseries.NewStore(agentMetricNames, agentMetricTiers...)
+		s.stores[agent.ID] = store
+	}
+	s.mu.Unlock()
+	store.Add(now, values)
+
+	cooldown := time.Duration(utils.ToInt(s.settingsService.Get(constant.SectionAgentAlert, constant.KeyAgentAlertCooldownMinutes), 60)) * time.Minute
+	for _, rule := range agentResourceRules {
+		threshold := float64(utils.ToInt(s.settingsService.Get(constant.SectionAgentAlert, rule.key), 0))
+		value := rule.value(metrics)
+		key := agent.ID + ":" + rule.metric
+
+		if threshold <= 0 || value < threshold {
+			continue
+		}
+		s.mu.Lock()
+		allowed := s.limiter.Allow(key, now, cooldown)
+		s.mu.Unlock()
+		if !allowed {
+			continue
+		}
+
+		logger.Warnf("[AgentMetrics] Agent #%s %s %.1f%% 超过阈值 %.0f%%", agent.ID, rule.label, value, threshold)
+		eventbus.DefaultBus.Publish(eventbus.Event{
+			Type: constant.EventAgentResourceAlert,
+			Payload: map[string]interface{}{
+				"agent_id":     agent.ID,
+				"agent_name":   agent.Name,
+				"metric":       rule.metric,
+				"metric_label": rule.label,
+				"value":        fmt.Sprintf("%.1f", value),
+				"threshold":    fmt.Sprintf("%.0f", threshold),
+				"detail":       rule.current(metrics),
+			},
+		})
+	}
+}
+
+// History 查询 Agent 在 [from, to] 内的历史指标，names 为空时返回全部指标
+// Agent 指标只保存在内存中，面板重启后从头开始记录
+func (s *AgentMetricsService) History(agentID string, from, to time.Time, names []string) (*HostHistory, error) {
+	s.mu.Lock()
+	store, ok := s.stores[agentID]
+	s.mu.Unlock()
+	if !ok {
+		store = timeseries.NewStore(agentMetricNames, agentMetricTiers...)
+	}
+	return queryHistory(store, from, to, names)
+}
+
+// Remove 删除 Agent 时清除其历史指标与告警状态
+func (s *AgentMetricsService) Remove(agentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.stores, agentID)
+	delete(s.offline, agentID)
+	for _, rule := range agentResourceRules {
+		s.limiter.Reset(agentID + ":" + rule.metric)
+	}
+}
+
+// offlineThreshold 离线告警时长，为 0 时不告警
+func (s *AgentMetricsService) offlineThreshold() time.Duration {
+	return time.Duration(utils.ToInt(s.settingsService.Get(constant.SectionAgentAlert, constant.KeyAgentAlertOfflineMinutes), 0)) * time.Minute
+}
+
+// offlineAgents 已启用、已通过审批、处于离线状态且最后心跳早于 before 的 Agent
+func (s *AgentMetricsService) offlineAgents(before time.Time) []models.Agent {
+	var agents []models.Agent
+	database.DB.Where("status = ? AND last_seen IS NOT NULL AND last_seen < ?", constant.AgentStatusOffline, before).Find(&agents)
+	result := agents[:0]
+	for _, agent := range agents {
+		if utils.DerefBool(agent.Enabled, true) && agent.Approved() {
+			result = append(result, agent)
+		}
+	}
+	return result
+}
+
+// checkOffline 对离线超过设定时长的 Agent 发布离线告警，每次离线只告警一次
+func (s *AgentMetricsService) checkOffline() {
+	threshold := s.offlineThreshold()
+	if threshold <= 0 {
+		return
+	}
+	wsManager := GetAgentWSManager()
+	for _, agent := range s.offlineAgents(time.Now().Add(-threshold)) {
+		if wsManager.IsAgentOnline(agent.ID) {
+			continue
+		}
+		s.mu.Lock()
+		alerted := s.offline[agent.ID]
+		s.offline[agent.ID] = true
+		s.mu.Unlock()
+		if alerted {
+			continue
+		}
+
+		lastSeen := time.Time(*agent.LastSeen)
+		logger.Warnf("[AgentMetrics] Agent #%s 已离线超过 %s", agent.ID, threshold)
+		eventbus.DefaultBus.Publish(eventbus.Event{
+			Type: constant.EventAgentOffline,
+			Payload: map[string]interface{}{
+				"agent_id":   agent.ID,
+				"agent_name": agent.Name,
+				"last_seen":  lastSeen.Format(time.DateTime),
+				"minutes":    int(time.Since(lastSeen).Minutes()),
+			},
+		})
+	}
+}
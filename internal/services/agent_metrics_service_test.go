@@ -0,0 +1,128 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/timeseries"
+)
+
+func TestAgentMetricsResourceAlert(t *testing.T) {
+	setupTestDB(t)
+
+	settings := NewSettingsService()
+	settings.Set(constant.SectionAgentAlert, constant.KeyAgentAlertDiskPercent, "90")
+	settings.Set(constant.SectionAgentAlert, constant.KeyAgentAlertMemPercent, "0")
+
+	svc := &AgentMetricsService{
+		settingsService: settings,
+		stores:          make(map[string]*timeseries.Store),
+		offline:         make(map[string]bool),
+	}
+
+	var mu sync.Mutex
+	var alerts []map[string]interface{}
+	eventbus.DefaultBus.Subscribe(constant.EventAgentResourceAlert, func(e eventbus.Event) {
+		mu.Lock()
+		alerts = append(alerts, e.Payload.(map[string]interface{}))
+		mu.Unlock()
+	})
+
+	agent := &models.Agent{ID: "a_metrics", Name: "测试 Agent"}
+	metrics := &models.AgentHostMetrics{CPUPercent: 99, MemPercent: 99, DiskPercent: 95, DiskPath: "/data"}
+	load := &models.AgentLoad{WorkerCount: 4, BusyWorkers: 2, QueueSize: 3, RunningTasks: 2}
+
+	// 冷却期内重复上报只告警一次；内存阈值为 0、CPU 使用默认值 0，均不告警
+	svc.Record(agent, metrics, load)
+	svc.Record(agent, metrics, load)
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	if len(alerts) != 1 {
+		t.Fatalf("期望 1 条告警，实际 %d 条: %v", len(alerts), alerts)
+	}
+	if alerts[0]["metric"] != HostMetricDiskPercent || alerts[0]["value"] != "95.0" || alerts[0]["threshold"] != "90" {
+		t.Errorf("告警内容不正确: %v", alerts[0])
+	}
+	mu.Unlock()
+
+	history, err := svc.History(agent.ID, time.Now().Add(-time.Hour), time.Now(), []string{HostMetricDiskPercent, HostMetricQueueDepth})
+	if err != nil {
+		t.Fatalf("查询历史指标失败: %v", err)
+	}
+	if len(history.Timestamps) != 1 || history.Series[HostMetricDiskPercent].Max[0] != 95 || history.Series[HostMetricQueueDepth].Avg[0] != 3 {
+		t.Errorf("历史指标不正确: %+v", history)
+	}
+
+	if _, err := svc.History(agent.ID, time.Now().Add(-time.Hour), time.Now(), []string{HostMetricNetRx}); err == nil {
+		t.Errorf("Agent 不采集网络指标，查询应当报错")
+	}
+}
+
+func TestAlertLimiter(t *testing.T) {
+	var l alertLimiter
+	now := time.Now()
+	if !l.Allow("a:disk", now, time.Hour) {
+		t.Fatal("首次告警应当允许")
+	}
+	if l.Allow("a:disk", now.Add(30*time.Minute), time.Hour) {
+		t.Error("冷却期内不应重复告警")
+	}
+	if !l.Allow("b:disk", now, time.Hour) {
+		t.Error("不同 Agent 的告警互不影响")
+	}
+	if !l.Allow("a:disk", now.Add(time.Hour), time.Hour) {
+		t.Error("冷却期结束后应当再次告警")
+	}
+	l.Reset("a:disk")
+	if !l.Allow("a:disk", now.Add(time.Hour+time.Minute), time.Hour) {
+		t.Error("清除记录后应当立即告警")
+	}
+}
+
+func TestAgentMetricsOfflineAlert(t *testing.T) {
+	setupTestDB(t, &models.Agent{})
+
+	settings := NewSettingsService()
+	settings.Set(constant.SectionAgentAlert, constant.KeyAgentAlertOfflineMinutes, "10")
+	svc := &AgentMetricsService{
+		settingsService: settings,
+		stores:          make(map[string]*timeseries.Store),
+		offline:         make(map[string]bool),
+	}
+
+	longAgo := models.LocalTime(time.Now().Add(-time.Hour))
+	recent := models.LocalTime(time.Now().Add(-time.Minute))
+	disabled := false
+	database.DB.Create(&models.Agent{ID: "a_old", Name: "启动前已离线", Token: "t1", MachineID: "m1", Status: constant.AgentStatusOffline, LastSeen: &longAgo})
+	svc.Start()
+	database.DB.Create(&models.Agent{ID: "a_down", Name: "刚离线", Token: "t2", MachineID: "m2", Status: constant.AgentStatusOffline, LastSeen: &longAgo})
+	database.DB.Create(&models.Agent{ID: "a_recent", Name: "离线不久", Token: "t3", MachineID: "m3", Status: constant.AgentStatusOffline, LastSeen: &recent})
+	database.DB.Create(&models.Agent{ID: "a_disabled", Name: "已禁用", Token: "t4", MachineID: "m4", Status: constant.AgentStatusOffline, LastSeen: &longAgo, Enabled: &disabled})
+
+	var mu sync.Mutex
+	var offline []string
+	eventbus.DefaultBus.Subscribe(constant.EventAgentOffline, func(e eventbus.Event) {
+		mu.Lock()
+		offline = append(offline, e.Payload.(map[string]interface{})["agent_id"].(string))
+		mu.Unlock()
+	})
+
+	// 每次离线只告警一次，重新上报心跳后再次离线才会告警
+	svc.checkOffline()
+	svc.checkOffline()
+	svc.Record(&models.Agent{ID: "a_down"}, nil, nil)
+	svc.checkOffline()
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(offline) != 2 || offline[0] != "a_down" || offline[1] != "a_down" {
+		t.Errorf("离线告警不正确: %v", offline)
+	}
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// agentRolloutTimeout 下发升级后多久仍未确认视为失败，Agent 侧回滚期限为 3 分钟
+const agentRolloutTimeout = 10 * time.Minute
+
+// AgentRolloutStats 分批升级的目标统计
+type AgentRolloutStats struct {
+	models.AgentRollout
+	Total   int `json:"total"`
+	Canary  int `json:"canary"`
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+}
+
+// AgentRolloutTargetItem 分批升级目标及 Agent 当前信息
+type AgentRolloutTargetItem struct {
+	models.AgentRolloutTarget
+	AgentName string `json:"agent_name"`
+	Version   string `json:"version"` // Agent 当前版本
+	Online    bool   `json:"online"`
+}
+
+// AgentRolloutDetail 分批升级详情
+type AgentRolloutDetail struct {
+	Rollout AgentRolloutStats        `json:"rollout"`
+	Targets []AgentRolloutTargetItem `json:"targets"`
+}
+
+// AgentRolloutService Agent 分批升级：先向金丝雀 Agent 下发更新，确认无误后再升级其余 Agent
+// 升级进行中时，Agent 的自动更新由升级计划接管，未放行的 Agent 不会更新
+type AgentRolloutService struct {
+	agentService *AgentService
+
+	mu       sync.Mutex
+	activeID string // 进行中的升级，同一时间只允许一个
+}
+
+var (
+	agentRolloutServiceInstance *AgentRolloutService
+	agentRolloutServiceOnce     sync.Once
+)
+
+// GetAgentRolloutService 获取 Agent 分批升级服务单例
+func GetAgentRolloutService() *AgentRolloutService {
+	agentRolloutServiceOnce.Do(func() {
+		agentRolloutServiceInstance = &AgentRolloutService{agentService: NewAgentService()}
+	})
+	return agentRolloutServiceInstance
+}
+
+// Start 恢复重启前进行中的升级，并定期检查升级超时
+func (s *AgentRolloutService) Start() {
+	var rollout models.AgentRollout
+	if err := database.DB.Where("status = ?", constant.TaskStatusRunning).Order("created_at DESC").First(&rollout).Error; err == nil {
+		s.mu.Lock()
+		s.activeID = rollout.ID
+		s.mu.Unlock()
+	}
+	executor.GetSysCron().AddJob("@every 1m", s.checkTimeout)
+}
+
+// Create 为所有需要更新的已启用 Agent 创建升级计划，canaryIDs 与按比例随机抽取的 Agent 作为金丝雀
+// 没有金丝雀时直接升级全部 Agent
+func (s *AgentRolloutService) Create(canaryPercent int, canaryIDs []string) (*models.AgentRollout, error) {
+	if canaryPercent < 0 || canaryPercent > 100 {
+		return nil, fmt.Errorf("金丝雀比例必须在 0 到 100 之间")
+	}
+	version := s.agentService.GetLatestVersion()
+	if version == "" {
+		return nil, fmt.Errorf("未找到 Agent 发布包版本信息")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activeID != "" {
+		return nil, fmt.Errorf("已有进行中的分批升级，请先完成或取消")
+	}
+
+	var agents []models.Agent
+	database.DB.Where("enabled = ? OR enabled IS NULL", true).Order("created_at ASC").Find(&agents)
+	var ids []string
+	versions := make(map[string]string)
+	for _, agent := range agents {
+		if agent.Approved() && s.agentService.CheckNeedUpdate(agent.Version, agent.BuildTime) {
+			ids = append(ids, agent.ID)
+			versions[agent.ID] = agent.Version
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("所有 Agent 均已是最新版本")
+	}
+
+	canaries := selectCanaries(ids, canaryIDs, canaryPercent, rand.New(rand.NewSource(time.Now().UnixNano())))
+	rollout := &models.AgentRollout{
+		ID:            utils.GenerateID(),
+		Version:       version,
+		CanaryPercent: canaryPercent,
+		Stage:         constant.AgentRolloutStageCanary,
+		Status:        constant.TaskStatusRunning,
+	}
+	if len(canaries) == 0 {
+		rollout.Stage = constant.AgentRolloutStageAll
+	}
+	targets := make([]models.AgentRolloutTarget, 0, len(ids))
+	for _, id := range ids {
+		targets = append(targets, models.AgentRolloutTarget{
+			ID:          utils.GenerateID(),
+			RolloutID:   rollout.ID,
+			AgentID:     id,
+			Canary:      canaries[id],
+			Status:      constant.TaskStatusPending,
+			FromVersion: versions[id],
+		})
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(rollout).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(&targets).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	s.activeID = rollout.ID
+	logger.Infof("[AgentRollout] 开始分批升级到 %s: 共 %d 个 Agent，金丝雀 %d 个", version, len(ids), len(canaries))
+	s.dispatch(rollout)
+	return rollout, nil
+}
+
+// selectCanaries 选出金丝雀 Agent：指定的 Agent 加上随机抽取的 Agent，总数不少于 ids 的 percent%
+func selectCanaries(ids, explicit []string, percent int, r *rand.Rand) map[string]bool {
+	canaries := make(map[string]bool)
+	candidates := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		candidates[id] = true
+	}
+	for _, id := range explicit {
+		if candidates[id] {
+			canaries[id] = true
+		}
+	}
+
+	want := (len(ids)*percent + 99) / 100
+	for _, i := range r.Perm(len(ids)) {
+		if len(canaries) >= want {
+			break
+		}
+		canaries[ids[i]] = true
+	}
+	return canaries
+}
+
+// Promote 金丝雀升级完成后放行其余 Agent，force 为 true 时忽略失败的金丝雀
+func (s *AgentRolloutService) Promote(id string, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollout, err := s.getRunning(id)
+	if err != nil {
+		return err
+	}
+	if rollout.Stage != constant.AgentRolloutStageCanary {
+		return fmt.Errorf("已在升级全部 Agent")
+	}
+
+	var counts []struct {
+		Status string
+		Count  int
+	}
+	database.DB.Model(&models.AgentRolloutTarget{}).Select("status, count(*) as count").
+		Where("rollout_id = ? AND canary = ?", id, true).Group("status").Scan(&counts)
+	for _, c := range counts {
+		switch c.Status {
+		case constant.TaskStatusPending, constant.TaskStatusRunning:
+			return fmt.Errorf("还有 %d 个金丝雀 Agent 未完成升级", c.Count)
+		case constant.TaskStatusFailed:
+			if !force {
+				return fmt.Errorf("有 %d 个金丝雀 Agent 升级失败，确认无误后可强制继续", c.Count)
+			}
+		}
+	}
+
+	rollout.Stage = constant.AgentRolloutStageAll
+	if err := database.DB.Model(rollout).Update("stage", rollout.Stage).Error; err != nil {
+		return err
+	}
+	logger.Infof("[AgentRollout] 金丝雀验证完成，开始升级其余 Agent")
+	s.dispatch(rollout)
+	s.checkDone(rollout)
+	return nil
+}
+
+// Cancel 取消升级，尚未下发的 Agent 不再升级，恢复各 Agent 自身的自动更新设置
+func (s *AgentRolloutService) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollout, err := s.getRunning(id)
+	if err != nil {
+		return err
+	}
+	database.DB.Model(&models.AgentRolloutTarget{}).
+		Where("rollout_id = ? AND status = ?", id, constant.TaskStatusPending).
+		Update("status", constant.TaskStatusCancelled)
+	s.finish(rollout, constant.TaskStatusCancelled)
+	return nil
+}
+
+// List 最近的升级记录
+func (s *AgentRolloutService) List(limit int) []AgentRolloutStats {
+	var rollouts []models.AgentRollout
+	database.DB.Order("created_at DESC").Limit(limit).Find(&rollouts)
+	result := make([]AgentRolloutStats, 0, len(rollouts))
+	for _, r := range rollouts {
+		result = append(result, s.stats(r))
+	}
+	return result
+}
+
+// Detail 升级详情
+func (s *AgentRolloutService) Detail(id string) (*AgentRolloutDetail, error) {
+	var rollout models.AgentRollout
+	if err := database.DB.Where("id = ?", id).First(&rollout).Error; err != nil {
+		return nil, fmt.Errorf("升级记录不存在")
+	}
+
+	var targets []models.AgentRolloutTarget
+	database.DB.Where("rollout_id = ?", id).Order("canary DESC, agent_id ASC").Find(&targets)
+	agentIDs := make([]string, 0, len(targets))
+	for _, t := range targets {
+		agentIDs = append(agentIDs, t.AgentID)
+	}
+	var agents []models.Agent
+	database.DB.Where("id IN ?", agentIDs).Find(&agents)
+	agentMap := make(map[string]models.Agent, len(agents))
+	for _, a := range agents {
+		agentMap[a.ID] = a
+	}
+
+	ws := GetAgentWSManager()
+	detail := &AgentRolloutDetail{Rollout: s.stats(rollout), Targets: make([]AgentRolloutTargetItem, 0, len(targets))}
+	for _, t := range targets {
+		agent := agentMap[t.AgentID]
+		detail.Targets = append(detail.Targets, AgentRolloutTargetItem{
+			AgentRolloutTarget: t,
+			AgentName:          agent.Name,
+			Version:            agent.Version,
+			Online:             ws.IsAgentOnline(t.AgentID),
+		})
+	}
+	return detail, nil
+}
+
+// Heartbeat 处理 Agent 心跳：更新升级进度，返回该 Agent 是否可以按自身设置自动更新
+// 没有进行中的升级时原样返回 needUpdate；升级进行中时由升级计划主动下发更新
+func (s *AgentRolloutService) Heartbeat(agentID string, needUpdate bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeID == "" {
+		return needUpdate
+	}
+	rollout, err := s.getRunning(s.activeID)
+	if err != nil {
+		return needUpdate
+	}
+
+	var target models.AgentRolloutTarget
+	if err := database.DB.Where("rollout_id = ? AND agent_id = ?", rollout.ID, agentID).First(&target).Error; err != nil {
+		// 升级开始后新加入的 Agent 在放行全部后按自身设置更新
+		return needUpdate && rollout.Stage == constant.AgentRolloutStageAll
+	}
+
+	switch {
+	case !needUpdate && (target.Status == constant.TaskStatusPending || target.Status == constant.TaskStatusRunning):
+		s.setTarget(&target, constant.TaskStatusSuccess, "")
+		s.checkDone(rollout)
+	case target.Status == constant.TaskStatusPending && (target.Canary || rollout.Stage == constant.AgentRolloutStageAll):
+		s.sendUpdate(&target)
+	}
+	return false
+}
+
+// HandleUpdateResult 处理 Agent 上报的自更新结果
+func (s *AgentRolloutService) HandleUpdateResult(agentID string, success bool, version, errMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeID == "" {
+		return
+	}
+	rollout, err := s.getRunning(s.activeID)
+	if err != nil {
+		return
+	}
+	var target models.AgentRolloutTarget
+	if err := database.DB.Where("rollout_id = ? AND agent_id = ? AND status IN ?", rollout.ID, agentID,
+		[]string{constant.TaskStatusPending, constant.TaskStatusRunning}).First(&target).Error; err != nil {
+		return
+	}
+	if success {
+		s.setTarget(&target, constant.TaskStatusSuccess, "")
+	} else {
+		if errMsg == "" {
+			errMsg = "升级失败"
+		}
+		logger.Warnf("[AgentRollout] Agent #%s 升级到 %s 失败: %s", agentID, version, errMsg)
+		s.setTarget(&target, constant.TaskStatusFailed, errMsg)
+	}
+	s.checkDone(rollout)
+}
+
+// RemoveAgent Agent 被删除时取消其未完成的升级，避免升级无法结束
+func (s *AgentRolloutService) RemoveAgent(agentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeID == "" {
+		return
+	}
+	rollout, err := s.getRunning(s.activeID)
+	if err != nil {
+		return
+	}
+	res := database.DB.Model(&models.AgentRolloutTarget{}).
+		Where("rollout_id = ? AND agent_id = ? AND status IN ?", rollout.ID, agentID, []string{constant.TaskStatusPending, constant.TaskStatusRunning}).
+		Updates(map[string]interface{}{"status": constant.TaskStatusCancelled, "error": "Agent 已删除"})
+	if res.RowsAffected > 0 {
+		s.checkDone(rollout)
+	}
+}
+
+// dispatch 向已放行且在线的待升级 Agent 下发更新，离线的在下次心跳时下发
+func (s *AgentRolloutService) dispatch(rollout *models.AgentRollout) {
+	query := database.DB.Where("rollout_id = ? AND status = ?", rollout.ID, constant.TaskStatusPending)
+	if rollout.Stage == constant.AgentRolloutStageCanary {
+		query = query.Where("canary = ?", true)
+	}
+	var targets []models.AgentRolloutTarget
+	query.Find(&targets)
+
+	ws := GetAgentWSManager()
+	for i := range targets {
+		if ws.IsAgentOnline(targets[i].AgentID) {
+			s.sendUpdate(&targets[i])
+		}
+	}
+}
+
+func (s *AgentRolloutService) sendUpdate(target *models.AgentRolloutTarget) {
+	if err := GetAgentWSManager().SendToAgent(target.AgentID, WSTypeUpdate, map[string]interface{}{"rollout_id": target.RolloutID}); err != nil {
+		return
+	}
+	now := models.Now()
+	target.StartTime = &now
+	s.setTarget(target, constant.TaskStatusRunning, "")
+}
+
+func (s *AgentRolloutService) setTarget(target *models.AgentRolloutTarget, status, errMsg string) {
+	target.Status = status
+	target.Error = errMsg
+	database.DB.Model(target).Updates(map[string]interface{}{
+		"status":     status,
+		"error":      errMsg,
+		"start_time": target.StartTime,
+	})
+}
+
+// checkTimeout 将下发后长时间未确认的 Agent 标记为失败
+func (s *AgentRolloutService) checkTimeout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeID == "" {
+		return
+	}
+	rollout, err := s.getRunning(s.activeID)
+	if err != nil {
+		return
+	}
+	deadline := models.LocalTime(time.Now().Add(-agentRolloutTimeout))
+	res := database.DB.Model(&models.AgentRolloutTarget{}).
+		Where("rollout_id = ? AND status = ? AND start_time < ?", rollout.ID, constant.TaskStatusRunning, deadline).
+		Updates(map[string]interface{}{"status": constant.TaskStatusFailed, "error": "升级超时，未收到新版本心跳"})
+	if res.RowsAffected > 0 {
+		s.checkDone(rollout)
+	}
+}
+
+// checkDone 全部 Agent 都已放行且没有未完成的目标时结束升级
+func (s *AgentRolloutService) checkDone(rollout *models.AgentRollout) {
+	if rollout.Stage != constant.AgentRolloutStageAll {
+		return
+	}
+	var remaining int64
+	database.DB.Model(&models.AgentRolloutTarget{}).
+		Where("rollout_id = ? AND status IN ?", rollout.ID, []string{constant.TaskStatusPending, constant.TaskStatusRunning}).
+		Count(&remaining)
+	if remaining == 0 {
+		s.finish(rollout, constant.TaskStatusSuccess)
+	}
+}
+
+func (s *AgentRolloutService) finish(rollout *models.AgentRollout, status string) {
+	now := models.Now()
+	database.DB.Model(rollout).Updates(map[string]interface{}{"status": status, "end_time": &now})
+	if s.activeID == rollout.ID {
+		s.activeID = ""
+	}
+	logger.Infof("[AgentRollout] 分批升级到 %s 已结束: %s", rollout.Version, status)
+}
+
+func (s *AgentRolloutService) getRunning(id string) (*models.AgentRollout, error) {
+	var rollout models.AgentRollout
+	if err := database.DB.Where("id = ?", id).First(&rollout).Error; err != nil {
+		return nil, fmt.Errorf("升级记录不存在")
+	}
+	if rollout.Status != constant.TaskStatusRunning {
+		return nil, fmt.Errorf("升级已结束")
+	}
+	return &rollout, nil
+}
+
+func (s *AgentRolloutService) stats(rollout models.AgentRollout) AgentRolloutStats {
+	stats := AgentRolloutStats{AgentRollout: rollout}
+	var targets []models.AgentRolloutTarget
+	database.DB.Select("status, canary").Where("rollout_id = ?", rollout.ID).Find(&targets)
+	for _, t := range targets {
+		stats.Total++
+		if t.Canary {
+			stats.Canary++
+		}
+		switch t.Status {
+		case constant.TaskStatusPending:
+			stats.Pending++
+		case constant.TaskStatusRunning:
+			stats.Running++
+		case constant.TaskStatusSuccess:
+			stats.Success++
+		case constant.TaskStatusFailed:
+			stats.Failed++
+		}
+	}
+	return stats
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestSelectCanaries(t *testing.T) {
+	ids := []string{"a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8", "a9", "a10"}
+	r := rand.New(rand.NewSource(1))
+
+	if got := selectCanaries(ids, nil, 0, r); len(got) != 0 {
+		t.Errorf("比例为 0 且未指定时不应有金丝雀: %v", got)
+	}
+	if got := selectCanaries(ids, []string{"a3", "unknown"}, 0, r); len(got) != 1 || !got["a3"] {
+		t.Errorf("只应包含指定且需要更新的 Agent: %v", got)
+	}
+	// 向上取整：10 个中的 15% 为 2 个
+	if got := selectCanaries(ids, nil, 15, r); len(got) != 2 {
+		t.Errorf("期望 2 个金丝雀，实际 %v", got)
+	}
+	// 指定的 Agent 计入比例
+	if got := selectCanaries(ids, []string{"a1", "a2"}, 20, r); len(got) != 2 || !got["a1"] || !got["a2"] {
+		t.Errorf("指定的 Agent 已满足比例时不应再随机抽取: %v", got)
+	}
+}
+
+func TestAgentRolloutFlow(t *testing.T) {
+	setupTestDB(t, &models.Agent{}, &models.AgentRollout{}, &models.AgentRolloutTarget{})
+	t.Chdir(t.TempDir())
+	os.MkdirAll(filepath.Join("data", "agent"), 0755)
+	os.WriteFile(filepath.Join("data", "agent", "version.txt"), []byte("v2\n"), 0644)
+
+	for i, id := range []string{"a1", "a2", "a3", "a4"} {
+		version := "v1"
+		if id == "a4" {
+			version = "v2"
+		}
+		database.DB.Create(&models.Agent{ID: id, Name: id, Token: id, MachineID: "m" + string(rune('0'+i)), Version: version})
+	}
+
+	svc := &AgentRolloutService{agentService: NewAgentService()}
+	rollout, err := svc.Create(0, []string{"a1"})
+	if err != nil {
+		t.Fatalf("创建升级失败: %v", err)
+	}
+	if _, err := svc.Create(0, nil); err == nil {
+		t.Error("已有进行中的升级时不能再创建")
+	}
+
+	detail, _ := svc.Detail(rollout.ID)
+	if detail.Rollout.Total != 3 || detail.Rollout.Canary != 1 || detail.Rollout.Stage != constant.AgentRolloutStageCanary {
+		t.Fatalf("升级计划不正确: %+v", detail.Rollout)
+	}
+
+	// 金丝雀阶段其余 Agent 不自动更新
+	if svc.Heartbeat("a2", true) {
+		t.Error("未放行的 Agent 不应自动更新")
+	}
+	if err := svc.Promote(rollout.ID, false); err == nil {
+		t.Error("金丝雀未完成时不能放行")
+	}
+
+	// 金丝雀上报新版本后升级成功，放行其余 Agent
+	svc.Heartbeat("a1", false)
+	if err := svc.Promote(rollout.ID, false); err != nil {
+		t.Fatalf("放行失败: %v", err)
+	}
+	svc.HandleUpdateResult("a2", false, "v2", "签名校验失败")
+	svc.Heartbeat("a3", false)
+
+	detail, _ = svc.Detail(rollout.ID)
+	if detail.Rollout.Status != constant.TaskStatusSuccess || detail.Rollout.Success != 2 || detail.Rollout.Failed != 1 {
+		t.Fatalf("升级结果不正确: %+v", detail.Rollout)
+	}
+	for _, target := range detail.Targets {
+		if target.AgentID == "a2" && target.Error != "签名校验失败" {
+			t.Errorf("失败原因未记录: %+v", target)
+		}
+	}
+
+	// 升级结束后恢复按 Agent 自身设置更新
+	if !svc.Heartbeat("a2", true) {
+		t.Error("升级结束后应恢复自动更新")
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -10,8 +12,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/agentsign"
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
 	"github.com/engigu/baihu-panel/internal/executor"
 	"github.com/engigu/baihu-panel/internal/logger"
 	"github.com/engigu/baihu-panel/internal/models"
@@ -111,29 +117,44 @@ func (s *AgentService) UseToken(id string) {
 // ========== Agent 注册 ==========
 
 // RegisterByToken 通过令牌注册 Agent（首次 WebSocket 连接时调用）
+// 开启注册审批时新 Agent 处于待审批状态，审批通过前不下发任务
 // 返回: agent, isNewAgent, error
-func (s *AgentService) RegisterByToken(token string, machineID string, ip string) (*models.Agent, bool, error) {
+func (s *AgentService) RegisterByToken(req *models.AgentRegisterRequest, ip string) (*models.Agent, bool, error) {
 	// 验证令牌
-	agentToken, err := s.ValidateToken(token)
+	agentToken, err := s.ValidateToken(req.Token)
 	if err != nil {
 		return nil, false, err
 	}
 
+	approval := constant.AgentApprovalApproved
+	if s.RequireApproval() {
+		approval = constant.AgentApprovalPending
+	}
+
 	// 如果提供了 machine_id，先检查是否已存在
-	if machineID != "" {
+	if req.MachineID != "" {
 		var existing models.Agent
-		res := database.DB.Where("machine_id = ?", machineID).Limit(1).Find(&existing)
+		res := database.DB.Where("machine_id = ?", req.MachineID).Limit(1).Find(&existing)
 		if res.Error == nil && res.RowsAffected > 0 {
 			// 已存在，更新 token 和状态，复用已有 Agent
 			now := models.LocalTime(time.Now())
-			database.DB.Model(&existing).Updates(map[string]interface{}{
-				"token":     token,
+			updates := map[string]interface{}{
+				"token":     req.Token,
 				"ip":        ip,
 				"status":    constant.AgentStatusOnline,
 				"last_seen": now,
-			})
+			}
+			// 开启审批时换令牌重新注册同样需要审批，已拒绝的保持拒绝
+			pending := approval == constant.AgentApprovalPending && existing.Approval != constant.AgentApprovalRejected
+			if pending {
+				updates["approval"] = approval
+			}
+			database.DB.Model(&existing).Updates(updates)
 			s.UseToken(agentToken.ID)
-			logger.Infof("[Agent] Agent #%s 通过 machine_id 复用 (%s)", existing.ID, machineID[:8]+"...")
+			logger.Infof("[Agent] Agent #%s 通过 machine_id 复用 (%s)", existing.ID, req.MachineID[:8]+"...")
+			if pending {
+				s.publishPending(&existing)
+			}
 			return &existing, false, nil
 		}
 	}
@@ -143,12 +164,17 @@ func (s *AgentService) RegisterByToken(token string, machineID string, ip string
 	agent := &models.Agent{
 		ID:        utils.GenerateID(),
 		Name:      fmt.Sprintf("agent-%d", time.Now().Unix()),
-		Token:     token,
-		MachineID: machineID,
+		Token:     req.Token,
+		MachineID: req.MachineID,
 		IP:        ip,
+		Hostname:  req.Hostname,
+		OS:        req.OS,
+		Arch:      req.Arch,
+		Version:   req.Version,
 		Status:    constant.AgentStatusOnline,
 		LastSeen:  &now,
 		Enabled:   utils.BoolPtr(true),
+		Approval:  approval,
 	}
 
 	if err := database.DB.Create(agent).Error; err != nil {
@@ -157,9 +183,161 @@ func (s *AgentService) RegisterByToken(token string, machineID string, ip string
 
 	s.UseToken(agentToken.ID)
 	logger.Infof("[Agent] Agent 通过令牌注册: #%s (%s)", agent.ID, ip)
+	if approval == constant.AgentApprovalPending {
+		s.publishPending(agent)
+	}
 	return agent, true, nil
 }
 
+// SetPublicKey 保存 Agent 上报的端到端加密公钥，公钥有变化时返回 true
+// 首次上报的公钥直接固定；之后只有附带旧私钥解出的轮换挑战（proof）才能替换，
+// 否则新公钥记为待批准，由管理员确认，避免拿到令牌的人悄悄换掉公钥窃取机密
+func (s *AgentService) SetPublicKey(agent *models.Agent, publicKey, proof string) bool {
+	if publicKey == "" || publicKey == agent.PublicKey {
+		return false
+	}
+	if !agentcrypto.ValidPublicKey(publicKey) {
+		logger.Warnf("[Agent] Agent #%s 上报的公钥无效，忽略", agent.ID)
+		return false
+	}
+
+	// 以数据库为准，连接上缓存的 Agent 可能早于本次轮换
+	var current models.Agent
+	if err := database.DB.Select("id, public_key, pending_key, key_challenge").Where("id = ?", agent.ID).First(&current).Error; err != nil {
+		return false
+	}
+	if current.PublicKey == publicKey {
+		agent.PublicKey = publicKey
+		return false
+	}
+	if current.PublicKey != "" && !keyProofValid(current.KeyChallenge, proof) {
+		if current.PendingKey != publicKey {
+			database.DB.Model(&models.Agent{}).Where("id = ?", agent.ID).Update("pending_key", publicKey)
+			logger.Warnf("[Agent] Agent #%s 上报了未经旧私钥证明的新公钥 %s，等待管理员批准", agent.ID, agentcrypto.Fingerprint(publicKey))
+		}
+		return false
+	}
+	if err := s.savePublicKey(agent, publicKey); err != nil {
+		logger.Errorf("[Agent] 保存 Agent #%s 公钥失败: %v", agent.ID, err)
+		return false
+	}
+	if current.PublicKey == "" {
+		logger.Infof("[Agent] Agent #%s 启用端到端加密，公钥指纹 %s", agent.ID, agentcrypto.Fingerprint(publicKey))
+	} else {
+		logger.Infof("[Agent] Agent #%s 公钥已轮换，新指纹 %s", agent.ID, agentcrypto.Fingerprint(publicKey))
+	}
+	return true
+}
+
+// savePublicKey 替换公钥并清除待批准的公钥与轮换挑战
+func (s *AgentService) savePublicKey(agent *models.Agent, publicKey string) error {
+	now := models.LocalTime(time.Now())
+	if err := database.DB.Model(&models.Agent{}).Where("id = ?", agent.ID).Updates(map[string]interface{}{
+		"public_key":    publicKey,
+		"public_key_at": &now,
+		"pending_key":   "",
+		"key_challenge": "",
+	}).Error; err != nil {
+		return err
+	}
+	agent.PublicKey = publicKey
+	agent.PublicKeyAt = &now
+	agent.PendingKey = ""
+	agent.KeyChallenge = ""
+	return nil
+}
+
+// BeginKeyRotation 生成轮换挑战，返回用当前公钥加密的挑战，Agent 轮换后须随新公钥回传明文
+func (s *AgentService) BeginKeyRotation(agent *models.Agent) (string, error) {
+	if agent.PublicKey == "" {
+		return "", &ServiceError{Message: "Agent 尚未上报公钥"}
+	}
+	nonce := generateToken()
+	sealed, err := agentcrypto.Encrypt(agent.PublicKey, nonce)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(nonce))
+	if err := database.DB.Model(&models.Agent{}).Where("id = ?", agent.ID).Update("key_challenge", hex.EncodeToString(sum[:])).Error; err != nil {
+		return "", err
+	}
+	return sealed, nil
+}
+
+// ApprovePendingKey 管理员批准 Agent 上报的新公钥
+func (s *AgentService) ApprovePendingKey(id string) (*models.Agent, error) {
+	agent := s.GetByID(id)
+	if agent == nil {
+		return nil, &ServiceError{Message: "Agent 不存在"}
+	}
+	if agent.PendingKey == "" {
+		return nil, &ServiceError{Message: "没有待批准的公钥"}
+	}
+	if err := s.savePublicKey(agent, agent.PendingKey); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// keyProofValid 校验 Agent 回传的轮换挑战
+func keyProofValid(challenge, proof string) bool {
+	if challenge == "" || proof == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(proof))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// SetProtocol 保存 Agent 握手上报的协议版本与能力，供离线时展示需要升级的功能
+func (s *AgentService) SetProtocol(agentID string, peer agentproto.Peer) error {
+	return database.DB.Model(&models.Agent{}).Where("id = ?", agentID).Updates(map[string]interface{}{
+		"protocol":     peer.ProtocolVersion,
+		"capabilities": models.AgentCapabilities(peer.Capabilities),
+	}).Error
+}
+
+// RequireApproval 是否开启了新 Agent 注册审批
+func (s *AgentService) RequireApproval() bool {
+	return NewSettingsService().Get(constant.SectionAgent, constant.KeyAgentRequireApproval) == "true"
+}
+
+// publishPending 通知管理员有 Agent 等待审批
+func (s *AgentService) publishPending(agent *models.Agent) {
+	logger.Warnf("[Agent] Agent #%s (%s, %s) 等待审批", agent.ID, agent.Hostname, agent.IP)
+	eventbus.DefaultBus.Publish(eventbus.Event{
+		Type: constant.EventAgentPending,
+		Payload: map[string]interface{}{
+			"agent_id":   agent.ID,
+			"agent_name": agent.Name,
+			"hostname":   agent.Hostname,
+			"ip":         agent.IP,
+			"os":         agent.OS,
+			"arch":       agent.Arch,
+			"machine_id": agent.MachineID,
+		},
+	})
+}
+
+// Review 审批 Agent 注册，approve 为 false 时拒绝
+func (s *AgentService) Review(id string, approve bool) (*models.Agent, error) {
+	agent := s.GetByID(id)
+	if agent == nil {
+		return nil, &ServiceError{Message: "Agent 不存在"}
+	}
+	approval := constant.AgentApprovalApproved
+	if !approve {
+		approval = constant.AgentApprovalRejected
+	}
+	if agent.Approval == approval {
+		return nil, &ServiceError{Message: "Agent 已是该审批状态"}
+	}
+	if err := database.DB.Model(agent).Update("approval", approval).Error; err != nil {
+		return nil, err
+	}
+	agent.Approval = approval
+	return agent, nil
+}
+
 // Register Agent 注册（必须使用令牌）- 保留兼容旧版本
 func (s *AgentService) Register(req *models.AgentRegisterRequest, ip string) (*models.Agent, string, error) {
 	// 必须提供令牌
@@ -179,6 +357,11 @@ func (s *AgentService) Register(req *models.AgentRegisterRequest, ip string) (*m
 		return nil, "", &ServiceError{Message: "Agent 名称已存在"}
 	}
 
+	approval := constant.AgentApprovalApproved
+	if s.RequireApproval() {
+		approval = constant.AgentApprovalPending
+	}
+
 	// 创建新 Agent，使用令牌作为认证 Token
 	now := models.LocalTime(time.Now())
 	agent := &models.Agent{
@@ -192,6 +375,7 @@ func (s *AgentService) Register(req *models.AgentRegisterRequest, ip string) (*m
 		Status:    constant.AgentStatusOnline,
 		LastSeen:  &now,
 		Enabled:   utils.BoolPtr(true),
+		Approval:  approval,
 	}
 
 	if err := database.DB.Create(agent).Error; err != nil {
@@ -200,16 +384,20 @@ func (s *AgentService) Register(req *models.AgentRegisterRequest, ip string) (*m
 
 	s.UseToken(agentToken.ID)
 	logger.Infof("[Agent] Agent 注册成功: %s (%s)", req.Name, ip)
+	if approval == constant.AgentApprovalPending {
+		s.publishPending(agent)
+	}
 	return agent, req.Token, nil
 }
 
 // Update 更新 Agent
-func (s *AgentService) Update(id string, name, description string, enabled bool, schedulerConfig models.AgentSchedulerConfig) error {
+func (s *AgentService) Update(id string, name, description string, enabled bool, schedulerConfig models.AgentSchedulerConfig, labels models.AgentLabels) error {
 	return database.DB.Model(&models.Agent{}).Where("id = ?", id).Updates(map[string]interface{}{
 		"name":             name,
 		"description":      description,
 		"enabled":          &enabled,
 		"scheduler_config": schedulerConfig,
+		"labels":           labels,
 	}).Error
 }
 
@@ -314,8 +502,13 @@ func (s *AgentService) Heartbeat(token, ip, version, buildTime, hostname, osType
 	return agent, nil
 }
 
-// GetTasks 获取 Agent 的任务列表
+// GetTasks 获取 Agent 的任务列表，未通过注册审批的 Agent 返回空列表
 func (s *AgentService) GetTasks(agentID string) []models.AgentTask {
+	agent := s.GetByID(agentID)
+	if agent == nil || !agent.Approved() {
+		return []models.AgentTask{}
+	}
+
 	var tasksList []models.Task
 	database.DB.Where("agent_id = ? AND enabled = ?", agentID, true).Find(&tasksList)
 
@@ -333,10 +526,10 @@ func (s *AgentService) GetTasks(agentID string) []models.AgentTask {
 		}
 	}
 
-	result := make([]models.AgentTask, len(tasksList))
+	result := make([]models.AgentTask, 0, len(tasksList))
 	envService := NewEnvService()
 
-	for i, task := range tasksList {
+	for _, task := range tasksList {
 		// 加载环境配置
 		var envVars []string
 
@@ -359,21 +552,32 @@ func (s *AgentService) GetTasks(agentID string) []models.AgentTask {
 		}
 
 		envVarsStr := executor.FormatEnvVars(envVars)
+		// Agent 上报了公钥时变量与机密加密下发，明文只存在于 Agent 进程内
+		if agent.PublicKey != "" {
+			sealed, err := agentcrypto.EncryptValues(agent.PublicKey, append([]string{envVarsStr}, secrets...))
+			if err != nil {
+				logger.Errorf("[Agent] 加密任务 #%s 的变量失败，不下发该任务: %v", task.ID, err)
+				continue
+			}
+			envVarsStr, secrets = sealed[0], sealed[1:]
+		}
 
 		command := string(task.Command)
 		preCommand := string(task.PreCommand)
 		postCommand := string(task.PostCommand)
 		workDir := task.WorkDir
+		languages := []map[string]string(task.Languages)
 
 		// 仓库同步任务特殊处理：将配置转换为 reposync 命令行
 		if task.Type == constant.TaskTypeRepo {
 			command, workDir = tasks.BuildRepoCommand(&task)
+			languages = nil // 仓库同步不使用 mise
 			// 仓库任务的前置/后置命令已作为参数传给 reposync 内部处理，此处清空防止重复执行
 			preCommand = ""
 			postCommand = ""
 		}
 
-		result[i] = models.AgentTask{
+		result = append(result, models.AgentTask{
 			ID:          task.ID,
 			Name:        task.Name,
 			Command:     command,
@@ -383,11 +587,12 @@ func (s *AgentService) GetTasks(agentID string) []models.AgentTask {
 			Timeout:     task.Timeout,
 			WorkDir:     workDir,
 			Envs:        envVarsStr,
-			Languages:   []map[string]string(task.Languages),
+			Languages:   languages,
 			RandomRange: task.RandomRange,
 			Secrets:     secrets,
 			Enabled:     utils.DerefBool(task.Enabled, true),
-		}
+			SyncFiles:   task.SyncFileList(),
+		})
 	}
 
 	return result
@@ -530,21 +735,32 @@ func (s *AgentService) GetAvailablePlatforms() []map[string]string {
 func (s *AgentService) GetAgentBinary(osType, arch string) ([]byte, string, error) {
 	filename := fmt.Sprintf("baihu-agent-%s-%s.tar.gz", osType, arch)
 
-	// 优先从 /opt/agent 读取（容器内）
-	filePath := filepath.Join("/opt/agent", filename)
-	data, err := os.ReadFile(filePath)
+	data, err := os.ReadFile(agentPackagePath(filename))
 	if err != nil {
-		// 回退到 data/agent（本地开发）
-		filePath = filepath.Join("data/agent", filename)
-		data, err = os.ReadFile(filePath)
-		if err != nil {
-			return nil, "", &ServiceError{Message: "未找到对应平台的 Agent 程序"}
-		}
+		return nil, "", &ServiceError{Message: "未找到对应平台的 Agent 程序"}
 	}
 
 	return data, filename, nil
 }
 
+// GetAgentSignature 获取发布包旁 .sig 文件中的签名，未签名时返回空字符串
+func (s *AgentService) GetAgentSignature(filename string) string {
+	data, err := os.ReadFile(agentPackagePath(filename) + agentsign.SignatureSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// agentPackagePath 优先使用 /opt/agent（容器内），不存在时回退到 data/agent（本地开发）
+func agentPackagePath(filename string) string {
+	filePath := filepath.Join("/opt/agent", filename)
+	if _, err := os.Stat(filePath); err == nil {
+		return filePath
+	}
+	return filepath.Join("data/agent", filename)
+}
+
 // SetForceUpdate 设置强制更新标志
 func (s *AgentService) SetForceUpdate(id string) error {
 	return database.DB.Model(&models.Agent{}).Where("id = ?", id).Update("force_update", true).Error
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+func TestAgentRegisterApproval(t *testing.T) {
+	setupTestDB(t, &models.Agent{}, &models.AgentToken{}, &models.Task{})
+	database.DB.Create(&models.AgentToken{ID: "t1", Token: "token-approval-test"})
+	svc := NewAgentService()
+
+	// 未开启审批时直接通过
+	agent, _, err := svc.RegisterByToken(&models.AgentRegisterRequest{Token: "token-approval-test", MachineID: "machine-0000000001"}, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+	if !agent.Approved() {
+		t.Errorf("未开启审批时应直接通过: %q", agent.Approval)
+	}
+
+	NewSettingsService().Set(constant.SectionAgent, constant.KeyAgentRequireApproval, "true")
+	agent, isNew, err := svc.RegisterByToken(&models.AgentRegisterRequest{
+		Token: "token-approval-test", MachineID: "machine-0000000002", Hostname: "web-1", OS: "linux", Arch: "amd64",
+	}, "10.0.0.2")
+	if err != nil || !isNew {
+		t.Fatalf("注册失败: %v", err)
+	}
+	if agent.Approval != constant.AgentApprovalPending || agent.Hostname != "web-1" {
+		t.Fatalf("开启审批后新 Agent 应等待审批: %+v", agent)
+	}
+	if tasks := svc.GetTasks(agent.ID); len(tasks) != 0 {
+		t.Errorf("等待审批的 Agent 不应收到任务: %v", tasks)
+	}
+
+	if _, err := svc.Review(agent.ID, false); err != nil {
+		t.Fatalf("拒绝失败: %v", err)
+	}
+	// 已拒绝的机器换令牌重新注册仍保持拒绝
+	agent, _, _ = svc.RegisterByToken(&models.AgentRegisterRequest{Token: "token-approval-test", MachineID: "machine-0000000002"}, "10.0.0.2")
+	if agent.Approval != constant.AgentApprovalRejected {
+		t.Errorf("已拒绝的 Agent 不应重置为待审批: %q", agent.Approval)
+	}
+
+	if _, err := svc.Review(agent.ID, true); err != nil {
+		t.Fatalf("通过失败: %v", err)
+	}
+	if _, err := svc.Review(agent.ID, true); err == nil {
+		t.Error("重复审批应返回错误")
+	}
+	if got := svc.GetByID(agent.ID); !got.Approved() {
+		t.Errorf("审批通过后状态不正确: %q", got.Approval)
+	}
+}
+
+func TestAgentTasksEncryptedToPublicKey(t *testing.T) {
+	setupTestDB(t, &models.Agent{}, &models.Task{}, &models.EnvironmentVariable{}, &models.DataRelation{})
+	pub, priv, _ := agentcrypto.GenerateKey()
+	agentID := "a1"
+	database.DB.Create(&models.Agent{ID: agentID, Name: "a1", Token: "a1", MachineID: "m1"})
+	database.DB.Create(&models.EnvironmentVariable{ID: "e1", Name: "API_URL", Value: "https://example.com"})
+	t.Setenv("BAIHU_SECRET_KEY", "test-secret-key")
+	utils.InitSecretKey()
+	stored, _ := utils.Encrypt("s3cret")
+	database.DB.Create(&models.EnvironmentVariable{ID: "e2", Name: "API_TOKEN", Value: models.BigText(stored), Type: constant.EnvTypeSecret})
+	database.DB.Create(&models.Task{ID: "t1", Name: "t1", AgentID: &agentID, Config: `{"$task_all_envs":true}`})
+	svc := NewAgentService()
+
+	// 未上报公钥的旧版 Agent 按明文下发
+	tasks := svc.GetTasks("a1")
+	if len(tasks) != 1 || agentcrypto.IsEncrypted(tasks[0].Envs) || len(tasks[0].Secrets) != 1 || tasks[0].Secrets[0] != "s3cret" {
+		t.Fatalf("明文下发不正确: %+v", tasks)
+	}
+
+	agent := svc.GetByID("a1")
+	if svc.SetPublicKey(agent, "invalid", "") {
+		t.Error("无效公钥不应保存")
+	}
+	if !svc.SetPublicKey(agent, pub, "") || svc.SetPublicKey(agent, pub, "") {
+		t.Error("只有公钥变化时才返回 true")
+	}
+
+	tasks = svc.GetTasks("a1")
+	if !agentcrypto.IsEncrypted(tasks[0].Envs) || !agentcrypto.IsEncrypted(tasks[0].Secrets[0]) {
+		t.Fatalf("上报公钥后应加密下发: %+v", tasks[0])
+	}
+	envs, _ := agentcrypto.Decrypt(priv, tasks[0].Envs)
+	secret, _ := agentcrypto.Decrypt(priv, tasks[0].Secrets[0])
+	if secret != "s3cret" || !strings.Contains(envs, "API_TOKEN=s3cret") {
+		t.Errorf("解密结果不正确: envs=%q secret=%q", envs, secret)
+	}
+}
+
+func TestAgentPublicKeyPinned(t *testing.T) {
+	setupTestDB(t, &models.Agent{})
+	database.DB.Create(&models.Agent{ID: "a1", Name: "a1", Token: "a1", MachineID: "m1"})
+	svc := NewAgentService()
+	oldPub, oldPriv, _ := agentcrypto.GenerateKey()
+	newPub, _, _ := agentcrypto.GenerateKey()
+	otherPub, _, _ := agentcrypto.GenerateKey()
+
+	agent := svc.GetByID("a1")
+	if !svc.SetPublicKey(agent, oldPub, "") {
+		t.Fatal("首次上报的公钥应直接固定")
+	}
+
+	// 未经证明的新公钥不替换，只记为待批准
+	if svc.SetPublicKey(agent, newPub, "") || svc.SetPublicKey(agent, newPub, "forged") {
+		t.Error("未经旧私钥证明的公钥不应替换")
+	}
+	if got := svc.GetByID("a1"); got.PublicKey != oldPub || got.PendingKey != newPub {
+		t.Fatalf("公钥应保持不变并记录待批准: %+v", got)
+	}
+
+	// 用旧私钥解出挑战即可轮换
+	challenge, err := svc.BeginKeyRotation(agent)
+	if err != nil {
+		t.Fatalf("生成轮换挑战失败: %v", err)
+	}
+	nonce, _ := agentcrypto.Decrypt(oldPriv, challenge)
+	if !svc.SetPublicKey(agent, newPub, nonce) {
+		t.Fatal("附带挑战明文的新公钥应替换")
+	}
+	if got := svc.GetByID("a1"); got.PublicKey != newPub || got.PendingKey != "" || got.KeyChallenge != "" {
+		t.Errorf("轮换后状态不正确: %+v", got)
+	}
+	if svc.SetPublicKey(agent, otherPub, nonce) {
+		t.Error("挑战只能使用一次")
+	}
+
+	// 管理员批准待批准的公钥
+	if _, err := svc.ApprovePendingKey("a1"); err != nil {
+		t.Fatalf("批准失败: %v", err)
+	}
+	if got := svc.GetByID("a1"); got.PublicKey != otherPub || got.PendingKey != "" {
+		t.Errorf("批准后公钥不正确: %+v", got)
+	}
+	if _, err := svc.ApprovePendingKey("a1"); err == nil {
+		t.Error("没有待批准公钥时应返回错误")
+	}
+}
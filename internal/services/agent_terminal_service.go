@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// MaxTerminalsPerAgent 单个 Agent 同时打开的终端会话上限
+const MaxTerminalsPerAgent = 5
+
+// AgentTerminalMessage Agent 终端会话的消息，面板与 Agent 双向使用
+type AgentTerminalMessage struct {
+	SessionID string `json:"session_id"`
+	Data      string `json:"data,omitempty"`
+	Rows      uint16 `json:"rows,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AgentTerminal 面板侧的 Agent 终端会话，输出由 Agent 连接转发到 Output
+type AgentTerminal struct {
+	ID      string
+	AgentID string
+	Output  chan string
+	Done    chan struct{}
+	ExitErr string
+
+	once sync.Once
+}
+
+func (t *AgentTerminal) finish(errMsg string) {
+	t.once.Do(func() {
+		t.ExitErr = errMsg
+		close(t.Done)
+	})
+}
+
+var (
+	agentTerminals  = make(map[string]*AgentTerminal)
+	agentTerminalMu sync.Mutex
+)
+
+// OpenTerminal 在 Agent 上打开终端会话
+func (m *AgentWSManager) OpenTerminal(agentID string, rows, cols uint16) (*AgentTerminal, error) {
+	if err := m.requireCapability(agentID, constant.AgentCapTerminal); err != nil {
+		return nil, err
+	}
+
+	agentTerminalMu.Lock()
+	count := 0
+	for _, t := range agentTerminals {
+		if t.AgentID == agentID {
+			count++
+		}
+	}
+	if count >= MaxTerminalsPerAgent {
+		agentTerminalMu.Unlock()
+		return nil, fmt.Errorf("该 Agent 已打开 %d 个终端会话，请先关闭其他会话", count)
+	}
+	t := &AgentTerminal{
+		ID:      utils.GenerateID(),
+		AgentID: agentID,
+		Output:  make(chan string, 256),
+		Done:    make(chan struct{}),
+	}
+	agentTerminals[t.ID] = t
+	agentTerminalMu.Unlock()
+
+	m.SendToAgent(agentID, WSTypeTerminalOpen, AgentTerminalMessage{SessionID: t.ID, Rows: rows, Cols: cols})
+	return t, nil
+}
+
+// SendTerminalInput 转发终端输入
+func (m *AgentWSManager) SendTerminalInput(t *AgentTerminal, data string) {
+	m.SendToAgent(t.AgentID, WSTypeTerminalInput, AgentTerminalMessage{SessionID: t.ID, Data: data})
+}
+
+// ResizeTerminal 转发终端窗口大小
+func (m *AgentWSManager) ResizeTerminal(t *AgentTerminal, rows, cols uint16) {
+	m.SendToAgent(t.AgentID, WSTypeTerminalResize, AgentTerminalMessage{SessionID: t.ID, Rows: rows, Cols: cols})
+}
+
+// CloseTerminal 关闭终端会话并通知 Agent 结束进程
+func (m *AgentWSManager) CloseTerminal(t *AgentTerminal) {
+	agentTerminalMu.Lock()
+	delete(agentTerminals, t.ID)
+	agentTerminalMu.Unlock()
+	t.finish("")
+	m.SendToAgent(t.AgentID, WSTypeTerminalClose, AgentTerminalMessage{SessionID: t.ID})
+}
+
+// HandleTerminalMessage 处理 Agent 返回的终端输出与退出消息，只接受会话所属 Agent 的消息
+func (m *AgentWSManager) HandleTerminalMessage(agentID, msgType string, data json.RawMessage) {
+	var msg AgentTerminalMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	agentTerminalMu.Lock()
+	t, ok := agentTerminals[msg.SessionID]
+	agentTerminalMu.Unlock()
+	if !ok || t.AgentID != agentID {
+		return
+	}
+
+	switch msgType {
+	case WSTypeTerminalOutput:
+		select {
+		case t.Output <- msg.Data:
+		case <-t.Done:
+		}
+	case WSTypeTerminalExit:
+		t.finish(msg.Error)
+	}
+}
+
+// closeAgentTerminals Agent 断开时结束其所有终端会话
+func closeAgentTerminals(agentID string) {
+	agentTerminalMu.Lock()
+	defer agentTerminalMu.Unlock()
+	for id, t := range agentTerminals {
+		if t.AgentID == agentID {
+			t.finish("Agent 连接已断开")
+			delete(agentTerminals, id)
+		}
+	}
+}
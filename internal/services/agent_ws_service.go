@@ -2,9 +2,11 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentproto"
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/executor"
@@ -41,6 +43,12 @@ type AgentConnection struct {
 	LastPing time.Time
 	closed   bool
 	mu       sync.Mutex
+
+	load         models.AgentLoad // 最近一次心跳上报的调度器负载
+	loadReported bool
+	metrics      *models.AgentHostMetrics // 最近一次心跳上报的主机资源，旧版 Agent 不上报
+	pending      bool                     // 等待注册审批，审批通过前只处理心跳
+	peer         agentproto.Peer          // 握手协商结果，收到 hello 前按旧版 Agent 处理
 }
 
 // WSMessage WebSocket 消息结构
@@ -51,19 +59,40 @@ type WSMessage struct {
 
 // 消息类型常量
 const (
-	WSTypeHeartbeat     = constant.WSTypeHeartbeat
-	WSTypeHeartbeatAck  = constant.WSTypeHeartbeatAck
-	WSTypeTasks         = constant.WSTypeTasks
-	WSTypeTaskResult    = constant.WSTypeTaskResult
-	WSTypeUpdate        = constant.WSTypeUpdate
-	WSTypeDisconnect    = constant.WSTypeDisconnect
-	WSTypeConnected     = constant.WSTypeConnected
-	WSTypeDisabled      = constant.WSTypeDisabled
-	WSTypeEnabled       = constant.WSTypeEnabled
-	WSTypeFetchTasks    = constant.WSTypeFetchTasks
-	WSTypeTaskLog       = constant.WSTypeTaskLog
-	WSTypeExecute       = constant.WSTypeExecute
-	WSTypeTaskHeartbeat = constant.WSTypeTaskHeartbeat
+	WSTypeHeartbeat       = constant.WSTypeHeartbeat
+	WSTypeHeartbeatAck    = constant.WSTypeHeartbeatAck
+	WSTypeTasks           = constant.WSTypeTasks
+	WSTypeTaskResult      = constant.WSTypeTaskResult
+	WSTypeUpdate          = constant.WSTypeUpdate
+	WSTypeDisconnect      = constant.WSTypeDisconnect
+	WSTypeConnected       = constant.WSTypeConnected
+	WSTypeDisabled        = constant.WSTypeDisabled
+	WSTypeEnabled         = constant.WSTypeEnabled
+	WSTypeFetchTasks      = constant.WSTypeFetchTasks
+	WSTypeTaskLog         = constant.WSTypeTaskLog
+	WSTypeExecute         = constant.WSTypeExecute
+	WSTypeTaskHeartbeat   = constant.WSTypeTaskHeartbeat
+	WSTypeFileSync        = constant.WSTypeFileSync
+	WSTypeFileBundle      = constant.WSTypeFileBundle
+	WSTypeTerminalOpen    = constant.WSTypeTerminalOpen
+	WSTypeTerminalInput   = constant.WSTypeTerminalInput
+	WSTypeTerminalResize  = constant.WSTypeTerminalResize
+	WSTypeTerminalClose   = constant.WSTypeTerminalClose
+	WSTypeTerminalOutput  = constant.WSTypeTerminalOutput
+	WSTypeTerminalExit    = constant.WSTypeTerminalExit
+	WSTypeRuntimes        = constant.WSTypeRuntimes
+	WSTypeFetchRuntimes   = constant.WSTypeFetchRuntimes
+	WSTypeCommand         = constant.WSTypeCommand
+	WSTypeCommandOutput   = constant.WSTypeCommandOutput
+	WSTypeCommandResult   = constant.WSTypeCommandResult
+	WSTypeUpdateResult    = constant.WSTypeUpdateResult
+	WSTypeRotateKey       = constant.WSTypeRotateKey
+	WSTypeHello           = constant.WSTypeHello
+	WSTypeSDKRequest      = constant.WSTypeSDKRequest
+	WSTypeSDKResponse     = constant.WSTypeSDKResponse
+	WSTypeTaskResultAck   = constant.WSTypeTaskResultAck
+	WSTypeSDKGrantRequest = constant.WSTypeSDKGrantRequest
+	WSTypeSDKGrant        = constant.WSTypeSDKGrant
 )
 
 var agentWSManager *AgentWSManager
@@ -155,6 +184,7 @@ func (m *AgentWSManager) Register(agentID string, conn *websocket.Conn, ip strin
 			}
 		}
 		old.Close()
+		closeAgentTerminals(agentID)
 	}
 
 	ac := &AgentConnection{
@@ -163,6 +193,7 @@ func (m *AgentWSManager) Register(agentID string, conn *websocket.Conn, ip strin
 		Conn:     conn,
 		Send:     make(chan []byte, 256),
 		LastPing: time.Now(),
+		peer:     agentproto.Legacy(),
 	}
 	m.connections[agentID] = ac
 
@@ -188,6 +219,7 @@ func (m *AgentWSManager) Unregister(agentID string, ac *AgentConnection) {
 		}
 		conn.Close()
 		delete(m.connections, agentID)
+		closeAgentTerminals(agentID)
 		logger.Infof("[AgentWS] Agent #%s 已断开", agentID)
 	}
 }
@@ -207,6 +239,41 @@ func (m *AgentWSManager) IsAgentOnline(agentID string) bool {
 	return exists
 }
 
+// GetAgentLoad 获取 Agent 最近一次心跳上报的负载，未上报（旧版 Agent）时第二个返回值为 false
+func (m *AgentWSManager) GetAgentLoad(agentID string) (models.AgentLoad, bool) {
+	conn := m.GetConnection(agentID)
+	if conn == nil {
+		return models.AgentLoad{}, false
+	}
+	return conn.Load()
+}
+
+// GetAgentMetrics 获取在线 Agent 最近一次心跳上报的主机资源
+func (m *AgentWSManager) GetAgentMetrics(agentID string) *models.AgentHostMetrics {
+	conn := m.GetConnection(agentID)
+	if conn == nil {
+		return nil
+	}
+	return conn.Metrics()
+}
+
+// SupportsCapability 在线 Agent 是否在握手时声明了某项能力
+func (m *AgentWSManager) SupportsCapability(agentID, capability string) bool {
+	conn := m.GetConnection(agentID)
+	return conn != nil && conn.Peer().Supports(capability)
+}
+
+// requireCapability 检查 Agent 在线且支持某项功能，否则返回需要升级的提示
+func (m *AgentWSManager) requireCapability(agentID, capability string) error {
+	if !m.IsAgentOnline(agentID) {
+		return fmt.Errorf("Agent 不在线")
+	}
+	if !m.SupportsCapability(agentID, capability) {
+		return fmt.Errorf("Agent 版本过旧，不支持%s，请先升级 Agent", agentproto.Label(capability))
+	}
+	return nil
+}
+
 // SendToAgent 发送消息给指定 Agent
 func (m *AgentWSManager) SendToAgent(agentID string, msgType string, data interface{}) error {
 	conn := m.GetConnection(agentID)
@@ -226,8 +293,11 @@ func (m *AgentWSManager) SendToAgent(agentID string, msgType string, data interf
 	}
 }
 
-// BroadcastTasks 广播任务更新给指定 Agent
+// BroadcastTasks 广播任务更新给指定 Agent，等待审批的 Agent 不下发
 func (m *AgentWSManager) BroadcastTasks(agentID string) {
+	if conn := m.GetConnection(agentID); conn != nil && conn.Pending() {
+		return
+	}
 	agentService := NewAgentService()
 	tasks := agentService.GetTasks(agentID)
 	m.SendToAgent(agentID, WSTypeTasks, map[string]interface{}{
@@ -310,6 +380,7 @@ func (m *AgentWSManager) cleanupLoop() {
 			}
 			conn.Close()
 			delete(m.connections, agentID)
+			closeAgentTerminals(agentID)
 			// 更新数据库状态
 			database.DB.Model(&models.Agent{}).Where("id = ?", agentID).Update("status", constant.AgentStatusOffline)
 			logger.Infof("[AgentWS] Agent #%s 心跳超时，已断开", agentID)
@@ -404,6 +475,63 @@ func (c *AgentConnection) WritePing() error {
 	return c.Conn.WriteMessage(websocket.PingMessage, nil)
 }
 
+// SetLoad 记录心跳上报的负载
+func (c *AgentConnection) SetLoad(load models.AgentLoad) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load = load
+	c.loadReported = true
+}
+
+// Load 最近一次上报的负载
+func (c *AgentConnection) Load() (models.AgentLoad, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load, c.loadReported
+}
+
+// SetMetrics 记录心跳上报的主机资源
+func (c *AgentConnection) SetMetrics(metrics models.AgentHostMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = &metrics
+}
+
+// Metrics 最近一次上报的主机资源，未上报时返回 nil
+func (c *AgentConnection) Metrics() *models.AgentHostMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.metrics
+}
+
+// SetPeer 记录握手协商结果
+func (c *AgentConnection) SetPeer(peer agentproto.Peer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peer = peer
+}
+
+// Peer 握手协商结果
+func (c *AgentConnection) Peer() agentproto.Peer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer
+}
+
+// SetPending 设置连接是否等待注册审批
+func (c *AgentConnection) SetPending(pending bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = pending
+}
+
+// Pending 连接是否等待注册审批
+func (c *AgentConnection) Pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending
+}
+
 // UpdatePing 更新心跳时间
 func (c *AgentConnection) UpdatePing() {
 	c.LastPing = time.Now()
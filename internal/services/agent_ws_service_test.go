@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/agentproto"
+	"github.com/engigu/baihu-panel/internal/constant"
+)
+
+func TestAgentCapabilityGate(t *testing.T) {
+	m := &AgentWSManager{
+		connections:   make(map[string]*AgentConnection),
+		ipConnections: make(map[string]int),
+	}
+	if err := m.requireCapability("a1", constant.AgentCapTerminal); err == nil || !strings.Contains(err.Error(), "不在线") {
+		t.Errorf("离线 Agent 应提示不在线: %v", err)
+	}
+
+	// 未发送 hello 的旧版 Agent 只能使用基础功能
+	ac := m.Register("a1", nil, "10.0.0.1")
+	if err := m.requireCapability("a1", constant.AgentCapTerminal); err == nil || !strings.Contains(err.Error(), "升级") {
+		t.Errorf("旧版 Agent 应提示需要升级: %v", err)
+	}
+
+	ac.SetPeer(agentproto.Negotiate(agentproto.Hello{ProtocolVersion: 2, Capabilities: []string{constant.AgentCapMise}}))
+	if err := m.requireCapability("a1", constant.AgentCapMise); err != nil {
+		t.Errorf("已声明的能力应可用: %v", err)
+	}
+	if m.SupportsCapability("a1", constant.AgentCapTerminal) {
+		t.Error("未声明的能力不应可用")
+	}
+}
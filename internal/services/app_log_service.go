@@ -142,6 +142,10 @@ func (s *AppLogService) GetRetentionConfigs() map[string]LogRetentionConfig {
 			Days:     utils.ToInt(s.settingsService.Get(constant.SectionSystem, constant.KeyFilterLogDays), 15),
 			MaxCount: utils.ToInt(s.settingsService.Get(constant.SectionSystem, constant.KeyFilterLogMaxCount), 2000),
 		},
+		constant.LogCategoryAuditLog: {
+			Days:     180,
+			MaxCount: 10000,
+		},
 		constant.LogCategoryDefault: {
 			Days:     30,
 			MaxCount: 10000,
@@ -171,6 +175,7 @@ func (s *AppLogService) CleanUp() {
 		constant.LogCategoryLoginLog, 
 		constant.LogCategorySchedulerLog,
 		constant.LogCategoryFilterLog,
+		constant.LogCategoryAuditLog,
 	}
 
 	var totalDeleted int64
@@ -223,6 +228,8 @@ func (s *AppLogService) CleanUp() {
 				catLabel = "调度日志"
 			case constant.LogCategoryFilterLog:
 				catLabel = "过滤日志"
+			case constant.LogCategoryAuditLog:
+				catLabel = "审计日志"
 			default:
 				catLabel = cat
 			}
@@ -391,3 +398,15 @@ func (s *AppLogService) AddFilterLog(title, content, level string, filterID, fil
 		ErrorMsg: models.BigText(filterName), // 使用 ErrorMsg 借用存储过滤规则名称以备展示
 	})
 }
+
+// AddAuditLog 记录一条审计日志，refID 为操作对象的 ID
+func (s *AppLogService) AddAuditLog(title, content, refID string) error {
+	return s.Add(&models.AppLog{
+		Category: constant.LogCategoryAuditLog,
+		Title:    title,
+		Content:  models.BigText(content),
+		Level:    constant.LogLevelInfo,
+		Status:   constant.LogStatusRead,
+		RefID:    refID,
+	})
+}
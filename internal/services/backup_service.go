@@ -15,8 +15,12 @@ import (
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/logstore"
 	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
 	"github.com/engigu/baihu-panel/internal/systime"
+	"github.com/engigu/baihu-panel/internal/utils"
 	"github.com/rs/xid"
 	"gorm.io/gorm"
 )
@@ -35,8 +39,16 @@ const (
 	BackupSection = "backup"
 	BackupFileKey = "backup_file"
 	BackupDir     = "./data/backups"
+
+	// backupLogDir 备份包中任务日志内容的目录，每条日志一个 zstd 文件，有行元数据时另存一个 .meta 文件
+	backupLogDir = "task_logs/"
 )
 
+// BackupOptions 备份选项
+type BackupOptions struct {
+	IncludeLogs bool // 是否包含任务执行日志（记录及日志内容）
+}
+
 // tableConfig 表备份配置
 type tableConfig struct {
 	filename string
@@ -134,7 +146,7 @@ func (s *BackupService) restoreSettings(data []byte) error {
 }
 
 // CreateBackup 创建备份
-func (s *BackupService) CreateBackup() (string, error) {
+func (s *BackupService) CreateBackup(opts BackupOptions) (string, error) {
 	if err := os.MkdirAll(BackupDir, 0755); err != nil {
 		return "", err
 	}
@@ -153,6 +165,9 @@ func (s *BackupService) CreateBackup() (string, error) {
 
 	// 导出各表
 	for _, cfg := range s.getTableConfigs() {
+		if cfg.filename == "task_logs.json" && !opts.IncludeLogs {
+			continue
+		}
 		w, err := zipWriter.Create(cfg.filename)
 		if err != nil {
 			return "", err
@@ -162,10 +177,18 @@ func (s *BackupService) CreateBackup() (string, error) {
 		}
 	}
 
+	// 导出任务日志内容（日志内容不在 task_logs.json 中，无论存储在数据库还是外部存储都统一写入 zstd 文件）
+	if opts.IncludeLogs {
+		if err := s.exportLogContents(zipWriter); err != nil {
+			return "", err
+		}
+	}
+
 	// 写入元数据信息
 	sysInfo := map[string]interface{}{
-		"version": "v3",
-		"ts":      time.Now().Format("2006-01-02 15:04:05"),
+		"version":      "v3",
+		"ts":           time.Now().Format("2006-01-02 15:04:05"),
+		"include_logs": opts.IncludeLogs,
 	}
 	sysFile, err := zipWriter.Create("__sys__.json")
 	if err != nil {
@@ -188,6 +211,116 @@ func (s *BackupService) CreateBackup() (string, error) {
 	return zipPath, nil
 }
 
+// exportLogContents 将已结束任务日志的内容写入备份包
+func (s *BackupService) exportLogContents(zipWriter *zip.Writer) error {
+	var logs []models.TaskLog
+	return database.DB.Where("status != ?", constant.TaskStatusRunning).
+		FindInBatches(&logs, 200, func(tx *gorm.DB, batch int) error {
+			for i := range logs {
+				// 行元数据不参与 JSON 序列化，单独写入备份包
+				if logs[i].LineMeta != "" {
+					w, err := zipWriter.Create(backupLogDir + logs[i].ID + ".meta")
+					if err != nil {
+						return err
+					}
+					if _, err := io.WriteString(w, string(logs[i].LineMeta)); err != nil {
+						return err
+					}
+				}
+
+				data, err := tasks.LoadTaskLogZstd(&logs[i])
+				if err != nil {
+					logger.Warnf("[Backup] 读取日志 #%s 内容失败，已跳过: %v", logs[i].ID, err)
+					continue
+				}
+				if len(data) == 0 {
+					continue
+				}
+				w, err := zipWriter.Create(backupLogDir + logs[i].ID + ".zst")
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write(data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// restoreLogContents 将备份包中的日志内容写回当前存储后端（外部存储或数据库），返回本次写入的对象
+func (s *BackupService) restoreLogContents(tx *gorm.DB, r *zip.ReadCloser) (map[string]bool, error) {
+	written := make(map[string]bool)
+	store := logstore.Current()
+
+	// 备份中的存储字段指向原面板的外部存储，统一清空后以备份包中的日志内容为准
+	if err := tx.Model(&models.TaskLog{}).Where("storage != ''").
+		Updates(map[string]interface{}{"storage": "", "storage_key": ""}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, f := range r.File {
+		if strings.HasPrefix(f.Name, backupLogDir) && strings.HasSuffix(f.Name, ".meta") {
+			if err := restoreLogLineMeta(tx, f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !strings.HasPrefix(f.Name, backupLogDir) || !strings.HasSuffix(f.Name, ".zst") {
+			continue
+		}
+		logID := strings.TrimSuffix(strings.TrimPrefix(f.Name, backupLogDir), ".zst")
+
+		var taskLog models.TaskLog
+		res := tx.Select("id, created_at").Where("id = ?", logID).Limit(1).Find(&taskLog)
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		updates := map[string]interface{}{"output": "", "storage": "", "storage_key": ""}
+		if store != nil {
+			key := logstore.KeyFor(logID, taskLog.CreatedAt.Time())
+			if err := store.Put(key, data); err != nil {
+				return nil, fmt.Errorf("写入日志 #%s 内容失败: %v", logID, err)
+			}
+			written[store.Name()+":"+key] = true
+			updates["storage"] = store.Name()
+			updates["storage_key"] = key
+		} else {
+			updates["output"] = utils.ZstdToBase64(data)
+		}
+		if err := tx.Model(&models.TaskLog{}).Where("id = ?", logID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// restoreLogLineMeta 将备份包中的行元数据写回对应的日志记录
+func restoreLogLineMeta(tx *gorm.DB, f *zip.File) error {
+	logID := strings.TrimSuffix(strings.TrimPrefix(f.Name, backupLogDir), ".meta")
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.TaskLog{}).Where("id = ?", logID).Update("line_meta", string(data)).Error
+}
+
 // Restore 恢复备份
 func (s *BackupService) Restore(zipPath string) error {
 	r, err := zip.OpenReader(zipPath)
@@ -221,12 +354,18 @@ func (s *BackupService) Restore(zipPath string) error {
 		// 	return fmt.Errorf("非法备份包：缺失版本标记")
 	}
 
+	// 记录恢复前外部存储中的日志对象，恢复成功后清理
+	var oldLogs []models.TaskLog
+	database.DB.Select("id, storage, storage_key").Where("storage != ''").Find(&oldLogs)
+	var written map[string]bool
+
 	// 开启全局事务
 	err = database.DB.Transaction(func(tx *gorm.DB) error {
 		// 1. 清空现有数据（物理删除）
 		tx.Where("1=1").Delete(&models.User{})
 		tx.Where("1=1").Delete(&models.Task{})
 		tx.Where("1=1").Delete(&models.TaskLog{})
+		tx.Where("1=1").Delete(&models.TaskLogIndex{})
 		tx.Where("1=1").Delete(&models.EnvironmentVariable{})
 		tx.Where("1=1").Delete(&models.Script{})
 		tx.Where("section != ?", BackupSection).Delete(&models.Setting{})
@@ -251,13 +390,28 @@ func (s *BackupService) Restore(zipPath string) error {
 			}
 		}
 
-		// 3. 恢复 scripts 文件夹
+		// 3. 恢复任务日志内容
+		var err error
+		if written, err = s.restoreLogContents(tx, r); err != nil {
+			return err
+		}
+
+		// 4. 恢复 scripts 文件夹
 		s.restoreScriptsDir(r)
 
 		return nil
 	})
 
 	if err == nil {
+		tasks.RemoveLogChunks()
+		for i := range oldLogs {
+			if !written[oldLogs[i].Storage+":"+oldLogs[i].StorageKey] {
+				if store, err := logstore.Open(oldLogs[i].Storage); err == nil {
+					_ = store.Delete(oldLogs[i].StorageKey)
+				}
+			}
+		}
+
 		// 备份恢复成功后，需要同时刷新内存中的配置缓存以免数据不一致导致异常
 		constant.Secret = s.settingsService.Get(constant.SectionSecurity, constant.KeySecret)
 		cache.LoadSiteCache()
@@ -2,10 +2,12 @@ package services
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/logstore"
 	"github.com/engigu/baihu-panel/internal/utils"
 
 	"gopkg.in/ini.v1"
@@ -36,10 +38,32 @@ type SecurityConfig struct {
 	Secret string `ini:"secret"`
 }
 
+// LogStorageConfig 任务日志存储配置
+type LogStorageConfig struct {
+	Type        string `ini:"type"` // db, fs, s3
+	Path        string `ini:"path"`
+	S3Endpoint  string `ini:"s3_endpoint"`
+	S3Region    string `ini:"s3_region"`
+	S3Bucket    string `ini:"s3_bucket"`
+	S3AccessKey string `ini:"s3_access_key"`
+	S3SecretKey string `ini:"s3_secret_key"`
+	S3Prefix    string `ini:"s3_prefix"`
+	S3UseSSL    bool   `ini:"s3_use_ssl"`
+	S3PathStyle bool   `ini:"s3_path_style"`
+}
+
+// MetricsConfig Prometheus 指标接口配置
+type MetricsConfig struct {
+	Enabled bool   `ini:"enabled"`
+	Token   string `ini:"token"` // 抓取时通过 Authorization: Bearer <token> 或 ?token= 传入
+}
+
 type AppConfig struct {
-	Server   ServerConfig   `ini:"server"`
-	Database DatabaseConfig `ini:"database"`
-	Security SecurityConfig `ini:"security"`
+	Server     ServerConfig     `ini:"server"`
+	Database   DatabaseConfig   `ini:"database"`
+	Security   SecurityConfig   `ini:"security"`
+	LogStorage LogStorageConfig `ini:"log_storage"`
+	Metrics    MetricsConfig    `ini:"metrics"`
 }
 
 var Config *AppConfig
@@ -103,6 +127,10 @@ func LoadConfig(path string) (*AppConfig, error) {
 		Security: SecurityConfig{
 			Secret: "",
 		},
+		LogStorage: LogStorageConfig{
+			Type:     "db",
+			S3UseSSL: true,
+		},
 	}
 
 	// 检查配置文件是否存在
@@ -126,6 +154,10 @@ func LoadConfig(path string) (*AppConfig, error) {
 	if Config.Database.Path == "" {
 		Config.Database.Path = constant.DefaultDBPath
 	}
+	// 设置默认日志存储目录
+	if Config.LogStorage.Path == "" {
+		Config.LogStorage.Path = filepath.Join(constant.DataDir, "logs")
+	}
 
 	// 设置配置到 constant 包
 	if Config.Server.CookieName != "" {
@@ -163,6 +195,14 @@ func LoadConfig(path string) (*AppConfig, error) {
 	maskedDBName := utils.MaskString(Config.Database.DBName)
 	logger.Infof("[Config] 数据库: type=%s, host=%s, port=%d, dbname=%s, dsn=%v",
 		Config.Database.Type, maskedHost, Config.Database.Port, maskedDBName, Config.Database.DSN != "")
+	logger.Infof("[Config] 日志存储: type=%s", Config.LogStorage.Type)
+	if Config.Metrics.Enabled {
+		if Config.Metrics.Token == "" {
+			logger.Warn("[Config] 指标接口已启用但未配置 token，/metrics 将拒绝所有请求")
+		} else {
+			logger.Info("[Config] 指标接口已启用: /metrics")
+		}
+	}
 
 	return Config, nil
 }
@@ -191,8 +231,40 @@ func applyEnvOverrides() {
 	// Security
 	getEnvStr("BH_SECRET", &Config.Security.Secret)
 
+	// Log Storage
+	getEnvStr("BH_LOG_STORAGE_TYPE", &Config.LogStorage.Type)
+	getEnvStr("BH_LOG_STORAGE_PATH", &Config.LogStorage.Path)
+	getEnvStr("BH_LOG_STORAGE_S3_ENDPOINT", &Config.LogStorage.S3Endpoint)
+	getEnvStr("BH_LOG_STORAGE_S3_REGION", &Config.LogStorage.S3Region)
+	getEnvStr("BH_LOG_STORAGE_S3_BUCKET", &Config.LogStorage.S3Bucket)
+	getEnvStr("BH_LOG_STORAGE_S3_ACCESS_KEY", &Config.LogStorage.S3AccessKey)
+	getEnvStr("BH_LOG_STORAGE_S3_SECRET_KEY", &Config.LogStorage.S3SecretKey)
+	getEnvStr("BH_LOG_STORAGE_S3_PREFIX", &Config.LogStorage.S3Prefix)
+	getEnvBool("BH_LOG_STORAGE_S3_USE_SSL", &Config.LogStorage.S3UseSSL)
+	getEnvBool("BH_LOG_STORAGE_S3_PATH_STYLE", &Config.LogStorage.S3PathStyle)
+
+	// Metrics
+	getEnvBool("BH_METRICS_ENABLED", &Config.Metrics.Enabled)
+	getEnvStr("BH_METRICS_TOKEN", &Config.Metrics.Token)
+
 }
 
 func GetConfig() *AppConfig {
 	return Config
 }
+
+// LogStoreConfig 将日志存储配置转换为 logstore 包使用的配置
+func (c LogStorageConfig) LogStoreConfig() logstore.Config {
+	return logstore.Config{
+		Type:        c.Type,
+		Path:        c.Path,
+		S3Endpoint:  c.S3Endpoint,
+		S3Region:    c.S3Region,
+		S3Bucket:    c.S3Bucket,
+		S3AccessKey: c.S3AccessKey,
+		S3SecretKey: c.S3SecretKey,
+		S3Prefix:    c.S3Prefix,
+		S3UseSSL:    c.S3UseSSL,
+		S3PathStyle: c.S3PathStyle,
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/models"
@@ -15,10 +17,13 @@ func NewDependencyService() *DependencyService {
 	return &DependencyService{}
 }
 
-// List 获取依赖列表
-func (s *DependencyService) List(language, langVersion string) ([]models.Dependency, error) {
+// agentDepTimeout Agent 上安装或卸载依赖的超时时间
+const agentDepTimeout = 30 * time.Minute
+
+// List 获取依赖列表，agentID 为空时返回面板本机的依赖
+func (s *DependencyService) List(language, langVersion, agentID string) ([]models.Dependency, error) {
 	var results []models.Dependency
-	query := database.DB
+	query := database.DB.Where("agent_id = ?", agentID)
 	if language != "" {
 		query = query.Where("language = ?", language)
 	}
@@ -33,7 +38,7 @@ func (s *DependencyService) List(language, langVersion string) ([]models.Depende
 func (s *DependencyService) Create(dep *models.Dependency) error {
 	// 检查是否已存在（名称、版本、语言及版本必须完全匹配）
 	var existing models.Dependency
-	res := database.DB.Where("name = ? AND version = ? AND language = ? AND lang_version = ?", dep.Name, dep.Version, dep.Language, dep.LangVersion).Limit(1).Find(&existing)
+	res := database.DB.Where("name = ? AND version = ? AND language = ? AND lang_version = ? AND agent_id = ?", dep.Name, dep.Version, dep.Language, dep.LangVersion, dep.AgentID).Limit(1).Find(&existing)
 	if res.Error == nil && res.RowsAffected > 0 {
 		// 如果已存在，更新 ID 并执行更新
 		dep.ID = existing.ID
@@ -47,29 +52,70 @@ func (s *DependencyService) Create(dep *models.Dependency) error {
 	return database.DB.Create(dep).Error
 }
 
+// GetByID 获取依赖记录
+func (s *DependencyService) GetByID(id string) *models.Dependency {
+	var dep models.Dependency
+	if res := database.DB.Where("id = ?", id).Limit(1).Find(&dep); res.Error != nil || res.RowsAffected == 0 {
+		return nil
+	}
+	return &dep
+}
+
 // Delete 删除依赖记录
 func (s *DependencyService) Delete(id string) error {
 	return database.DB.Where("id = ?", id).Delete(&models.Dependency{}).Error
 }
 
-// Install 安装依赖
+// Install 安装依赖，指定了 Agent 时在 Agent 上安装
 func (s *DependencyService) Install(dep *models.Dependency) error {
 	m := deps.GetManager(dep.Language)
 	if m == nil {
 		return errors.New("不支持的依赖类型: " + dep.Language)
 	}
+	if dep.AgentID != "" {
+		cmd, err := m.GetInstallCommand(dep)
+		if err != nil {
+			return err
+		}
+		return s.runOnAgent(dep, cmd, "安装失败")
+	}
 	return m.Install(dep)
 }
 
-// Uninstall 卸载依赖
+// Uninstall 卸载依赖，指定了 Agent 时在 Agent 上卸载
 func (s *DependencyService) Uninstall(dep *models.Dependency) error {
 	m := deps.GetManager(dep.Language)
 	if m == nil {
 		return errors.New("不支持的依赖类型: " + dep.Language)
 	}
+	if dep.AgentID != "" {
+		cmd, err := m.GetUninstallCommand(dep)
+		if err != nil {
+			return err
+		}
+		return s.runOnAgent(dep, cmd, "卸载失败")
+	}
 	return m.Uninstall(dep)
 }
 
+// runOnAgent 在依赖所属的 Agent 上执行命令，输出实时推送给前端并记录到依赖日志
+// 完成后 Agent 会重新上报运行时
+func (s *DependencyService) runOnAgent(dep *models.Dependency, cmd, failMsg string) error {
+	result, err := GetAgentWSManager().RunCommand(dep.AgentID, cmd, agentDepTimeout)
+	if err != nil {
+		dep.Log = models.BigText(err.Error())
+		return errors.New(failMsg + ": " + err.Error())
+	}
+	dep.Log = models.BigText(result.Output)
+	if result.Error != "" {
+		return errors.New(failMsg + ": " + result.Error)
+	}
+	if result.ExitCode != 0 || !strings.Contains(result.Output, deps.MarkerSuccess) {
+		return errors.New(failMsg + ": " + result.Output)
+	}
+	return nil
+}
+
 // GetInstalledPackages 获取已安装的包列表
 func (s *DependencyService) GetInstalledPackages(language, langVersion string) ([]models.Dependency, error) {
 	m := deps.GetManager(language)
@@ -95,7 +141,7 @@ func (s *DependencyService) GetReinstallAllCommand(language, langVersion string)
 		return "", errors.New("不支持的依赖类型: " + language)
 	}
 
-	deps_list, err := s.List(language, langVersion)
+	deps_list, err := s.List(language, langVersion, "")
 	if err != nil {
 		return "", err
 	}
@@ -19,8 +19,15 @@ type Manager interface {
 	GetBatchInstallCommand(deps []models.Dependency) (string, error)
 	GetReinstallAllCommand(deps []models.Dependency) (string, error)
 	GetVerifyCommand(langVersion string) (string, error)
+	GetUninstallCommand(dep *models.Dependency) (string, error)
 }
 
+// 安装/卸载命令末尾输出的结果标记，用于在终端或 Agent 输出中判断是否成功
+const (
+	MarkerSuccess = "__INSTALL_SUCCESS__"
+	MarkerFailed  = "__INSTALL_FAILED__"
+)
+
 // BaseManager 基础管理器，提供通用方法
 type BaseManager struct {
 	Language     string
@@ -137,6 +144,14 @@ func (m *BaseManager) GetVerifyCommand(langVersion string) (string, error) {
 	return utils.BuildMiseCommandSimple(cmd, m.Language, langVersion), nil
 }
 
+func (m *BaseManager) GetUninstallCommand(dep *models.Dependency) (string, error) {
+	args := append([]string{}, m.UninstallCmd...)
+	args = append(args, dep.Name)
+
+	fullCmd := utils.BuildMiseCommandSimple(strings.Join(args, " "), m.Language, dep.LangVersion)
+	return fullCmd + " && echo \"" + MarkerSuccess + "\" || echo \"" + MarkerFailed + "\"", nil
+}
+
 func (m *BaseManager) Uninstall(dep *models.Dependency) error {
 	args := append([]string{}, m.UninstallCmd...)
 	args = append(args, dep.Name)
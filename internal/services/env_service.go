@@ -5,6 +5,7 @@ import (
 
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/services/relation"
 	"github.com/engigu/baihu-panel/internal/utils"
@@ -38,6 +39,7 @@ func (es *EnvService) CreateEnvVar(name, value, remark, envType string, hidden,
 		UpdatedAt: models.Now(),
 	}
 	database.DB.Select("*").Create(env)
+	publishDataChanged()
 	return env
 }
 
@@ -48,6 +50,21 @@ func (es *EnvService) GetEnvVarsByUserID(userID string) []models.EnvironmentVari
 	return envs
 }
 
+// GetEnvVarsInScope 获取指定范围的环境变量，all 为 true 时返回全部
+func (es *EnvService) GetEnvVarsInScope(all bool, ids []string) []models.EnvironmentVariable {
+	var envs []models.EnvironmentVariable
+	if !all && len(ids) == 0 {
+		return envs
+	}
+	query := database.DB
+	if !all {
+		query = query.Where("id IN ?", ids)
+	}
+	query.Find(&envs)
+	es.LoadEnvTags(envs)
+	return envs
+}
+
 // GetFormattedEnvVarsByUserID 获取用户环境变量并格式化为 NAME=VALUE 格式（支持重名合并）
 func (es *EnvService) GetFormattedEnvVarsByUserID(userID string) []string {
 	envs := es.GetEnvVarsByUserID(userID)
@@ -134,6 +151,7 @@ func (es *EnvService) UpdateEnvVar(id string, name, value, remark, envType strin
 		"enabled": &enabled,
 	}
 	database.DB.Model(&env).Updates(updates)
+	publishDataChanged()
 	return &env
 }
 
@@ -168,6 +186,7 @@ func (es *EnvService) DeleteEnvVar(id string, force bool) (bool, []models.Task)
 		})
 		if err == nil {
 			relation.DataRelation.CleanRelations(id, constant.RelationTypeEnvTag)
+			publishDataChanged()
 			return true, nil
 		}
 		return false, nil
@@ -176,6 +195,7 @@ func (es *EnvService) DeleteEnvVar(id string, force bool) (bool, []models.Task)
 	result := database.DB.Where("id = ?", id).Delete(&models.EnvironmentVariable{})
 	if result.RowsAffected > 0 {
 		relation.DataRelation.CleanRelations(id, constant.RelationTypeEnvTag)
+		publishDataChanged()
 		return true, nil
 	}
 	return false, nil
@@ -343,6 +363,7 @@ func splitEnvIDs(envIDs string) []string {
 // SaveEnvTags 保存环境变量标签
 func (es *EnvService) SaveEnvTags(envID string, tagsStr string) {
 	database.DB.Where("data_id = ? AND type = ?", envID, constant.RelationTypeEnvTag).Delete(&models.DataRelation{})
+	defer publishDataChanged()
 	if tagsStr == "" {
 		return
 	}
@@ -407,3 +428,7 @@ func (es *EnvService) CleanEnvTags(id string) {
 	database.DB.Where("data_id = ? AND type = ?", id, constant.RelationTypeEnvTag).Delete(&models.DataRelation{})
 }
 
+// publishDataChanged 通知环境变量已变更，托管同步据此推送到子节点
+func publishDataChanged() {
+	eventbus.DefaultBus.Publish(eventbus.Event{Type: constant.EventDataChanged})
+}
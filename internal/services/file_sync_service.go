@@ -0,0 +1,212 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// 单个任务可同步的文件上限
+const (
+	MaxSyncFiles = 2000
+	MaxSyncBytes = 64 << 20
+)
+
+// fileHashEntry 文件哈希缓存项，大小与修改时间不变时复用
+type fileHashEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+var (
+	fileHashMu    sync.Mutex
+	fileHashCache = make(map[string]fileHashEntry)
+)
+
+// FileSyncService 向 Agent 同步任务所需的脚本文件
+type FileSyncService struct {
+	baseDir string
+}
+
+func NewFileSyncService() *FileSyncService {
+	return &FileSyncService{baseDir: constant.ScriptsWorkDir}
+}
+
+// NormalizeSyncPaths 校验同步路径，统一为相对脚本目录、以 / 分隔的形式
+func NormalizeSyncPaths(paths []string) ([]string, error) {
+	var result []string
+	for _, p := range paths {
+		p = strings.TrimPrefix(strings.TrimSpace(p), constant.ScriptsDirPlaceholder)
+		clean := filepath.ToSlash(filepath.Clean(strings.TrimLeft(filepath.ToSlash(p), "/")))
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("同步路径必须位于脚本目录内: %s", p)
+		}
+		if !slices.Contains(result, clean) {
+			result = append(result, clean)
+		}
+	}
+	return result, nil
+}
+
+// Manifest 生成路径列表对应的文件清单，目录会递归展开，按路径排序
+func (s *FileSyncService) Manifest(paths []string) ([]models.AgentFile, error) {
+	paths, err := NormalizeSyncPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var files []models.AgentFile
+	var total int64
+	for _, rel := range paths {
+		root := filepath.Join(s.baseDir, filepath.FromSlash(rel))
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 只同步普通文件，不跟随符号链接
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			relPath, err := filepath.Rel(s.baseDir, path)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if seen[relPath] {
+				return nil
+			}
+			seen[relPath] = true
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+			if len(files) >= MaxSyncFiles || total > MaxSyncBytes {
+				return fmt.Errorf("同步文件超过上限 (%d 个文件或 %d MB)", MaxSyncFiles, MaxSyncBytes>>20)
+			}
+			hash, err := hashFile(path, info)
+			if err != nil {
+				return err
+			}
+			files = append(files, models.AgentFile{Path: relPath, Hash: hash, Size: info.Size(), Mode: uint32(info.Mode().Perm())})
+			return nil
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("同步路径不存在: %s", rel)
+			}
+			return nil, err
+		}
+	}
+	slices.SortFunc(files, func(a, b models.AgentFile) int { return strings.Compare(a.Path, b.Path) })
+	return files, nil
+}
+
+// hashFile 计算文件内容的 SHA-256
+func hashFile(path string, info fs.FileInfo) (string, error) {
+	fileHashMu.Lock()
+	entry, ok := fileHashCache[path]
+	fileHashMu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.hash, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	fileHashMu.Lock()
+	fileHashCache[path] = fileHashEntry{size: info.Size(), modTime: info.ModTime(), hash: hash}
+	fileHashMu.Unlock()
+	return hash, nil
+}
+
+// Bundle 生成任务的文件同步响应，have 为 Agent 本地已缓存的内容哈希
+// 只有任务可能在该 Agent 上执行时才允许同步，避免 Agent 借此读取其他任务的脚本
+func (s *FileSyncService) Bundle(agent *models.Agent, taskID string, have []string) *models.AgentFileBundle {
+	bundle := &models.AgentFileBundle{TaskID: taskID}
+
+	task := tasks.NewTaskService().GetTaskByID(taskID)
+	if task == nil {
+		bundle.Error = "任务不存在"
+		return bundle
+	}
+	if !taskRunsOnAgent(task, agent) {
+		bundle.Error = "任务未分配给该 Agent"
+		return bundle
+	}
+
+	files, err := s.Manifest(task.SyncFileList())
+	if err != nil {
+		bundle.Error = err.Error()
+		return bundle
+	}
+	bundle.Files = files
+
+	cached := make(map[string]bool, len(have))
+	for _, h := range have {
+		cached[h] = true
+	}
+	bundle.Blobs = make(map[string][]byte)
+	for _, f := range files {
+		if cached[f.Hash] || bundle.Blobs[f.Hash] != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.baseDir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			bundle.Error = err.Error()
+			bundle.Blobs = nil
+			return bundle
+		}
+		bundle.Blobs[f.Hash] = utils.CompressZstd(string(data))
+	}
+	return bundle
+}
+
+// taskRunsOnAgent 任务是否可能在该 Agent 上执行：指定给该 Agent、选择器匹配，或正有派发到该 Agent 的运行（如广播运行）
+func taskRunsOnAgent(task *models.Task, agent *models.Agent) bool {
+	if task.AgentID != nil && *task.AgentID != "" && *task.AgentID == agent.ID {
+		return true
+	}
+	if task.UsesAgentSelector() {
+		if selector, err := tasks.ParseAgentSelector(task.AgentSelector); err == nil && selector.Matches(agent.Labels) {
+			return true
+		}
+	}
+	var active int64
+	database.DB.Model(&models.TaskLog{}).
+		Where("task_id = ? AND agent_id = ? AND status IN ?", task.ID, agent.ID,
+			[]string{constant.TaskStatusRunning, constant.TaskStatusQueued}).
+		Count(&active)
+	return active > 0
+}
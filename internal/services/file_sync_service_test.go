@@ -0,0 +1,59 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeSyncPaths(t *testing.T) {
+	got, err := NormalizeSyncPaths([]string{"lib/", "$SCRIPTS_DIR$/main.py", "./lib", "/abs/x.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"lib", "main.py", "abs/x.sh"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	for _, p := range []string{"..", "../etc/passwd", "lib/../../x", "."} {
+		if _, err := NormalizeSyncPaths([]string{p}); err == nil {
+			t.Errorf("NormalizeSyncPaths(%q) expected error", p)
+		}
+	}
+}
+
+func TestFileSyncManifest(t *testing.T) {
+	base := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(base, path)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		os.WriteFile(full, []byte(content), 0644)
+	}
+	write("job/run.sh", "echo hi")
+	write("job/lib/util.sh", "echo hi")
+	write("job/.git/HEAD", "ref")
+	write("other.py", "print(1)")
+
+	s := &FileSyncService{baseDir: base}
+	files, err := s.Manifest([]string{"job", "job/run.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "job/lib/util.sh" || files[1].Path != "job/run.sh" {
+		t.Fatalf("manifest = %+v", files)
+	}
+	// 相同内容的哈希一致，便于 Agent 按内容复用缓存
+	if files[0].Hash != files[1].Hash || len(files[0].Hash) != 64 {
+		t.Errorf("hashes = %s, %s", files[0].Hash, files[1].Hash)
+	}
+
+	if _, err := s.Manifest([]string{"missing"}); err == nil {
+		t.Error("expected error for missing path")
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+	"github.com/engigu/baihu-panel/internal/timeseries"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// 主机历史指标名称
+const (
+	HostMetricCPUPercent   = "cpu_percent"   // CPU 使用率（%）
+	HostMetricLoad1        = "load1"         // 1 分钟平均负载
+	HostMetricMemPercent   = "mem_percent"   // 内存使用率（%）
+	HostMetricMemUsed      = "mem_used"      // 已用内存（字节）
+	HostMetricDiskPercent  = "disk_percent"  // 根分区使用率（%）
+	HostMetricDiskUsed     = "disk_used"     // 根分区已用（字节）
+	HostMetricNetRx        = "net_rx_bps"    // 网络接收速率（字节/秒）
+	HostMetricNetTx        = "net_tx_bps"    // 网络发送速率（字节/秒）
+	HostMetricQueueDepth   = "queue_depth"   // 调度队列等待数
+	HostMetricRunningTasks = "running_tasks" // 正在运行的任务数
+	HostMetricBusyWorkers  = "busy_workers"  // 忙碌的调度 Worker 数
+)
+
+var hostMetricNames = []string{
+	HostMetricCPUPercent, HostMetricLoad1, HostMetricMemPercent, HostMetricMemUsed,
+	HostMetricDiskPercent, HostMetricDiskUsed, HostMetricNetRx, HostMetricNetTx,
+	HostMetricQueueDepth, HostMetricRunningTasks, HostMetricBusyWorkers,
+}
+
+// hostHistoryTiers 1 分钟分辨率保留 24 小时，1 小时分辨率保留 30 天
+var hostHistoryTiers = []timeseries.Tier{
+	{Resolution: time.Minute, Capacity: 24 * 60},
+	{Resolution: time.Hour, Capacity: 30 * 24},
+}
+
+const (
+	// hostHistorySampleSpec 主机指标采样间隔
+	hostHistorySampleSpec = "@every 10s"
+	// maxHostHistoryMarkers 单次查询最多返回的任务运行标记数
+	maxHostHistoryMarkers = 500
+)
+
+// HostHistorySeries 单个指标的时间序列，与 HostHistory.Timestamps 一一对应
+type HostHistorySeries struct {
+	Avg []float64 `json:"avg"`
+	Max []float64 `json:"max"`
+}
+
+// HostHistory 主机历史指标查询结果
+type HostHistory struct {
+	Resolution int                          `json:"resolution"` // 分辨率（秒）
+	From       int64                        `json:"from"`
+	To         int64                        `json:"to"`
+	Timestamps []int64                      `json:"timestamps"` // 各点的时间桶起点（Unix 秒）
+	Series     map[string]HostHistorySeries `json:"series"`
+}
+
+// TaskRunMarker 叠加在历史图表上的任务运行区间
+type TaskRunMarker struct {
+	LogID    string  `json:"log_id"`
+	TaskID   string  `json:"task_id"`
+	TaskName string  `json:"task_name"`
+	AgentID  *string `json:"agent_id"`
+	Status   string  `json:"status"`
+	Start    int64   `json:"start"` // Unix 秒
+	End      int64   `json:"end"`   // Unix 秒，运行中为 0
+	Duration int64   `json:"duration"`
+	CPU      int64   `json:"cpu"`     // 用户态+内核态 CPU 时间（毫秒）
+	MaxRSS   int64   `json:"max_rss"` // 进程树中单个进程的峰值内存（字节）
+}
+
+// HostHistoryService 主机历史指标服务
+// 定时采样主机与调度器指标，写入固定容量的降采样时序存储；完成聚合的点按槽位覆盖写入数据库，重启后恢复
+type HostHistoryService struct {
+	executorService *tasks.ExecutorService
+	store           *timeseries.Store
+
+	mu        sync.Mutex
+	lastNetAt time.Time
+	lastRx    uint64
+	lastTx    uint64
+}
+
+// NewHostHistoryService 创建主机历史指标服务
+func NewHostHistoryService(executorService *tasks.ExecutorService) *HostHistoryService {
+	return &HostHistoryService{
+		executorService: executorService,
+		store:           timeseries.NewStore(hostMetricNames, hostHistoryTiers...),
+	}
+}
+
+// HostMetricNames 支持查询的指标名称
+func HostMetricNames() []string {
+	return append([]string(nil), hostMetricNames...)
+}
+
+// Start 恢复已持久化的历史数据并开始定时采样
+func (s *HostHistoryService) Start() {
+	s.restore()
+	executor.GetSysCron().AddJob(hostHistorySampleSpec, s.sample)
+}
+
+// persistedValues 数据库中保存的指标值，按名称存储以兼容指标增减
+type persistedValues struct {
+	Avg map[string]float64 `json:"avg"`
+	Max map[string]float64 `json:"max"`
+}
+
+func (s *HostHistoryService) restore() {
+	var rows []models.HostMetricPoint
+	if err := database.DB.Find(&rows).Error; err != nil {
+		logger.Warnf("[HostHistory] 加载历史指标失败: %v", err)
+		return
+	}
+
+	tierIndex := make(map[int]int, len(hostHistoryTiers))
+	for i, t := range hostHistoryTiers {
+		tierIndex[int(t.Resolution/time.Second)] = i
+	}
+	for _, row := range rows {
+		tier, ok := tierIndex[row.Resolution]
+		if !ok {
+			continue
+		}
+		var values persistedValues
+		if err := json.Unmarshal([]byte(row.Values), &values); err != nil {
+			continue
+		}
+		p := timeseries.Point{Time: row.Time, Count: row.Count, Avg: make([]float64, len(hostMetricNames)), Max: make([]float64, len(hostMetricNames))}
+		for i, name := range hostMetricNames {
+			p.Avg[i] = values.Avg[name]
+			p.Max[i] = values.Max[name]
+		}
+		s.store.Restore(tier, p)
+	}
+	s.store.Rebuild()
+}
+
+func (s *HostHistoryService) sample() {
+	now := time.Now()
+	host := GetMonitorService().GetHostMetrics()
+	values := make([]float64, len(hostMetricNames))
+	values[0] = host.CPUPercent
+	if avg, err := load.Avg(); err == nil {
+		values[1] = avg.Load1
+	}
+	values[2] = host.VMem.UsedPercent
+	values[3] = float64(host.VMem.Used)
+	values[4] = host.DiskUsage.UsedPercent
+	values[5] = float64(host.DiskUsage.Used)
+	values[6], values[7] = s.netRates(now)
+
+	if s.executorService != nil {
+		if scheduler := s.executorService.GetScheduler(); scheduler != nil {
+			values[8] = float64(scheduler.GetQueueSize())
+			for _, w := range scheduler.GetWorkerStatuses() {
+				if w.Status == "running" {
+					values[10]++
+				}
+			}
+		}
+		values[9] = float64(s.executorService.GetRunningCount())
+	}
+
+	for _, f := range s.store.Add(now, values) {
+		s.persist(f)
+	}
+}
+
+// netRates 根据两次采样之间的网卡计数差计算收发速率
+func (s *HostHistoryService) netRates(now time.Time) (float64, float64) {
+	if constant.DemoMode {
+		return 0, 0
+	}
+	counters, err := net.IOCounters(false)
+	if err != nil || len(counters) == 0 {
+		return 0, 0
+	}
+	rx, tx := counters[0].BytesRecv, counters[0].BytesSent
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rxRate, txRate float64
+	if elapsed := now.Sub(s.lastNetAt).Seconds(); !s.lastNetAt.IsZero() && elapsed > 0 && rx >= s.lastRx && tx >= s.lastTx {
+		rxRate = float64(rx-s.lastRx) / elapsed
+		txRate = float64(tx-s.lastTx) / elapsed
+	}
+	s.lastNetAt, s.lastRx, s.lastTx = now, rx, tx
+	return rxRate, txRate
+}
+
+func (s *HostHistoryService) persist(f timeseries.Flushed) {
+	values := persistedValues{Avg: make(map[string]float64, len(hostMetricNames)), Max: make(map[string]float64, len(hostMetricNames))}
+	for i, name := range hostMetricNames {
+		values.Avg[name] = f.Point.Avg[i]
+		values.Max[name] = f.Point.Max[i]
+	}
+	data, _ := json.Marshal(values)
+
+	resolution := int(hostHistoryTiers[f.Tier].Resolution / time.Second)
+	row := models.HostMetricPoint{
+		ID:         fmt.Sprintf("%d-%d", resolution, f.Slot),
+		Resolution: resolution,
+		Time:       f.Point.Time,
+		Count:      f.Point.Count,
+		Values:     models.BigText(data),
+	}
+	if err := database.DB.Save(&row).Error; err != nil {
+		logger.Warnf("[HostHistory] 保存历史指标失败: %v", err)
+	}
+}
+
+// History 查询 [from, to] 内的历史指标，names 为空时返回全部指标
+// 起点在 24 小时内时使用 1 分钟分辨率，否则使用 1 小时分辨率
+func (s *HostHistoryService) History(from, to time.Time, names []string) (*HostHistory, error) {
+	return queryHistory(s.store, from, to, names)
+}
+
+// queryHistory 从时序存储中取出指定指标，names 为空时返回全部指标
+func queryHistory(store *timeseries.Store, from, to time.Time, names []string) (*HostHistory, error) {
+	known := store.Names()
+	if len(names) == 0 {
+		names = known
+	}
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = slices.Index(known, name)
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("不支持的指标: %s", name)
+		}
+	}
+
+	tier, points := store.Query(from, to, true)
+	history := &HostHistory{
+		Resolution: int(tier.Resolution / time.Second),
+		From:       from.Unix(),
+		To:         to.Unix(),
+		Timestamps: make([]int64, len(points)),
+		Series:     make(map[string]HostHistorySeries, len(names)),
+	}
+	for i, name := range names {
+		series := HostHistorySeries{Avg: make([]float64, len(points)), Max: make([]float64, len(points))}
+		for j, p := range points {
+			series.Avg[j] = p.Avg[indexes[i]]
+			series.Max[j] = p.Max[indexes[i]]
+		}
+		history.Series[name] = series
+	}
+	for i, p := range points {
+		history.Timestamps[i] = p.Time
+	}
+	return history, nil
+}
+
+// Markers 查询与 [from, to] 有交集的任务运行区间，用于与指标尖峰对照
+func (s *HostHistoryService) Markers(from, to time.Time, taskID string) ([]TaskRunMarker, error) {
+	query := database.DB.Model(&models.TaskLog{}).
+		Select("id, task_id, agent_id, status, duration, start_time, end_time, user_cpu, system_cpu, max_rss").
+		Where("start_time <= ? AND (end_time >= ? OR end_time IS NULL)", to, from)
+	if taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	}
+
+	var logs []models.TaskLog
+	if err := query.Order("start_time ASC").Limit(maxHostHistoryMarkers).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	markers := make([]TaskRunMarker, 0, len(logs))
+	if len(logs) == 0 {
+		return markers, nil
+	}
+
+	ids := make([]string, 0, len(logs))
+	for _, log := range logs {
+		ids = append(ids, log.TaskID)
+	}
+	var taskList []models.Task
+	database.DB.Select("id, name").Where("id IN ?", ids).Find(&taskList)
+	names := make(map[string]string, len(taskList))
+	for _, t := range taskList {
+		names[t.ID] = t.Name
+	}
+
+	for _, log := range logs {
+		m := TaskRunMarker{
+			LogID:    log.ID,
+			TaskID:   log.TaskID,
+			TaskName: names[log.TaskID],
+			AgentID:  log.AgentID,
+			Status:   log.Status,
+			Duration: log.Duration,
+			CPU:      log.UserCPU + log.SystemCPU,
+			MaxRSS:   log.MaxRSS,
+		}
+		if log.StartTime != nil {
+			m.Start = time.Time(*log.StartTime).Unix()
+		}
+		if log.EndTime != nil && log.Status != constant.TaskStatusRunning {
+			m.End = time.Time(*log.EndTime).Unix()
+		}
+		markers = append(markers, m)
+	}
+	return markers, nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/metrics"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+)
+
+// taskDurationBuckets 任务耗时直方图的分桶（秒）
+var taskDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// MetricsService Prometheus 指标服务
+// 计数类指标通过订阅事件总线累计（进程重启后归零，符合 Prometheus counter 语义），状态类指标在抓取时实时读取
+type MetricsService struct {
+	executorService *tasks.ExecutorService
+	registry        *metrics.Registry
+
+	taskRuns      *metrics.CounterVec
+	taskFailures  *metrics.CounterVec
+	taskDuration  *metrics.HistogramVec
+	notifications *metrics.CounterVec
+}
+
+// NewMetricsService 创建指标服务
+func NewMetricsService(executorService *tasks.ExecutorService) *MetricsService {
+	s := &MetricsService{
+		executorService: executorService,
+		registry:        metrics.NewRegistry(),
+		taskRuns: metrics.NewCounterVec("baihu_task_runs_total",
+			"Number of finished task runs by final status.", "task_id", "task_name", "status"),
+		taskFailures: metrics.NewCounterVec("baihu_task_failures_total",
+			"Number of failed or timed out task runs.", "task_id", "task_name"),
+		taskDuration: metrics.NewHistogramVec("baihu_task_duration_seconds",
+			"Duration of finished task runs in seconds.", taskDurationBuckets, "task_id", "task_name"),
+		notifications: metrics.NewCounterVec("baihu_notifications_sent_total",
+			"Number of notification sends by channel and result.", "channel_id", "channel_name", "result"),
+	}
+	s.registry.Register(s.taskRuns)
+	s.registry.Register(s.taskFailures)
+	s.registry.Register(s.taskDuration)
+	s.registry.Register(s.notifications)
+	s.registry.Register(metrics.CollectorFunc(s.collectScheduler))
+	s.registry.Register(metrics.CollectorFunc(s.collectAgents))
+	s.registry.Register(metrics.RuntimeCollector{})
+	return s
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出全部指标
+func (s *MetricsService) WriteMetrics(w io.Writer) error {
+	return s.registry.WriteText(w)
+}
+
+// SubscribeEvents 订阅任务结束与通知发送事件
+func (s *MetricsService) SubscribeEvents(bus *eventbus.EventBus) {
+	taskEvents := []string{constant.EventTaskSuccess, constant.EventTaskFailed, constant.EventTaskTimeout, constant.EventTaskCancelled}
+	for _, event := range taskEvents {
+		bus.Subscribe(event, s.onTaskFinished)
+	}
+	bus.Subscribe(constant.EventNotifySent, s.onNotifySent)
+}
+
+func (s *MetricsService) onTaskFinished(e eventbus.Event) {
+	payload, ok := e.Payload.(map[string]interface{})
+	if !ok {
+		return
+	}
+	taskID, _ := payload["task_id"].(string)
+	taskName, _ := payload["task_name"].(string)
+	status, _ := payload["status"].(string)
+
+	s.taskRuns.Inc(taskID, taskName, status)
+	if status == constant.TaskStatusFailed || status == constant.TaskStatusTimeout {
+		s.taskFailures.Inc(taskID, taskName)
+	}
+	if duration, ok := payload["duration"].(int64); ok {
+		s.taskDuration.Observe(float64(duration)/1000, taskID, taskName)
+	}
+}
+
+func (s *MetricsService) onNotifySent(e eventbus.Event) {
+	payload, ok := e.Payload.(map[string]interface{})
+	if !ok {
+		return
+	}
+	channelID, _ := payload["channel_id"].(string)
+	channelName, _ := payload["channel_name"].(string)
+	result := "failure"
+	if success, _ := payload["success"].(bool); success {
+		result = "success"
+	}
+	s.notifications.Inc(channelID, channelName, result)
+}
+
+// collectScheduler 调度器队列深度与 Worker 忙闲状态
+func (s *MetricsService) collectScheduler() []metrics.Family {
+	if s.executorService == nil || s.executorService.GetScheduler() == nil {
+		return nil
+	}
+	scheduler := s.executorService.GetScheduler()
+	workers := scheduler.GetWorkerStatuses()
+
+	busy := 0
+	perWorker := metrics.Family{
+		Name:       "baihu_scheduler_worker_busy",
+		Help:       "Whether the scheduler worker is running a task (1) or idle (0).",
+		Type:       metrics.TypeGauge,
+		LabelNames: []string{"worker"},
+	}
+	for _, w := range workers {
+		v := 0.0
+		if w.Status == "running" {
+			v = 1
+			busy++
+		}
+		perWorker.Samples = append(perWorker.Samples, metrics.Sample{Labels: []string{strconv.Itoa(w.ID)}, Value: v})
+	}
+
+	return []metrics.Family{
+		{
+			Name:    "baihu_scheduler_queue_depth",
+			Help:    "Number of task runs waiting in the scheduler queue.",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(scheduler.GetQueueSize())}},
+		},
+		{
+			Name:       "baihu_scheduler_workers",
+			Help:       "Number of scheduler workers by state.",
+			Type:       metrics.TypeGauge,
+			LabelNames: []string{"state"},
+			Samples: []metrics.Sample{
+				{Labels: []string{"busy"}, Value: float64(busy)},
+				{Labels: []string{"idle"}, Value: float64(len(workers) - busy)},
+			},
+		},
+		perWorker,
+		{
+			Name:    "baihu_scheduler_running_tasks",
+			Help:    "Number of tasks currently running in the scheduler.",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(scheduler.GetRunningTaskCount())}},
+		},
+	}
+}
+
+// collectAgents Agent 在线数量
+func (s *MetricsService) collectAgents() []metrics.Family {
+	var enabled int64
+	database.DB.Model(&models.Agent{}).Where("enabled = ?", true).Count(&enabled)
+	return []metrics.Family{
+		{
+			Name:    "baihu_agents_online",
+			Help:    "Number of agents currently connected over WebSocket.",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(GetAgentWSManager().OnlineCount())}},
+		},
+		{
+			Name:    "baihu_agents_enabled",
+			Help:    "Number of enabled agents.",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(enabled)}},
+		},
+	}
+}
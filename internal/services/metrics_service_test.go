@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/tasks"
+)
+
+func TestMetricsCountsFailedRuns(t *testing.T) {
+	setupTestDB(t, &models.Agent{}, &models.Task{}, &models.TaskLog{}, &models.TaskLogIndex{},
+		&models.TaskRunRollup{}, &models.DataRelation{}, &models.SendStats{})
+	// 隔离临时日志目录，避免清理其他测试的临时文件
+	t.Setenv("TMPDIR", t.TempDir())
+	database.DB.Create(&models.Task{ID: "t1", Name: "broken"})
+
+	es := tasks.NewExecutorService(tasks.NewTaskService(), tasks.NewTaskLogService(NewSendStatsService()), nil, NewSettingsService(), NewEnvService())
+	defer es.Stop()
+	svc := NewMetricsService(nil)
+	svc.SubscribeEvents(eventbus.DefaultBus)
+
+	// 执行器未返回结果时由 OnTaskFailed 收尾
+	for _, execErr := range []error{errors.New("无法启动进程"), fmt.Errorf("等待执行: %w", context.DeadlineExceeded)} {
+		es.GetScheduler().SetExecutor(func(ctx context.Context, req *executor.ExecutionRequest, stdout, stderr io.Writer) (*executor.Result, error) {
+			time.Sleep(20 * time.Millisecond)
+			return nil, execErr
+		})
+		es.GetScheduler().ExecuteSync(&executor.ExecutionRequest{TaskID: "t1", Name: "broken", Command: "true"})
+	}
+
+	var text string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var buf bytes.Buffer
+		svc.WriteMetrics(&buf)
+		if text = buf.String(); strings.Contains(text, `baihu_task_duration_seconds_count{task_id="t1",task_name="broken"} 2`) {
+			break
+		}
+	}
+	for _, want := range []string{
+		`baihu_task_runs_total{task_id="t1",task_name="broken",status="failed"} 1`,
+		`baihu_task_runs_total{task_id="t1",task_name="broken",status="timeout"} 1`,
+		`baihu_task_failures_total{task_id="t1",task_name="broken"} 2`,
+		`baihu_task_duration_seconds_count{task_id="t1",task_name="broken"} 2`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("缺少指标 %s\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `status=""`) {
+		t.Errorf("失败的运行不应缺少状态:\n%s", text)
+	}
+
+	var logs []models.TaskLog
+	database.DB.Where("task_id = ?", "t1").Order("id").Find(&logs)
+	if len(logs) != 2 || logs[1].Status != "timeout" || logs[0].Duration < 20 {
+		t.Errorf("日志状态或耗时不正确: %+v", logs)
+	}
+}
@@ -69,6 +69,12 @@ var SupportedEvents = []map[string]string{
 	{"type": constant.EventTaskSuccess, "label": "任务成功", "binding_type": constant.BindingTypeTask},
 	{"type": constant.EventTaskFailed, "label": "任务失败", "binding_type": constant.BindingTypeTask},
 	{"type": constant.EventTaskTimeout, "label": "任务超时", "binding_type": constant.BindingTypeTask},
+	{"type": constant.EventAgentResourceAlert, "label": "Agent 资源告警", "binding_type": constant.BindingTypeSystem},
+	{"type": constant.EventAgentOffline, "label": "Agent 离线", "binding_type": constant.BindingTypeSystem},
+	{"type": constant.EventAgentPending, "label": "Agent 待审批", "binding_type": constant.BindingTypeSystem},
+	{"type": constant.EventAgentReviewed, "label": "Agent 审批结果", "binding_type": constant.BindingTypeSystem},
+	{"type": constant.EventRemoteTaskSuccess, "label": "子节点任务成功", "binding_type": constant.BindingTypeSystem},
+	{"type": constant.EventRemoteTaskFailed, "label": "子节点任务失败", "binding_type": constant.BindingTypeSystem},
 }
 
 type NotificationService struct {
@@ -334,7 +340,7 @@ func (s *NotificationService) SendByChannelID(channelID string, msg *NotifyMessa
 // SubscribeEvents 注册通知服务自身为事件流的订阅者
 func (s *NotificationService) SubscribeEvents(bus *eventbus.EventBus) {
 	// 系统事件
-	systemEvents := []string{constant.EventUserLogin, constant.EventBruteForceLogin, constant.EventPasswordChanged}
+	systemEvents := []string{constant.EventUserLogin, constant.EventBruteForceLogin, constant.EventPasswordChanged, constant.EventAgentResourceAlert, constant.EventAgentOffline, constant.EventAgentPending, constant.EventAgentReviewed, constant.EventRemoteTaskSuccess, constant.EventRemoteTaskFailed}
 	for _, evt := range systemEvents {
 		bus.Subscribe(evt, s.handleEvent(constant.BindingTypeSystem))
 	}
@@ -400,6 +406,24 @@ func (s *NotificationService) getDefaultMessage(eventType string, payload map[st
 	case constant.EventTaskTimeout:
 		title = fmt.Sprintf("任务[%v] 超时", payload["task_name"])
 		text = fmt.Sprintf("任务 #%v %v\n执行超时\n执行时间: %v\n耗时: %vms", payload["task_id"], payload["task_name"], payload["start_time"], payload["duration"])
+	case constant.EventAgentResourceAlert:
+		title = fmt.Sprintf("Agent[%v] %v过高", payload["agent_name"], payload["metric_label"])
+		text = fmt.Sprintf("Agent #%v %v\n%v: %v%%（阈值 %v%%）\n%v", payload["agent_id"], payload["agent_name"], payload["metric_label"], payload["value"], payload["threshold"], payload["detail"])
+	case constant.EventAgentOffline:
+		title = fmt.Sprintf("Agent[%v] 离线", payload["agent_name"])
+		text = fmt.Sprintf("Agent #%v %v\n已离线 %v 分钟\n最后心跳: %v", payload["agent_id"], payload["agent_name"], payload["minutes"], payload["last_seen"])
+	case constant.EventAgentPending:
+		title = fmt.Sprintf("新 Agent[%v] 等待审批", payload["hostname"])
+		text = fmt.Sprintf("Agent #%v\n主机名: %v\nIP: %v\n系统: %v/%v\n机器码: %v", payload["agent_id"], payload["hostname"], payload["ip"], payload["os"], payload["arch"], payload["machine_id"])
+	case constant.EventAgentReviewed:
+		title = fmt.Sprintf("Agent[%v] 注册审批%v", payload["agent_name"], payload["result"])
+		text = fmt.Sprintf("Agent #%v %v\n主机名: %v\nIP: %v\n审批结果: %v\n操作人: %v (%v)", payload["agent_id"], payload["agent_name"], payload["hostname"], payload["ip"], payload["result"], payload["operator"], payload["operator_ip"])
+	case constant.EventRemoteTaskSuccess:
+		title = fmt.Sprintf("子节点[%v] 任务[%v] 成功", payload["node_name"], payload["task_name"])
+		text = fmt.Sprintf("子节点 %v 任务 #%v %v\n状态: 成功\n耗时: %vms", payload["node_name"], payload["child_task_id"], payload["task_name"], payload["duration"])
+	case constant.EventRemoteTaskFailed:
+		title = fmt.Sprintf("子节点[%v] 任务[%v] %v", payload["node_name"], payload["task_name"], payload["status_label"])
+		text = fmt.Sprintf("子节点 %v 任务 #%v %v\n状态: %v\n执行时间: %v\n原因: %v", payload["node_name"], payload["child_task_id"], payload["task_name"], payload["status_label"], payload["start_time"], payload["error"])
 	}
 	return title, text
 }
@@ -426,6 +450,32 @@ func (s *NotificationService) resolveEvent(eventType string, payload map[string]
 		tmplTitleKey = constant.KeyNotifyTemplatePasswordChangedTitle
 		tmplTextKey = constant.KeyNotifyTemplatePasswordChangedText
 
+	case constant.EventAgentResourceAlert:
+		tmplTitleKey = constant.KeyNotifyTemplateAgentResourceAlertTitle
+		tmplTextKey = constant.KeyNotifyTemplateAgentResourceAlertText
+
+	case constant.EventAgentOffline:
+		tmplTitleKey = constant.KeyNotifyTemplateAgentOfflineTitle
+		tmplTextKey = constant.KeyNotifyTemplateAgentOfflineText
+
+	case constant.EventAgentPending:
+		tmplTitleKey = constant.KeyNotifyTemplateAgentPendingTitle
+		tmplTextKey = constant.KeyNotifyTemplateAgentPendingText
+
+	case constant.EventAgentReviewed:
+		tmplTitleKey = constant.KeyNotifyTemplateAgentReviewedTitle
+		tmplTextKey = constant.KeyNotifyTemplateAgentReviewedText
+
+	case constant.EventRemoteTaskSuccess, constant.EventRemoteTaskFailed:
+		if eventType == constant.EventRemoteTaskSuccess {
+			tmplTitleKey = constant.KeyNotifyTemplateRemoteTaskSuccessTitle
+			tmplTextKey = constant.KeyNotifyTemplateRemoteTaskSuccessText
+		} else {
+			tmplTitleKey = constant.KeyNotifyTemplateRemoteTaskFailedTitle
+			tmplTextKey = constant.KeyNotifyTemplateRemoteTaskFailedText
+		}
+		rawOutput, _ = payload["output"].(string)
+
 	case constant.EventTaskSuccess, constant.EventTaskFailed, constant.EventTaskTimeout:
 		switch eventType {
 		case constant.EventTaskSuccess:
@@ -14,8 +14,12 @@ import (
 	"gorm.io/gorm"
 )
 
-func setupTestDB(t *testing.T) {
-	time.Local = systime.CST
+// setupTestDB 使用内存 SQLite 作为测试库，extra 为测试额外需要的表
+func setupTestDB(t *testing.T, extra ...interface{}) {
+	// 仅在时区不同时赋值，避免与其他测试遗留的 goroutine 读取 time.Local 产生竞争
+	if time.Local != systime.CST {
+		time.Local = systime.CST
+	}
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("无法开启 SQLite 内存测试库: %v", err)
@@ -30,6 +34,9 @@ func setupTestDB(t *testing.T) {
 		&models.NotifyFilter{},
 		&models.AppLog{},
 	)
+	if err == nil && len(extra) > 0 {
+		err = db.AutoMigrate(extra...)
+	}
 	if err != nil {
 		t.Fatalf("测试数据迁移失败: %v", err)
 	}
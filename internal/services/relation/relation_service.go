@@ -139,3 +139,15 @@ func (s *DataRelationService) GetAllTags(relType string) ([]string, error) {
 	}
 	return tags, nil
 }
+
+// GetDataIDsByTag 获取带有指定 Tag 的全部数据 ID
+func (s *DataRelationService) GetDataIDsByTag(relType string, tag string) []string {
+	var storageIDs []string
+	database.DB.Model(&models.DataStorage{}).Where("type = ? AND name = ?", relType, tag).Pluck("id", &storageIDs)
+	if len(storageIDs) == 0 {
+		return nil
+	}
+	var dataIDs []string
+	database.DB.Model(&models.DataRelation{}).Where("type = ? AND relate_id IN ?", relType, storageIDs).Distinct().Pluck("data_id", &dataIDs)
+	return dataIDs
+}
@@ -15,9 +15,9 @@ func NewSendStatsService() *SendStatsService {
 	return &SendStatsService{}
 }
 
-// IncrementStats 增加任务执行统计
-func (s *SendStatsService) IncrementStats(taskID string, status string) error {
-	day := systime.FormatDate(time.Now())
+// IncrementStats 增加任务执行统计，at 决定计入哪一天
+func (s *SendStatsService) IncrementStats(taskID string, status string, at time.Time) error {
+	day := systime.FormatDate(at)
 
 	var stats models.SendStats
 	res := database.DB.Where("task_id = ? AND day = ? AND status = ?", taskID, day, status).Limit(1).Find(&stats)
@@ -0,0 +1,276 @@
+package tasks
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// 选择器表达式运算符
+const (
+	selectorOpEquals    = "="
+	selectorOpNotEquals = "!="
+	selectorOpExists    = "exists"
+	selectorOpNotExists = "!exists"
+)
+
+// selectorRequirement 选择器中的单个条件
+type selectorRequirement struct {
+	Key    string
+	Op     string
+	Values []string // = 与 != 可用 | 分隔多个候选值
+}
+
+// AgentSelector 标签选择器，所有条件同时满足才算匹配
+// 语法：逗号分隔的条件，支持 key=value、key!=value、key（存在）、!key（不存在），value 可用 | 表示多选
+type AgentSelector []selectorRequirement
+
+// ParseAgentSelector 解析标签选择器
+func ParseAgentSelector(expr string) (AgentSelector, error) {
+	var selector AgentSelector
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var req selectorRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = selectorRequirement{Key: kv[0], Op: selectorOpNotEquals, Values: splitSelectorValues(kv[1])}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = selectorRequirement{Key: kv[0], Op: selectorOpEquals, Values: splitSelectorValues(kv[1])}
+		case strings.HasPrefix(part, "!"):
+			req = selectorRequirement{Key: part[1:], Op: selectorOpNotExists}
+		default:
+			req = selectorRequirement{Key: part, Op: selectorOpExists}
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		if req.Key == "" || strings.ContainsAny(req.Key, "=! ") {
+			return nil, fmt.Errorf("无效的选择器条件: %s", part)
+		}
+		if (req.Op == selectorOpEquals || req.Op == selectorOpNotEquals) && len(req.Values) == 0 {
+			return nil, fmt.Errorf("选择器条件缺少取值: %s", part)
+		}
+		selector = append(selector, req)
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("选择器不能为空")
+	}
+	return selector, nil
+}
+
+func splitSelectorValues(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, "|") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Matches 判断标签是否满足选择器
+func (s AgentSelector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.Key]
+		switch req.Op {
+		case selectorOpExists:
+			if !ok {
+				return false
+			}
+		case selectorOpNotExists:
+			if ok {
+				return false
+			}
+		case selectorOpEquals:
+			if !ok || !slices.Contains(req.Values, value) {
+				return false
+			}
+		case selectorOpNotEquals:
+			if ok && slices.Contains(req.Values, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateAgentLabels 校验 Agent 标签，键值不能包含选择器语法使用的字符
+func ValidateAgentLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, "=!,| ") {
+			return fmt.Errorf("无效的标签名: %q", key)
+		}
+		if strings.ContainsAny(value, ",|") || strings.TrimSpace(value) != value {
+			return fmt.Errorf("标签 %s 的取值无效: %q", key, value)
+		}
+	}
+	return nil
+}
+
+// NormalizeAgentStrategy 校验选择策略，为空时返回默认的轮询
+func NormalizeAgentStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "":
+		return constant.AgentStrategyRoundRobin, nil
+	case constant.AgentStrategyRoundRobin, constant.AgentStrategyLeastBusy, constant.AgentStrategyRandom:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("不支持的 Agent 选择策略: %s", strategy)
+}
+
+// agentCandidate 参与选择的 Agent
+type agentCandidate struct {
+	ID   string
+	Name string
+	Load models.AgentLoad
+	// Reported 为 false 表示 Agent 尚未上报负载（旧版 Agent）
+	Reported bool
+	// Inflight 本服务已派发、尚未返回结果的任务数
+	Inflight int
+}
+
+// busyScore 负载评分，越小越空闲
+// 以 Worker 数归一化，便于不同规格的机器比较；上报存在延迟，取上报值与已派发数中的较大者
+func (c agentCandidate) busyScore() float64 {
+	busy := c.Inflight
+	workers := 1
+	if c.Reported {
+		busy = max(busy, c.Load.BusyWorkers+c.Load.QueueSize)
+		workers = max(workers, c.Load.WorkerCount)
+	}
+	return float64(busy) / float64(workers)
+}
+
+// orderCandidates 按策略排列候选 Agent，调用方按顺序尝试，前一个不可用时回退到下一个
+// candidates 须已按 ID 排序；cursor 为轮询计数
+func orderCandidates(candidates []agentCandidate, strategy string, cursor uint64, rnd *rand.Rand) []agentCandidate {
+	n := len(candidates)
+	if n <= 1 {
+		return append([]agentCandidate(nil), candidates...)
+	}
+	// 从轮询位置开始旋转得到新切片
+	start := int(cursor % uint64(n))
+	ordered := slices.Concat(candidates[start:], candidates[:start])
+	switch strategy {
+	case constant.AgentStrategyLeastBusy:
+		// 评分相同时保持轮询顺序，避免总是压在同一台上
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].busyScore() < ordered[j].busyScore()
+		})
+	case constant.AgentStrategyRandom:
+		rnd.Shuffle(n, func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	}
+	return ordered
+}
+
+// AgentRouter 按标签选择器为任务挑选在线 Agent
+type AgentRouter struct {
+	wsManager AgentWSManager
+
+	mu       sync.Mutex
+	cursors  map[string]uint64 // 任务 ID -> 轮询计数
+	inflight map[string]int    // Agent ID -> 已派发未完成数
+	rnd      *rand.Rand
+}
+
+// NewAgentRouter 创建 Agent 路由器
+func NewAgentRouter(wsManager AgentWSManager) *AgentRouter {
+	return &AgentRouter{
+		wsManager: wsManager,
+		cursors:   make(map[string]uint64),
+		inflight:  make(map[string]int),
+		rnd:       rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// Candidates 返回任务可用的在线 Agent，已按任务的选择策略排好尝试顺序
+func (r *AgentRouter) Candidates(task *models.Task) ([]agentCandidate, error) {
+	selector, err := ParseAgentSelector(task.AgentSelector)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := NormalizeAgentStrategy(task.AgentStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := r.OnlineMatches(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range candidates {
+		candidates[i].Inflight = r.inflight[candidates[i].ID]
+	}
+	cursor := r.cursors[task.ID]
+	r.cursors[task.ID] = cursor + 1
+	return orderCandidates(candidates, strategy, cursor, r.rnd), nil
+}
+
+// OnlineMatches 返回匹配选择器的已启用、已通过审批的在线 Agent，按 ID 排序
+func (r *AgentRouter) OnlineMatches(selector AgentSelector) ([]agentCandidate, error) {
+	var agents []models.Agent
+	if err := database.DB.Select("id, name, enabled, labels, approval").Order("id ASC").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := make([]agentCandidate, 0, len(agents))
+	for _, agent := range agents {
+		if !utils.DerefBool(agent.Enabled, true) || !agent.Approved() || !selector.Matches(agent.Labels) {
+			continue
+		}
+		if r.wsManager == nil || !r.wsManager.IsAgentOnline(agent.ID) {
+			continue
+		}
+		// 旧版 Agent 只能执行本地任务列表中的任务，无法接收选择器派发的任务
+		if !r.wsManager.SupportsCapability(agent.ID, constant.AgentCapInlineTask) {
+			continue
+		}
+		c := agentCandidate{ID: agent.ID, Name: agent.Name}
+		c.Load, c.Reported = r.wsManager.GetAgentLoad(agent.ID)
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// Acquire 记录向 Agent 派发了一个任务，返回的函数用于在任务结束时释放
+func (r *AgentRouter) Acquire(agentID string) func() {
+	r.mu.Lock()
+	r.inflight[agentID]++
+	r.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.inflight[agentID] <= 1 {
+				delete(r.inflight, agentID)
+			} else {
+				r.inflight[agentID]--
+			}
+		})
+	}
+}
+
+// Forget 清理已删除任务的轮询计数
+func (r *AgentRouter) Forget(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cursors, taskID)
+}
@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestAgentSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "role": "worker", "gpu": ""}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"env=prod", true},
+		{"env=prod, role=worker", true},
+		{"env=staging|prod", true},
+		{"env!=prod", false},
+		{"env!=staging", true},
+		{"region!=cn", true},
+		{"gpu", true},
+		{"!gpu", false},
+		{"!ssd,env=prod", true},
+		{"role=db", false},
+		{"region=cn", false},
+	}
+	for _, c := range cases {
+		selector, err := ParseAgentSelector(c.expr)
+		if err != nil {
+			t.Fatalf("ParseAgentSelector(%q) error: %v", c.expr, err)
+		}
+		if got := selector.Matches(labels); got != c.want {
+			t.Errorf("%q matches = %v, want %v", c.expr, got, c.want)
+		}
+	}
+
+	for _, expr := range []string{"", " , ", "=prod", "env=", "!", "bad key=1"} {
+		if _, err := ParseAgentSelector(expr); err == nil {
+			t.Errorf("ParseAgentSelector(%q) expected error", expr)
+		}
+	}
+}
+
+func TestOrderCandidates(t *testing.T) {
+	candidates := []agentCandidate{
+		{ID: "a", Reported: true, Load: models.AgentLoad{WorkerCount: 4, BusyWorkers: 4}},
+		{ID: "b", Reported: true, Load: models.AgentLoad{WorkerCount: 8, BusyWorkers: 2}},
+		{ID: "c", Inflight: 1},
+	}
+	ids := func(list []agentCandidate) string {
+		s := ""
+		for _, c := range list {
+			s += c.ID
+		}
+		return s
+	}
+	rnd := rand.New(rand.NewSource(1))
+
+	// 轮询：每次从下一个候选开始，其余作为回退顺序
+	for cursor, want := range []string{"abc", "bca", "cab", "abc"} {
+		if got := ids(orderCandidates(candidates, constant.AgentStrategyRoundRobin, uint64(cursor), rnd)); got != want {
+			t.Errorf("round robin cursor %d = %s, want %s", cursor, got, want)
+		}
+	}
+
+	// 最空闲：b 为 2/8，c 未上报负载按已派发数 1/1，a 为 4/4
+	if got := ids(orderCandidates(candidates, constant.AgentStrategyLeastBusy, 0, rnd)); got != "bac" {
+		t.Errorf("least busy = %s, want bac", got)
+	}
+	candidates[2].Inflight = 0
+	if got := ids(orderCandidates(candidates, constant.AgentStrategyLeastBusy, 0, rnd)); got != "cba" {
+		t.Errorf("least busy = %s, want cba", got)
+	}
+
+	// 随机：只打乱顺序，不丢失候选
+	if got := orderCandidates(candidates, constant.AgentStrategyRandom, 0, rnd); len(got) != len(candidates) {
+		t.Errorf("random returned %d candidates", len(got))
+	}
+}
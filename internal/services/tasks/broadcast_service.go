@@ -0,0 +1,404 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// MaxBroadcastParallel 广播运行并行数上限
+const MaxBroadcastParallel = 100
+
+// broadcastCancels 运行中的广播，用于停止；broadcastStarting 正在创建广播的任务
+var (
+	broadcastMu       sync.Mutex
+	broadcastCancels  = make(map[string]context.CancelFunc)
+	broadcastStarting = make(map[string]bool)
+)
+
+// claimBroadcastStart 占用任务的广播创建权，同一任务的并发请求只有一个能完成检查并写入运行记录
+func claimBroadcastStart(taskID string) (release func(), ok bool) {
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+	if broadcastStarting[taskID] {
+		return nil, false
+	}
+	broadcastStarting[taskID] = true
+	return func() {
+		broadcastMu.Lock()
+		delete(broadcastStarting, taskID)
+		broadcastMu.Unlock()
+	}, true
+}
+
+// BroadcastRunDetail 广播运行及其子日志
+type BroadcastRunDetail struct {
+	Run  *models.BroadcastRun `json:"run"`
+	Logs []models.TaskLog     `json:"logs"`
+}
+
+// BroadcastService 广播运行服务：将同一任务同时派发到所有匹配选择器的在线 Agent
+type BroadcastService struct {
+	es *ExecutorService
+}
+
+// NewBroadcastService 创建广播运行服务
+func NewBroadcastService(es *ExecutorService) *BroadcastService {
+	return &BroadcastService{es: es}
+}
+
+// CleanupInterrupted 将服务重启前未结束的广播及其子日志标记为失败
+func (s *BroadcastService) CleanupInterrupted() error {
+	now := models.Now()
+	var runIDs []string
+	if err := database.DB.Model(&models.BroadcastRun{}).Where("status = ?", constant.TaskStatusRunning).Pluck("id", &runIDs).Error; err != nil {
+		return err
+	}
+	if len(runIDs) == 0 {
+		return nil
+	}
+	logger.Infof("[Broadcast] 正在清理 %d 个因重启中断的广播运行", len(runIDs))
+	database.DB.Model(&models.TaskLog{}).
+		Where("run_id IN ? AND status IN ?", runIDs, []string{constant.TaskStatusQueued, constant.TaskStatusRunning}).
+		Updates(map[string]interface{}{"status": constant.TaskStatusFailed, "error": "服务重启，广播运行已中断", "end_time": now})
+	return database.DB.Model(&models.BroadcastRun{}).Where("id IN ?", runIDs).
+		Updates(map[string]interface{}{"status": constant.TaskStatusFailed, "end_time": now}).Error
+}
+
+// Start 创建广播运行并在后台派发，selector 为空时使用任务自身的选择器，maxParallel 为 0 时使用系统设置
+func (s *BroadcastService) Start(taskID, selectorExpr string, maxParallel int) (*models.BroadcastRun, error) {
+	task := s.es.taskService.GetTaskByID(taskID)
+	if task == nil {
+		return nil, fmt.Errorf("任务不存在")
+	}
+
+	selectorExpr = strings.TrimSpace(selectorExpr)
+	if selectorExpr == "" {
+		selectorExpr = task.AgentSelector
+	}
+	selector, err := ParseAgentSelector(selectorExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxParallel <= 0 {
+		maxParallel = getIntSetting(s.es.settingsService, constant.SectionScheduler, constant.KeyBroadcastParallel, 5)
+	}
+	maxParallel = min(max(maxParallel, 1), MaxBroadcastParallel)
+
+	release, ok := claimBroadcastStart(task.ID)
+	if !ok {
+		return nil, fmt.Errorf("该任务已有广播运行中")
+	}
+	defer release()
+
+	var running int64
+	database.DB.Model(&models.BroadcastRun{}).Where("task_id = ? AND status = ?", task.ID, constant.TaskStatusRunning).Count(&running)
+	if running > 0 {
+		return nil, fmt.Errorf("该任务已有广播运行中")
+	}
+
+	targets, err := s.es.agentRouter.OnlineMatches(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("没有匹配选择器 [%s] 的在线 Agent", selectorExpr)
+	}
+
+	req := s.es.CreateExecutionRequest(task, executor.TaskTypeManual, nil)
+	now := models.Now()
+	run := &models.BroadcastRun{
+		ID:          utils.GenerateID(),
+		TaskID:      task.ID,
+		Selector:    selectorExpr,
+		MaxParallel: maxParallel,
+		Status:      constant.TaskStatusRunning,
+		Total:       len(targets),
+		StartTime:   &now,
+		CreatedAt:   now,
+	}
+
+	// 预先为每个 Agent 创建排队中的子日志，便于立即看到全部目标
+	children := make([]models.TaskLog, len(targets))
+	for i, target := range targets {
+		agentID := target.ID
+		children[i] = models.TaskLog{
+			ID:        utils.GenerateID(),
+			TaskID:    task.ID,
+			AgentID:   &agentID,
+			RunID:     run.ID,
+			Command:   models.BigText(req.MaskedCommand),
+			Status:    constant.TaskStatusQueued,
+			CreatedAt: now,
+		}
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Create(&children).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	broadcastMu.Lock()
+	broadcastCancels[run.ID] = cancel
+	broadcastMu.Unlock()
+
+	logger.Infof("[Broadcast] 任务 #%s 广播到 %d 个 Agent (选择器: %s, 并行: %d)", task.ID, len(targets), selectorExpr, maxParallel)
+	go s.run(ctx, run, task, req, children)
+	return run, nil
+}
+
+// Stop 停止广播运行：正在执行的 Agent 下发停止指令，尚未派发的直接取消
+func (s *BroadcastService) Stop(runID string) error {
+	broadcastMu.Lock()
+	cancel, ok := broadcastCancels[runID]
+	broadcastMu.Unlock()
+	if !ok {
+		return fmt.Errorf("广播运行不存在或已结束")
+	}
+	cancel()
+	return nil
+}
+
+// run 按并行上限派发子任务并在全部结束后汇总状态
+func (s *BroadcastService) run(ctx context.Context, run *models.BroadcastRun, task *models.Task, req *executor.ExecutionRequest, children []models.TaskLog) {
+	defer func() {
+		broadcastMu.Lock()
+		if cancel, ok := broadcastCancels[run.ID]; ok {
+			cancel()
+			delete(broadcastCancels, run.ID)
+		}
+		broadcastMu.Unlock()
+	}()
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		failedLog  string
+		sem        = make(chan struct{}, run.MaxParallel)
+		envs       = executor.FormatEnvVars(req.Envs)
+		runStarted = time.Now()
+	)
+	for i := range children {
+		child := &children[i]
+		// 停止后不再等待空闲槽位，剩余子任务直接取消
+		acquired := false
+		select {
+		case sem <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if acquired {
+				defer func() { <-sem }()
+			}
+			status := s.runChild(ctx, task, req, envs, child)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case constant.TaskStatusSuccess:
+				run.Success++
+			case constant.TaskStatusCancelled:
+				run.Cancelled++
+			default:
+				run.Failed++
+				if failedLog == "" {
+					failedLog = child.ID
+				}
+			}
+			database.DB.Model(run).Updates(map[string]interface{}{
+				"success":   run.Success,
+				"failed":    run.Failed,
+				"cancelled": run.Cancelled,
+			})
+		}()
+	}
+	wg.Wait()
+
+	end := models.Now()
+	run.Status = broadcastStatus(run)
+	run.EndTime = &end
+	database.DB.Model(run).Updates(map[string]interface{}{"status": run.Status, "end_time": end})
+	logger.Infof("[Broadcast] 任务 #%s 广播运行 #%s 结束: %s", task.ID, run.ID, run.Summary())
+
+	s.publish(run, task, failedLog, time.Since(runStarted))
+}
+
+// runChild 在单个 Agent 上执行并落库子日志，返回最终状态
+func (s *BroadcastService) runChild(ctx context.Context, task *models.Task, req *executor.ExecutionRequest, envs string, child *models.TaskLog) string {
+	agentID := *child.AgentID
+	if ctx.Err() != nil {
+		now := models.Now()
+		child.Status = constant.TaskStatusCancelled
+		child.Error = models.BigText("广播运行已停止，未派发到该 Agent")
+		child.EndTime = &now
+		database.DB.Model(child).Updates(map[string]interface{}{"status": child.Status, "error": child.Error, "end_time": now})
+		return child.Status
+	}
+
+	start := models.Now()
+	child.Status = constant.TaskStatusRunning
+	child.StartTime = &start
+	database.DB.Model(child).Updates(map[string]interface{}{"status": child.Status, "start_time": start})
+
+	tl, err := NewTinyLog(child.ID, req.Secrets)
+	if err != nil {
+		logger.Warnf("[Broadcast] 创建日志 #%s 的收集器失败: %v", child.ID, err)
+	}
+
+	release := s.es.agentRouter.Acquire(agentID)
+	result, err := s.es.executeOnAgent(ctx, task, agentID, child.ID, envs, req.Secrets)
+	release()
+	if result == nil {
+		now := time.Now()
+		result = &executor.Result{
+			Status:    constant.TaskStatusFailed,
+			Error:     err.Error(),
+			ExitCode:  -1,
+			StartTime: time.Time(start),
+			EndTime:   now,
+			Duration:  now.Sub(time.Time(start)).Milliseconds(),
+		}
+	}
+
+	var output, lineMeta string
+	if tl != nil {
+		if output, err = tl.CompressAndCleanup(); err != nil {
+			output = "[System Error] 日志处理失败: " + err.Error()
+		} else {
+			lineMeta = tl.LineMeta()
+		}
+	} else {
+		output, _ = utils.CompressToBase64(result.Output)
+	}
+
+	startTime := models.LocalTime(result.StartTime)
+	endTime := models.LocalTime(result.EndTime)
+	child.Output = models.BigText(output)
+	child.LineMeta = models.BigText(lineMeta)
+	child.Error = models.BigText(result.Error)
+	child.Status = result.Status
+	child.Duration = result.Duration
+	child.ExitCode = result.ExitCode
+	child.StartTime = &startTime
+	child.EndTime = &endTime
+	if result.Usage != nil {
+		child.ResourceUsage = *result.Usage
+	}
+	if err := s.es.taskLogService.ProcessTaskCompletion(child); err != nil {
+		logger.Warnf("[Broadcast] 保存日志 #%s 失败: %v", child.ID, err)
+	}
+	return child.Status
+}
+
+// broadcastStatus 汇总子日志状态：全部成功为 success，存在失败为 failed，仅有取消为 cancelled
+func broadcastStatus(run *models.BroadcastRun) string {
+	switch {
+	case run.Failed > 0:
+		return constant.TaskStatusFailed
+	case run.Cancelled > 0:
+		return constant.TaskStatusCancelled
+	default:
+		return constant.TaskStatusSuccess
+	}
+}
+
+// publish 广播结束后发布一次汇总事件，避免每个 Agent 各发一条通知
+func (s *BroadcastService) publish(run *models.BroadcastRun, task *models.Task, failedLog string, duration time.Duration) {
+	var eventType string
+	switch run.Status {
+	case constant.TaskStatusSuccess:
+		eventType = constant.EventTaskSuccess
+	case constant.TaskStatusFailed:
+		eventType = constant.EventTaskFailed
+	case constant.TaskStatusCancelled:
+		eventType = constant.EventTaskCancelled
+	default:
+		return
+	}
+	summary := "[广播运行] " + run.Summary()
+	errText := ""
+	if run.Status != constant.TaskStatusSuccess {
+		errText = summary
+	}
+	eventbus.DefaultBus.Publish(eventbus.Event{
+		Type: eventType,
+		Payload: map[string]interface{}{
+			"log_id":     failedLog,
+			"run_id":     run.ID,
+			"task_id":    task.ID,
+			"task_name":  task.Name,
+			"status":     run.Status,
+			"start_time": time.Time(*run.StartTime).Format("2006-01-02 15:04:05"),
+			"duration":   duration.Milliseconds(),
+			"output":     summary,
+			"error":      errText,
+		},
+	})
+}
+
+// List 分页查询广播运行，taskID 为空时查询全部
+func (s *BroadcastService) List(taskID string, page, pageSize int) ([]models.BroadcastRun, int64, error) {
+	query := database.DB.Model(&models.BroadcastRun{})
+	if taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var runs []models.BroadcastRun
+	err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&runs).Error
+	return runs, total, err
+}
+
+// Detail 查询广播运行及其子日志，不存在时返回 nil
+func (s *BroadcastService) Detail(runID string) (*BroadcastRunDetail, error) {
+	var run models.BroadcastRun
+	res := database.DB.Where("id = ?", runID).Limit(1).Find(&run)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	var logs []models.TaskLog
+	if err := database.DB.Omit("output", "line_meta").Where("run_id = ?", runID).Order("agent_id ASC").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return &BroadcastRunDetail{Run: &run, Logs: logs}, nil
+}
+
+// TaskNames 查询广播运行所属任务的名称
+func (s *BroadcastService) TaskNames(runs []models.BroadcastRun) map[string]string {
+	names := make(map[string]string, len(runs))
+	if len(runs) == 0 {
+		return names
+	}
+	taskIDs := make([]string, 0, len(runs))
+	for _, run := range runs {
+		taskIDs = append(taskIDs, run.TaskID)
+	}
+	var taskList []models.Task
+	database.DB.Select("id, name").Where("id IN ?", taskIDs).Find(&taskList)
+	for _, t := range taskList {
+		names[t.ID] = t.Name
+	}
+	return names
+}
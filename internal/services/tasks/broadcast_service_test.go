@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestBroadcastStatus(t *testing.T) {
+	cases := []struct {
+		run         models.BroadcastRun
+		wantStatus  string
+		wantSummary string
+	}{
+		{models.BroadcastRun{Total: 3, Success: 3}, constant.TaskStatusSuccess, "全部成功 (3)"},
+		{models.BroadcastRun{Total: 5, Success: 3, Failed: 2}, constant.TaskStatusFailed, "2 个失败，共 5 个"},
+		{models.BroadcastRun{Total: 5, Success: 2, Failed: 1, Cancelled: 2}, constant.TaskStatusFailed, "1 个失败，2 个取消，共 5 个"},
+		{models.BroadcastRun{Total: 4, Success: 1, Cancelled: 3}, constant.TaskStatusCancelled, "3 个取消，共 4 个"},
+	}
+	for _, c := range cases {
+		run := c.run
+		run.Status = broadcastStatus(&run)
+		if run.Status != c.wantStatus {
+			t.Errorf("%+v status = %s, want %s", c.run, run.Status, c.wantStatus)
+		}
+		if got := run.Summary(); got != c.wantSummary {
+			t.Errorf("%+v summary = %q, want %q", c.run, got, c.wantSummary)
+		}
+	}
+
+	running := models.BroadcastRun{Status: constant.TaskStatusRunning, Total: 4, Success: 1, Failed: 1}
+	if got := running.Summary(); got != "运行中 2/4" {
+		t.Errorf("running summary = %q", got)
+	}
+}
+
+func TestClaimBroadcastStart(t *testing.T) {
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	releases := make(chan func(), 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, ok := claimBroadcastStart("t1"); ok {
+				claimed.Add(1)
+				releases <- release
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Fatalf("同一任务的并发请求应只有一个通过, got %d", claimed.Load())
+	}
+	if _, ok := claimBroadcastStart("t2"); !ok {
+		t.Error("不同任务之间不应互相阻塞")
+	}
+
+	(<-releases)()
+	if _, ok := claimBroadcastStart("t1"); !ok {
+		t.Error("释放后应可再次创建")
+	}
+}
@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/engigu/baihu-panel/internal/agentcrypto"
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
 	"github.com/engigu/baihu-panel/internal/eventbus"
@@ -28,6 +30,8 @@ type AgentWSManager interface {
 	UnregisterRemoteWaiter(logID string)
 	SendToAgent(agentID string, msgType string, data interface{}) error
 	IsAgentOnline(agentID string) bool
+	GetAgentLoad(agentID string) (models.AgentLoad, bool)
+	SupportsCapability(agentID, capability string) bool
 }
 
 // SettingsService 接口定义（避免循环依赖）
@@ -49,6 +53,7 @@ type ExecutorService struct {
 	agentWSManager  AgentWSManager
 	settingsService SettingsService
 	envService      EnvService
+	agentRouter     *AgentRouter
 	scheduler       *executor.Scheduler
 	cronManager     *executor.CronManager
 	results         []executor.ExecutionResult
@@ -77,6 +82,7 @@ func NewExecutorService(
 		agentWSManager:  agentWSManager,
 		settingsService: settingsService,
 		envService:      envService,
+		agentRouter:     NewAgentRouter(agentWSManager),
 		results:         make([]executor.ExecutionResult, 0, 100),
 		stopCh:          make(chan struct{}),
 	}
@@ -158,8 +164,8 @@ func (h *ServerSchedulerHandler) OnTaskExecuting(req *executor.ExecutionRequest)
 		return nil, nil, nil
 	}
 
-	// 1. 使用预先准备好的脱敏指令创建初始日志记录
-	taskLog, err := h.es.taskLogService.CreateEmptyLog(task.ID, req.MaskedCommand)
+	// 1. 使用预先准备好的脱敏指令创建初始日志记录，触发时已预留日志 ID 的沿用该 ID
+	taskLog, err := h.es.taskLogService.CreateEmptyLog(req.LogID, task.ID, req.MaskedCommand)
 	if err != nil {
 		return nil, nil, fmt.Errorf("创建初始日志失败: %v", err)
 	}
@@ -204,11 +210,19 @@ func (h *ServerSchedulerHandler) OnTaskExecuting(req *executor.ExecutionRequest)
 	})
 
 	if req.Metadata.RetryIndex > 0 {
-		tl.Write([]byte(fmt.Sprintf("\n[System] 此为任务失败后的第 %d 次重试执行...\n\n", req.Metadata.RetryIndex)))
+		tl.Stream(LogStreamSystem).Write([]byte(fmt.Sprintf("\n[System] 此为任务失败后的第 %d 次重试执行...\n\n", req.Metadata.RetryIndex)))
 	}
 
 	// 对于本地任务，Scheduler 会通过返回的 Writer 写入日志
 	// 对于远程任务，Scheduler 不会写入任何内容（由 Agent 推送至此 TL）
+	var config models.TaskConfig
+	if task.Config != "" {
+		_ = json.Unmarshal([]byte(task.Config), &config)
+	}
+	if config.SplitStreams {
+		// stdout 与 stderr 使用不同的 Writer 时执行器以管道方式运行，便于区分输出流
+		return tl.Stream(LogStreamStdout), tl.Stream(LogStreamStderr), nil
+	}
 	return tl, tl, nil
 }
 
@@ -242,7 +256,7 @@ func (h *ServerSchedulerHandler) OnTaskCompleted(req *executor.ExecutionRequest,
 
 	// 无论本地还是远程，都在此处处理日志压缩和落库
 	tl := GetActiveLog(req.LogID)
-	var output string
+	var output, lineMeta string
 	if tl != nil {
 		// 压缩并清理实时日志
 		var err error
@@ -250,6 +264,8 @@ func (h *ServerSchedulerHandler) OnTaskCompleted(req *executor.ExecutionRequest,
 		if err != nil {
 			logger.Errorf("[Executor] 压缩任务 #%s 日志失败: %v", task.ID, err)
 			output = "[System Error] 日志处理失败: " + err.Error()
+		} else {
+			lineMeta = tl.LineMeta()
 		}
 	} else {
 		// 如果 TinyLog 已经丢失，尝试从 result.Output 中恢复一次（主要针对本地任务）
@@ -265,6 +281,7 @@ func (h *ServerSchedulerHandler) OnTaskCompleted(req *executor.ExecutionRequest,
 		TaskID:    task.ID,
 		Command:   models.BigText(req.MaskedCommand),
 		Output:    models.BigText(output),
+		LineMeta:  models.BigText(lineMeta),
 		Error:     models.BigText(result.Error),
 		Status:    result.Status,
 		Duration:  result.Duration,
@@ -273,12 +290,14 @@ func (h *ServerSchedulerHandler) OnTaskCompleted(req *executor.ExecutionRequest,
 		EndTime:   &endTime,
 	}
 
-	// 如果有 AgentID，也记录下来
-	if task.AgentID != nil && *task.AgentID != "" {
-		agentID := *task.AgentID
-		taskLog.AgentID = &agentID
+	if result.Usage != nil {
+		taskLog.ResourceUsage = *result.Usage
 	}
 
+	// 如果有 AgentID，也记录下来
+	taskLog.AgentID = executionAgentID(task, req)
+	taskLog.Failover = req.Metadata.Failover
+
 	// 移除运行记录
 	if req.Metadata.GoID != 0 {
 		h.es.RemoveRunningGo(task.ID, req.Metadata.GoID)
@@ -337,36 +356,51 @@ func (h *ServerSchedulerHandler) OnTaskFailed(req *executor.ExecutionRequest, er
 		h.es.RemoveRunningGo(taskID, req.Metadata.GoID)
 	}
 
+	status := constant.TaskStatusFailed
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = constant.TaskStatusTimeout
+	}
+
+	// 以初始日志的开始时间计算耗时，未找到时视为刚开始
+	now := models.LocalTime(time.Now())
+	startTime := now
+	var existing models.TaskLog
+	if res := database.DB.Select("id, start_time").Where("id = ?", req.LogID).Limit(1).Find(&existing); res.Error == nil && existing.StartTime != nil {
+		startTime = *existing.StartTime
+	}
+	duration := time.Time(now).Sub(startTime.Time()).Milliseconds()
+
 	// 构造错误日志
 	tl := GetActiveLog(req.LogID)
-	var output string
+	var output, lineMeta string
 	if tl != nil {
-		tl.Write([]byte(fmt.Sprintf("\n[System Error] %v", err)))
+		tl.Stream(LogStreamSystem).Write([]byte(fmt.Sprintf("\n[System Error] %v", err)))
 		output, _ = tl.CompressAndCleanup()
+		lineMeta = tl.LineMeta()
 	} else {
 		output, _ = utils.CompressToBase64(fmt.Sprintf("任务执行失败: %v", err))
 	}
 
-	now := models.LocalTime(time.Now())
 	taskLog := &models.TaskLog{
 		ID:        req.LogID,
 		TaskID:    taskID,
 		Command:   models.BigText(req.MaskedCommand),
 		Output:    models.BigText(output),
+		LineMeta:  models.BigText(lineMeta),
 		Error:     models.BigText(err.Error()),
-		Status:    constant.TaskStatusFailed,
-		Duration:  0,
+		Status:    status,
+		Duration:  duration,
 		ExitCode:  1,
-		StartTime: &now,
+		StartTime: &startTime,
 		EndTime:   &now,
 	}
 
 	// 补充 AgentID
 	task := h.es.taskService.GetTaskByID(taskID)
-	if task != nil && task.AgentID != nil && *task.AgentID != "" {
-		agentID := *task.AgentID
-		taskLog.AgentID = &agentID
+	if task != nil {
+		taskLog.AgentID = executionAgentID(task, req)
 	}
+	taskLog.Failover = req.Metadata.Failover
 
 	h.es.taskLogService.ProcessTaskCompletion(taskLog)
 
@@ -374,14 +408,15 @@ func (h *ServerSchedulerHandler) OnTaskFailed(req *executor.ExecutionRequest, er
 	h.es.UpdateResult(executor.ExecutionResult{
 		TaskID:    req.TaskID,
 		LogID:     req.LogID,
-		Status:    constant.TaskStatusFailed,
+		Status:    status,
 		Error:     err.Error(),
-		StartTime: time.Now(),
-		EndTime:   time.Now(),
+		Duration:  duration,
+		StartTime: startTime.Time(),
+		EndTime:   time.Time(now),
 	})
 
 	// ======= 重试逻辑 =======
-	h.es.HandleTaskRetry(task, req, false, constant.TaskStatusFailed, 1)
+	h.es.HandleTaskRetry(task, req, false, status, 1)
 
 	// ======= 通知触发 =======
 	// ======= 通知触发 =======
@@ -390,14 +425,21 @@ func (h *ServerSchedulerHandler) OnTaskFailed(req *executor.ExecutionRequest, er
 		if task != nil {
 			taskName = task.Name
 		}
+		eventType := constant.EventTaskFailed
+		if status == constant.TaskStatusTimeout {
+			eventType = constant.EventTaskTimeout
+		}
 		eventbus.DefaultBus.Publish(eventbus.Event{
-			Type: constant.EventTaskFailed,
+			Type: eventType,
 			Payload: map[string]interface{}{
-				"log_id":    req.LogID,
-				"task_id":   taskID,
-				"task_name": taskName,
-				"error":     err.Error(),
-				"output":    output,
+				"log_id":     req.LogID,
+				"task_id":    taskID,
+				"task_name":  taskName,
+				"status":     status,
+				"start_time": startTime.Time().Format("2006-01-02 15:04:05"),
+				"duration":   duration,
+				"error":      err.Error(),
+				"output":     output,
 			},
 		})
 	}()
@@ -491,11 +533,20 @@ func (es *ExecutorService) ExecuteDispatcher(ctx context.Context, req *executor.
 
 	// 远程任务
 	if task.AgentID != nil && *task.AgentID != "" {
-		// 将请求中已包含的环境变量（已合并）传递给 Agent
-		return es.ExecuteRemoteForScheduler(ctx, task, req.LogID, executor.FormatEnvVars(req.Envs), req.Secrets)
+		return es.ExecuteRemoteForScheduler(ctx, req, task, stdout, stderr)
+	}
+
+	// 按标签选择器路由的远程任务
+	if task.UsesAgentSelector() {
+		return es.ExecuteSelectorForScheduler(ctx, req, task)
 	}
 
 	// 本地任务
+	return es.executeLocal(ctx, req, task, stdout, stderr)
+}
+
+// executeLocal 在面板本机执行任务
+func (es *ExecutorService) executeLocal(ctx context.Context, req *executor.ExecutionRequest, task *models.Task, stdout, stderr io.Writer) (*executor.Result, error) {
 	hooks := &LocalTaskHooks{es: es, logID: req.LogID}
 	return executor.ExecuteWithHooks(ctx, executor.Request{
 		Command:     req.Command,
@@ -556,6 +607,7 @@ func (es *ExecutorService) AddCronTask(task *models.Task) error {
 // RemoveCronTask 移除计划任务
 func (es *ExecutorService) RemoveCronTask(taskID string) {
 	es.cronManager.RemoveTask(taskID)
+	es.agentRouter.Forget(taskID)
 }
 
 // ValidateCron 验证 Cron 表达式
@@ -745,10 +797,13 @@ func (es *ExecutorService) ExecuteTask(taskID string, extraEnvs []string) *execu
 	}
 
 	req := es.CreateExecutionRequest(task, executor.TaskTypeManual, extraEnvs)
+	// 预留日志 ID，任务出队后以此创建日志，调用方可据此跟踪本次执行
+	req.LogID = utils.GenerateID()
 	es.scheduler.EnqueueOrExecute(req)
 
 	return &executor.ExecutionResult{
 		TaskID:    task.ID,
+		LogID:     req.LogID,
 		Success:   true,
 		Status:    constant.TaskStatusQueued,
 		StartTime: time.Now(),
@@ -805,15 +860,19 @@ func (es *ExecutorService) StopTaskExecution(logID string) error {
 		return fmt.Errorf("停止失败：关联的任务信息已丢失")
 	}
 
-	// 2. 远程任务逻辑
-	if task.AgentID != nil && *task.AgentID != "" {
+	// 2. 远程任务逻辑（选择器任务以日志中记录的实际执行 Agent 为准）
+	agentID := task.AgentID
+	if taskLog.AgentID != nil && *taskLog.AgentID != "" {
+		agentID = taskLog.AgentID
+	}
+	if agentID != nil && *agentID != "" {
 		// 校验 Agent 是否在线
-		if !es.agentWSManager.IsAgentOnline(*task.AgentID) {
-			return fmt.Errorf("停止失败：目标 Agent (%s) 当前离线，无法下发指令", *task.AgentID)
+		if !es.agentWSManager.IsAgentOnline(*agentID) {
+			return fmt.Errorf("停止失败：目标 Agent (%s) 当前离线，无法下发指令", *agentID)
 		}
 
-		logger.Infof("[Executor] 请求停止远程任务 #%s (Agent #%s, LogID: %s)", task.ID, *task.AgentID, logID)
-		err := es.agentWSManager.SendToAgent(*task.AgentID, constant.WSTypeStop, map[string]interface{}{
+		logger.Infof("[Executor] 请求停止远程任务 #%s (Agent #%s, LogID: %s)", task.ID, *agentID, logID)
+		err := es.agentWSManager.SendToAgent(*agentID, constant.WSTypeStop, map[string]interface{}{
 			"log_id": logID,
 		})
 		if err != nil {
@@ -1069,8 +1128,99 @@ func (es *ExecutorService) RemoveRunningGo(taskID string, goid int64) {
 }
 
 // ExecuteRemoteForScheduler 供 Scheduler 调用，执行远程任务并等待结果
-func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *models.Task, logID string, envs string, secrets []string) (*executor.Result, error) {
-	agentID := *task.AgentID
+// 指定的 Agent 不可用且任务配置了故障转移时，按故障转移链改由其他目标执行
+func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, req *executor.ExecutionRequest, task *models.Task, stdout, stderr io.Writer) (*executor.Result, error) {
+	if len(task.Failover) > 0 {
+		if reason := es.agentUnavailable(*task.AgentID); reason != "" {
+			return es.executeFailover(ctx, req, task, reason, stdout, stderr)
+		}
+	}
+	// 将请求中已包含的环境变量（已合并）传递给 Agent
+	result, err := es.executeOnAgent(ctx, task, *task.AgentID, req.LogID, executor.FormatEnvVars(req.Envs), req.Secrets)
+	// 只有指令未送达时才转移；已送达的执行即使 Agent 随后离线也不再转移，避免同一次运行执行两次
+	if len(task.Failover) > 0 && errors.Is(err, errAgentDispatch) {
+		return es.executeFailover(ctx, req, task, err.Error(), stdout, stderr)
+	}
+	return result, err
+}
+
+var (
+	// errAgentDispatch 执行指令未能送达 Agent，Agent 不会执行本次运行，可以安全地改由其他目标执行
+	errAgentDispatch = errors.New("执行指令未送达 Agent")
+	// errAgentOffline Agent 收到指令后在返回结果前离线，任务可能仍在执行，结果在重连后按原日志 ID 补传
+	errAgentOffline = errors.New("Agent 离线")
+)
+
+// agentOfflineCheckInterval 等待 Agent 结果时检查在线状态的间隔
+var agentOfflineCheckInterval = 3 * time.Second
+
+// executionAgentID 本次执行实际所在的 Agent，本机执行返回 nil
+// 按选择器派发或故障转移时以派发时记录的目标为准
+func executionAgentID(task *models.Task, req *executor.ExecutionRequest) *string {
+	if req.Metadata.AgentID != "" {
+		agentID := req.Metadata.AgentID
+		return &agentID
+	}
+	if req.Metadata.Failover != "" {
+		return nil
+	}
+	if task.AgentID != nil && *task.AgentID != "" {
+		agentID := *task.AgentID
+		return &agentID
+	}
+	return nil
+}
+
+// ExecuteSelectorForScheduler 供 Scheduler 调用，按标签选择器挑选在线 Agent 执行
+// 候选 Agent 按任务的选择策略排序，执行指令未能送达所选 Agent 时回退到下一个候选
+func (es *ExecutorService) ExecuteSelectorForScheduler(ctx context.Context, req *executor.ExecutionRequest, task *models.Task) (*executor.Result, error) {
+	if es.agentWSManager == nil {
+		return nil, fmt.Errorf("AgentWSManager 未初始化")
+	}
+	candidates, err := es.agentRouter.Candidates(task)
+	if err != nil {
+		return nil, fmt.Errorf("Agent 选择器 [%s] 无效: %v", task.AgentSelector, err)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("没有匹配选择器 [%s] 的在线 Agent", task.AgentSelector)
+	}
+
+	envs := executor.FormatEnvVars(req.Envs)
+	tl := GetActiveLog(req.LogID)
+	var result *executor.Result
+	for _, candidate := range candidates {
+		if !es.agentWSManager.IsAgentOnline(candidate.ID) {
+			continue
+		}
+
+		req.Metadata.AgentID = candidate.ID
+		if err := es.taskLogService.SetLogAgent(req.LogID, candidate.ID); err != nil {
+			logger.Warnf("[Executor] 记录任务 #%s 的执行 Agent 失败: %v", task.ID, err)
+		}
+		if tl != nil {
+			tl.Stream(LogStreamSystem).Write([]byte(fmt.Sprintf("[System] 按选择器 [%s] 分配到 Agent #%s (%s)\n", task.AgentSelector, candidate.ID, candidate.Name)))
+		}
+
+		release := es.agentRouter.Acquire(candidate.ID)
+		result, err = es.executeOnAgent(ctx, task, candidate.ID, req.LogID, envs, req.Secrets)
+		release()
+		if !errors.Is(err, errAgentDispatch) {
+			return result, err
+		}
+
+		logger.Warnf("[Executor] 任务 #%s 的执行指令未送达 Agent #%s，尝试下一个候选 Agent", task.ID, candidate.ID)
+		if tl != nil {
+			tl.Stream(LogStreamSystem).Write([]byte(fmt.Sprintf("\n[System] 执行指令未送达 Agent #%s，尝试下一个候选 Agent\n", candidate.ID)))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("没有匹配选择器 [%s] 的在线 Agent", task.AgentSelector)
+}
+
+// executeOnAgent 向指定 Agent 下发任务并等待结果
+func (es *ExecutorService) executeOnAgent(ctx context.Context, task *models.Task, agentID string, logID string, envs string, secrets []string) (*executor.Result, error) {
 	logger.Infof("[Executor] 远程执行任务 #%s: %s (Agent #%s, LogID: %s)", task.ID, task.Name, agentID, logID)
 
 	// 1. 检查 Agent 状态
@@ -1082,9 +1232,24 @@ func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *
 	if !utils.DerefBool(agent.Enabled, true) {
 		return nil, fmt.Errorf("Agent #%s 已禁用", agentID)
 	}
+	if !agent.Approved() {
+		return nil, fmt.Errorf("Agent #%s 尚未通过注册审批", agentID)
+	}
 	if es.agentWSManager == nil {
 		return nil, fmt.Errorf("AgentWSManager 未初始化")
 	}
+	// 本次执行的 SDK 转发凭证，结果返回或超时后即失效
+	sdkToken := IssueSDKGrant(agentID, task.ID, logID)
+	defer RevokeSDKGrant(sdkToken)
+
+	// Agent 上报了公钥时变量、机密与 SDK 凭证加密下发
+	if agent.PublicKey != "" {
+		sealed, err := agentcrypto.EncryptValues(agent.PublicKey, append([]string{envs, sdkToken}, secrets...))
+		if err != nil {
+			return nil, fmt.Errorf("加密下发给 Agent #%s 的变量失败: %v", agentID, err)
+		}
+		envs, sdkToken, secrets = sealed[0], sealed[1], sealed[2:]
+	}
 
 	// 2. 注册结果等待者
 	resultChan := es.agentWSManager.RegisterRemoteWaiter(logID)
@@ -1099,9 +1264,11 @@ func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *
 		"command":      task.Command,
 		"pre_command":  task.PreCommand,
 		"post_command": task.PostCommand,
+		"task":         agentTaskDefinition(task),
+		"sdk_token":    sdkToken,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("发送执行命令失败: %v", err)
+		return nil, fmt.Errorf("%w: Agent #%s %v", errAgentDispatch, agentID, err)
 	}
 
 	// 4. 等待结果或超时
@@ -1114,7 +1281,7 @@ func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *
 		timeoutChan = time.After(time.Duration(timeout) * time.Minute)
 	}
 
-	ticker := time.NewTicker(3 * time.Second)
+	ticker := time.NewTicker(agentOfflineCheckInterval)
 	defer ticker.Stop()
 
 	for {
@@ -1128,6 +1295,7 @@ func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *
 				ExitCode:  agentResult.ExitCode,
 				StartTime: time.Unix(agentResult.StartTime, 0),
 				EndTime:   time.Unix(agentResult.EndTime, 0),
+				Usage:     agentResult.Usage,
 			}, nil
 
 		case <-timeoutChan:
@@ -1162,17 +1330,34 @@ func (es *ExecutorService) ExecuteRemoteForScheduler(ctx context.Context, task *
 				end := time.Now()
 				return &executor.Result{
 					Status:    constant.TaskStatusFailed,
-					Error:     "Agent 离线，任务被迫终止",
+					Error:     "Agent 离线，任务可能仍在 Agent 上执行，结果将在 Agent 重连后补传",
 					Duration:  end.Sub(start).Milliseconds(),
 					ExitCode:  -1,
 					StartTime: start,
 					EndTime:   end,
-				}, fmt.Errorf("Agent 离线")
+				}, errAgentOffline
 			}
 		}
 	}
 }
 
+// agentTaskDefinition 随执行指令下发的任务定义
+// 选择器任务与广播运行的任务不在目标 Agent 的任务列表中，Agent 依据此定义执行
+func agentTaskDefinition(task *models.Task) *models.AgentTask {
+	return &models.AgentTask{
+		ID:          task.ID,
+		Name:        task.Name,
+		Command:     string(task.Command),
+		PreCommand:  string(task.PreCommand),
+		PostCommand: string(task.PostCommand),
+		Timeout:     task.Timeout,
+		WorkDir:     task.WorkDir,
+		Languages:   []map[string]string(task.Languages),
+		Enabled:     true,
+		SyncFiles:   task.SyncFileList(),
+	}
+}
+
 // HandleAgentResult 处理来自 Agent 的异步结果
 func (es *ExecutorService) HandleAgentResult(result *models.AgentTaskResult) error {
 	// 加载机密以进行脱敏处理
@@ -0,0 +1,192 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+const (
+	maxFailoverTargets     = 10      // 故障转移链的最大长度
+	maxFailoverWaitMinutes = 24 * 60 // 单个等待目标的最长等待时间
+)
+
+// failoverPollInterval 等待原 Agent 恢复时检查在线状态的间隔
+var failoverPollInterval = 3 * time.Second
+
+// NormalizeFailover 校验故障转移链，只有固定在某个 Agent 上执行的任务才使用，其余任务一并清空
+func NormalizeFailover(agentID *string, chain models.TaskFailover) (models.TaskFailover, error) {
+	if agentID == nil || *agentID == "" || len(chain) == 0 {
+		return nil, nil
+	}
+	if len(chain) > maxFailoverTargets {
+		return nil, fmt.Errorf("故障转移目标最多 %d 个", maxFailoverTargets)
+	}
+
+	seen := map[string]bool{*agentID: true}
+	hasLocal := false
+	result := make(models.TaskFailover, 0, len(chain))
+	for _, target := range chain {
+		switch target.Type {
+		case constant.FailoverTargetAgent:
+			if target.AgentID == "" {
+				return nil, fmt.Errorf("备用 Agent 不能为空")
+			}
+			if seen[target.AgentID] {
+				return nil, fmt.Errorf("故障转移目标中 Agent #%s 重复", target.AgentID)
+			}
+			var count int64
+			database.DB.Model(&models.Agent{}).Where("id = ?", target.AgentID).Count(&count)
+			if count == 0 {
+				return nil, fmt.Errorf("Agent #%s 不存在", target.AgentID)
+			}
+			seen[target.AgentID] = true
+			result = append(result, models.FailoverTarget{Type: target.Type, AgentID: target.AgentID})
+		case constant.FailoverTargetLocal:
+			if hasLocal {
+				return nil, fmt.Errorf("故障转移目标中本机重复")
+			}
+			hasLocal = true
+			result = append(result, models.FailoverTarget{Type: target.Type})
+		case constant.FailoverTargetWait:
+			if target.Minutes < 1 || target.Minutes > maxFailoverWaitMinutes {
+				return nil, fmt.Errorf("等待时间须在 1 到 %d 分钟之间", maxFailoverWaitMinutes)
+			}
+			result = append(result, models.FailoverTarget{Type: target.Type, Minutes: target.Minutes})
+		default:
+			return nil, fmt.Errorf("不支持的故障转移目标: %s", target.Type)
+		}
+	}
+	return result, nil
+}
+
+// agentUnavailable 返回 Agent 当前无法接收任务的原因，可用时为空
+func (es *ExecutorService) agentUnavailable(agentID string) string {
+	var agent models.Agent
+	res := database.DB.Select("id, enabled, approval").Where("id = ?", agentID).Limit(1).Find(&agent)
+	switch {
+	case res.Error != nil || res.RowsAffected == 0:
+		return fmt.Sprintf("Agent #%s 不存在", agentID)
+	case !utils.DerefBool(agent.Enabled, true):
+		return fmt.Sprintf("Agent #%s 已禁用", agentID)
+	case !agent.Approved():
+		return fmt.Sprintf("Agent #%s 尚未通过注册审批", agentID)
+	case es.agentWSManager == nil || !es.agentWSManager.IsAgentOnline(agentID):
+		return fmt.Sprintf("Agent #%s 离线", agentID)
+	}
+	return ""
+}
+
+// waitAgent 等待 Agent 恢复可用，返回是否恢复及等待时长；任务被取消时返回错误
+func (es *ExecutorService) waitAgent(ctx context.Context, agentID string, limit time.Duration) (bool, time.Duration, error) {
+	start := time.Now()
+	deadline := time.NewTimer(limit)
+	defer deadline.Stop()
+	ticker := time.NewTicker(failoverPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, time.Since(start), fmt.Errorf("等待 Agent #%s 恢复时任务被取消", agentID)
+		case <-deadline.C:
+			return false, time.Since(start), nil
+		case <-ticker.C:
+			if es.agentUnavailable(agentID) == "" {
+				return true, time.Since(start), nil
+			}
+		}
+	}
+}
+
+// executeFailover 任务指定的 Agent 不可用或执行指令未送达时按故障转移链依次尝试
+// 指令送达后 Agent 离线的执行不会转移，以免同一次运行在两处执行
+// 实际执行的目标与转移原因记录在日志上，本机执行时日志的 AgentID 为空
+func (es *ExecutorService) executeFailover(ctx context.Context, req *executor.ExecutionRequest, task *models.Task, reason string, stdout, stderr io.Writer) (*executor.Result, error) {
+	primary := *task.AgentID
+	envs := executor.FormatEnvVars(req.Envs)
+	tl := GetActiveLog(req.LogID)
+	notify := func(msg string) {
+		logger.Warnf("[Executor] 任务 #%s %s", task.ID, msg)
+		if tl != nil {
+			tl.Stream(LogStreamSystem).Write([]byte("[System] " + msg + "\n"))
+		}
+	}
+
+	reasons := []string{reason}
+	for _, target := range task.Failover {
+		switch target.Type {
+		case constant.FailoverTargetWait:
+			notify(fmt.Sprintf("%s，等待恢复（最多 %d 分钟）", strings.Join(reasons, "；"), target.Minutes))
+			ok, waited, err := es.waitAgent(ctx, primary, time.Duration(target.Minutes)*time.Minute)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				reasons = append(reasons, fmt.Sprintf("等待 %d 分钟后 Agent #%s 仍不可用", target.Minutes, primary))
+				continue
+			}
+			failover := fmt.Sprintf("%s，等待 %s 后恢复", strings.Join(reasons, "；"), waited.Round(time.Second))
+			notify(failover)
+			es.recordFailover(req, primary, failover)
+			result, err := es.executeOnAgent(ctx, task, primary, req.LogID, envs, req.Secrets)
+			if errors.Is(err, errAgentDispatch) {
+				reasons = append(reasons, err.Error())
+				continue
+			}
+			return result, err
+
+		case constant.FailoverTargetAgent:
+			if r := es.agentUnavailable(target.AgentID); r != "" {
+				reasons = append(reasons, r)
+				continue
+			}
+			// 备用 Agent 的任务列表中没有该任务，需随指令下发任务定义
+			if !es.agentWSManager.SupportsCapability(target.AgentID, constant.AgentCapInlineTask) {
+				reasons = append(reasons, fmt.Sprintf("Agent #%s 版本过旧，无法接管其他 Agent 的任务", target.AgentID))
+				continue
+			}
+			failover := fmt.Sprintf("%s，转由 Agent #%s 执行", strings.Join(reasons, "；"), target.AgentID)
+			notify(failover)
+			es.recordFailover(req, target.AgentID, failover)
+			result, err := es.executeOnAgent(ctx, task, target.AgentID, req.LogID, envs, req.Secrets)
+			if errors.Is(err, errAgentDispatch) {
+				reasons = append(reasons, err.Error())
+				continue
+			}
+			return result, err
+
+		case constant.FailoverTargetLocal:
+			failover := fmt.Sprintf("%s，转由面板本机执行", strings.Join(reasons, "；"))
+			notify(failover)
+			es.recordFailover(req, "", failover)
+			// Agent 上的工作目录在本机不一定存在，此时改用脚本目录
+			if _, err := os.Stat(req.WorkDir); req.WorkDir != "" && err != nil {
+				req.WorkDir, _ = filepath.Abs(constant.ScriptsWorkDir)
+			}
+			return es.executeLocal(ctx, req, task, stdout, stderr)
+		}
+	}
+	return nil, fmt.Errorf("%s，故障转移目标均不可用", strings.Join(reasons, "；"))
+}
+
+// recordFailover 记录本次执行实际所在的目标与故障转移原因，agentID 为空表示本机
+func (es *ExecutorService) recordFailover(req *executor.ExecutionRequest, agentID, reason string) {
+	req.Metadata.AgentID = agentID
+	req.Metadata.Failover = reason
+	if err := es.taskLogService.SetLogFailover(req.LogID, agentID, reason); err != nil {
+		logger.Warnf("[Executor] 记录日志 #%s 的故障转移失败: %v", req.LogID, err)
+	}
+}
@@ -0,0 +1,235 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/executor"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+// fakeAgentWS 模拟 Agent 连接，收到执行指令的 Agent 立即返回成功
+type fakeAgentWS struct {
+	mu      sync.Mutex
+	online  map[string]bool
+	waiters map[string]chan *models.AgentTaskResult
+	sent    []string        // 收到执行指令的 Agent
+	dropped map[string]bool // 执行指令发送失败的 Agent
+	silent  map[string]bool // 收到指令后不返回结果的 Agent
+}
+
+func (f *fakeAgentWS) setOnline(agentID string, online bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.online[agentID] = online
+}
+
+func (f *fakeAgentWS) RegisterRemoteWaiter(logID string) chan *models.AgentTaskResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan *models.AgentTaskResult, 1)
+	f.waiters[logID] = ch
+	return ch
+}
+
+func (f *fakeAgentWS) UnregisterRemoteWaiter(logID string) {}
+
+func (f *fakeAgentWS) SendToAgent(agentID string, msgType string, data interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if msgType == constant.WSTypeExecute {
+		if f.dropped[agentID] {
+			return errors.New("连接已断开")
+		}
+		f.sent = append(f.sent, agentID)
+		if f.silent[agentID] {
+			return nil
+		}
+		logID := data.(map[string]interface{})["log_id"].(string)
+		f.waiters[logID] <- &models.AgentTaskResult{LogID: logID, AgentID: agentID, Status: constant.TaskStatusSuccess}
+	}
+	return nil
+}
+
+func (f *fakeAgentWS) IsAgentOnline(agentID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.online[agentID]
+}
+
+func (f *fakeAgentWS) GetAgentLoad(agentID string) (models.AgentLoad, bool) {
+	return models.AgentLoad{}, false
+}
+
+func (f *fakeAgentWS) SupportsCapability(agentID, capability string) bool {
+	return true
+}
+
+func setupFailoverTest(t *testing.T) (*ExecutorService, *fakeAgentWS) {
+	setupTestDB(t, &models.Agent{}, &models.TaskLog{})
+	db := database.DB
+	for _, id := range []string{"a1", "a2", "a3"} {
+		db.Create(&models.Agent{ID: id, Name: id, Token: id, MachineID: "m-" + id})
+	}
+
+	ws := &fakeAgentWS{online: map[string]bool{}, waiters: map[string]chan *models.AgentTaskResult{}, dropped: map[string]bool{}, silent: map[string]bool{}}
+	return &ExecutorService{agentWSManager: ws, taskLogService: &TaskLogService{}}, ws
+}
+
+func runFailover(t *testing.T, es *ExecutorService, task *models.Task) (*executor.ExecutionRequest, *models.TaskLog, error) {
+	t.Helper()
+	logID := "log-" + task.ID
+	database.DB.Create(&models.TaskLog{ID: logID, TaskID: task.ID, Status: constant.TaskStatusRunning})
+	req := &executor.ExecutionRequest{TaskID: task.ID, LogID: logID, Command: "echo failover"}
+	_, err := es.ExecuteRemoteForScheduler(context.Background(), req, task, nil, nil)
+
+	var log models.TaskLog
+	database.DB.Where("id = ?", logID).First(&log)
+	return req, &log, err
+}
+
+func TestNormalizeFailover(t *testing.T) {
+	setupFailoverTest(t)
+	primary := "a1"
+
+	if chain, _ := NormalizeFailover(nil, models.TaskFailover{{Type: constant.FailoverTargetLocal}}); chain != nil {
+		t.Error("未指定 Agent 的任务不使用故障转移")
+	}
+	chain, err := NormalizeFailover(&primary, models.TaskFailover{
+		{Type: constant.FailoverTargetWait, Minutes: 5, AgentID: "ignored"},
+		{Type: constant.FailoverTargetAgent, AgentID: "a2"},
+		{Type: constant.FailoverTargetLocal},
+	})
+	if err != nil || len(chain) != 3 || chain[0].AgentID != "" {
+		t.Fatalf("合法的故障转移链被拒绝: %v %+v", err, chain)
+	}
+
+	invalid := []models.TaskFailover{
+		{{Type: constant.FailoverTargetAgent, AgentID: "a1"}},
+		{{Type: constant.FailoverTargetAgent, AgentID: "missing"}},
+		{{Type: constant.FailoverTargetAgent}},
+		{{Type: constant.FailoverTargetLocal}, {Type: constant.FailoverTargetLocal}},
+		{{Type: constant.FailoverTargetWait}},
+		{{Type: "broadcast"}},
+	}
+	for _, c := range invalid {
+		if _, err := NormalizeFailover(&primary, c); err == nil {
+			t.Errorf("应拒绝故障转移链 %+v", c)
+		}
+	}
+}
+
+func TestFailoverToBackupAgent(t *testing.T) {
+	es, ws := setupFailoverTest(t)
+	primary := "a1"
+	task := &models.Task{ID: "t1", AgentID: &primary, Failover: models.TaskFailover{
+		{Type: constant.FailoverTargetAgent, AgentID: "a2"},
+		{Type: constant.FailoverTargetAgent, AgentID: "a3"},
+		{Type: constant.FailoverTargetLocal},
+	}}
+
+	// 原 Agent 在线时不触发故障转移
+	ws.setOnline("a1", true)
+	if req, _, err := runFailover(t, es, task); err != nil || req.Metadata.Failover != "" || ws.sent[0] != "a1" {
+		t.Fatalf("原 Agent 在线时应直接执行: %v %+v %v", err, req.Metadata, ws.sent)
+	}
+
+	// 原 Agent 与第一个备用 Agent 离线，由第二个备用 Agent 执行
+	ws.setOnline("a1", false)
+	ws.setOnline("a3", true)
+	task.ID = "t2"
+	req, log, err := runFailover(t, es, task)
+	if err != nil {
+		t.Fatalf("故障转移执行失败: %v", err)
+	}
+	if ws.sent[len(ws.sent)-1] != "a3" || log.AgentID == nil || *log.AgentID != "a3" {
+		t.Fatalf("应由 Agent a3 执行: %v %v", ws.sent, log.AgentID)
+	}
+	if !strings.Contains(log.Failover, "Agent #a1 离线") || !strings.Contains(log.Failover, "Agent #a2 离线") {
+		t.Errorf("未记录故障转移原因: %s", log.Failover)
+	}
+	if got := executionAgentID(task, req); got == nil || *got != "a3" {
+		t.Errorf("完成时记录的执行 Agent 不正确: %v", got)
+	}
+}
+
+func TestFailoverToLocal(t *testing.T) {
+	es, _ := setupFailoverTest(t)
+	t.Chdir(t.TempDir())
+	primary := "a1"
+	task := &models.Task{ID: "t3", AgentID: &primary, Failover: models.TaskFailover{{Type: constant.FailoverTargetLocal}}}
+
+	req, log, err := runFailover(t, es, task)
+	if err != nil {
+		t.Fatalf("本机执行失败: %v", err)
+	}
+	if log.AgentID != nil || !strings.Contains(log.Failover, "本机") {
+		t.Errorf("本机执行时日志应不带 Agent 并记录原因: %v %s", log.AgentID, log.Failover)
+	}
+	if executionAgentID(task, req) != nil {
+		t.Error("本机执行时完成记录不应带 Agent")
+	}
+}
+
+func TestFailoverWaitForAgent(t *testing.T) {
+	es, ws := setupFailoverTest(t)
+	defer func(d time.Duration) { failoverPollInterval = d }(failoverPollInterval)
+	failoverPollInterval = 10 * time.Millisecond
+
+	primary := "a1"
+	task := &models.Task{ID: "t4", AgentID: &primary, Failover: models.TaskFailover{{Type: constant.FailoverTargetWait, Minutes: 1}}}
+	time.AfterFunc(50*time.Millisecond, func() { ws.setOnline("a1", true) })
+
+	_, log, err := runFailover(t, es, task)
+	if err != nil {
+		t.Fatalf("等待恢复后执行失败: %v", err)
+	}
+	if log.AgentID == nil || *log.AgentID != "a1" || !strings.Contains(log.Failover, "后恢复") {
+		t.Errorf("应在原 Agent 恢复后执行: %v %s", log.AgentID, log.Failover)
+	}
+
+	// 所有目标都不可用时返回汇总原因
+	task = &models.Task{ID: "t5", AgentID: &primary, Failover: models.TaskFailover{{Type: constant.FailoverTargetAgent, AgentID: "a2"}}}
+	ws.setOnline("a1", false)
+	if _, _, err := runFailover(t, es, task); err == nil || !strings.Contains(err.Error(), "故障转移目标均不可用") {
+		t.Errorf("应返回故障转移失败: %v", err)
+	}
+}
+
+func TestFailoverOnlyBeforeDispatch(t *testing.T) {
+	es, ws := setupFailoverTest(t)
+	defer func(d time.Duration) { agentOfflineCheckInterval = d }(agentOfflineCheckInterval)
+	agentOfflineCheckInterval = 10 * time.Millisecond
+
+	primary := "a1"
+	task := &models.Task{ID: "t6", AgentID: &primary, Failover: models.TaskFailover{{Type: constant.FailoverTargetAgent, AgentID: "a2"}}}
+	ws.setOnline("a1", true)
+	ws.setOnline("a2", true)
+
+	// 指令未送达原 Agent 时转由备用 Agent 执行
+	ws.dropped["a1"] = true
+	_, log, err := runFailover(t, es, task)
+	if err != nil || log.AgentID == nil || *log.AgentID != "a2" || !strings.Contains(log.Failover, "未送达") {
+		t.Fatalf("指令未送达时应转移到备用 Agent: %v %v %s", err, log.AgentID, log.Failover)
+	}
+
+	// 指令已送达后原 Agent 离线，不再转移，避免重复执行
+	ws.dropped["a1"] = false
+	ws.silent["a1"] = true
+	ws.sent = nil
+	task.ID = "t7"
+	time.AfterFunc(30*time.Millisecond, func() { ws.setOnline("a1", false) })
+	_, log, err = runFailover(t, es, task)
+	if !errors.Is(err, errAgentOffline) {
+		t.Fatalf("已送达的执行在 Agent 离线时应直接返回: %v", err)
+	}
+	if len(ws.sent) != 1 || ws.sent[0] != "a1" || log.Failover != "" {
+		t.Errorf("已送达的执行不应转移到其他目标: %v %s", ws.sent, log.Failover)
+	}
+}
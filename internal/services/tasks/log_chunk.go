@@ -0,0 +1,322 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// logChunkMagic 分块缓存文件头
+	logChunkMagic = "BHLOGCK1"
+	// logChunkMaxLines 每个分块最多包含的行数
+	logChunkMaxLines = 1000
+	// logChunkMaxBytes 每个分块未压缩时的最大字节数
+	logChunkMaxBytes = 256 * 1024
+	// logChunkCacheLimit 分块缓存最多保留的日志数量，超出后按最近访问时间淘汰
+	logChunkCacheLimit = 200
+)
+
+// logChunk 分块索引项
+type logChunk struct {
+	Line   int   `json:"l"` // 首行行号（从 0 开始）
+	Lines  int   `json:"n"` // 行数
+	Offset int64 `json:"o"` // 压缩数据在数据区中的偏移
+	Size   int64 `json:"s"` // 压缩数据长度
+}
+
+// logChunkIndex 分块缓存文件索引
+type logChunkIndex struct {
+	TotalLines int        `json:"total_lines"`
+	TotalBytes int64      `json:"total_bytes"`
+	Chunks     []logChunk `json:"chunks"`
+}
+
+// logChunkFile 已打开的分块缓存文件，每个分块是独立的 zstd 帧，可按行号定位后只解压需要的部分
+type logChunkFile struct {
+	f        *os.File
+	index    logChunkIndex
+	dataBase int64
+}
+
+var logChunkBuildMu sync.Mutex
+
+// LogChunkDir 返回日志分块缓存目录
+func LogChunkDir() string {
+	return filepath.Join(constant.DataDir, "cache", "log_chunks")
+}
+
+func logChunkPath(logID string) string {
+	return filepath.Join(LogChunkDir(), logID+".chk")
+}
+
+// RemoveLogChunks 删除指定日志的分块缓存，未指定 ID 时清空全部缓存
+func RemoveLogChunks(logIDs ...string) {
+	if len(logIDs) == 0 {
+		_ = os.RemoveAll(LogChunkDir())
+		return
+	}
+	for _, id := range logIDs {
+		_ = os.Remove(logChunkPath(id))
+	}
+}
+
+// RemoveLogChunksWhere 删除满足条件的日志的分块缓存，需在删除数据库记录之前调用
+func RemoveLogChunksWhere(query string, args ...interface{}) {
+	var logs []models.TaskLog
+	database.DB.Model(&models.TaskLog{}).Select("id").Where(query, args...).
+		FindInBatches(&logs, 500, func(tx *gorm.DB, batch int) error {
+			for i := range logs {
+				_ = os.Remove(logChunkPath(logs[i].ID))
+			}
+			return nil
+		})
+}
+
+// openLogChunks 打开已结束日志的分块缓存，不存在时从日志存储中构建
+func openLogChunks(taskLog *models.TaskLog) (*logChunkFile, error) {
+	path := logChunkPath(taskLog.ID)
+	if cf, err := readLogChunkFile(path); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return cf, nil
+	}
+
+	logChunkBuildMu.Lock()
+	defer logChunkBuildMu.Unlock()
+
+	// 等待锁期间可能已被其他请求构建
+	if cf, err := readLogChunkFile(path); err == nil {
+		return cf, nil
+	}
+
+	rc, err := OpenTaskLogReader(taskLog)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if err := buildLogChunkFile(path, rc); err != nil {
+		return nil, err
+	}
+	pruneLogChunkCache()
+	return readLogChunkFile(path)
+}
+
+// buildLogChunkFile 将日志内容按行切分并逐块压缩写入缓存文件
+func buildLogChunkFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	var index logChunkIndex
+	var chunk bytes.Buffer
+	chunkStart, chunkLines := 0, 0
+
+	flush := func() {
+		if chunkLines == 0 {
+			return
+		}
+		compressed := utils.CompressZstd(chunk.String())
+		index.Chunks = append(index.Chunks, logChunk{
+			Line:   chunkStart,
+			Lines:  chunkLines,
+			Offset: int64(data.Len()),
+			Size:   int64(len(compressed)),
+		})
+		data.Write(compressed)
+		chunk.Reset()
+		chunkStart += chunkLines
+		chunkLines = 0
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			index.TotalBytes += int64(len(line))
+			chunk.WriteString(line)
+			chunkLines++
+			index.TotalLines++
+			if chunkLines >= logChunkMaxLines || chunk.Len() >= logChunkMaxBytes {
+				flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	flush()
+
+	header, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(logChunkMagic)
+	binary.Write(w, binary.BigEndian, uint32(len(header)))
+	w.Write(header)
+	w.Write(data.Bytes())
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readLogChunkFile(path string) (*logChunkFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, len(logChunkMagic)+4)
+	if _, err := io.ReadFull(f, head); err != nil || string(head[:len(logChunkMagic)]) != logChunkMagic {
+		f.Close()
+		return nil, errors.New("无效的日志分块缓存")
+	}
+	size := binary.BigEndian.Uint32(head[len(logChunkMagic):])
+	header := make([]byte, size)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cf := &logChunkFile{f: f, dataBase: int64(len(head)) + int64(size)}
+	if err := json.Unmarshal(header, &cf.index); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+func (cf *logChunkFile) Close() error {
+	return cf.f.Close()
+}
+
+// readChunk 解压指定分块并切分为行
+func (cf *logChunkFile) readChunk(i int) ([]string, error) {
+	c := cf.index.Chunks[i]
+	buf := make([]byte, c.Size)
+	if _, err := cf.f.ReadAt(buf, cf.dataBase+c.Offset); err != nil {
+		return nil, err
+	}
+	text, err := utils.DecompressZstd(buf)
+	if err != nil {
+		return nil, fmt.Errorf("解压日志分块失败: %v", err)
+	}
+	return splitLogLines(text), nil
+}
+
+// readLines 读取 [start, end) 行（行号从 0 开始）
+func (cf *logChunkFile) readLines(start, end int) ([]string, error) {
+	if end > cf.index.TotalLines {
+		end = cf.index.TotalLines
+	}
+	if start >= end {
+		return nil, nil
+	}
+
+	chunks := cf.index.Chunks
+	first := sort.Search(len(chunks), func(i int) bool { return chunks[i].Line+chunks[i].Lines > start })
+	lines := make([]string, 0, end-start)
+	for i := first; i < len(chunks) && chunks[i].Line < end; i++ {
+		chunkLines, err := cf.readChunk(i)
+		if err != nil {
+			return nil, err
+		}
+		for j, line := range chunkLines {
+			no := chunks[i].Line + j
+			if no >= start && no < end {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// scan 按顺序逐块遍历所有行，fn 返回 false 时停止
+func (cf *logChunkFile) scan(fn func(no int, line string) bool) error {
+	for i, c := range cf.index.Chunks {
+		chunkLines, err := cf.readChunk(i)
+		if err != nil {
+			return err
+		}
+		for j, line := range chunkLines {
+			if !fn(c.Line+j, line) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// splitLogLines 按换行符切分文本并去掉行尾的 \r，结尾换行符之后的空串不计为一行
+func splitLogLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// pruneLogChunkCache 分块缓存数量超出上限时，按最近访问时间淘汰最旧的缓存
+func pruneLogChunkCache() {
+	entries, err := os.ReadDir(LogChunkDir())
+	if err != nil || len(entries) <= logChunkCacheLimit {
+		return
+	}
+
+	type cached struct {
+		name    string
+		modTime time.Time
+	}
+	files := make([]cached, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".chk" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, cached{e.Name(), info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for i := 0; i < len(files)-logChunkCacheLimit; i++ {
+		_ = os.Remove(filepath.Join(LogChunkDir(), files[i].name))
+	}
+}
@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestLogChunkFile(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 2500; i++ {
+		fmt.Fprintf(&b, "line %d\r\n", i+1)
+	}
+	b.WriteString("\nlast")
+
+	path := filepath.Join(t.TempDir(), "test.chk")
+	if err := buildLogChunkFile(path, strings.NewReader(b.String())); err != nil {
+		t.Fatal(err)
+	}
+	cf, err := readLogChunkFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+
+	if cf.index.TotalLines != 2502 || len(cf.index.Chunks) != 3 {
+		t.Fatalf("unexpected index: lines=%d chunks=%d", cf.index.TotalLines, len(cf.index.Chunks))
+	}
+
+	// 跨分块读取
+	lines, err := cf.readLines(998, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "line 999,line 1000,line 1001,line 1002" {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+
+	lines, _ = cf.readLines(2499, 3000)
+	if len(lines) != 3 || lines[1] != "" || lines[2] != "last" {
+		t.Fatalf("unexpected tail lines: %q", lines)
+	}
+
+	count := 0
+	cf.scan(func(no int, line string) bool {
+		count++
+		return true
+	})
+	if count != 2502 {
+		t.Fatalf("scan count = %d", count)
+	}
+}
+
+func TestCleanTaskLogsRemovesChunks(t *testing.T) {
+	dataDir := constant.DataDir
+	constant.DataDir = t.TempDir()
+	defer func() { constant.DataDir = dataDir }()
+
+	setupTestDB(t, &models.Task{}, &models.TaskLog{}, &models.TaskLogIndex{})
+	db := database.DB
+	db.Create(&models.Task{ID: "t1", Name: "clean", CleanConfig: `{"type":"count","keep":1}`})
+
+	if err := os.MkdirAll(LogChunkDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"l1", "l2", "l3"} {
+		db.Create(&models.TaskLog{ID: id, TaskID: "t1", Status: constant.TaskStatusSuccess})
+		if err := buildLogChunkFile(logChunkPath(id), strings.NewReader("line "+id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(&TaskLogService{}).CleanTaskLogs("t1")
+
+	for id, want := range map[string]bool{"l1": false, "l2": false, "l3": true} {
+		if _, err := os.Stat(logChunkPath(id)); (err == nil) != want {
+			t.Errorf("chunk %s exists=%v, want %v", id, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// LogStream 日志行所属的输出流
+type LogStream uint8
+
+const (
+	LogStreamStdout LogStream = iota // 标准输出（未区分输出流时所有行都记为 stdout）
+	LogStreamStderr                  // 标准错误
+	LogStreamSystem                  // 面板写入的系统提示（重试、截断、执行失败等）
+)
+
+const (
+	// lineMetaVersion 行元数据编码版本
+	lineMetaVersion = 1
+	// maxLineMetaSize 运行期间行元数据的最大字节数，超出后放弃记录（约可覆盖 200 万行）
+	maxLineMetaSize = 4 * 1024 * 1024
+)
+
+// String 返回输出流名称
+func (s LogStream) String() string {
+	switch s {
+	case LogStreamStderr:
+		return "stderr"
+	case LogStreamSystem:
+		return "system"
+	default:
+		return "stdout"
+	}
+}
+
+// ParseLogStream 解析输出流名称，空串表示不过滤
+func ParseLogStream(name string) (LogStream, bool, error) {
+	switch name {
+	case "":
+		return 0, false, nil
+	case "stdout":
+		return LogStreamStdout, true, nil
+	case "stderr":
+		return LogStreamStderr, true, nil
+	case "system":
+		return LogStreamSystem, true, nil
+	}
+	return 0, false, fmt.Errorf("不支持的输出流: %s", name)
+}
+
+// lineMeta 单行的元数据
+type lineMeta struct {
+	At     int64 // 到达时间（Unix 毫秒）
+	Stream LogStream
+}
+
+// lineMetaEncoder 行元数据的紧凑编码
+// 格式：版本号(1 字节) + uvarint(基准时间毫秒)，之后每行一个 uvarint(距上一行的毫秒数<<2 | 输出流)
+type lineMetaEncoder struct {
+	buf  []byte
+	base int64
+	last int64
+}
+
+func newLineMetaEncoder(base int64) *lineMetaEncoder {
+	e := &lineMetaEncoder{base: base, last: base}
+	e.buf = append(e.buf, lineMetaVersion)
+	e.buf = binary.AppendUvarint(e.buf, uint64(base))
+	return e
+}
+
+func (e *lineMetaEncoder) add(at int64, stream LogStream) {
+	if at < e.last {
+		at = e.last
+	}
+	e.buf = binary.AppendUvarint(e.buf, uint64(at-e.last)<<2|uint64(stream&3))
+	e.last = at
+}
+
+// decodeLineMeta 解码行元数据，返回基准时间与逐行记录
+func decodeLineMeta(data []byte) (int64, []lineMeta, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	if data[0] != lineMetaVersion {
+		return 0, nil, fmt.Errorf("不支持的行元数据版本: %d", data[0])
+	}
+	base, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return 0, nil, errors.New("行元数据已损坏")
+	}
+	data = data[1+n:]
+
+	metas := make([]lineMeta, 0, len(data))
+	at := int64(base)
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, nil, errors.New("行元数据已损坏")
+		}
+		data = data[n:]
+		at += int64(v >> 2)
+		metas = append(metas, lineMeta{At: at, Stream: LogStream(v & 3)})
+	}
+	return int64(base), metas, nil
+}
+
+// encodeLineMetaText 将行元数据压缩编码为可存入数据库的文本
+func encodeLineMetaText(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	return utils.ZstdToBase64(utils.CompressZstd(string(data)))
+}
+
+// decodeLineMetaText 解码数据库中保存的行元数据，旧日志没有元数据时返回空
+func decodeLineMetaText(text string) (int64, []lineMeta, error) {
+	if text == "" {
+		return 0, nil, nil
+	}
+	raw, err := utils.DecompressFromBase64(text)
+	if err != nil {
+		return 0, nil, err
+	}
+	return decodeLineMeta([]byte(raw))
+}
+
+// formatLineTime 按时间戳显示方式格式化行时间
+func formatLineTime(at, base int64, mode string) string {
+	switch mode {
+	case LogTimestampRelative:
+		return fmt.Sprintf("+%.3fs", float64(at-base)/1000)
+	case LogTimestampAbsolute:
+		return time.UnixMilli(at).Format("2006-01-02 15:04:05.000")
+	}
+	return ""
+}
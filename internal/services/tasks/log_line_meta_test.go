@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"testing"
+)
+
+func TestTinyLogLineMeta(t *testing.T) {
+	tl, err := NewTinyLog("meta_test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := tl.Stream(LogStreamStdout), tl.Stream(LogStreamStderr)
+	stdout.Write([]byte("a\nb"))
+	stderr.Write([]byte("e1\n"))
+	stdout.Write([]byte("c\n"))
+	tl.Stream(LogStreamSystem).Write([]byte("[System] done"))
+
+	output, err := tl.CompressAndCleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "raw:a\ne1\nbc\n[System] done" {
+		t.Fatalf("unexpected output %q", output)
+	}
+
+	base, metas, err := decodeLineMetaText(tl.LineMeta())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LogStream{LogStreamStdout, LogStreamStderr, LogStreamStdout, LogStreamSystem}
+	if len(metas) != len(want) {
+		t.Fatalf("got %d line records, want %d", len(metas), len(want))
+	}
+	for i, m := range metas {
+		if m.Stream != want[i] {
+			t.Errorf("line %d stream = %s, want %s", i, m.Stream, want[i])
+		}
+		if m.At < base {
+			t.Errorf("line %d time %d before base %d", i, m.At, base)
+		}
+	}
+}
+
+func TestLineMetaEncoding(t *testing.T) {
+	enc := newLineMetaEncoder(1000)
+	enc.add(1000, LogStreamStdout)
+	enc.add(1500, LogStreamStderr)
+	enc.add(1400, LogStreamSystem) // 时间回拨按上一行计
+	base, metas, err := decodeLineMeta(enc.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != 1000 || len(metas) != 3 || metas[1].At != 1500 || metas[2].At != 1500 || metas[2].Stream != LogStreamSystem {
+		t.Fatalf("unexpected decode result: base=%d metas=%+v", base, metas)
+	}
+	if got := formatLineTime(13345, 1000, LogTimestampRelative); got != "+12.345s" {
+		t.Errorf("relative time = %q", got)
+	}
+}
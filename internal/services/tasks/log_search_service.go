@@ -0,0 +1,439 @@
+package tasks
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxIndexTokenLen 单个词元的最大长度，过长的词元（如 base64 串）不参与索引
+	maxIndexTokenLen = 64
+	// maxIndexTokensSize 单条日志词元总长度上限 (256KB)，超出后标记为截断
+	maxIndexTokensSize = 256 * 1024
+	// maxSnippetsPerLog 每条日志最多返回的匹配行数
+	maxSnippetsPerLog = 5
+	// maxSnippetLen 单个匹配片段的最大字符数
+	maxSnippetLen = 300
+	// maxScanLogs 单次检索最多解压扫描的日志条数，防止正则检索拖垮系统
+	maxScanLogs = 500
+	// searchBatchSize 每批从索引表读取的候选日志数量
+	searchBatchSize = 50
+)
+
+// LogSearchQuery 日志检索条件
+type LogSearchQuery struct {
+	Keyword   string    // 关键字（大小写不敏感的子串匹配）
+	Regex     bool      // 是否将 Keyword 作为正则表达式
+	TaskID    string    // 按任务筛选
+	Status    string    // 按状态筛选
+	AgentID   string    // 按 Agent 筛选，"local" 表示仅本地执行
+	StartTime time.Time // 开始时间（含）
+	EndTime   time.Time // 结束时间（含）
+	Before    string    // 游标：仅返回 ID 小于该值的日志
+	Limit     int       // 返回的日志条数
+}
+
+// LogSearchSnippet 匹配行片段
+type LogSearchSnippet struct {
+	Line int    `json:"line"` // 行号（从 1 开始）
+	Text string `json:"text"` // 行内容（过长会被截断）
+}
+
+// LogSearchHit 单条日志的检索结果
+type LogSearchHit struct {
+	LogID     string             `json:"log_id"`
+	TaskID    string             `json:"task_id"`
+	TaskName  string             `json:"task_name"`
+	AgentID   string             `json:"agent_id"`
+	Status    string             `json:"status"`
+	CreatedAt models.LocalTime   `json:"created_at"`
+	Matches   int                `json:"matches"` // 匹配行总数
+	Snippets  []LogSearchSnippet `json:"snippets"`
+}
+
+// LogSearchResult 检索结果
+type LogSearchResult struct {
+	Hits       []LogSearchHit `json:"hits"`
+	NextCursor string         `json:"next_cursor"` // 非空表示还有更多结果，作为下一次请求的 before 参数
+	Scanned    int            `json:"scanned"`     // 本次实际扫描的日志条数
+	Limited    bool           `json:"limited"`     // 是否因达到扫描上限而提前结束
+}
+
+// LogSearchService 任务日志全文检索服务
+type LogSearchService struct{}
+
+// NewLogSearchService 创建日志检索服务
+func NewLogSearchService() *LogSearchService {
+	return &LogSearchService{}
+}
+
+// IndexLogByID 为指定日志建立（或重建）检索索引，运行中的日志会被跳过
+func (s *LogSearchService) IndexLogByID(logID string) error {
+	var taskLog models.TaskLog
+	res := database.DB.Where("id = ?", logID).Limit(1).Find(&taskLog)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	return s.IndexLog(&taskLog)
+}
+
+// IndexLog 为一条完整的日志记录建立检索索引
+func (s *LogSearchService) IndexLog(taskLog *models.TaskLog) error {
+	if taskLog.Status == constant.TaskStatusRunning {
+		return nil
+	}
+
+	content, err := LoadTaskLogOutput(taskLog)
+	if err != nil {
+		return fmt.Errorf("解压日志失败: %v", err)
+	}
+
+	tokens, truncated := buildIndexTokens(content)
+	agentID := ""
+	if taskLog.AgentID != nil {
+		agentID = *taskLog.AgentID
+	}
+	createdAt := taskLog.CreatedAt
+	if createdAt.Time().IsZero() && taskLog.StartTime != nil {
+		createdAt = *taskLog.StartTime
+	}
+
+	index := &models.TaskLogIndex{
+		ID:        taskLog.ID,
+		TaskID:    taskLog.TaskID,
+		AgentID:   agentID,
+		Status:    taskLog.Status,
+		Tokens:    models.BigText(tokens),
+		Truncated: truncated,
+		LineCount: strings.Count(content, "\n") + 1,
+		CreatedAt: createdAt,
+	}
+	return database.DB.Save(index).Error
+}
+
+// DeleteIndex 删除指定日志的检索索引
+func (s *LogSearchService) DeleteIndex(logIDs ...string) error {
+	if len(logIDs) == 0 {
+		return nil
+	}
+	return database.DB.Where("id IN ?", logIDs).Delete(&models.TaskLogIndex{}).Error
+}
+
+// DeleteIndexByTask 删除指定任务的全部检索索引，taskID 为空时清空所有索引
+func (s *LogSearchService) DeleteIndexByTask(taskID string) error {
+	query := database.DB.Model(&models.TaskLogIndex{})
+	if taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	} else {
+		query = query.Where("1 = 1")
+	}
+	return query.Delete(&models.TaskLogIndex{}).Error
+}
+
+// PruneOrphans 清理日志已被删除但索引仍然残留的记录
+func (s *LogSearchService) PruneOrphans() int64 {
+	sub := database.DB.Model(&models.TaskLog{}).Select("id")
+	res := database.DB.Where("id NOT IN (?)", sub).Delete(&models.TaskLogIndex{})
+	return res.RowsAffected
+}
+
+// Rebuild 为已有的全部日志重建检索索引，taskID 非空时只重建该任务，progress 可为空
+func (s *LogSearchService) Rebuild(taskID string, progress func(done, failed int)) (int, int, error) {
+	if taskID != "" {
+		if err := s.DeleteIndexByTask(taskID); err != nil {
+			return 0, 0, err
+		}
+	} else if err := s.DeleteIndexByTask(""); err != nil {
+		return 0, 0, err
+	}
+
+	query := database.DB.Model(&models.TaskLog{}).Where("status != ?", constant.TaskStatusRunning)
+	if taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	}
+
+	done, failed := 0, 0
+	var batch []models.TaskLog
+	err := query.FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := s.IndexLog(&batch[i]); err != nil {
+				logger.Warnf("[LogSearch] 重建日志 #%s 索引失败: %v", batch[i].ID, err)
+				failed++
+				continue
+			}
+			done++
+		}
+		if progress != nil {
+			progress(done, failed)
+		}
+		return nil
+	}).Error
+	return done, failed, err
+}
+
+// Search 按条件检索日志内容
+func (s *LogSearchService) Search(q LogSearchQuery) (*LogSearchResult, error) {
+	keyword := strings.TrimSpace(q.Keyword)
+	if keyword == "" {
+		return nil, fmt.Errorf("检索关键字不能为空")
+	}
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 20
+	}
+
+	var matcher func(line string) bool
+	if q.Regex {
+		re, err := regexp.Compile(keyword)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式无效: %v", err)
+		}
+		matcher = re.MatchString
+	} else {
+		lowered := strings.ToLower(keyword)
+		matcher = func(line string) bool {
+			return strings.Contains(strings.ToLower(line), lowered)
+		}
+	}
+
+	query := database.DB.Model(&models.TaskLogIndex{})
+	if q.TaskID != "" {
+		query = query.Where("task_id = ?", q.TaskID)
+	}
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	switch q.AgentID {
+	case "":
+	case "local":
+		query = query.Where("agent_id = ?", "")
+	default:
+		query = query.Where("agent_id = ?", q.AgentID)
+	}
+	if !q.StartTime.IsZero() {
+		query = query.Where("created_at >= ?", q.StartTime)
+	}
+	if !q.EndTime.IsZero() {
+		query = query.Where("created_at <= ?", q.EndTime)
+	}
+
+	// 关键字检索：使用词元索引预筛选候选日志；正则检索无法预筛选，仅依赖元数据条件
+	if !q.Regex {
+		tokens := queryTokens(keyword)
+		if len(tokens) > 0 {
+			sub := database.DB.Where("1 = 1")
+			for _, tok := range tokens {
+				sub = sub.Where("tokens LIKE ?", "%"+tok+"%")
+			}
+			query = query.Where(database.DB.Where("truncated = ?", true).Or(sub))
+		}
+	}
+
+	result := &LogSearchResult{Hits: make([]LogSearchHit, 0)}
+	cursor := q.Before
+	for len(result.Hits) < q.Limit {
+		batchQuery := query.Session(&gorm.Session{})
+		if cursor != "" {
+			batchQuery = batchQuery.Where("id < ?", cursor)
+		}
+		var candidates []models.TaskLogIndex
+		if err := batchQuery.Select("id, task_id, agent_id, status, created_at").Order("id DESC").Limit(searchBatchSize).Find(&candidates).Error; err != nil {
+			return nil, err
+		}
+		if len(candidates) == 0 {
+			cursor = ""
+			break
+		}
+
+		ids := make([]string, len(candidates))
+		for i, c := range candidates {
+			ids[i] = c.ID
+		}
+		var logs []models.TaskLog
+		database.DB.Select("id, output, storage, storage_key").Where("id IN ?", ids).Find(&logs)
+		logMap := make(map[string]*models.TaskLog, len(logs))
+		for i := range logs {
+			logMap[logs[i].ID] = &logs[i]
+		}
+
+		for _, c := range candidates {
+			if result.Scanned >= maxScanLogs {
+				result.Limited = true
+				break
+			}
+			cursor = c.ID
+			result.Scanned++
+
+			taskLog, ok := logMap[c.ID]
+			if !ok {
+				continue
+			}
+			content, err := LoadTaskLogOutput(taskLog)
+			if err != nil {
+				continue
+			}
+			matches, snippets := matchLines(content, matcher)
+			if matches == 0 {
+				continue
+			}
+			result.Hits = append(result.Hits, LogSearchHit{
+				LogID:     c.ID,
+				TaskID:    c.TaskID,
+				AgentID:   c.AgentID,
+				Status:    c.Status,
+				CreatedAt: c.CreatedAt,
+				Matches:   matches,
+				Snippets:  snippets,
+			})
+			if len(result.Hits) >= q.Limit {
+				break
+			}
+		}
+
+		if result.Limited || len(candidates) < searchBatchSize && len(result.Hits) < q.Limit {
+			if !result.Limited {
+				cursor = ""
+			}
+			break
+		}
+	}
+
+	result.NextCursor = cursor
+	fillHitTaskNames(result.Hits)
+	return result, nil
+}
+
+// fillHitTaskNames 批量补充检索结果的任务名称
+func fillHitTaskNames(hits []LogSearchHit) {
+	if len(hits) == 0 {
+		return
+	}
+	taskIDs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		taskIDs = append(taskIDs, hit.TaskID)
+	}
+	var taskList []models.Task
+	database.DB.Select("id, name").Where("id IN ?", taskIDs).Find(&taskList)
+	names := make(map[string]string, len(taskList))
+	for _, t := range taskList {
+		names[t.ID] = t.Name
+	}
+	for i := range hits {
+		hits[i].TaskName = names[hits[i].TaskID]
+	}
+}
+
+// matchLines 逐行匹配日志内容，返回匹配总行数及前若干条片段
+func matchLines(content string, matcher func(line string) bool) (int, []LogSearchSnippet) {
+	matches := 0
+	snippets := make([]LogSearchSnippet, 0)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), constant.MaxLogSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if !matcher(line) {
+			continue
+		}
+		matches++
+		if len(snippets) < maxSnippetsPerLog {
+			snippets = append(snippets, LogSearchSnippet{Line: lineNo, Text: truncateSnippet(line)})
+		}
+	}
+	return matches, snippets
+}
+
+// truncateSnippet 按字符截断过长的匹配行
+func truncateSnippet(line string) string {
+	if utf8.RuneCountInString(line) <= maxSnippetLen {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:maxSnippetLen]) + "..."
+}
+
+// tokenize 将文本切分为小写词元：连续的字母、数字、下划线构成一个词元，
+// 中日韩等无空格分隔的文字按单字切分
+func tokenize(text string) []string {
+	var tokens []string
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, sb.String())
+			sb.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			sb.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// queryTokens 生成用于索引预筛选的词元，与建立索引时一致跳过过长的词元，
+// 这类词元只能在读取日志内容后逐行匹配
+func queryTokens(keyword string) []string {
+	var tokens []string
+	for _, tok := range tokenize(keyword) {
+		if len(tok) <= maxIndexTokenLen {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+// buildIndexTokens 生成去重排序后的词元串，首尾补空格；超出上限时返回截断标记
+func buildIndexTokens(content string) (string, bool) {
+	seen := make(map[string]struct{})
+	for _, tok := range tokenize(content) {
+		if len(tok) > maxIndexTokenLen {
+			continue
+		}
+		seen[tok] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(seen))
+	for tok := range seen {
+		sorted = append(sorted, tok)
+	}
+	sort.Strings(sorted)
+
+	var sb strings.Builder
+	sb.WriteByte(' ')
+	for _, tok := range sorted {
+		if sb.Len()+len(tok)+1 > maxIndexTokensSize {
+			return sb.String(), true
+		}
+		sb.WriteString(tok)
+		sb.WriteByte(' ')
+	}
+	return sb.String(), false
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logstore"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+func setupLogSearchTest(t *testing.T) *LogSearchService {
+	t.Helper()
+	setupTestDB(t, &models.Task{}, &models.TaskLog{}, &models.TaskLogIndex{})
+	return NewLogSearchService()
+}
+
+// createSearchLog 创建一条已结束的日志并建立检索索引
+func createSearchLog(t *testing.T, s *LogSearchService, taskLog *models.TaskLog, content string) {
+	t.Helper()
+	output, err := utils.CompressToBase64(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskLog.Output = models.BigText(output)
+	taskLog.Status = constant.TaskStatusSuccess
+	if err := database.DB.Create(taskLog).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.IndexLog(taskLog); err != nil {
+		t.Fatalf("建立索引失败: %v", err)
+	}
+}
+
+func TestTokenize_MixedText(t *testing.T) {
+	tokens := tokenize("ERROR: connect_timeout after 30s, 连接失败")
+	expected := []string{"error", "connect_timeout", "after", "30s", "连", "接", "失", "败"}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range expected {
+		if tokens[i] != tok {
+			t.Errorf("Token %d: expected %q, got %q", i, tok, tokens[i])
+		}
+	}
+}
+
+func TestBuildIndexTokens_DedupAndTruncate(t *testing.T) {
+	tokens, truncated := buildIndexTokens("foo bar foo\nBAR baz " + strings.Repeat("x", maxIndexTokenLen+1))
+	if truncated {
+		t.Errorf("Expected not truncated")
+	}
+	if tokens != " bar baz foo " {
+		t.Errorf("Unexpected tokens: %q", tokens)
+	}
+
+	var sb strings.Builder
+	for i := 0; sb.Len() < maxIndexTokensSize*2; i++ {
+		sb.WriteString("n" + strconv.Itoa(i) + "\n")
+	}
+	_, truncated = buildIndexTokens(sb.String())
+	if !truncated {
+		t.Errorf("Expected truncated for oversized token set")
+	}
+}
+
+func TestMatchLines_KeywordAndSnippets(t *testing.T) {
+	content := "start\nerror: disk full\nok\nError again\n" + strings.Repeat("error x\n", 10)
+	lowered := "error"
+	matches, snippets := matchLines(content, func(line string) bool {
+		return strings.Contains(strings.ToLower(line), lowered)
+	})
+	if matches != 12 {
+		t.Errorf("Expected 12 matches, got %d", matches)
+	}
+	if len(snippets) != maxSnippetsPerLog {
+		t.Errorf("Expected %d snippets, got %d", maxSnippetsPerLog, len(snippets))
+	}
+	if snippets[0].Line != 2 || snippets[0].Text != "error: disk full" {
+		t.Errorf("Unexpected first snippet: %+v", snippets[0])
+	}
+}
+
+func TestQueryTokens_SkipsOversizedTokens(t *testing.T) {
+	long := strings.Repeat("a1", maxIndexTokenLen)
+	tokens := queryTokens("upload /data/" + long + " failed")
+	if strings.Join(tokens, ",") != "upload,data,failed" {
+		t.Errorf("Unexpected query tokens: %v", tokens)
+	}
+}
+
+func TestSearch_LongToken(t *testing.T) {
+	s := setupLogSearchTest(t)
+	long := strings.Repeat("ab12", maxIndexTokenLen/2)
+	createSearchLog(t, s, &models.TaskLog{ID: "l1", TaskID: "t1"}, "start\nkey="+long+"\ndone")
+	createSearchLog(t, s, &models.TaskLog{ID: "l2", TaskID: "t1"}, "start\nother\ndone")
+
+	for _, keyword := range []string{long, "key=" + long} {
+		result, err := s.Search(LogSearchQuery{Keyword: keyword})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Hits) != 1 || result.Hits[0].LogID != "l1" || result.Hits[0].Snippets[0].Line != 2 {
+			t.Errorf("Expected long token %q to match l1 line 2, got %+v", keyword[:8], result.Hits)
+		}
+	}
+}
+
+func TestSearch_ExternalStorage(t *testing.T) {
+	s := setupLogSearchTest(t)
+	if err := logstore.Init(logstore.Config{Type: logstore.TypeFS, Path: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	defer logstore.Init(logstore.Config{})
+
+	taskLog := &models.TaskLog{ID: "l1", TaskID: "t1"}
+	createSearchLog(t, s, taskLog, "start\nupload failed: quota exceeded\ndone")
+	OffloadTaskLogOutput(taskLog)
+	if taskLog.Storage != logstore.TypeFS {
+		t.Fatalf("Expected log offloaded to fs, got %q", taskLog.Storage)
+	}
+	database.DB.Save(taskLog)
+
+	result, err := s.Search(LogSearchQuery{Keyword: "quota exceeded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].LogID != "l1" {
+		t.Errorf("Expected fs-stored log to match, got %+v", result.Hits)
+	}
+}
@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/logstore"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+// LoadTaskLogOutput 读取并解压日志记录中的输出内容（自动识别数据库或外部存储）
+func LoadTaskLogOutput(taskLog *models.TaskLog) (string, error) {
+	if taskLog.Storage == "" {
+		return utils.DecompressFromBase64(string(taskLog.Output))
+	}
+	data, err := loadStoredObject(taskLog)
+	if err != nil {
+		return "", err
+	}
+	return utils.DecompressZstd(data)
+}
+
+// LoadTaskLogEncoded 读取日志记录的压缩编码内容，格式与 TaskLog.Output 一致（供前端自行解压）
+func LoadTaskLogEncoded(taskLog *models.TaskLog) (string, error) {
+	if taskLog.Storage == "" {
+		return string(taskLog.Output), nil
+	}
+	data, err := loadStoredObject(taskLog)
+	if err != nil {
+		return "", err
+	}
+	return utils.ZstdToBase64(data), nil
+}
+
+// LoadTaskLogZstd 读取日志内容的 zstd 帧，数据库中的日志会被重新压缩
+func LoadTaskLogZstd(taskLog *models.TaskLog) ([]byte, error) {
+	if taskLog.Storage != "" {
+		return loadStoredObject(taskLog)
+	}
+	content, err := utils.DecompressFromBase64(string(taskLog.Output))
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return nil, nil
+	}
+	return utils.CompressZstd(content), nil
+}
+
+// OpenTaskLogReader 以流的方式读取日志内容，避免大日志一次性解压到内存
+func OpenTaskLogReader(taskLog *models.TaskLog) (io.ReadCloser, error) {
+	var compressed io.Reader
+	if taskLog.Storage != "" {
+		data, err := loadStoredObject(taskLog)
+		if err != nil {
+			return nil, err
+		}
+		compressed = bytes.NewReader(data)
+	} else {
+		output := string(taskLog.Output)
+		switch {
+		case strings.HasPrefix(output, "zstd:"):
+			compressed = base64.NewDecoder(base64.StdEncoding, strings.NewReader(output[len("zstd:"):]))
+		default:
+			// raw 与旧版 zlib 格式的日志体积较小，直接解压
+			content, err := utils.DecompressFromBase64(output)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(strings.NewReader(content)), nil
+		}
+	}
+
+	zr, err := zstd.NewReader(compressed, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+func loadStoredObject(taskLog *models.TaskLog) ([]byte, error) {
+	store, err := logstore.Open(taskLog.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(taskLog.StorageKey)
+}
+
+// OffloadTaskLogOutput 将日志内容转存到当前配置的外部存储后端
+// 未配置外部存储、日志仍在运行或内容为空时不做处理；写入失败时日志保留在数据库中
+func OffloadTaskLogOutput(taskLog *models.TaskLog) {
+	store := logstore.Current()
+	if store == nil || taskLog.Storage != "" || taskLog.Output == "" || taskLog.Status == constant.TaskStatusRunning {
+		return
+	}
+	if err := storeTaskLogOutput(store, taskLog, nil); err != nil {
+		logger.Warnf("[TaskLog] 日志 #%s 转存到 %s 失败，保留在数据库中: %v", taskLog.ID, store.Name(), err)
+	}
+}
+
+// storeTaskLogOutput 将日志内容写入指定后端并更新记录中的存储字段（不写数据库），data 为空时从 Output 中压缩得到
+func storeTaskLogOutput(store logstore.Store, taskLog *models.TaskLog, data []byte) error {
+	if data == nil {
+		content, err := utils.DecompressFromBase64(string(taskLog.Output))
+		if err != nil {
+			return err
+		}
+		data = utils.CompressZstd(content)
+	}
+
+	createdAt := taskLog.CreatedAt.Time()
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	key := logstore.KeyFor(taskLog.ID, createdAt)
+	if err := store.Put(key, data); err != nil {
+		return err
+	}
+
+	taskLog.Output = ""
+	taskLog.Storage = store.Name()
+	taskLog.StorageKey = key
+	return nil
+}
+
+// DeleteStoredTaskLogs 删除满足条件的日志在外部存储中的对象，需在删除数据库记录之前调用
+func DeleteStoredTaskLogs(query string, args ...interface{}) {
+	var logs []models.TaskLog
+	database.DB.Model(&models.TaskLog{}).Select("id, storage, storage_key").
+		Where("storage != ''").Where(query, args...).
+		FindInBatches(&logs, 500, func(tx *gorm.DB, batch int) error {
+			for i := range logs {
+				deleteStoredObject(&logs[i])
+			}
+			return nil
+		})
+}
+
+func deleteStoredObject(taskLog *models.TaskLog) {
+	if taskLog.Storage == "" || taskLog.StorageKey == "" {
+		return
+	}
+	store, err := logstore.Open(taskLog.Storage)
+	if err != nil {
+		logger.Warnf("[TaskLog] 删除日志 #%s 存储对象失败: %v", taskLog.ID, err)
+		return
+	}
+	if err := store.Delete(taskLog.StorageKey); err != nil {
+		logger.Warnf("[TaskLog] 删除日志 #%s 存储对象失败: %v", taskLog.ID, err)
+	}
+}
+
+// LogStorageMigrateResult 日志存储迁移结果
+type LogStorageMigrateResult struct {
+	Migrated int `json:"migrated"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// MigrateTaskLogStorage 将已结束的任务日志迁移到目标后端，target 为 nil 表示迁回数据库
+// 每条日志写入目标后端成功后才更新记录并删除旧对象，中断后可重复执行
+func MigrateTaskLogStorage(target logstore.Store, progress func(done int)) (*LogStorageMigrateResult, error) {
+	targetName := ""
+	if target != nil {
+		targetName = target.Name()
+	}
+
+	result := &LogStorageMigrateResult{}
+	var logs []models.TaskLog
+	err := database.DB.Where("status != ? AND storage != ?", constant.TaskStatusRunning, targetName).
+		FindInBatches(&logs, 100, func(tx *gorm.DB, batch int) error {
+			for i := range logs {
+				moved, err := migrateTaskLog(&logs[i], target)
+				switch {
+				case err != nil:
+					logger.Warnf("[TaskLog] 迁移日志 #%s 失败: %v", logs[i].ID, err)
+					result.Failed++
+				case moved:
+					result.Migrated++
+				default:
+					result.Skipped++
+				}
+			}
+			if progress != nil {
+				progress(result.Migrated + result.Skipped + result.Failed)
+			}
+			return nil
+		}).Error
+	return result, err
+}
+
+// migrateTaskLog 迁移单条日志，没有日志内容的记录会被跳过
+func migrateTaskLog(taskLog *models.TaskLog, target logstore.Store) (bool, error) {
+	old := *taskLog
+
+	if target == nil {
+		content, err := LoadTaskLogOutput(taskLog)
+		if err != nil {
+			return false, err
+		}
+		compressed, err := utils.CompressToBase64(content)
+		if err != nil {
+			return false, err
+		}
+		taskLog.Output = models.BigText(compressed)
+		taskLog.Storage = ""
+		taskLog.StorageKey = ""
+	} else {
+		data, err := LoadTaskLogZstd(taskLog)
+		if err != nil {
+			return false, err
+		}
+		if data == nil {
+			return false, nil
+		}
+		if err := storeTaskLogOutput(target, taskLog, data); err != nil {
+			return false, err
+		}
+	}
+
+	err := database.DB.Model(&models.TaskLog{}).Where("id = ?", taskLog.ID).Updates(map[string]interface{}{
+		"output":      taskLog.Output,
+		"storage":     taskLog.Storage,
+		"storage_key": taskLog.StorageKey,
+	}).Error
+	if err != nil {
+		return false, fmt.Errorf("更新日志记录失败: %v", err)
+	}
+
+	// 新位置写入成功后再清理旧对象（同一后端同一 key 时不能删除）
+	if old.Storage != "" && (old.Storage != taskLog.Storage || old.StorageKey != taskLog.StorageKey) {
+		deleteStoredObject(&old)
+	}
+	return true, nil
+}
@@ -0,0 +1,555 @@
+package tasks
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/utils"
+)
+
+// 日志行输出格式
+const (
+	LogFormatRaw   = "raw"   // 原样输出，保留 ANSI 控制序列
+	LogFormatPlain = "plain" // 移除 ANSI 控制序列
+	LogFormatHTML  = "html"  // ANSI 颜色转换为 HTML（逐行转换，样式不跨行延续）
+)
+
+// 日志行时间戳显示方式
+const (
+	LogTimestampRelative = "relative" // 相对日志开始的偏移，如 +12.345s
+	LogTimestampAbsolute = "absolute" // 绝对时间，精确到毫秒
+)
+
+const (
+	defaultLogViewLines = 500
+	maxLogViewLines     = 5000
+	defaultGrepLimit    = 100
+	maxGrepLimit        = 1000
+	maxGrepContext      = 10
+)
+
+// ErrLogNotFound 日志不存在
+var ErrLogNotFound = errors.New("日志不存在")
+
+// LogViewOptions 日志行的过滤与展示选项
+type LogViewOptions struct {
+	Format     string // 输出格式：raw、plain、html
+	Stream     string // 只返回指定输出流（stdout、stderr、system）的行，为空不过滤
+	Timestamps string // 时间戳显示方式：relative、absolute，为空不返回
+}
+
+// LogLine 日志行，No 为从 1 开始的行号
+// Stream 与 Time 仅在日志记录了行元数据时返回，旧日志没有这些信息
+type LogLine struct {
+	No     int    `json:"no"`
+	Text   string `json:"text"`
+	Stream string `json:"stream,omitempty"`
+	Time   string `json:"time,omitempty"`
+}
+
+// LogLinesResult 日志行范围查询结果
+type LogLinesResult struct {
+	LogID      string    `json:"log_id"`
+	Status     string    `json:"status"`
+	Running    bool      `json:"running"`     // 是否为运行中的实时日志
+	TotalLines int       `json:"total_lines"` // 当前日志总行数（按输出流过滤时为该输出流的行数；运行中的日志会继续增长）
+	Start      int       `json:"start"`       // 返回的首行行号，无内容时为 0
+	End        int       `json:"end"`         // 返回的末行行号，无内容时为 0
+	HasMore    bool      `json:"has_more"`    // 返回的行之后是否还有内容
+	Lines      []LogLine `json:"lines"`
+}
+
+// LogGrepQuery 单条日志内检索条件
+type LogGrepQuery struct {
+	Keyword    string
+	Regex      bool
+	IgnoreCase bool
+	Context    int // 每个匹配行前后附带的上下文行数
+	Limit      int
+	LogViewOptions
+}
+
+// LogGrepMatch 单个匹配行
+type LogGrepMatch struct {
+	LogLine
+	Before []LogLine `json:"before,omitempty"`
+	After  []LogLine `json:"after,omitempty"`
+}
+
+// LogGrepResult 单条日志内检索结果
+type LogGrepResult struct {
+	LogID      string         `json:"log_id"`
+	Running    bool           `json:"running"`
+	TotalLines int            `json:"total_lines"`
+	MatchCount int            `json:"match_count"` // 匹配行总数
+	Limited    bool           `json:"limited"`     // 匹配行超过返回上限
+	Matches    []LogGrepMatch `json:"matches"`
+}
+
+// logLineSource 按行读取日志内容的数据源，行号从 0 开始
+type logLineSource interface {
+	totalLines() (int, error)
+	readLines(start, end int) ([]string, error)
+	scan(fn func(no int, line string) bool) error
+	Close() error
+}
+
+// openedLog 已打开的日志及其行元数据
+type openedLog struct {
+	taskLog *models.TaskLog
+	src     logLineSource
+	base    int64
+	metas   []lineMeta
+	opts    LogViewOptions
+	stream  LogStream
+	filter  bool // 是否按输出流过滤
+}
+
+// streamOf 返回指定行所属的输出流，没有元数据的行视为 stdout
+func (o *openedLog) streamOf(no int) LogStream {
+	if no < len(o.metas) {
+		return o.metas[no].Stream
+	}
+	return LogStreamStdout
+}
+
+func (o *openedLog) accept(no int) bool {
+	return !o.filter || o.streamOf(no) == o.stream
+}
+
+// line 按展示选项构造日志行
+func (o *openedLog) line(no int, text string) LogLine {
+	l := LogLine{No: no + 1, Text: formatLogLine(text, o.opts.Format)}
+	if no < len(o.metas) {
+		l.Stream = o.metas[no].Stream.String()
+		l.Time = formatLineTime(o.metas[no].At, o.base, o.opts.Timestamps)
+	}
+	return l
+}
+
+func (o *openedLog) newResult() *LogLinesResult {
+	return &LogLinesResult{
+		LogID:   o.taskLog.ID,
+		Status:  o.taskLog.Status,
+		Running: o.taskLog.Status == constant.TaskStatusRunning,
+		Lines:   make([]LogLine, 0),
+	}
+}
+
+// LogViewService 大日志的分页、区间与检索访问
+// 已结束的日志从分块压缩缓存中按需解压，运行中的日志直接读取 TinyLog 的临时文件
+type LogViewService struct{}
+
+// NewLogViewService 创建日志查看服务
+func NewLogViewService() *LogViewService {
+	return &LogViewService{}
+}
+
+// Lines 读取从 start 行（从 1 开始）起的 limit 行；按输出流过滤时 start 与 limit 按过滤后的行计数
+func (s *LogViewService) Lines(logID string, start, limit int, opts LogViewOptions) (*LogLinesResult, error) {
+	if start < 1 {
+		start = 1
+	}
+	limit = clampLimit(limit, defaultLogViewLines, maxLogViewLines)
+
+	o, err := s.open(logID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer o.src.Close()
+
+	if o.filter {
+		return s.filteredLines(o, start-1, limit)
+	}
+	total, err := o.src.totalLines()
+	if err != nil {
+		return nil, err
+	}
+	return s.buildResult(o, total, start-1, start-1+limit)
+}
+
+// Head 读取前 n 行
+func (s *LogViewService) Head(logID string, n int, opts LogViewOptions) (*LogLinesResult, error) {
+	return s.Lines(logID, 1, n, opts)
+}
+
+// Tail 读取最后 n 行
+func (s *LogViewService) Tail(logID string, n int, opts LogViewOptions) (*LogLinesResult, error) {
+	n = clampLimit(n, defaultLogViewLines, maxLogViewLines)
+
+	o, err := s.open(logID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer o.src.Close()
+
+	if o.filter {
+		return s.filteredTail(o, n)
+	}
+	total, err := o.src.totalLines()
+	if err != nil {
+		return nil, err
+	}
+	start := total - n
+	if start < 0 {
+		start = 0
+	}
+	return s.buildResult(o, total, start, total)
+}
+
+// Grep 在单条日志内按关键字或正则表达式检索，匹配时忽略 ANSI 控制序列
+// 按输出流过滤时只检索该输出流的行，上下文也只取自该输出流
+func (s *LogViewService) Grep(logID string, q LogGrepQuery) (*LogGrepResult, error) {
+	match, err := buildGrepMatcher(q)
+	if err != nil {
+		return nil, err
+	}
+	limit := clampLimit(q.Limit, defaultGrepLimit, maxGrepLimit)
+	context := q.Context
+	if context < 0 {
+		context = 0
+	}
+	if context > maxGrepContext {
+		context = maxGrepContext
+	}
+
+	o, err := s.open(logID, q.LogViewOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer o.src.Close()
+
+	result := &LogGrepResult{
+		LogID:   logID,
+		Running: o.taskLog.Status == constant.TaskStatusRunning,
+		Matches: make([]LogGrepMatch, 0),
+	}
+
+	var recent []LogLine // 最近的若干行，用作前置上下文
+	var pending []int    // 仍需补充后置上下文的匹配项下标
+	err = o.src.scan(func(no int, line string) bool {
+		if !o.accept(no) {
+			return true
+		}
+		current := o.line(no, line)
+		result.TotalLines++
+
+		remain := pending[:0]
+		for _, idx := range pending {
+			m := &result.Matches[idx]
+			m.After = append(m.After, current)
+			if len(m.After) < context {
+				remain = append(remain, idx)
+			}
+		}
+		pending = remain
+
+		if match(utils.StripAnsi(line)) {
+			result.MatchCount++
+			if len(result.Matches) < limit {
+				m := LogGrepMatch{LogLine: current}
+				if len(recent) > 0 {
+					m.Before = append([]LogLine(nil), recent...)
+				}
+				result.Matches = append(result.Matches, m)
+				if context > 0 {
+					pending = append(pending, len(result.Matches)-1)
+				}
+			} else {
+				result.Limited = true
+			}
+		}
+
+		if context > 0 {
+			recent = append(recent, current)
+			if len(recent) > context {
+				recent = recent[1:]
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OpenDownload 打开日志内容的只读流，用于流式下载
+func (s *LogViewService) OpenDownload(logID string) (*models.TaskLog, io.ReadCloser, error) {
+	taskLog, err := loadTaskLog(logID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if taskLog.Status == constant.TaskStatusRunning {
+		if tl := GetActiveLog(logID); tl != nil {
+			if f, err := tl.OpenReader(); err == nil {
+				return taskLog, f, nil
+			}
+		}
+		return taskLog, io.NopCloser(strings.NewReader("")), nil
+	}
+	rc, err := OpenTaskLogReader(taskLog)
+	if err != nil {
+		return nil, nil, err
+	}
+	return taskLog, rc, nil
+}
+
+// open 校验展示选项，加载日志记录、行元数据并打开对应的数据源
+func (s *LogViewService) open(logID string, opts LogViewOptions) (*openedLog, error) {
+	stream, filter, err := ParseLogStream(opts.Stream)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.Timestamps {
+	case "", LogTimestampRelative, LogTimestampAbsolute:
+	default:
+		return nil, fmt.Errorf("不支持的时间戳显示方式: %s", opts.Timestamps)
+	}
+
+	taskLog, err := loadTaskLog(logID)
+	if err != nil {
+		return nil, err
+	}
+	o := &openedLog{taskLog: taskLog, opts: opts, stream: stream, filter: filter}
+
+	if taskLog.Status == constant.TaskStatusRunning {
+		// 运行中的日志读取 TinyLog 临时文件；远程 Agent 执行或刚结束的日志暂无本地内容
+		if tl := GetActiveLog(logID); tl != nil {
+			if f, err := tl.OpenReader(); err == nil {
+				o.src = &liveLogSource{f: f}
+				// 元数据在打开文件之后读取，保证覆盖文件中已有的每一行
+				o.base, o.metas, _ = decodeLineMeta(tl.lineMetaSnapshot())
+				return o, nil
+			}
+		}
+		o.src = emptyLogSource{}
+		return o, nil
+	}
+
+	cf, err := openLogChunks(taskLog)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志内容失败: %v", err)
+	}
+	o.src = cf
+	if o.base, o.metas, err = decodeLineMetaText(string(taskLog.LineMeta)); err != nil {
+		logger.Warnf("[TaskLog] 日志 #%s 行元数据无效: %v", taskLog.ID, err)
+	}
+	return o, nil
+}
+
+func (s *LogViewService) buildResult(o *openedLog, total, start, end int) (*LogLinesResult, error) {
+	if end > total {
+		end = total
+	}
+	result := o.newResult()
+	result.TotalLines = total
+	if start >= end {
+		return result, nil
+	}
+
+	lines, err := o.src.readLines(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		result.Lines = append(result.Lines, o.line(start+i, line))
+	}
+	if len(result.Lines) > 0 {
+		result.Start = result.Lines[0].No
+		result.End = result.Lines[len(result.Lines)-1].No
+	}
+	result.HasMore = result.End < total
+	return result, nil
+}
+
+// filteredLines 按输出流过滤后，读取第 skip 行（从 0 开始）起的 limit 行，需遍历整个日志以统计总行数
+func (s *LogViewService) filteredLines(o *openedLog, skip, limit int) (*LogLinesResult, error) {
+	result := o.newResult()
+	err := o.src.scan(func(no int, line string) bool {
+		if !o.accept(no) {
+			return true
+		}
+		if result.TotalLines >= skip && len(result.Lines) < limit {
+			result.Lines = append(result.Lines, o.line(no, line))
+		}
+		result.TotalLines++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.fillRange(result, skip+len(result.Lines) < result.TotalLines)
+	return result, nil
+}
+
+// filteredTail 按输出流过滤后读取最后 n 行
+func (s *LogViewService) filteredTail(o *openedLog, n int) (*LogLinesResult, error) {
+	result := o.newResult()
+	ring := make([]LogLine, 0, n)
+	err := o.src.scan(func(no int, line string) bool {
+		if !o.accept(no) {
+			return true
+		}
+		current := o.line(no, line)
+		if len(ring) < n {
+			ring = append(ring, current)
+		} else {
+			ring[result.TotalLines%n] = current
+		}
+		result.TotalLines++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ring) == n && result.TotalLines > n {
+		pos := result.TotalLines % n
+		ring = append(ring[pos:], ring[:pos]...)
+	}
+	result.Lines = ring
+	s.fillRange(result, false)
+	return result, nil
+}
+
+func (s *LogViewService) fillRange(result *LogLinesResult, hasMore bool) {
+	if len(result.Lines) > 0 {
+		result.Start = result.Lines[0].No
+		result.End = result.Lines[len(result.Lines)-1].No
+	}
+	result.HasMore = hasMore
+}
+
+func loadTaskLog(logID string) (*models.TaskLog, error) {
+	var taskLog models.TaskLog
+	res := database.DB.Where("id = ?", logID).Limit(1).Find(&taskLog)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrLogNotFound
+	}
+	return &taskLog, nil
+}
+
+func buildGrepMatcher(q LogGrepQuery) (func(string) bool, error) {
+	if q.Keyword == "" {
+		return nil, errors.New("检索关键字不能为空")
+	}
+	if q.Regex {
+		pattern := q.Keyword
+		if q.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式无效: %v", err)
+		}
+		return re.MatchString, nil
+	}
+	if q.IgnoreCase {
+		keyword := strings.ToLower(q.Keyword)
+		return func(line string) bool { return strings.Contains(strings.ToLower(line), keyword) }, nil
+	}
+	return func(line string) bool { return strings.Contains(line, q.Keyword) }, nil
+}
+
+// formatLogLine 按输出格式转换日志行
+func formatLogLine(line, format string) string {
+	switch format {
+	case LogFormatPlain:
+		return utils.StripAnsi(line)
+	case LogFormatHTML:
+		return utils.AnsiToHTML(line)
+	default:
+		return line
+	}
+}
+
+func clampLimit(n, def, max int) int {
+	if n <= 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// liveLogSource 运行中日志的数据源，每次操作从头顺序读取 TinyLog 临时文件
+type liveLogSource struct {
+	f *os.File
+}
+
+func (s *liveLogSource) scan(fn func(no int, line string) bool) error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(s.f, 64*1024)
+	no := 0
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			if !fn(no, line) {
+				return nil
+			}
+			no++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *liveLogSource) totalLines() (int, error) {
+	total := 0
+	err := s.scan(func(no int, line string) bool {
+		total++
+		return true
+	})
+	return total, err
+}
+
+func (s *liveLogSource) readLines(start, end int) ([]string, error) {
+	lines := make([]string, 0, end-start)
+	err := s.scan(func(no int, line string) bool {
+		if no >= end {
+			return false
+		}
+		if no >= start {
+			lines = append(lines, line)
+		}
+		return true
+	})
+	return lines, err
+}
+
+func (s *liveLogSource) Close() error {
+	return s.f.Close()
+}
+
+// emptyLogSource 暂无本地内容的日志数据源
+type emptyLogSource struct{}
+
+func (emptyLogSource) totalLines() (int, error)                     { return 0, nil }
+func (emptyLogSource) readLines(start, end int) ([]string, error)   { return nil, nil }
+func (emptyLogSource) scan(fn func(no int, line string) bool) error { return nil }
+func (emptyLogSource) Close() error                                 { return nil }
+
+// totalLines 已结束日志的总行数直接取自分块索引
+func (cf *logChunkFile) totalLines() (int, error) {
+	return cf.index.TotalLines, nil
+}
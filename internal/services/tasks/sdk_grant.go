@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/relation"
+)
+
+// SDKGrant 面板为下发到 Agent 的一次执行签发的 SDK 转发凭证
+// Agent 转发脚本的 SDK 调用时须附带该凭证，面板据此把调用限定在这次执行所属的任务内
+type SDKGrant struct {
+	AgentID   string
+	TaskID    string
+	LogID     string
+	ExpiresAt time.Time // 零值表示由签发方在执行结束时吊销
+}
+
+var sdkGrants sync.Map // 凭证 -> SDKGrant
+
+// agentSDKGrantMaxTTL Agent 申请的凭证在任务未设置超时时的有效期
+const agentSDKGrantMaxTTL = 24 * time.Hour
+
+func storeSDKGrant(grant SDKGrant) string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	sdkGrants.Store(token, grant)
+	return token
+}
+
+// IssueSDKGrant 为 Agent 上的一次执行签发凭证，执行结束后须调用 RevokeSDKGrant
+func IssueSDKGrant(agentID, taskID, logID string) string {
+	return storeSDKGrant(SDKGrant{AgentID: agentID, TaskID: taskID, LogID: logID})
+}
+
+// IssueAgentSDKGrant 为 Agent 本地定时触发的执行签发凭证，只签发给分配到该 Agent 的任务
+// 面板收到该执行的结果时吊销；结果一直未返回时按任务超时过期，未设置超时的任务 24 小时后过期
+func IssueAgentSDKGrant(agentID, taskID, logID string) (string, error) {
+	if logID == "" {
+		return "", fmt.Errorf("缺少执行日志 ID")
+	}
+	var task models.Task
+	res := database.DB.Select("id, agent_id, timeout").Where("id = ?", taskID).Limit(1).Find(&task)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return "", fmt.Errorf("任务 #%s 不存在", taskID)
+	}
+	if task.AgentID == nil || *task.AgentID != agentID {
+		return "", fmt.Errorf("任务 #%s 未分配到该 Agent", taskID)
+	}
+	ttl := agentSDKGrantMaxTTL
+	if task.Timeout > 0 && time.Duration(task.Timeout)*time.Minute < ttl {
+		ttl = time.Duration(task.Timeout) * time.Minute
+	}
+	return storeSDKGrant(SDKGrant{AgentID: agentID, TaskID: taskID, LogID: logID, ExpiresAt: time.Now().Add(ttl)}), nil
+}
+
+// RevokeSDKGrant 吊销凭证
+func RevokeSDKGrant(token string) {
+	sdkGrants.Delete(token)
+}
+
+// RevokeSDKGrantsForLog 吊销 Agent 为某次执行持有的凭证，面板收到执行结果时调用
+func RevokeSDKGrantsForLog(agentID, logID string) {
+	if logID == "" {
+		return
+	}
+	sdkGrants.Range(func(key, value any) bool {
+		if grant := value.(SDKGrant); grant.AgentID == agentID && grant.LogID == logID {
+			sdkGrants.Delete(key)
+		}
+		return true
+	})
+}
+
+// LookupSDKGrant 查找仍有效的凭证
+func LookupSDKGrant(token string) (SDKGrant, bool) {
+	if token == "" {
+		return SDKGrant{}, false
+	}
+	v, ok := sdkGrants.Load(token)
+	if !ok {
+		return SDKGrant{}, false
+	}
+	grant := v.(SDKGrant)
+	if !grant.ExpiresAt.IsZero() && time.Now().After(grant.ExpiresAt) {
+		sdkGrants.Delete(token)
+		return SDKGrant{}, false
+	}
+	return grant, true
+}
+
+// EnvScope 任务可访问的环境变量：注入全部变量的任务 all 为 true，否则为任务关联的变量 ID
+func (g SDKGrant) EnvScope() (all bool, ids []string) {
+	var task models.Task
+	if res := database.DB.Select("id, config").Where("id = ?", g.TaskID).Limit(1).Find(&task); res.Error != nil || res.RowsAffected == 0 {
+		return false, nil
+	}
+	var config models.TaskConfig
+	if task.Config != "" && json.Unmarshal([]byte(task.Config), &config) == nil && config.AllEnvs {
+		return true, nil
+	}
+	return false, relation.DataRelation.LoadRelations([]string{g.TaskID}, constant.RelationTypeTaskEnv)[g.TaskID]
+}
+
+// AllowsEnv 任务是否可以访问指定环境变量
+func (g SDKGrant) AllowsEnv(envID string) bool {
+	all, ids := g.EnvScope()
+	if all {
+		return true
+	}
+	for _, id := range ids {
+		if id == envID {
+			return true
+		}
+	}
+	return false
+}
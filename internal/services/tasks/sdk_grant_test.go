@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestSDKGrantScope(t *testing.T) {
+	setupTestDB(t, &models.Task{}, &models.DataRelation{})
+	db := database.DB
+	db.Create(&models.Task{ID: "t1", Name: "t1"})
+	db.Create(&models.Task{ID: "t2", Name: "t2", Config: `{"$task_all_envs":true}`})
+	db.Create(&models.DataRelation{ID: "r1", DataID: "t1", RelateID: "e1", Type: constant.RelationTypeTaskEnv})
+
+	token := IssueSDKGrant("a1", "t1", "l1")
+	grant, ok := LookupSDKGrant(token)
+	if !ok || grant.AgentID != "a1" || grant.TaskID != "t1" || grant.LogID != "l1" {
+		t.Fatalf("凭证内容不正确: %+v", grant)
+	}
+	if _, ok := LookupSDKGrant(""); ok {
+		t.Error("空凭证不应有效")
+	}
+
+	// 只能访问任务关联的变量，注入全部变量的任务不受限
+	if !grant.AllowsEnv("e1") || grant.AllowsEnv("e2") {
+		t.Error("变量范围应限定为任务关联的变量")
+	}
+	if !(SDKGrant{TaskID: "t2"}).AllowsEnv("e2") {
+		t.Error("注入全部变量的任务应可访问任意变量")
+	}
+	if (SDKGrant{TaskID: "missing"}).AllowsEnv("e1") {
+		t.Error("不存在的任务不应访问任何变量")
+	}
+
+	RevokeSDKGrant(token)
+	if _, ok := LookupSDKGrant(token); ok {
+		t.Error("吊销后凭证应失效")
+	}
+}
+
+func TestAgentSDKGrant(t *testing.T) {
+	setupTestDB(t, &models.Task{})
+	agentID := "a1"
+	database.DB.Create(&models.Task{ID: "t1", Name: "t1", AgentID: &agentID, Timeout: 10})
+	database.DB.Create(&models.Task{ID: "t2", Name: "t2"})
+
+	// 只为分配到该 Agent 的任务签发
+	if _, err := IssueAgentSDKGrant("a1", "t2", "l1"); err == nil {
+		t.Error("不应为未分配到该 Agent 的任务签发凭证")
+	}
+	if _, err := IssueAgentSDKGrant("a2", "t1", "l1"); err == nil {
+		t.Error("不应为其他 Agent 的任务签发凭证")
+	}
+	if _, err := IssueAgentSDKGrant("a1", "t1", ""); err == nil {
+		t.Error("缺少日志 ID 时不应签发凭证")
+	}
+
+	token, err := IssueAgentSDKGrant("a1", "t1", "l1")
+	if err != nil {
+		t.Fatalf("IssueAgentSDKGrant error: %v", err)
+	}
+	grant, ok := LookupSDKGrant(token)
+	if !ok || grant.LogID != "l1" || time.Until(grant.ExpiresAt) > 10*time.Minute {
+		t.Fatalf("凭证应按任务超时过期: %+v", grant)
+	}
+
+	// 收到执行结果后吊销
+	RevokeSDKGrantsForLog("a1", "l1")
+	if _, ok := LookupSDKGrant(token); ok {
+		t.Error("收到结果后凭证应失效")
+	}
+
+	// 结果一直未返回时过期
+	expired := storeSDKGrant(SDKGrant{AgentID: "a1", TaskID: "t1", LogID: "l2", ExpiresAt: time.Now().Add(-time.Second)})
+	if _, ok := LookupSDKGrant(expired); ok {
+		t.Error("过期的凭证应失效")
+	}
+}
@@ -0,0 +1,574 @@
+package tasks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services/relation"
+	"github.com/engigu/baihu-panel/internal/systime"
+	"github.com/engigu/baihu-panel/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxAnalyticsDays 分析接口支持的最大天数
+	maxAnalyticsDays = 365
+	// maxAnalyticsRanking 排行最多返回的任务数
+	maxAnalyticsRanking = 100
+	// minRankingRuns 参与失败率/波动排行的最少运行次数，避免偶发一两次运行霸榜
+	minRankingRuns = 3
+)
+
+// 排行方式
+const (
+	AnalyticsRankFailures    = "failures"     // 失败次数
+	AnalyticsRankFailureRate = "failure_rate" // 失败率
+	AnalyticsRankSlowest     = "slowest"      // 平均耗时
+	AnalyticsRankFlaky       = "flaky"        // 波动（成功/失败交替）程度
+)
+
+// durationBounds 耗时直方图各桶的上界（毫秒），从 10ms 起按 1.25 倍递增至 24 小时以上，分位数误差约 25%
+var durationBounds = func() []int64 {
+	var bounds []int64
+	for b := 10.0; ; b *= 1.25 {
+		bounds = append(bounds, int64(math.Ceil(b)))
+		if b > 24*3600*1000 {
+			return bounds
+		}
+	}
+}()
+
+// rollupMu 串行化预聚合的读改写（TaskLogService 存在多个实例）
+var rollupMu sync.Mutex
+
+// durationBucket 耗时所属的直方图桶序号
+func durationBucket(ms int64) int {
+	i := sort.Search(len(durationBounds), func(i int) bool { return durationBounds[i] >= ms })
+	if i == len(durationBounds) {
+		i--
+	}
+	return i
+}
+
+// durationHistogram 稀疏的耗时直方图
+type durationHistogram map[int]int64
+
+func parseHistogram(text string) durationHistogram {
+	h := make(durationHistogram)
+	h.merge(text)
+	return h
+}
+
+// merge 合并序列化后的直方图
+func (h durationHistogram) merge(text string) {
+	for _, part := range strings.Split(text, ",") {
+		idx, count, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		i, err1 := strconv.Atoi(idx)
+		n, err2 := strconv.ParseInt(count, 10, 64)
+		if err1 == nil && err2 == nil && i >= 0 && i < len(durationBounds) {
+			h[i] += n
+		}
+	}
+}
+
+func (h durationHistogram) String() string {
+	keys := make([]int, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%d:%d", k, h[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// percentile 估算分位数（取所在桶的上界），结果不超过 maxValue
+func (h durationHistogram) percentile(q float64, maxValue int64) int64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(total)))
+	var cum int64
+	for i := range durationBounds {
+		cum += h[i]
+		if cum >= target {
+			return min(durationBounds[i], maxValue)
+		}
+	}
+	return maxValue
+}
+
+// runOutcome 将运行状态归类：成功、失败（含超时）、取消；其他状态不计入
+func runOutcome(status string) (success, failed, cancelled bool) {
+	switch status {
+	case constant.TaskStatusSuccess:
+		return true, false, false
+	case constant.TaskStatusFailed, constant.TaskStatusTimeout:
+		return false, true, false
+	case constant.TaskStatusCancelled:
+		return false, false, true
+	}
+	return false, false, false
+}
+
+// rollupHour 运行所属的小时（Unix 秒），东八区为整小时偏移，直接按 UTC 截断即可
+func rollupHour(taskLog *models.TaskLog) int64 {
+	t := time.Time(taskLog.CreatedAt)
+	if taskLog.StartTime != nil {
+		t = time.Time(*taskLog.StartTime)
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.Unix() - t.Unix()%3600
+}
+
+// TaskAnalyticsService 任务运行分析服务
+type TaskAnalyticsService struct{}
+
+// NewTaskAnalyticsService 创建任务运行分析服务
+func NewTaskAnalyticsService() *TaskAnalyticsService {
+	return &TaskAnalyticsService{}
+}
+
+// Record 将一次已结束的运行计入小时预聚合
+func (s *TaskAnalyticsService) Record(taskLog *models.TaskLog) error {
+	success, failed, cancelled := runOutcome(taskLog.Status)
+	if !success && !failed && !cancelled {
+		return nil
+	}
+
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	var flip bool
+	if !cancelled {
+		// 与该任务上一次有结果的运行对比，判断结果是否发生切换
+		var prev models.TaskLog
+		res := database.DB.Select("id, status").
+			Where("task_id = ? AND id < ? AND status IN ?", taskLog.TaskID, taskLog.ID,
+				[]string{constant.TaskStatusSuccess, constant.TaskStatusFailed, constant.TaskStatusTimeout}).
+			Order("id DESC").Limit(1).Find(&prev)
+		if res.Error == nil && res.RowsAffected > 0 {
+			prevSuccess, _, _ := runOutcome(prev.Status)
+			flip = prevSuccess != success
+		}
+	}
+
+	var rollup models.TaskRunRollup
+	hour := rollupHour(taskLog)
+	res := database.DB.Where("task_id = ? AND hour = ?", taskLog.TaskID, hour).Limit(1).Find(&rollup)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		rollup = models.TaskRunRollup{ID: utils.GenerateID(), TaskID: taskLog.TaskID, Hour: hour}
+	}
+	addToRollup(&rollup, taskLog.Duration, success, failed, cancelled, flip)
+	return database.DB.Save(&rollup).Error
+}
+
+func addToRollup(r *models.TaskRunRollup, duration int64, success, failed, cancelled, flip bool) {
+	r.Runs++
+	switch {
+	case success:
+		r.Success++
+	case failed:
+		r.Failed++
+	case cancelled:
+		r.Cancelled++
+	}
+	if flip {
+		r.Flips++
+	}
+	r.DurationSum += duration
+	r.DurationMax = max(r.DurationMax, duration)
+	h := parseHistogram(string(r.Histogram))
+	h[durationBucket(duration)]++
+	r.Histogram = models.BigText(h.String())
+}
+
+// EnsureRollups 预聚合表为空而已有运行日志时（首次升级），从历史日志回填
+func (s *TaskAnalyticsService) EnsureRollups() {
+	var count int64
+	database.DB.Model(&models.TaskRunRollup{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	database.DB.Model(&models.TaskLog{}).Where("status <> ?", constant.TaskStatusRunning).Count(&count)
+	if count == 0 {
+		return
+	}
+	if err := s.Rebuild(); err != nil {
+		logger.Errorf("[Analytics] 回填运行预聚合失败: %v", err)
+	}
+}
+
+// Rebuild 清空并根据现存的运行日志重建小时预聚合（已被清理的日志无法恢复）
+func (s *TaskAnalyticsService) Rebuild() error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	// FindInBatches 按主键（与创建时间同序）分批遍历，lastSuccess 记录每个任务上一次运行的结果
+	start := time.Now()
+	rollups := make(map[string]*models.TaskRunRollup)
+	lastSuccess := make(map[string]bool)
+	var logs []models.TaskLog
+	err := database.DB.Model(&models.TaskLog{}).
+		Select("id, task_id, status, duration, start_time, created_at").
+		Where("status <> ?", constant.TaskStatusRunning).
+		FindInBatches(&logs, 1000, func(tx *gorm.DB, batch int) error {
+			for i := range logs {
+				log := &logs[i]
+				success, failed, cancelled := runOutcome(log.Status)
+				if !success && !failed && !cancelled {
+					continue
+				}
+				var flip bool
+				if !cancelled {
+					if prev, ok := lastSuccess[log.TaskID]; ok {
+						flip = prev != success
+					}
+					lastSuccess[log.TaskID] = success
+				}
+				hour := rollupHour(log)
+				key := fmt.Sprintf("%s-%d", log.TaskID, hour)
+				r, ok := rollups[key]
+				if !ok {
+					r = &models.TaskRunRollup{ID: utils.GenerateID(), TaskID: log.TaskID, Hour: hour}
+					rollups[key] = r
+				}
+				addToRollup(r, log.Duration, success, failed, cancelled, flip)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.TaskRunRollup{}).Error; err != nil {
+			return err
+		}
+		batch := make([]*models.TaskRunRollup, 0, len(rollups))
+		for _, r := range rollups {
+			batch = append(batch, r)
+		}
+		if len(batch) > 0 {
+			if err := tx.CreateInBatches(batch, 200).Error; err != nil {
+				return err
+			}
+		}
+		logger.Infof("[Analytics] 已重建 %d 条运行预聚合，耗时 %v", len(batch), time.Since(start))
+		return nil
+	})
+}
+
+// AnalyticsWindow 时间窗口内的运行统计
+type AnalyticsWindow struct {
+	Window      string  `json:"window"` // 24h、7d、30d
+	Runs        int64   `json:"runs"`
+	Success     int64   `json:"success"`
+	Failed      int64   `json:"failed"`
+	Cancelled   int64   `json:"cancelled"`
+	SuccessRate float64 `json:"success_rate"` // 成功 / (成功 + 失败)，取消的运行不计入
+	P50         int64   `json:"p50"`          // 耗时中位数（毫秒，按直方图估算）
+	P95         int64   `json:"p95"`
+	Max         int64   `json:"max"`
+	Avg         int64   `json:"avg"`
+	Flakiness   float64 `json:"flakiness"` // 相邻两次运行结果不同的比例，0 表示稳定，1 表示每次都在成功与失败之间切换
+}
+
+// AnalyticsDay 每日运行统计
+type AnalyticsDay struct {
+	Day         string  `json:"day"`
+	Runs        int64   `json:"runs"`
+	Success     int64   `json:"success"`
+	Failed      int64   `json:"failed"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// HeatmapCell 热力图单元
+type HeatmapCell struct {
+	Runs   int64 `json:"runs"`
+	Failed int64 `json:"failed"`
+}
+
+// TaskAnalytics 任务或标签的运行分析
+type TaskAnalytics struct {
+	Scope   string             `json:"scope"` // task 或 tag
+	Key     string             `json:"key"`   // 任务 ID 或标签名
+	Name    string             `json:"name"`
+	TaskIDs []string           `json:"task_ids"`
+	Days    int                `json:"days"`
+	Windows []AnalyticsWindow  `json:"windows"`
+	Daily   []AnalyticsDay     `json:"daily"`
+	Heatmap [7][24]HeatmapCell `json:"heatmap"` // [星期][小时]（东八区），星期 0 为周日
+}
+
+// windowAccumulator 汇总多行预聚合
+type windowAccumulator struct {
+	AnalyticsWindow
+	durationSum int64
+	flips       int64
+	hist        durationHistogram
+}
+
+func (a *windowAccumulator) add(r *models.TaskRunRollup) {
+	a.Runs += r.Runs
+	a.Success += r.Success
+	a.Failed += r.Failed
+	a.Cancelled += r.Cancelled
+	a.flips += r.Flips
+	a.durationSum += r.DurationSum
+	a.Max = max(a.Max, r.DurationMax)
+	if a.hist == nil {
+		a.hist = make(durationHistogram)
+	}
+	a.hist.merge(string(r.Histogram))
+}
+
+func (a *windowAccumulator) result() AnalyticsWindow {
+	w := a.AnalyticsWindow
+	if decided := w.Success + w.Failed; decided > 0 {
+		w.SuccessRate = float64(w.Success) / float64(decided)
+		if decided > 1 {
+			w.Flakiness = math.Min(1, float64(a.flips)/float64(decided-1))
+		}
+	}
+	if w.Runs > 0 {
+		w.Avg = a.durationSum / w.Runs
+		w.P50 = a.hist.percentile(0.5, w.Max)
+		w.P95 = a.hist.percentile(0.95, w.Max)
+	}
+	return w
+}
+
+func analyticsDays(days int) int {
+	if days <= 0 {
+		return 30
+	}
+	return min(days, maxAnalyticsDays)
+}
+
+func loadRollups(taskIDs []string, since time.Time) ([]models.TaskRunRollup, error) {
+	var rollups []models.TaskRunRollup
+	if len(taskIDs) == 0 {
+		return rollups, nil
+	}
+	err := database.DB.Where("task_id IN ? AND hour >= ?", taskIDs, since.Unix()-since.Unix()%3600).
+		Order("hour").Find(&rollups).Error
+	return rollups, err
+}
+
+// analyze 根据预聚合计算窗口统计、每日趋势与热力图
+func analyze(result *TaskAnalytics) (*TaskAnalytics, error) {
+	now := time.Now()
+	windows := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"24h", 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+	}
+	span := max(time.Duration(result.Days)*24*time.Hour, windows[len(windows)-1].d)
+	rollups, err := loadRollups(result.TaskIDs, now.Add(-span))
+	if err != nil {
+		return nil, err
+	}
+
+	accs := make([]windowAccumulator, len(windows))
+	for i := range accs {
+		accs[i].Window = windows[i].name
+	}
+
+	// 每日趋势覆盖最近 Days 天（含今天）
+	today := systime.InCST(now)
+	firstDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()).AddDate(0, 0, -(result.Days - 1))
+	result.Daily = make([]AnalyticsDay, result.Days)
+	dayIndex := make(map[string]int, result.Days)
+	for i := range result.Daily {
+		day := systime.FormatDate(firstDay.AddDate(0, 0, i))
+		result.Daily[i].Day = day
+		dayIndex[day] = i
+	}
+
+	for i := range rollups {
+		r := &rollups[i]
+		at := time.Unix(r.Hour, 0)
+		for j, w := range windows {
+			// 按小时聚合，窗口起点所在的小时整体计入
+			if now.Sub(at) < w.d+time.Hour {
+				accs[j].add(r)
+			}
+		}
+		if at.Before(firstDay) {
+			continue
+		}
+		local := systime.InCST(at)
+		if idx, ok := dayIndex[systime.FormatDate(local)]; ok {
+			d := &result.Daily[idx]
+			d.Runs += r.Runs
+			d.Success += r.Success
+			d.Failed += r.Failed
+		}
+		cell := &result.Heatmap[local.Weekday()][local.Hour()]
+		cell.Runs += r.Runs
+		cell.Failed += r.Failed
+	}
+
+	result.Windows = make([]AnalyticsWindow, len(accs))
+	for i := range accs {
+		result.Windows[i] = accs[i].result()
+	}
+	for i := range result.Daily {
+		d := &result.Daily[i]
+		if decided := d.Success + d.Failed; decided > 0 {
+			d.SuccessRate = float64(d.Success) / float64(decided)
+		}
+	}
+	return result, nil
+}
+
+// TaskAnalytics 单个任务的运行分析，days 为每日趋势与热力图覆盖的天数
+func (s *TaskAnalyticsService) TaskAnalytics(taskID string, days int) (*TaskAnalytics, error) {
+	var task models.Task
+	res := database.DB.Select("id, name").Where("id = ?", taskID).Limit(1).Find(&task)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return analyze(&TaskAnalytics{Scope: "task", Key: taskID, Name: task.Name, TaskIDs: []string{taskID}, Days: analyticsDays(days)})
+}
+
+// TagAnalytics 带有指定标签的全部任务的合并运行分析
+func (s *TaskAnalyticsService) TagAnalytics(tag string, days int) (*TaskAnalytics, error) {
+	taskIDs := relation.DataRelation.GetDataIDsByTag(constant.RelationTypeTaskTag, tag)
+	if taskIDs == nil {
+		taskIDs = []string{}
+	}
+	return analyze(&TaskAnalytics{Scope: "tag", Key: tag, Name: tag, TaskIDs: taskIDs, Days: analyticsDays(days)})
+}
+
+// AnalyticsRankItem 排行项
+type AnalyticsRankItem struct {
+	TaskID   string `json:"task_id"`
+	TaskName string `json:"task_name"`
+	AnalyticsWindow
+}
+
+// Ranking 最近 days 天内失败最多、失败率最高、最慢或最不稳定的任务；tag 非空时只在该标签的任务中排行
+func (s *TaskAnalyticsService) Ranking(days int, sortBy, tag string, limit int) ([]AnalyticsRankItem, error) {
+	days = analyticsDays(days)
+	if limit <= 0 || limit > maxAnalyticsRanking {
+		limit = 10
+	}
+
+	var less func(a, b *AnalyticsRankItem) bool
+	minRuns := int64(1)
+	switch sortBy {
+	case "", AnalyticsRankFailures:
+		less = func(a, b *AnalyticsRankItem) bool { return a.Failed > b.Failed }
+	case AnalyticsRankFailureRate:
+		minRuns = minRankingRuns
+		less = func(a, b *AnalyticsRankItem) bool { return a.SuccessRate < b.SuccessRate }
+	case AnalyticsRankSlowest:
+		less = func(a, b *AnalyticsRankItem) bool { return a.Avg > b.Avg }
+	case AnalyticsRankFlaky:
+		minRuns = minRankingRuns
+		less = func(a, b *AnalyticsRankItem) bool { return a.Flakiness > b.Flakiness }
+	default:
+		return nil, fmt.Errorf("不支持的排行方式: %s", sortBy)
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	query := database.DB.Where("hour >= ?", since.Unix()-since.Unix()%3600)
+	if tag != "" {
+		taskIDs := relation.DataRelation.GetDataIDsByTag(constant.RelationTypeTaskTag, tag)
+		if len(taskIDs) == 0 {
+			return []AnalyticsRankItem{}, nil
+		}
+		query = query.Where("task_id IN ?", taskIDs)
+	}
+	var rollups []models.TaskRunRollup
+	if err := query.Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+
+	accs := make(map[string]*windowAccumulator)
+	for i := range rollups {
+		r := &rollups[i]
+		acc, ok := accs[r.TaskID]
+		if !ok {
+			acc = &windowAccumulator{}
+			acc.Window = fmt.Sprintf("%dd", days)
+			accs[r.TaskID] = acc
+		}
+		acc.add(r)
+	}
+
+	items := make([]AnalyticsRankItem, 0, len(accs))
+	for taskID, acc := range accs {
+		w := acc.result()
+		if w.Success+w.Failed < minRuns {
+			continue
+		}
+		if (sortBy == "" || sortBy == AnalyticsRankFailures || sortBy == AnalyticsRankFailureRate) && w.Failed == 0 {
+			continue
+		}
+		if sortBy == AnalyticsRankFlaky && w.Flakiness == 0 {
+			continue
+		}
+		items = append(items, AnalyticsRankItem{TaskID: taskID, AnalyticsWindow: w})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if less(&items[i], &items[j]) {
+			return true
+		}
+		if less(&items[j], &items[i]) {
+			return false
+		}
+		return items[i].Runs > items[j].Runs
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	if len(items) > 0 {
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.TaskID
+		}
+		var taskList []models.Task
+		database.DB.Select("id, name").Where("id IN ?", ids).Find(&taskList)
+		names := make(map[string]string, len(taskList))
+		for _, t := range taskList {
+			names[t.ID] = t.Name
+		}
+		for i := range items {
+			items[i].TaskName = names[items[i].TaskID]
+		}
+	}
+	return items, nil
+}
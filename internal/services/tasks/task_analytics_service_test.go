@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestDurationHistogram_Percentile(t *testing.T) {
+	var r models.TaskRunRollup
+	// 90 次 100ms 左右，10 次 10s 左右
+	for i := 0; i < 90; i++ {
+		addToRollup(&r, 100, true, false, false, false)
+	}
+	for i := 0; i < 10; i++ {
+		addToRollup(&r, 10000, false, true, false, i%2 == 0)
+	}
+
+	h := parseHistogram(string(r.Histogram))
+	p50 := h.percentile(0.5, r.DurationMax)
+	if p50 < 100 || p50 > 125 {
+		t.Errorf("Expected p50 close to 100ms, got %d", p50)
+	}
+	if p95 := h.percentile(0.95, r.DurationMax); p95 != 10000 {
+		t.Errorf("Expected p95 capped at max 10000ms, got %d", p95)
+	}
+	if r.Runs != 100 || r.Success != 90 || r.Failed != 10 || r.Flips != 5 {
+		t.Errorf("Unexpected rollup counters: %+v", r)
+	}
+
+	// 序列化后再合并应得到相同的计数
+	merged := make(durationHistogram)
+	merged.merge(h.String())
+	merged.merge(h.String())
+	if merged[durationBucket(100)] != 180 {
+		t.Errorf("Expected merged bucket count 180, got %d", merged[durationBucket(100)])
+	}
+}
+
+func TestWindowAccumulator_Flakiness(t *testing.T) {
+	var a windowAccumulator
+	a.add(&models.TaskRunRollup{Runs: 5, Success: 3, Failed: 1, Cancelled: 1, Flips: 2, DurationSum: 500, DurationMax: 200, Histogram: "0:5"})
+	w := a.result()
+	if w.SuccessRate != 0.75 {
+		t.Errorf("Expected success rate 0.75 excluding cancelled runs, got %v", w.SuccessRate)
+	}
+	if w.Flakiness != 2.0/3 {
+		t.Errorf("Expected flakiness 2/3, got %v", w.Flakiness)
+	}
+	if w.Avg != 100 || w.Max != 200 {
+		t.Errorf("Unexpected avg/max: %d/%d", w.Avg, w.Max)
+	}
+}
@@ -14,18 +14,22 @@ import (
 
 // SendStatsService 接口定义（避免循环依赖）
 type SendStatsService interface {
-	IncrementStats(taskID string, status string) error
+	IncrementStats(taskID string, status string, at time.Time) error
 }
 
 // TaskLogService 任务日志服务
 type TaskLogService struct {
 	sendStatsService SendStatsService
+	searchService    *LogSearchService
+	analyticsService *TaskAnalyticsService
 }
 
 // NewTaskLogService 创建任务日志服务
 func NewTaskLogService(sendStatsService SendStatsService) *TaskLogService {
 	return &TaskLogService{
 		sendStatsService: sendStatsService,
+		searchService:    NewLogSearchService(),
+		analyticsService: NewTaskAnalyticsService(),
 	}
 }
 
@@ -35,11 +39,14 @@ type CleanConfig struct {
 	Keep int    `json:"keep"` // 保留天数或条数
 }
 
-// CreateEmptyLog 创建一个空的日志记录（任务开始时调用）
-func (s *TaskLogService) CreateEmptyLog(taskID string, command string) (*models.TaskLog, error) {
+// CreateEmptyLog 创建一个空的日志记录（任务开始时调用），logID 为空时生成新 ID
+func (s *TaskLogService) CreateEmptyLog(logID string, taskID string, command string) (*models.TaskLog, error) {
+	if logID == "" {
+		logID = utils.GenerateID()
+	}
 	startTime := models.Now()
 	taskLog := &models.TaskLog{
-		ID:        utils.GenerateID(),
+		ID:        logID,
 		TaskID:    taskID,
 		Command:   models.BigText(command),
 		Status:    "running",
@@ -58,8 +65,19 @@ func (s *TaskLogService) CreateEmptyLog(taskID string, command string) (*models.
 
 // SaveTaskLog 保存或更新任务日志
 func (s *TaskLogService) SaveTaskLog(taskLog *models.TaskLog) error {
+	isNew := taskLog.ID == ""
+	if isNew {
+		taskLog.ID = utils.GenerateID()
+		if taskLog.CreatedAt.Time().IsZero() {
+			taskLog.CreatedAt = models.Now()
+		}
+	}
+
+	// 已结束的日志按配置转存到外部存储
+	OffloadTaskLogOutput(taskLog)
+
 	var err error
-	if taskLog.ID != "" {
+	if !isNew {
 		// 先检查记录是否存在，如果不存在则创建，存在则更新
 		var count int64
 		database.DB.Model(&models.TaskLog{}).Where("id = ?", taskLog.ID).Count(&count)
@@ -69,10 +87,6 @@ func (s *TaskLogService) SaveTaskLog(taskLog *models.TaskLog) error {
 			err = database.DB.Create(taskLog).Error
 		}
 	} else {
-		taskLog.ID = utils.GenerateID()
-		if taskLog.CreatedAt.Time().IsZero() {
-			taskLog.CreatedAt = models.Now()
-		}
 		err = database.DB.Create(taskLog).Error
 	}
 
@@ -96,18 +110,35 @@ func (s *TaskLogService) UpdateTaskDuration(logID string, duration int64) error
 	return database.DB.Model(&models.TaskLog{}).Where("id = ?", logID).Update("duration", duration).Error
 }
 
+// SetLogAgent 记录运行中日志的实际执行 Agent（选择器任务在派发时才确定）
+func (s *TaskLogService) SetLogAgent(logID string, agentID string) error {
+	return database.DB.Model(&models.TaskLog{}).Where("id = ?", logID).Update("agent_id", agentID).Error
+}
+
+// SetLogFailover 记录运行中日志的故障转移目标与原因，agentID 为空表示转由本机执行
+func (s *TaskLogService) SetLogFailover(logID string, agentID string, reason string) error {
+	var agent interface{}
+	if agentID != "" {
+		agent = agentID
+	}
+	return database.DB.Model(&models.TaskLog{}).Where("id = ?", logID).Updates(map[string]interface{}{
+		"agent_id": agent,
+		"failover": reason,
+	}).Error
+}
+
 // UpdateLogCommand 更新日志中的命令内容（用于动态生成的命令脱敏）
 func (s *TaskLogService) UpdateLogCommand(logID string, command string) error {
 	return database.DB.Model(&models.TaskLog{}).Where("id = ?", logID).Update("command", models.BigText(command)).Error
 }
 
-// UpdateTaskStats 更新任务统计
-func (s *TaskLogService) UpdateTaskStats(taskID string, status string) {
+// UpdateTaskStats 更新任务统计，at 为计入统计的时间
+func (s *TaskLogService) UpdateTaskStats(taskID string, status string, at time.Time) {
 	if s.sendStatsService == nil {
 		logger.Error("[TaskLog] SendStatsService 未初始化")
 		return
 	}
-	err := s.sendStatsService.IncrementStats(taskID, status)
+	err := s.sendStatsService.IncrementStats(taskID, status, at)
 	if err != nil {
 		logger.Errorf("UpdateTaskStats err: %v", err)
 		return
@@ -140,14 +171,20 @@ func (s *TaskLogService) CleanTaskLogs(taskID string) {
 	switch config.Type {
 	case "day":
 		cutoff := systime.InCST(time.Now()).AddDate(0, 0, -config.Keep)
+		DeleteStoredTaskLogs("task_id = ? AND created_at < ?", taskID, cutoff)
+		RemoveLogChunksWhere("task_id = ? AND created_at < ?", taskID, cutoff)
 		result := database.DB.Where("task_id = ? AND created_at < ?", taskID, cutoff).Delete(&models.TaskLog{})
 		deleted = result.RowsAffected
+		database.DB.Where("task_id = ? AND created_at < ?", taskID, cutoff).Delete(&models.TaskLogIndex{})
 	case "count":
 		var boundaryLog models.TaskLog
 		res := database.DB.Where("task_id = ?", taskID).Order("id DESC").Offset(config.Keep - 1).Limit(1).Find(&boundaryLog)
 		if res.Error == nil && res.RowsAffected > 0 {
+			DeleteStoredTaskLogs("task_id = ? AND id < ?", taskID, boundaryLog.ID)
+			RemoveLogChunksWhere("task_id = ? AND id < ?", taskID, boundaryLog.ID)
 			result := database.DB.Where("task_id = ? AND id < ?", taskID, boundaryLog.ID).Delete(&models.TaskLog{})
 			deleted = result.RowsAffected
+			database.DB.Where("task_id = ? AND id < ?", taskID, boundaryLog.ID).Delete(&models.TaskLogIndex{})
 		}
 	}
 
@@ -156,18 +193,32 @@ func (s *TaskLogService) CleanTaskLogs(taskID string) {
 	}
 }
 
-// ProcessTaskCompletion 处理任务完成后的所有操作（保存日志、更新统计、清理旧日志）
+// ProcessTaskCompletion 处理任务完成后的所有操作（保存日志、更新统计、建立检索索引、清理旧日志）
 func (s *TaskLogService) ProcessTaskCompletion(taskLog *models.TaskLog) error {
 	// 1. 保存/更新日志
 	if err := s.SaveTaskLog(taskLog); err != nil {
 		return err
 	}
 
-	// 2. 更新统计
-	s.UpdateTaskStats(taskLog.TaskID, taskLog.Status)
+	// 2. 更新统计与分析预聚合
+	statsAt := time.Now()
+	if taskLog.SyncedLate && taskLog.StartTime != nil {
+		// 补传的结果计入实际执行的那一天
+		statsAt = taskLog.StartTime.Time()
+	}
+	s.UpdateTaskStats(taskLog.TaskID, taskLog.Status, statsAt)
+	if err := s.analyticsService.Record(taskLog); err != nil {
+		logger.Warnf("[TaskLog] 更新日志 #%s 运行预聚合失败: %v", taskLog.ID, err)
+	}
 
-	// 3. 异步清理旧日志
-	go s.CleanTaskLogs(taskLog.TaskID)
+	// 3. 异步建立检索索引后清理旧日志（串行执行，避免为即将被清理的日志建立索引残留）
+	logID, taskID := taskLog.ID, taskLog.TaskID
+	go func() {
+		if err := s.searchService.IndexLogByID(logID); err != nil {
+			logger.Warnf("[TaskLog] 建立日志 #%s 检索索引失败: %v", logID, err)
+		}
+		s.CleanTaskLogs(taskID)
+	}()
 
 	return nil
 }
@@ -182,22 +233,33 @@ func (s *TaskLogService) CreateTaskLogFromAgentResult(result *models.AgentTaskRe
 		compressed = ""
 	}
 
+	// 补传的结果按实际开始时间归档，SyncedLate 标记其为重连后补传
+	createdAt := models.Now()
+	if result.StartTime > 0 {
+		createdAt = models.LocalTime(time.Unix(result.StartTime, 0))
+	}
+
 	logID := result.LogID
 	if logID == "" {
-		logID = utils.GenerateID()
+		logID = utils.GenerateIDAt(createdAt.Time())
 	}
 
 	taskLog := &models.TaskLog{
-		ID:        logID,
-		TaskID:    result.TaskID,
-		AgentID:   &result.AgentID,
-		Command:   models.BigText(result.Command),
-		Output:    models.BigText(compressed),
-		Error:     models.BigText(result.Error),
-		Status:    result.Status,
-		Duration:  result.Duration,
-		ExitCode:  result.ExitCode,
-		CreatedAt: models.Now(),
+		ID:         logID,
+		TaskID:     result.TaskID,
+		AgentID:    &result.AgentID,
+		Command:    models.BigText(result.Command),
+		Output:     models.BigText(compressed),
+		Error:      models.BigText(result.Error),
+		Status:     result.Status,
+		Duration:   result.Duration,
+		ExitCode:   result.ExitCode,
+		CreatedAt:  createdAt,
+		SyncedLate: result.SpooledAt > 0,
+	}
+
+	if result.Usage != nil {
+		taskLog.ResourceUsage = *result.Usage
 	}
 
 	// 处理开始和结束时间
@@ -0,0 +1,40 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/rs/xid"
+)
+
+func TestCreateTaskLogFromSpooledResult(t *testing.T) {
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	result := &models.AgentTaskResult{
+		TaskID:    "task1",
+		AgentID:   "agent1",
+		Status:    "success",
+		StartTime: start.Unix(),
+		EndTime:   start.Add(time.Minute).Unix(),
+		SpooledAt: time.Now().Unix(),
+	}
+
+	taskLog, err := NewTaskLogService(nil).CreateTaskLogFromAgentResult(result)
+	if err != nil {
+		t.Fatalf("CreateTaskLogFromAgentResult error: %v", err)
+	}
+	if !taskLog.SyncedLate {
+		t.Error("spooled result should be marked SyncedLate")
+	}
+	if !taskLog.CreatedAt.Time().Equal(start) {
+		t.Errorf("CreatedAt = %v, want start time %v", taskLog.CreatedAt.Time(), start)
+	}
+	// 历史按 ID 排序，补传的记录应排在实际执行时间的位置
+	id, err := xid.FromString(taskLog.ID)
+	if err != nil {
+		t.Fatalf("invalid log ID %q: %v", taskLog.ID, err)
+	}
+	if !id.Time().Equal(start) {
+		t.Errorf("log ID time = %v, want %v", id.Time(), start)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/engigu/baihu-panel/internal/constant"
 	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/eventbus"
 	"github.com/engigu/baihu-panel/internal/models"
 	"github.com/engigu/baihu-panel/internal/services/relation"
 	"github.com/engigu/baihu-panel/internal/utils"
@@ -27,6 +28,10 @@ type TaskParam struct {
 	Envs          string
 	Languages     models.TaskLanguages
 	AgentID       *string
+	AgentSelector string
+	AgentStrategy string
+	SyncFiles     string
+	Failover      models.TaskFailover
 	TriggerType   string
 	RetryCount    int
 	RetryInterval int
@@ -83,6 +88,10 @@ func (ts *TaskService) CreateTask(p *TaskParam) *models.Task {
 		Envs:          models.BigText(p.Envs),
 		Languages:     p.Languages,
 		AgentID:       p.AgentID,
+		AgentSelector: p.AgentSelector,
+		AgentStrategy: p.AgentStrategy,
+		SyncFiles:     p.SyncFiles,
+		Failover:      p.Failover,
 		Enabled:       utils.BoolPtr(true),
 		RetryCount:    p.RetryCount,
 		RetryInterval: p.RetryInterval,
@@ -99,6 +108,7 @@ func (ts *TaskService) CreateTask(p *TaskParam) *models.Task {
 	task.Tags = p.Tags
 	relation.DataRelation.SaveRelations(task.ID, constant.RelationTypeTaskEnv, p.Envs)
 	task.Envs = models.BigText(p.Envs)
+	publishDataChanged()
 
 	return task
 }
@@ -203,6 +213,10 @@ func (ts *TaskService) UpdateTask(id string, p *TaskParam) *models.Task {
 	task.CleanConfig = p.CleanConfig
 	task.Enabled = &p.Enabled
 	task.AgentID = p.AgentID
+	task.AgentSelector = p.AgentSelector
+	task.AgentStrategy = p.AgentStrategy
+	task.SyncFiles = p.SyncFiles
+	task.Failover = p.Failover
 	task.Languages = p.Languages
 	task.Config = models.BigText(p.Config)
 	task.RetryCount = p.RetryCount
@@ -220,7 +234,7 @@ func (ts *TaskService) UpdateTask(id string, p *TaskParam) *models.Task {
 
 	database.DB.Model(&task).Select(
 		"Name", "Remark", "Command", "Tags", "Schedule", "Timeout", "WorkDir",
-		"CleanConfig", "Enabled", "AgentID", "Languages",
+		"CleanConfig", "Enabled", "AgentID", "AgentSelector", "AgentStrategy", "SyncFiles", "Failover", "Languages",
 		"RetryCount", "RetryInterval", "RandomRange", "Type",
 		"TriggerType", "Config", "SourceID", "PinType",
 		"PreCommand", "PostCommand",
@@ -230,6 +244,7 @@ func (ts *TaskService) UpdateTask(id string, p *TaskParam) *models.Task {
 	task.Tags = p.Tags
 	relation.DataRelation.SaveRelations(task.ID, constant.RelationTypeTaskEnv, p.Envs)
 	task.Envs = models.BigText(p.Envs)
+	publishDataChanged()
 
 	return &task
 }
@@ -241,6 +256,7 @@ func (ts *TaskService) DeleteTask(id string) bool {
 	relation.DataRelation.CleanRelations(id, constant.RelationTypeTaskEnv)
 
 	result := database.DB.Where("id = ?", id).Delete(&models.Task{})
+	publishDataChanged()
 	return result.RowsAffected > 0
 }
 
@@ -251,9 +267,15 @@ func (ts *TaskService) BatchDeleteTasks(ids []string) int64 {
 	database.DB.Where("type = ? AND data_id IN ?", constant.RelationTypeTaskEnv, ids).Delete(&models.DataRelation{})
 
 	result := database.DB.Where("id IN ?", ids).Delete(&models.Task{})
+	publishDataChanged()
 	return result.RowsAffected
 }
 
+// publishDataChanged 通知任务数据已变更，托管同步据此推送到子节点
+func publishDataChanged() {
+	eventbus.DefaultBus.Publish(eventbus.Event{Type: constant.EventDataChanged})
+}
+
 // GetAllTags 获取所有任务标签
 func (ts *TaskService) GetAllTags() ([]string, error) {
 	return relation.DataRelation.GetAllTags(constant.RelationTypeTaskTag)
@@ -0,0 +1,176 @@
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/systime"
+)
+
+const (
+	// maxUsageTrendPoints 单个任务资源趋势最多返回的运行次数
+	maxUsageTrendPoints = 1000
+	// maxUsageRankingSize 资源排行最多返回的任务数
+	maxUsageRankingSize = 100
+)
+
+// 资源排行的排序方式
+const (
+	UsageSortCPU = "cpu"
+	UsageSortRSS = "rss"
+	UsageSortIO  = "io"
+)
+
+// UsagePoint 单次运行的资源占用
+type UsagePoint struct {
+	LogID     string            `json:"log_id"`
+	StartTime *models.LocalTime `json:"start_time"`
+	Status    string            `json:"status"`
+	Duration  int64             `json:"duration"`
+	models.ResourceUsage
+}
+
+// UsageSummary 资源占用汇总
+type UsageSummary struct {
+	Runs       int64   `json:"runs"`        // 已采集到资源占用的运行次数
+	AvgCPU     float64 `json:"avg_cpu"`     // 平均 CPU 时间（用户态+内核态，毫秒）
+	MaxCPU     int64   `json:"max_cpu"`     // 单次最大 CPU 时间（毫秒）
+	AvgRSS     float64 `json:"avg_rss"`     // 单个进程峰值内存的平均值（字节）
+	MaxRSS     int64   `json:"max_rss"`     // 单个进程峰值内存的最大值（字节）
+	ReadBytes  int64   `json:"read_bytes"`  // 累计读取字节数
+	WriteBytes int64   `json:"write_bytes"` // 累计写入字节数
+}
+
+// UsageTrend 单个任务的资源占用趋势
+type UsageTrend struct {
+	TaskID  string       `json:"task_id"`
+	Days    int          `json:"days"`
+	Points  []UsagePoint `json:"points"`
+	Summary UsageSummary `json:"summary"`
+}
+
+// UsageRankItem 资源排行项
+type UsageRankItem struct {
+	TaskID     string `json:"task_id"`
+	TaskName   string `json:"task_name"`
+	Runs       int64  `json:"runs"`
+	TotalCPU   int64  `json:"total_cpu"` // 累计 CPU 时间（毫秒）
+	MaxRSS     int64  `json:"max_rss"` // 单个进程峰值内存的最大值（字节）
+	ReadBytes  int64  `json:"read_bytes"`
+	WriteBytes int64  `json:"write_bytes"`
+}
+
+// TaskUsageService 任务资源占用统计服务
+type TaskUsageService struct{}
+
+// NewTaskUsageService 创建任务资源占用统计服务
+func NewTaskUsageService() *TaskUsageService {
+	return &TaskUsageService{}
+}
+
+// usageSince 统计窗口的起始时间
+func usageSince(days int) time.Time {
+	return systime.InCST(time.Now()).AddDate(0, 0, -days)
+}
+
+// Trend 获取任务最近 days 天内每次运行的资源占用（按开始时间升序），运行中与未采集到资源占用的记录不计入
+func (s *TaskUsageService) Trend(taskID string, days, limit int) (*UsageTrend, error) {
+	if limit <= 0 || limit > maxUsageTrendPoints {
+		limit = maxUsageTrendPoints
+	}
+
+	var logs []models.TaskLog
+	err := database.DB.Model(&models.TaskLog{}).
+		Select("id, status, duration, start_time, user_cpu, system_cpu, max_rss, read_bytes, write_bytes").
+		Where("task_id = ? AND status <> ? AND created_at >= ?", taskID, constant.TaskStatusRunning, usageSince(days)).
+		Where("user_cpu + system_cpu + max_rss + read_bytes + write_bytes > 0").
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	trend := &UsageTrend{TaskID: taskID, Days: days, Points: make([]UsagePoint, 0, len(logs))}
+	var cpuSum, rssSum int64
+	sum := &trend.Summary
+	for i := len(logs) - 1; i >= 0; i-- {
+		log := logs[i]
+		trend.Points = append(trend.Points, UsagePoint{
+			LogID:         log.ID,
+			StartTime:     log.StartTime,
+			Status:        log.Status,
+			Duration:      log.Duration,
+			ResourceUsage: log.ResourceUsage,
+		})
+
+		cpu := log.UserCPU + log.SystemCPU
+		cpuSum += cpu
+		rssSum += log.MaxRSS
+		sum.MaxCPU = max(sum.MaxCPU, cpu)
+		sum.MaxRSS = max(sum.MaxRSS, log.MaxRSS)
+		sum.ReadBytes += log.ReadBytes
+		sum.WriteBytes += log.WriteBytes
+	}
+	if n := int64(len(logs)); n > 0 {
+		sum.Runs = n
+		sum.AvgCPU = float64(cpuSum) / float64(n)
+		sum.AvgRSS = float64(rssSum) / float64(n)
+	}
+	return trend, nil
+}
+
+// Ranking 获取最近 days 天内资源占用最高的任务
+func (s *TaskUsageService) Ranking(days int, sortBy string, limit int) ([]UsageRankItem, error) {
+	if limit <= 0 || limit > maxUsageRankingSize {
+		limit = maxUsageRankingSize
+	}
+
+	// 排序使用聚合表达式而非别名，PostgreSQL 不允许在 ORDER BY 表达式中引用别名
+	var order string
+	switch sortBy {
+	case "", UsageSortCPU:
+		order = "SUM(user_cpu + system_cpu) DESC"
+	case UsageSortRSS:
+		order = "MAX(max_rss) DESC"
+	case UsageSortIO:
+		order = "SUM(read_bytes + write_bytes) DESC"
+	default:
+		return nil, fmt.Errorf("不支持的排序方式: %s", sortBy)
+	}
+
+	items := make([]UsageRankItem, 0)
+	err := database.DB.Model(&models.TaskLog{}).
+		Select("task_id, COUNT(*) AS runs, SUM(user_cpu + system_cpu) AS total_cpu, MAX(max_rss) AS max_rss, " +
+			"SUM(read_bytes) AS read_bytes, SUM(write_bytes) AS write_bytes").
+		Where("status <> ? AND created_at >= ?", constant.TaskStatusRunning, usageSince(days)).
+		Where("user_cpu + system_cpu + max_rss + read_bytes + write_bytes > 0").
+		Group("task_id").
+		Order(order).
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.TaskID
+	}
+	var taskList []models.Task
+	database.DB.Select("id, name").Where("id IN ?", ids).Find(&taskList)
+	names := make(map[string]string, len(taskList))
+	for _, t := range taskList {
+		names[t.ID] = t.Name
+	}
+	for i := range items {
+		items[i].TaskName = names[items[i].TaskID]
+	}
+	return items, nil
+}
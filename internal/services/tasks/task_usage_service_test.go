@@ -0,0 +1,62 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+)
+
+func TestTaskUsageTrendAndRanking(t *testing.T) {
+	setupTestDB(t, &models.Task{}, &models.TaskLog{})
+	db := database.DB
+	db.Create(&models.Task{ID: "t1", Name: "heavy-cpu"})
+	db.Create(&models.Task{ID: "t2", Name: "heavy-io"})
+
+	now := time.Now()
+	addLog := func(id, taskID, status string, ago time.Duration, usage models.ResourceUsage) {
+		start := models.LocalTime(now.Add(-ago))
+		db.Create(&models.TaskLog{ID: id, TaskID: taskID, Status: status, StartTime: &start, CreatedAt: start, ResourceUsage: usage})
+	}
+	addLog("l1", "t1", constant.TaskStatusSuccess, 3*time.Hour, models.ResourceUsage{UserCPU: 300, SystemCPU: 100, MaxRSS: 1000})
+	addLog("l2", "t1", constant.TaskStatusFailed, 2*time.Hour, models.ResourceUsage{UserCPU: 100, MaxRSS: 3000, ReadBytes: 10})
+	addLog("l3", "t1", constant.TaskStatusRunning, time.Hour, models.ResourceUsage{UserCPU: 9999})     // 运行中不计入
+	addLog("l4", "t1", constant.TaskStatusSuccess, time.Hour, models.ResourceUsage{})                  // 未采集到不计入
+	addLog("l5", "t1", constant.TaskStatusSuccess, 10*24*time.Hour, models.ResourceUsage{UserCPU: 50}) // 超出统计窗口
+	addLog("l6", "t2", constant.TaskStatusSuccess, time.Hour, models.ResourceUsage{UserCPU: 10, MaxRSS: 500, ReadBytes: 4000, WriteBytes: 6000})
+
+	s := NewTaskUsageService()
+	trend, err := s.Trend("t1", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend.Points) != 2 || trend.Points[0].LogID != "l1" || trend.Points[1].LogID != "l2" {
+		t.Fatalf("趋势应按开始时间升序且只包含已结束并采集到资源的运行: %+v", trend.Points)
+	}
+	sum := trend.Summary
+	if sum.Runs != 2 || sum.AvgCPU != 250 || sum.MaxCPU != 400 || sum.AvgRSS != 2000 || sum.MaxRSS != 3000 || sum.ReadBytes != 10 {
+		t.Errorf("汇总不正确: %+v", sum)
+	}
+	if trend, _ := s.Trend("t1", 7, 1); len(trend.Points) != 1 || trend.Points[0].LogID != "l2" {
+		t.Errorf("限制条数时应保留最近的运行: %+v", trend.Points)
+	}
+
+	for sortBy, first := range map[string]string{UsageSortCPU: "t1", UsageSortRSS: "t1", UsageSortIO: "t2"} {
+		items, err := s.Ranking(7, sortBy, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 || items[0].TaskID != first {
+			t.Errorf("按 %s 排序结果不正确: %+v", sortBy, items)
+		}
+	}
+	items, _ := s.Ranking(7, UsageSortCPU, 0)
+	if items[0].TaskName != "heavy-cpu" || items[0].Runs != 2 || items[0].TotalCPU != 500 || items[0].MaxRSS != 3000 {
+		t.Errorf("排行聚合不正确: %+v", items[0])
+	}
+	if _, err := s.Ranking(7, "bogus", 0); err == nil {
+		t.Error("应拒绝不支持的排序方式")
+	}
+}
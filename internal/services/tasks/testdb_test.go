@@ -0,0 +1,22 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 使用内存 SQLite 作为测试库并迁移测试需要的表
+func setupTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("无法开启 SQLite 内存测试库: %v", err)
+	}
+	database.DB = db
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/engigu/baihu-panel/internal/constant"
@@ -64,9 +65,14 @@ type TinyLog struct {
 	path        string
 	writer      *bufio.Writer
 	subscribers []chan []byte
-	remainder   []byte   // Leftover bytes from previous write (partial lines)
-	masks       []string // Secrets to mask
+	remainder   []byte    // Leftover bytes from previous write (partial lines)
+	remainders  [2][]byte // stderr 与系统输出流遗留的不完整行
+	masks       []string  // Secrets to mask
 	closed      bool
+
+	meta     *lineMetaEncoder // 每行的输出流与到达时间
+	lineOpen bool             // 文件末尾的行尚未以换行符结束
+	lineMeta string           // CompressAndCleanup 后得到的行元数据编码
 }
 
 // NewTinyLog 创建一个新的 TinyLog 实例（基于临时文件存储）并注册它，支持将配置的 masks 替换为 ********
@@ -83,13 +89,32 @@ func NewTinyLog(logID string, masks []string) (*TinyLog, error) {
 		writer:      bufio.NewWriter(f),
 		subscribers: make([]chan []byte, 0),
 		masks:       masks,
+		meta:        newLineMetaEncoder(time.Now().UnixMilli()),
 	}
 	globalTinyLogManager.Register(tl)
 	return tl, nil
 }
 
-// Write 实现 io.Writer 接口
+// Write 实现 io.Writer 接口，写入的内容记为标准输出
 func (l *TinyLog) Write(p []byte) (n int, err error) {
+	return l.write(LogStreamStdout, p)
+}
+
+// Stream 返回写入指定输出流的 Writer，各输出流的不完整行分别缓冲，按完整行交错写入同一日志
+func (l *TinyLog) Stream(stream LogStream) io.Writer {
+	return &tinyLogStream{l: l, stream: stream}
+}
+
+type tinyLogStream struct {
+	l      *TinyLog
+	stream LogStream
+}
+
+func (w *tinyLogStream) Write(p []byte) (int, error) {
+	return w.l.write(w.stream, p)
+}
+
+func (l *TinyLog) write(stream LogStream, p []byte) (n int, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -99,12 +124,13 @@ func (l *TinyLog) Write(p []byte) (n int, err error) {
 
 	originalInputLen := len(p)
 	var payload []byte
-	if len(l.remainder) > 0 {
-		// 为了防止 p 和 l.remainder 底层数组有重叠或不可预期的修改，这里分配新内存
-		payload = make([]byte, len(l.remainder)+len(p))
-		copy(payload, l.remainder)
-		copy(payload[len(l.remainder):], p)
-		l.remainder = nil
+	rem := l.remainderOf(stream)
+	if len(*rem) > 0 {
+		// 为了防止 p 和 remainder 底层数组有重叠或不可预期的修改，这里分配新内存
+		payload = make([]byte, len(*rem)+len(p))
+		copy(payload, *rem)
+		copy(payload[len(*rem):], p)
+		*rem = nil
 	} else {
 		payload = p
 	}
@@ -135,42 +161,85 @@ func (l *TinyLog) Write(p []byte) (n int, err error) {
 			remainder = payload[lastSafe:]
 		} else {
 			// 保留当前所有内容到下一轮 (必须 copy，因为 payload 底层可能是 io.Copy 的复用 buf)
-			l.remainder = make([]byte, len(payload))
-			copy(l.remainder, payload)
+			*rem = make([]byte, len(payload))
+			copy(*rem, payload)
 			return originalInputLen, nil
 		}
 	}
 
 	// 4. 将剩余部分保存 (必须 copy，防止后续 Read 覆盖底层数组)
 	if len(remainder) > 0 {
-		l.remainder = make([]byte, len(remainder))
-		copy(l.remainder, remainder)
+		*rem = make([]byte, len(remainder))
+		copy(*rem, remainder)
 	} else {
-		l.remainder = nil
+		*rem = nil
 	}
 
 	// 5. 将完整行转换为 UTF-8 并脱敏
 	text := utils.MaskSecrets(utils.ToUTF8(completeBytes), l.masks)
-	outData := []byte(text)
-
-	// 6. 输出安全部分
-	_, err = l.writer.Write(outData)
-	if err != nil {
+	if err := l.output(stream, []byte(text)); err != nil {
 		return 0, err
 	}
+	return originalInputLen, nil
+}
+
+// remainderOf 返回指定输出流的不完整行缓冲
+func (l *TinyLog) remainderOf(stream LogStream) *[]byte {
+	if stream == LogStreamStdout || int(stream) > len(l.remainders) {
+		return &l.remainder
+	}
+	return &l.remainders[stream-1]
+}
 
-	// 6. 广播给所有订阅者
-	if len(l.subscribers) > 0 {
-		for _, ch := range l.subscribers {
-			select {
-			case ch <- outData:
-			default:
-				// 如果订阅者处理太慢，丢弃消息以避免阻塞写入
-			}
+// output 写入临时文件、记录行元数据并广播给订阅者，调用方需持有锁
+func (l *TinyLog) output(stream LogStream, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := l.writer.Write(data); err != nil {
+		return err
+	}
+	l.recordLines(stream, data)
+
+	// 广播给所有订阅者
+	for _, ch := range l.subscribers {
+		select {
+		case ch <- data:
+		default:
+			// 如果订阅者处理太慢，丢弃消息以避免阻塞写入
 		}
 	}
+	return nil
+}
 
-	return originalInputLen, nil
+// recordLines 为 data 中新开始的每一行记录输出流与到达时间
+// 行以 \n 划分，与日志查看接口的行号一致；接在未结束的行之后的内容沿用该行的记录
+func (l *TinyLog) recordLines(stream LogStream, data []byte) {
+	if l.meta != nil {
+		now := time.Now().UnixMilli()
+		pos := 0
+		if l.lineOpen {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				pos = len(data)
+			} else {
+				pos = idx + 1
+			}
+		}
+		for pos < len(data) {
+			l.meta.add(now, stream)
+			idx := bytes.IndexByte(data[pos:], '\n')
+			if idx < 0 {
+				break
+			}
+			pos += idx + 1
+		}
+		if len(l.meta.buf) > maxLineMetaSize {
+			logger.Warnf("[TinyLog] 日志 #%s 行数过多，停止记录行元数据", l.LogID)
+			l.meta = nil
+		}
+	}
+	l.lineOpen = data[len(data)-1] != '\n'
 }
 
 // WriteString 方便地写入字符串
@@ -210,20 +279,13 @@ func (l *TinyLog) Close() error {
 		return nil
 	}
 
-	// 处理剩余的字节
-	if len(l.remainder) > 0 {
-		text := utils.MaskSecrets(utils.ToUTF8(l.remainder), l.masks)
-		data := []byte(text)
-		_, _ = l.writer.Write(data)
-
-		// 通知订阅者最后一部分内容
-		for _, ch := range l.subscribers {
-			select {
-			case ch <- data:
-			default:
-			}
+	// 处理各输出流剩余的字节，并通知订阅者最后一部分内容
+	for _, stream := range []LogStream{LogStreamStdout, LogStreamStderr, LogStreamSystem} {
+		if rem := l.remainderOf(stream); len(*rem) > 0 {
+			text := utils.MaskSecrets(utils.ToUTF8(*rem), l.masks)
+			_ = l.output(stream, []byte(text))
+			*rem = nil
 		}
-		l.remainder = nil
 	}
 
 	// 将缓冲区刷新到文件
@@ -268,6 +330,7 @@ func (l *TinyLog) CompressAndCleanup() (string, error) {
 
 	// 如果日志极短，免去压缩和 Base64 编码，直接以 raw: 明文形式返回
 	if size <= int64(utils.MinCompressSize) {
+		l.finishLineMeta(nil, 0)
 		content, err := io.ReadAll(f)
 		if err != nil {
 			return "", err
@@ -298,6 +361,10 @@ func (l *TinyLog) CompressAndCleanup() (string, error) {
 		}
 	}
 
+	if err := l.finishLineMeta(f, readStart); err != nil {
+		return "", err
+	}
+
 	if readStart > 0 {
 		if _, err := f.Seek(readStart, io.SeekStart); err != nil {
 			return "", err
@@ -320,6 +387,70 @@ func (l *TinyLog) CompressAndCleanup() (string, error) {
 	return "zstd:" + buf.String(), nil
 }
 
+// LineMeta 返回 CompressAndCleanup 之后的行元数据编码，与压缩后的日志内容逐行对应
+func (l *TinyLog) LineMeta() string {
+	return l.lineMeta
+}
+
+// finishLineMeta 生成最终的行元数据编码；日志头部被截断时丢弃被截掉的行，并为截断提示补充系统行
+func (l *TinyLog) finishLineMeta(f *os.File, readStart int64) error {
+	if l.meta == nil {
+		return nil
+	}
+	if readStart == 0 {
+		l.lineMeta = encodeLineMetaText(l.meta.buf)
+		return nil
+	}
+
+	// 统计被截掉部分的换行数，即保留内容首行的行号
+	skipped := 0
+	buf := make([]byte, 64*1024)
+	for remain := readStart; remain > 0; {
+		chunk := buf
+		if remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		n, err := f.Read(chunk)
+		skipped += bytes.Count(chunk[:n], []byte{'\n'})
+		remain -= int64(n)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+
+	base, metas, err := decodeLineMeta(l.meta.buf)
+	if err != nil {
+		return nil
+	}
+	enc := newLineMetaEncoder(base)
+	at := base
+	if skipped < len(metas) {
+		at = metas[skipped].At
+	}
+	// 截断提示占 4 行，见 CompressAndCleanup
+	for i := 0; i < 4; i++ {
+		enc.add(at, LogStreamSystem)
+	}
+	for i := skipped; i < len(metas); i++ {
+		enc.add(metas[i].At, metas[i].Stream)
+	}
+	l.lineMeta = encodeLineMetaText(enc.buf)
+	return nil
+}
+
+// lineMetaSnapshot 返回运行中日志当前的行元数据
+func (l *TinyLog) lineMetaSnapshot() []byte {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.meta == nil {
+		return nil
+	}
+	return append([]byte(nil), l.meta.buf...)
+}
+
 // ReadLastLines 返回日志的最后 n 行
 func (l *TinyLog) ReadLastLines(n int) ([]byte, error) {
 	l.mu.RLock()
@@ -359,6 +490,16 @@ func (l *TinyLog) ReadLastLines(n int) ([]byte, error) {
 	return data, nil
 }
 
+// OpenReader 刷新缓冲后打开临时文件，返回当前已写入内容的只读句柄（调用方负责关闭）
+func (l *TinyLog) OpenReader() (*os.File, error) {
+	l.mu.Lock()
+	if !l.closed {
+		_ = l.writer.Flush()
+	}
+	l.mu.Unlock()
+	return os.Open(l.path)
+}
+
 // GetPath 返回临时文件路径
 func (l *TinyLog) GetPath() string {
 	return l.path
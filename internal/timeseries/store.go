@@ -0,0 +1,230 @@
+// Package timeseries 固定容量、逐级降采样的内存时序存储
+package timeseries
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tier 存储层级：按 Resolution 聚合，环形保留最近 Capacity 个点
+type Tier struct {
+	Resolution time.Duration
+	Capacity   int
+}
+
+// Retention 层级覆盖的时间跨度
+func (t Tier) Retention() time.Duration {
+	return t.Resolution * time.Duration(t.Capacity)
+}
+
+// Point 一个聚合点，Avg/Max 与 Store 的指标名称一一对应
+type Point struct {
+	Time  int64     `json:"time"`  // 时间桶起点（Unix 秒）
+	Count int       `json:"count"` // 参与聚合的原始采样数
+	Avg   []float64 `json:"avg"`
+	Max   []float64 `json:"max"`
+}
+
+// Flushed 已完成聚合、可持久化的点
+type Flushed struct {
+	Tier  int
+	Slot  int
+	Point Point
+}
+
+type ring struct {
+	tier    Tier
+	points  []Point // 按 slot 存放，Count 为 0 表示空
+	pending Point   // 正在聚合的时间桶
+}
+
+// Store 多层级时序存储
+// 原始采样先聚合到第一层，每完成一个点再向下一层级联聚合
+type Store struct {
+	mu    sync.RWMutex
+	names []string
+	rings []*ring
+	now   func() time.Time
+}
+
+// NewStore 创建时序存储，tiers 须按分辨率由细到粗排列
+func NewStore(names []string, tiers ...Tier) *Store {
+	s := &Store{names: append([]string(nil), names...), now: time.Now}
+	for _, t := range tiers {
+		s.rings = append(s.rings, &ring{tier: t, points: make([]Point, t.Capacity)})
+	}
+	return s
+}
+
+// Names 指标名称
+func (s *Store) Names() []string {
+	return s.names
+}
+
+// Tiers 存储层级
+func (s *Store) Tiers() []Tier {
+	tiers := make([]Tier, len(s.rings))
+	for i, r := range s.rings {
+		tiers[i] = r.tier
+	}
+	return tiers
+}
+
+// Slot 时间桶在环形缓冲中的位置
+func (t Tier) Slot(bucket int64) int {
+	return int((bucket / int64(t.Resolution/time.Second)) % int64(t.Capacity))
+}
+
+func (t Tier) bucket(unix int64) int64 {
+	res := int64(t.Resolution / time.Second)
+	return unix - unix%res
+}
+
+// Add 写入一次原始采样，返回因时间桶切换而完成聚合的点
+func (s *Store) Add(at time.Time, values []float64) []Flushed {
+	if len(values) != len(s.names) || len(s.rings) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := Point{Time: at.Unix(), Count: 1, Avg: values, Max: values}
+	var flushed []Flushed
+	s.accumulate(0, sample, &flushed)
+	return flushed
+}
+
+// accumulate 将 p 聚合进第 i 层的当前时间桶，时间桶切换时完成旧桶并级联到下一层
+func (s *Store) accumulate(i int, p Point, flushed *[]Flushed) {
+	r := s.rings[i]
+	bucket := r.tier.bucket(p.Time)
+	if r.pending.Count > 0 && r.pending.Time != bucket {
+		if bucket < r.pending.Time {
+			// 时钟回拨时丢弃过期采样
+			return
+		}
+		done := r.pending
+		slot := r.tier.Slot(done.Time)
+		r.points[slot] = done
+		*flushed = append(*flushed, Flushed{Tier: i, Slot: slot, Point: done})
+		r.pending = Point{}
+		if i+1 < len(s.rings) {
+			s.accumulate(i+1, done, flushed)
+		}
+	}
+	r.pending = merge(r.pending, bucket, p)
+}
+
+// merge 按采样数加权合并平均值，取最大值的最大值
+func merge(acc Point, bucket int64, p Point) Point {
+	if acc.Count == 0 {
+		return Point{
+			Time:  bucket,
+			Count: p.Count,
+			Avg:   append([]float64(nil), p.Avg...),
+			Max:   append([]float64(nil), p.Max...),
+		}
+	}
+	total := float64(acc.Count + p.Count)
+	for k := range acc.Avg {
+		acc.Avg[k] = (acc.Avg[k]*float64(acc.Count) + p.Avg[k]*float64(p.Count)) / total
+		acc.Max[k] = max(acc.Max[k], p.Max[k])
+	}
+	acc.Count += p.Count
+	return acc
+}
+
+// Restore 恢复持久化的点，全部恢复后应调用 Rebuild
+func (s *Store) Restore(tier int, p Point) {
+	if tier < 0 || tier >= len(s.rings) || p.Count == 0 || len(p.Avg) != len(s.names) || len(p.Max) != len(s.names) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rings[tier]
+	slot := r.tier.Slot(p.Time)
+	if r.points[slot].Count == 0 || r.points[slot].Time < p.Time {
+		r.points[slot] = p
+	}
+}
+
+// Rebuild 根据上一层已恢复的点重建各层尚未完成的时间桶，避免重启丢失粗粒度层级的部分数据
+func (s *Store) Rebuild() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 1; i < len(s.rings); i++ {
+		r := s.rings[i]
+		var last int64 = -1
+		for _, p := range r.points {
+			if p.Count > 0 && p.Time > last {
+				last = p.Time
+			}
+		}
+		var after int64
+		if last >= 0 {
+			after = last + int64(r.tier.Resolution/time.Second)
+		}
+		r.pending = Point{}
+		for _, p := range s.rings[i-1].sorted() {
+			if p.Time < after {
+				continue
+			}
+			bucket := r.tier.bucket(p.Time)
+			if r.pending.Count > 0 && r.pending.Time != bucket {
+				// 只保留最新的未完成时间桶，更早的桶已无法补齐
+				r.pending = Point{}
+			}
+			r.pending = merge(r.pending, bucket, p)
+		}
+	}
+}
+
+// sorted 按时间升序返回非空的点
+func (r *ring) sorted() []Point {
+	points := make([]Point, 0, len(r.points))
+	for _, p := range r.points {
+		if p.Count > 0 {
+			points = append(points, p)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return points
+}
+
+// Query 查询 [from, to] 内的点，选用能覆盖 from 的最细层级；includePending 为真时附带正在聚合的时间桶
+func (s *Store) Query(from, to time.Time, includePending bool) (Tier, []Point) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.rings) == 0 {
+		return Tier{}, nil
+	}
+
+	r := s.rings[len(s.rings)-1]
+	for _, candidate := range s.rings {
+		if s.now().Sub(from) <= candidate.tier.Retention() {
+			r = candidate
+			break
+		}
+	}
+
+	// 超出保留时长的点可能仍留在未被覆盖的槽位中，须一并过滤
+	oldest := s.now().Add(-r.tier.Retention()).Unix()
+	fromUnix, toUnix := r.tier.bucket(from.Unix()), to.Unix()
+	points := make([]Point, 0)
+	for _, p := range r.sorted() {
+		if p.Time >= fromUnix && p.Time <= toUnix && p.Time >= oldest {
+			points = append(points, clonePoint(p))
+		}
+	}
+	if includePending && r.pending.Count > 0 && r.pending.Time >= fromUnix && r.pending.Time <= toUnix {
+		points = append(points, clonePoint(r.pending))
+	}
+	return r.tier, points
+}
+
+func clonePoint(p Point) Point {
+	p.Avg = append([]float64(nil), p.Avg...)
+	p.Max = append([]float64(nil), p.Max...)
+	return p
+}
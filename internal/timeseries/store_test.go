@@ -0,0 +1,88 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreDownsampling(t *testing.T) {
+	s := NewStore([]string{"cpu"},
+		Tier{Resolution: time.Minute, Capacity: 60},
+		Tier{Resolution: time.Hour, Capacity: 24},
+	)
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base.Add(2*time.Hour + time.Minute)
+	s.now = func() time.Time { return now }
+	var flushed []Flushed
+	// 两个小时内每 30 秒采样一次，值为所在分钟数
+	for i := 0; i < 240; i++ {
+		at := base.Add(time.Duration(i) * 30 * time.Second)
+		flushed = append(flushed, s.Add(at, []float64{float64(i / 2)})...)
+	}
+	// 进入第三个小时后，小时层要等到第一个分钟点完成才会级联完成上一小时
+	flushed = append(flushed, s.Add(base.Add(2*time.Hour), []float64{0})...)
+	flushed = append(flushed, s.Add(base.Add(2*time.Hour+time.Minute), []float64{0})...)
+
+	var minutes, hours int
+	for _, f := range flushed {
+		switch f.Tier {
+		case 0:
+			minutes++
+			if f.Point.Count != 2 && f.Point.Time != base.Add(2*time.Hour).Unix() {
+				t.Fatalf("minute point count = %d, want 2", f.Point.Count)
+			}
+		case 1:
+			hours++
+		}
+	}
+	if minutes != 121 || hours != 2 {
+		t.Fatalf("flushed %d minute points and %d hour points, want 121 and 2", minutes, hours)
+	}
+
+	last := flushed[len(flushed)-1]
+	if last.Tier != 1 || last.Point.Count != 120 || last.Point.Max[0] != 119 || last.Point.Avg[0] != 89.5 {
+		t.Fatalf("unexpected hour point: %+v", last.Point)
+	}
+
+	// 分钟层只保留最近 60 个点，查询 3 小时前应落到小时层
+	tier, points := s.Query(base.Add(-time.Hour), now, false)
+	if tier.Resolution != time.Hour || len(points) != 2 {
+		t.Fatalf("query got tier %v with %d points", tier.Resolution, len(points))
+	}
+	tier, points = s.Query(base.Add(90*time.Minute), now, false)
+	if tier.Resolution != time.Minute || len(points) != 31 || points[0].Avg[0] != 90 {
+		t.Fatalf("query got tier %v with %d points", tier.Resolution, len(points))
+	}
+}
+
+func TestStoreRestoreRebuild(t *testing.T) {
+	tiers := []Tier{{Resolution: time.Minute, Capacity: 120}, {Resolution: time.Hour, Capacity: 24}}
+	src := NewStore([]string{"v"}, tiers...)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var flushed []Flushed
+	for i := 0; i <= 90; i++ {
+		flushed = append(flushed, src.Add(base.Add(time.Duration(i)*time.Minute), []float64{1})...)
+	}
+
+	dst := NewStore([]string{"v"}, tiers...)
+	for _, f := range flushed {
+		dst.Restore(f.Tier, f.Point)
+	}
+	dst.Rebuild()
+
+	// 恢复后继续写入，进入下一小时时应完成包含重启前 30 个分钟点的小时点（第 90 分钟未完成聚合，随重启丢失）
+	var out []Flushed
+	out = append(out, dst.Add(base.Add(91*time.Minute), []float64{1})...)
+	out = append(out, dst.Add(base.Add(2*time.Hour), []float64{1})...)
+	out = append(out, dst.Add(base.Add(2*time.Hour+time.Minute), []float64{1})...)
+	var hour *Point
+	for i := range out {
+		if out[i].Tier == 1 {
+			hour = &out[i].Point
+		}
+	}
+	if hour == nil || hour.Count != 31 {
+		t.Fatalf("rebuilt hour point = %+v, want 31 samples", hour)
+	}
+}
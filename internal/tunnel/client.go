@@ -86,13 +86,16 @@ func ApplyRole(role string) {
 	case constant.InterconnectRoleMaster:
 		// 主控角色：无需后台轮询，等待子节点上报即可
 		StopClient()
+		GetForwardManager().StartAll()
 	case constant.InterconnectRoleChild:
 		// 子节点：关闭可能存在的主控会话，启动连接守护
+		GetForwardManager().StopAll()
 		CloseAllSessions()
 		StartClient()
 	default:
 		// 未开启或离线
 		StopClient()
+		GetForwardManager().StopAll()
 		CloseAllSessions()
 	}
 }
@@ -0,0 +1,590 @@
+package tunnel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/logger"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services"
+	"github.com/engigu/baihu-panel/internal/utils"
+	"github.com/hashicorp/yamux"
+)
+
+// 端口转发流的握手：主节点打开新的 yamux 流后先发送 "BAIHU-FWD/1 host:port\n"，
+// 子节点连接目标后回复 "OK\n" 或 "ERR 原因\n"，之后流上传输的就是原始 TCP 数据。
+// 不带前缀的流仍按 HTTP 代理处理，旧版本子节点会把握手当作无效的 HTTP 请求并返回 400。
+const (
+	forwardPreface     = "BAIHU-FWD/1 "
+	forwardDialTimeout = 10 * time.Second
+	forwardAckTimeout  = 15 * time.Second
+)
+
+// ForwardInfo 端口转发配置及运行状态
+type ForwardInfo struct {
+	models.TunnelForward
+	NodeName string         `json:"node_name"`
+	Running  bool           `json:"running"`
+	Error    string         `json:"error,omitempty"`
+	Traffic  ForwardTraffic `json:"traffic"`
+}
+
+// forwardRunner 单个端口转发的监听器与活跃连接
+type forwardRunner struct {
+	forward  models.TunnelForward
+	allow    []*net.IPNet
+	listener net.Listener
+	traffic  *ForwardTraffic
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// ForwardManager 管理主节点上的端口转发监听
+type ForwardManager struct {
+	mu      sync.Mutex
+	runners map[string]*forwardRunner
+	errors  map[string]string // 启动失败或最近一次转发失败的原因
+	open    func(nodeID, target string) (net.Conn, error)
+}
+
+var (
+	forwardManager     *ForwardManager
+	forwardManagerOnce sync.Once
+)
+
+// GetForwardManager 获取端口转发管理器单例
+func GetForwardManager() *ForwardManager {
+	forwardManagerOnce.Do(func() {
+		forwardManager = newForwardManager()
+	})
+	return forwardManager
+}
+
+func newForwardManager() *ForwardManager {
+	return &ForwardManager{
+		runners: make(map[string]*forwardRunner),
+		errors:  make(map[string]string),
+		open:    openNodeForward,
+	}
+}
+
+// List 获取所有端口转发及运行状态
+func (m *ForwardManager) List() []ForwardInfo {
+	var forwards []models.TunnelForward
+	database.DB.Order("listen_port ASC").Find(&forwards)
+
+	var nodes []models.InterconnectNode
+	database.DB.Select("id", "name").Find(&nodes)
+	names := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		names[n.ID] = n.Name
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]ForwardInfo, 0, len(forwards))
+	for _, f := range forwards {
+		_, running := m.runners[f.ID]
+		result = append(result, ForwardInfo{
+			TunnelForward: f,
+			NodeName:      names[f.NodeID],
+			Running:       running,
+			Error:         m.errors[f.ID],
+			Traffic:       GetForwardTraffic(f.ID),
+		})
+	}
+	return result
+}
+
+// Save 新建或更新端口转发，主节点角色下立即按新配置重启监听
+func (m *ForwardManager) Save(f *models.TunnelForward) error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.TargetHost = strings.TrimSpace(f.TargetHost)
+	switch {
+	case f.Name == "":
+		return errors.New("名称不能为空")
+	case f.ListenPort <= 0 || f.ListenPort > 65535:
+		return errors.New("无效的监听端口")
+	case f.TargetHost == "":
+		return errors.New("目标地址不能为空")
+	case f.TargetPort <= 0 || f.TargetPort > 65535:
+		return errors.New("无效的目标端口")
+	}
+	f.BindAddr = strings.TrimSpace(f.BindAddr)
+	if f.BindAddr != "" && net.ParseIP(f.BindAddr) == nil {
+		return fmt.Errorf("无效的监听地址: %s", f.BindAddr)
+	}
+	if allow, err := parseAllowlist(f.Allowlist); err != nil {
+		return err
+	} else if len(allow) == 0 {
+		return errors.New("来源白名单不能为空")
+	}
+	var count int64
+	if f.ID != "" {
+		if database.DB.Model(&models.TunnelForward{}).Where("id = ?", f.ID).Count(&count); count == 0 {
+			return errors.New("端口转发不存在")
+		}
+	}
+	if database.DB.Model(&models.InterconnectNode{}).Where("id = ?", f.NodeID).Count(&count); count == 0 {
+		return errors.New("子节点不存在")
+	}
+	if database.DB.Model(&models.TunnelForward{}).Where("listen_port = ? AND id <> ?", f.ListenPort, f.ID).Count(&count); count > 0 {
+		return fmt.Errorf("监听端口 %d 已被其他转发使用", f.ListenPort)
+	}
+	var err error
+	if f.ID == "" {
+		if f.Enabled == nil {
+			f.Enabled = utils.BoolPtr(true)
+		}
+		f.ID = utils.GenerateID()
+		err = database.DB.Create(f).Error
+	} else {
+		updates := map[string]interface{}{
+			"name": f.Name, "node_id": f.NodeID, "listen_port": f.ListenPort, "target_host": f.TargetHost,
+			"target_port": f.TargetPort, "bind_addr": f.BindAddr, "allowlist": f.Allowlist, "remark": f.Remark,
+		}
+		// 未传启用状态时保留原值，避免更新其他字段时重新启用已停用的转发
+		if f.Enabled != nil {
+			updates["enabled"] = f.Enabled
+		}
+		if err = database.DB.Model(&models.TunnelForward{}).Where("id = ?", f.ID).Updates(updates).Error; err == nil {
+			err = database.DB.Where("id = ?", f.ID).First(f).Error
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	m.stop(f.ID)
+	if utils.DerefBool(f.Enabled, true) && isMasterRole() {
+		return m.start(*f)
+	}
+	return nil
+}
+
+// SetEnabled 启用或停用端口转发
+func (m *ForwardManager) SetEnabled(id string, enabled bool) error {
+	var f models.TunnelForward
+	if err := database.DB.Where("id = ?", id).First(&f).Error; err != nil {
+		return errors.New("端口转发不存在")
+	}
+	f.Enabled = &enabled
+	if err := database.DB.Model(&f).Update("enabled", enabled).Error; err != nil {
+		return err
+	}
+	m.stop(id)
+	if enabled && isMasterRole() {
+		return m.start(f)
+	}
+	return nil
+}
+
+// Delete 停止并删除端口转发
+func (m *ForwardManager) Delete(id string) error {
+	m.stop(id)
+	removeForwardTraffic(id)
+	return database.DB.Where("id = ?", id).Delete(&models.TunnelForward{}).Error
+}
+
+// StartAll 启动所有启用且尚未运行的端口转发，主节点角色生效时调用
+func (m *ForwardManager) StartAll() {
+	var forwards []models.TunnelForward
+	database.DB.Where("enabled = ? OR enabled IS NULL", true).Find(&forwards)
+	for _, f := range forwards {
+		m.mu.Lock()
+		_, running := m.runners[f.ID]
+		m.mu.Unlock()
+		if running {
+			continue
+		}
+		if err := m.start(f); err != nil {
+			logger.Warnf("[Tunnel] 端口转发 %s 启动失败: %v", f.Name, err)
+		}
+	}
+}
+
+// StopAll 停止所有端口转发，离开主节点角色时调用
+func (m *ForwardManager) StopAll() {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.runners))
+	for id := range m.runners {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		m.stop(id)
+	}
+}
+
+// start 监听端口并开始转发
+func (m *ForwardManager) start(f models.TunnelForward) error {
+	allow, err := parseAllowlist(f.Allowlist)
+	if err != nil {
+		return err
+	}
+	if len(allow) == 0 {
+		m.setError(f.ID, "未配置来源白名单，转发未启动")
+		return errors.New("未配置来源白名单")
+	}
+	bind := f.BindAddr
+	if bind == "" {
+		bind = "127.0.0.1"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(f.ListenPort)))
+	if err != nil {
+		m.setError(f.ID, fmt.Sprintf("监听端口失败: %v", err))
+		return fmt.Errorf("监听端口 %d 失败: %v", f.ListenPort, err)
+	}
+
+	r := &forwardRunner{
+		forward:  f,
+		allow:    allow,
+		listener: ln,
+		traffic:  forwardCounter(f.ID),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	m.mu.Lock()
+	m.runners[f.ID] = r
+	delete(m.errors, f.ID)
+	m.mu.Unlock()
+
+	logger.Infof("[Tunnel] 端口转发 %s 已启动: %s -> %s (节点 %s)", f.Name, ln.Addr(), r.target(), f.NodeID)
+	go m.serve(r)
+	return nil
+}
+
+// stop 关闭监听器及所有活跃连接
+func (m *ForwardManager) stop(id string) {
+	m.mu.Lock()
+	r, ok := m.runners[id]
+	delete(m.runners, id)
+	delete(m.errors, id)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	r.listener.Close()
+	r.mu.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = nil
+	r.mu.Unlock()
+}
+
+func (m *ForwardManager) setError(id, msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[id] = msg
+}
+
+func (m *ForwardManager) serve(r *forwardRunner) {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(r, conn)
+	}
+}
+
+// handle 每个入站连接在子节点隧道上打开一条独立的 yamux 流
+func (m *ForwardManager) handle(r *forwardRunner, conn net.Conn) {
+	defer conn.Close()
+	if !r.allowed(conn.RemoteAddr()) {
+		atomic.AddUint64(&r.traffic.Rejected, 1)
+		return
+	}
+	atomic.AddUint64(&r.traffic.Connections, 1)
+	atomic.AddInt64(&r.traffic.Active, 1)
+	defer atomic.AddInt64(&r.traffic.Active, -1)
+
+	if !r.track(conn, true) {
+		return
+	}
+	defer r.track(conn, false)
+
+	stream, err := m.open(r.forward.NodeID, r.target())
+	if err != nil {
+		m.setError(r.forward.ID, err.Error())
+		logger.Warnf("[Tunnel] 端口转发 %s 连接失败: %v", r.forward.Name, err)
+		return
+	}
+	defer stream.Close()
+	if !r.track(stream, true) {
+		return
+	}
+	defer r.track(stream, false)
+
+	m.mu.Lock()
+	delete(m.errors, r.forward.ID)
+	m.mu.Unlock()
+	pipe(conn, stream, &r.traffic.TxBytes, &r.traffic.RxBytes)
+}
+
+func (r *forwardRunner) target() string {
+	return net.JoinHostPort(r.forward.TargetHost, strconv.Itoa(r.forward.TargetPort))
+}
+
+// track 记录活跃连接以便停止转发时一并关闭，转发已停止时返回 false
+func (r *forwardRunner) track(conn net.Conn, add bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !add {
+		delete(r.conns, conn)
+		return true
+	}
+	if r.conns == nil {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	return true
+}
+
+// allowed 检查来源 IP 是否在白名单内，白名单为空时拒绝
+func (r *forwardRunner) allowed(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, n := range r.allow {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowlist 解析逗号分隔的 IP 或 CIDR 列表
+func parseAllowlist(value string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == ' ' }) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的来源地址: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的来源地址: %s", item)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// defaultForwardTargets 子节点未配置转发目标时只允许连接本机回环地址
+const defaultForwardTargets = "127.0.0.0/8,::1"
+
+// ParseForwardTargets 解析子节点允许端口转发连接的目标，留空时为本机回环地址
+func ParseForwardTargets(value string) ([]*net.IPNet, error) {
+	if strings.TrimSpace(value) == "" {
+		value = defaultForwardTargets
+	}
+	return parseAllowlist(value)
+}
+
+// forwardTargetAllowed 目标地址是否在子节点允许的转发范围内
+func forwardTargetAllowed(addr *net.TCPAddr) bool {
+	allow, err := ParseForwardTargets(services.NewSettingsService().Get(constant.SectionInterconnect, constant.KeyInterconnectForwardTargets))
+	if err != nil {
+		return false
+	}
+	for _, n := range allow {
+		if n.Contains(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMasterRole() bool {
+	return services.NewSettingsService().Get(constant.SectionInterconnect, constant.KeyInterconnectRole) == constant.InterconnectRoleMaster
+}
+
+// openNodeForward 在子节点隧道上打开端口转发流
+func openNodeForward(nodeID, target string) (net.Conn, error) {
+	sess := GetSession(nodeID)
+	if sess == nil {
+		return nil, errors.New("节点离线或隧道未建立")
+	}
+	return openForwardStream(sess.Session, target)
+}
+
+// openForwardStream 打开新的 yamux 流并完成端口转发握手
+func openForwardStream(session *yamux.Session, target string) (net.Conn, error) {
+	stream, err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(stream, forwardPreface+target+"\n"); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	stream.SetReadDeadline(time.Now().Add(forwardAckTimeout))
+	br := bufio.NewReader(stream)
+	line, err := br.ReadString('\n')
+	stream.SetReadDeadline(time.Time{})
+	line = strings.TrimSpace(line)
+	switch {
+	case err != nil:
+		stream.Close()
+		return nil, fmt.Errorf("等待子节点响应失败: %v", err)
+	case line == "OK":
+		return &bufferedConn{Conn: stream, r: br}, nil
+	case strings.HasPrefix(line, "ERR "):
+		stream.Close()
+		return nil, fmt.Errorf("子节点无法连接 %s: %s", target, strings.TrimPrefix(line, "ERR "))
+	default:
+		stream.Close()
+		return nil, errors.New("子节点版本过旧，不支持端口转发")
+	}
+}
+
+// serveForwardStream 子节点处理端口转发流：校验目标在本机允许的范围内后连接并双向转发
+// 目标先解析为 IP 再校验和连接，避免域名在校验后解析到其他地址
+func serveForwardStream(stream net.Conn, br *bufio.Reader) {
+	defer stream.Close()
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return
+	}
+	target := strings.TrimSpace(strings.TrimPrefix(line, forwardPreface))
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		io.WriteString(stream, "ERR 无效的目标地址\n")
+		return
+	}
+	addr, err := net.ResolveTCPAddr("tcp", target)
+	if err != nil {
+		io.WriteString(stream, "ERR 无法解析目标地址\n")
+		return
+	}
+	if !forwardTargetAllowed(addr) {
+		logger.Warnf("[Tunnel] 拒绝主节点转发到 %s (%s)：不在本节点允许的转发目标内", target, addr.IP)
+		io.WriteString(stream, "ERR 目标地址不在子节点允许的转发范围内\n")
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", addr.String(), forwardDialTimeout)
+	if err != nil {
+		io.WriteString(stream, "ERR "+strings.ReplaceAll(err.Error(), "\n", " ")+"\n")
+		return
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(stream, "OK\n"); err != nil {
+		return
+	}
+	pipe(&bufferedConn{Conn: stream, r: br}, conn, nil, nil)
+}
+
+// pipe 双向转发，任一方向结束后关闭两端；tx 统计 a 到 b 的字节数，rx 统计 b 到 a 的字节数
+func pipe(a, b net.Conn, tx, rx *uint64) {
+	var dummy uint64
+	if tx == nil {
+		tx = &dummy
+	}
+	if rx == nil {
+		rx = &dummy
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(&countingWriter{w: b, counter: tx}, a)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{w: a, counter: rx}, b)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
+
+// bufferedConn 读取时先消费握手阶段已缓冲的数据
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// streamListener 子节点接收主节点打开的 yamux 流，端口转发流直接处理，其余流交给 HTTP 服务
+type streamListener struct {
+	session *yamux.Session
+	conns   chan net.Conn
+}
+
+func newStreamListener(session *yamux.Session) *streamListener {
+	l := &streamListener{session: session, conns: make(chan net.Conn)}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *streamListener) acceptLoop() {
+	for {
+		stream, err := l.session.Accept()
+		if err != nil {
+			return
+		}
+		go l.dispatch(stream)
+	}
+}
+
+// dispatch 根据流的开头区分端口转发与 HTTP 请求
+func (l *streamListener) dispatch(stream net.Conn) {
+	stream.SetReadDeadline(time.Now().Add(forwardAckTimeout))
+	br := bufio.NewReader(stream)
+	head, _ := br.Peek(len(forwardPreface))
+	stream.SetReadDeadline(time.Time{})
+
+	if string(head) == forwardPreface {
+		serveForwardStream(stream, br)
+		return
+	}
+	select {
+	case l.conns <- &bufferedConn{Conn: stream, r: br}:
+	case <-l.session.CloseChan():
+		stream.Close()
+	}
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.session.CloseChan():
+		return nil, yamux.ErrSessionShutdown
+	}
+}
+
+func (l *streamListener) Close() error {
+	return l.session.Close()
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.session.Addr()
+}
@@ -0,0 +1,258 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/engigu/baihu-panel/internal/constant"
+	"github.com/engigu/baihu-panel/internal/database"
+	"github.com/engigu/baihu-panel/internal/models"
+	"github.com/engigu/baihu-panel/internal/services"
+	"github.com/glebarez/sqlite"
+	"github.com/hashicorp/yamux"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 使用内存 SQLite 作为测试库，子节点转发时读取本机设置
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("无法开启 SQLite 内存测试库: %v", err)
+	}
+	database.DB = db
+	if err := db.AutoMigrate(&models.Setting{}, &models.InterconnectNode{}, &models.TunnelForward{}); err != nil {
+		t.Fatalf("测试数据迁移失败: %v", err)
+	}
+	return db
+}
+
+// tunnelPair 建立一对 yamux 会话，主节点为 Client，子节点为 Server 并按转发或 HTTP 分流
+func tunnelPair(t *testing.T) *yamux.Session {
+	t.Helper()
+	a, b := net.Pipe()
+	master, err := yamux.Client(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := yamux.Server(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "panel")
+	})}
+	go server.Serve(newStreamListener(child))
+	t.Cleanup(func() {
+		master.Close()
+		child.Close()
+	})
+	return master
+}
+
+// echoServer 启动回显服务，返回监听地址
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) string {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestForwardStream(t *testing.T) {
+	setupTestDB(t)
+	master := tunnelPair(t)
+	target := echoServer(t)
+
+	conn, err := openForwardStream(master, target)
+	if err != nil {
+		t.Fatalf("打开转发流失败: %v", err)
+	}
+	defer conn.Close()
+	if got := roundTrip(t, conn, "ping"); got != "ping" {
+		t.Errorf("转发数据不一致: %q", got)
+	}
+
+	// 不可达的目标返回子节点的错误
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+	if _, err := openForwardStream(master, closed); err == nil || !strings.Contains(err.Error(), "子节点无法连接") {
+		t.Errorf("应返回目标不可达: %v", err)
+	}
+
+	// 子节点默认只允许转发到本机回环地址
+	if _, err := openForwardStream(master, "192.0.2.1:80"); err == nil || !strings.Contains(err.Error(), "允许的转发范围") {
+		t.Errorf("默认应拒绝非回环目标: %v", err)
+	}
+	services.NewSettingsService().Set(constant.SectionInterconnect, constant.KeyInterconnectForwardTargets, "192.0.2.0/24")
+	if _, err := openForwardStream(master, target); err == nil || !strings.Contains(err.Error(), "允许的转发范围") {
+		t.Errorf("配置转发目标后应拒绝范围外的地址: %v", err)
+	}
+	if _, err := ParseForwardTargets("not-an-ip"); err == nil {
+		t.Error("应拒绝无效的转发目标")
+	}
+
+	// 普通流仍由 HTTP 服务处理
+	client := &http.Client{Transport: &http.Transport{Dial: func(network, addr string) (net.Conn, error) { return master.Open() }}}
+	resp, err := client.Get("http://tunnel.local/")
+	if err != nil {
+		t.Fatalf("HTTP 代理请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "panel" {
+		t.Errorf("HTTP 代理响应不正确: %q", body)
+	}
+}
+
+func TestForwardRunner(t *testing.T) {
+	setupTestDB(t)
+	master := tunnelPair(t)
+	target := echoServer(t)
+	host, portStr, _ := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(portStr)
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	listenPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := newForwardManager()
+	m.open = func(nodeID, target string) (net.Conn, error) { return openForwardStream(master, target) }
+	f := models.TunnelForward{ID: "f1", Name: "echo", NodeID: "n1", ListenPort: listenPort, TargetHost: host, TargetPort: port, Allowlist: "127.0.0.1, 10.0.0.0/8"}
+	if err := m.start(f); err != nil {
+		t.Fatalf("启动转发失败: %v", err)
+	}
+	defer removeForwardTraffic("f1")
+	if addr := m.runners["f1"].listener.Addr().(*net.TCPAddr); !addr.IP.IsLoopback() {
+		t.Errorf("未设置监听地址时应只监听回环地址: %s", addr)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listenPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roundTrip(t, conn, "hello"); got != "hello" {
+		t.Errorf("转发数据不一致: %q", got)
+	}
+	// 回显数据先写给客户端再计数，稍等计数完成
+	deadline := time.Now().Add(time.Second)
+	for GetForwardTraffic("f1").RxBytes < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	traffic := GetForwardTraffic("f1")
+	if traffic.Connections != 1 || traffic.Active != 1 || traffic.TxBytes != 5 || traffic.RxBytes != 5 {
+		t.Errorf("流量统计不正确: %+v", traffic)
+	}
+
+	// 停止转发会关闭活跃连接
+	m.stop("f1")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("停止转发后连接应被关闭")
+	}
+	if _, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listenPort)); err == nil {
+		t.Error("停止转发后不应继续监听")
+	}
+
+	// 不在白名单内的来源被拒绝
+	f.Allowlist = "10.0.0.0/8"
+	if err := m.start(f); err != nil {
+		t.Fatal(err)
+	}
+	defer m.stop("f1")
+	conn, _ = net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listenPort))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("白名单外的连接应被关闭")
+	}
+	if GetForwardTraffic("f1").Rejected != 1 {
+		t.Errorf("应记录被拒绝的连接: %+v", GetForwardTraffic("f1"))
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	nets, err := parseAllowlist("192.168.1.10, 10.0.0.0/8\n::1")
+	if err != nil || len(nets) != 3 {
+		t.Fatalf("解析白名单失败: %v %v", err, nets)
+	}
+	r := &forwardRunner{allow: nets}
+	for addr, want := range map[string]bool{"192.168.1.10:5000": true, "192.168.1.11:5000": false, "10.2.3.4:1": true, "[::1]:80": true} {
+		a, _ := net.ResolveTCPAddr("tcp", addr)
+		if r.allowed(a) != want {
+			t.Errorf("%s 期望 %v", addr, want)
+		}
+	}
+	if _, err := parseAllowlist("10.0.0.300"); err == nil {
+		t.Error("应拒绝无效地址")
+	}
+	local, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:80")
+	if (&forwardRunner{}).allowed(local) {
+		t.Error("白名单为空时应拒绝所有来源")
+	}
+}
+
+func TestForwardSave(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&models.InterconnectNode{ID: "n1", Name: "a-node"})
+	m := newForwardManager()
+
+	f := &models.TunnelForward{Name: "db", NodeID: "n1", ListenPort: 13306, TargetHost: "127.0.0.1", TargetPort: 3306}
+	if err := m.Save(f); err == nil {
+		t.Error("来源白名单为空时应拒绝保存")
+	}
+	f.Allowlist, f.BindAddr = "10.0.0.0/8", "not-an-ip"
+	if err := m.Save(f); err == nil {
+		t.Error("应拒绝无效的监听地址")
+	}
+	f.BindAddr = ""
+	if err := m.Save(f); err != nil || !*f.Enabled {
+		t.Fatalf("新建转发失败或未默认启用: %v", err)
+	}
+	if err := m.SetEnabled(f.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未传启用状态的更新保留原值
+	update := &models.TunnelForward{ID: f.ID, Name: "db2", NodeID: "n1", ListenPort: 13306, TargetHost: "127.0.0.1", TargetPort: 3306, Allowlist: "10.0.0.0/8"}
+	if err := m.Save(update); err != nil {
+		t.Fatalf("更新转发失败: %v", err)
+	}
+	var saved models.TunnelForward
+	db.Where("id = ?", f.ID).First(&saved)
+	if saved.Name != "db2" || saved.Enabled == nil || *saved.Enabled {
+		t.Errorf("更新其他字段不应重新启用转发: %+v", saved)
+	}
+}
@@ -108,8 +108,8 @@ func serveLocalProxy(session *yamux.Session) {
 		server.Close()
 	}()
 
-	// yamux.Session 实现了标准的 net.Listener 接口！
-	err := server.Serve(session)
+	// 端口转发流在监听器中分流处理，其余流作为 HTTP 请求交给 server
+	err := server.Serve(newStreamListener(session))
 	if err != nil && err != http.ErrServerClosed && err != yamux.ErrSessionShutdown {
 		logger.Errorf("[Tunnel] Yamux 代理服务意外停止: %v", err)
 	}
@@ -1,7 +1,9 @@
 package tunnel
 
 import (
+	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 )
 
@@ -57,3 +59,62 @@ func ResetTrafficBytes() {
 	atomic.StoreUint64(&txBytes, 0)
 	atomic.StoreUint64(&rxBytes, 0)
 }
+
+// ForwardTraffic 单个端口转发的流量统计
+type ForwardTraffic struct {
+	TxBytes     uint64 `json:"tx_bytes"`    // 发往目标服务的字节数
+	RxBytes     uint64 `json:"rx_bytes"`    // 从目标服务收到的字节数
+	Connections uint64 `json:"connections"` // 累计连接数
+	Active      int64  `json:"active"`      // 当前活跃连接数
+	Rejected    uint64 `json:"rejected"`    // 被来源白名单拒绝的连接数
+}
+
+var (
+	forwardTraffic   = make(map[string]*ForwardTraffic)
+	forwardTrafficMu sync.Mutex
+)
+
+// forwardCounter 获取端口转发的计数器，不存在时创建
+func forwardCounter(id string) *ForwardTraffic {
+	forwardTrafficMu.Lock()
+	defer forwardTrafficMu.Unlock()
+	t, ok := forwardTraffic[id]
+	if !ok {
+		t = &ForwardTraffic{}
+		forwardTraffic[id] = t
+	}
+	return t
+}
+
+// GetForwardTraffic 返回端口转发的流量统计快照
+func GetForwardTraffic(id string) ForwardTraffic {
+	t := forwardCounter(id)
+	return ForwardTraffic{
+		TxBytes:     atomic.LoadUint64(&t.TxBytes),
+		RxBytes:     atomic.LoadUint64(&t.RxBytes),
+		Connections: atomic.LoadUint64(&t.Connections),
+		Active:      atomic.LoadInt64(&t.Active),
+		Rejected:    atomic.LoadUint64(&t.Rejected),
+	}
+}
+
+// removeForwardTraffic 删除端口转发时清理计数器
+func removeForwardTraffic(id string) {
+	forwardTrafficMu.Lock()
+	defer forwardTrafficMu.Unlock()
+	delete(forwardTraffic, id)
+}
+
+// countingWriter 统计经过的字节数
+type countingWriter struct {
+	w       io.Writer
+	counter *uint64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if n > 0 {
+		atomic.AddUint64(c.counter, uint64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiEscapeRegex 匹配 CSI 控制序列（颜色、光标移动、清屏等）及 OSC 序列（如终端标题、超链接）
+var ansiEscapeRegex = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)")
+
+// ansiBasicColors 标准 16 色调色板（0-7 为普通色，8-15 为高亮色）
+var ansiBasicColors = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// StripAnsi 移除文本中的 ANSI 控制序列
+func StripAnsi(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiEscapeRegex.ReplaceAllString(s, "")
+}
+
+// ansiStyle 当前生效的 SGR 文本样式
+type ansiStyle struct {
+	fg, bg                               string
+	bold, dim, italic, underline, strike bool
+}
+
+func (s ansiStyle) css() string {
+	var parts []string
+	if s.fg != "" {
+		parts = append(parts, "color:"+s.fg)
+	}
+	if s.bg != "" {
+		parts = append(parts, "background-color:"+s.bg)
+	}
+	if s.bold {
+		parts = append(parts, "font-weight:bold")
+	}
+	if s.dim {
+		parts = append(parts, "opacity:0.7")
+	}
+	if s.italic {
+		parts = append(parts, "font-style:italic")
+	}
+	switch {
+	case s.underline && s.strike:
+		parts = append(parts, "text-decoration:underline line-through")
+	case s.underline:
+		parts = append(parts, "text-decoration:underline")
+	case s.strike:
+		parts = append(parts, "text-decoration:line-through")
+	}
+	return strings.Join(parts, ";")
+}
+
+// AnsiToHTML 将带 ANSI 颜色序列的文本转换为 HTML（文本内容已转义，样式以内联 style 的 span 输出）
+// 仅解析 SGR 颜色与字形序列，其他控制序列会被直接移除；多行文本的样式会跨行延续
+func AnsiToHTML(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return html.EscapeString(s)
+	}
+
+	var b strings.Builder
+	var style ansiStyle
+	open := false
+
+	writeText := func(text string) {
+		if text == "" {
+			return
+		}
+		if !open {
+			if css := style.css(); css != "" {
+				b.WriteString(`<span style="` + css + `">`)
+				open = true
+			}
+		}
+		b.WriteString(html.EscapeString(text))
+	}
+
+	last := 0
+	for _, loc := range ansiEscapeRegex.FindAllStringIndex(s, -1) {
+		writeText(s[last:loc[0]])
+		last = loc[1]
+
+		seq := s[loc[0]:loc[1]]
+		if !strings.HasPrefix(seq, "\x1b[") || !strings.HasSuffix(seq, "m") {
+			continue
+		}
+		next := applySGR(style, seq[2:len(seq)-1])
+		if next != style {
+			if open {
+				b.WriteString("</span>")
+				open = false
+			}
+			style = next
+		}
+	}
+	writeText(s[last:])
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
+
+// applySGR 根据 SGR 参数更新文本样式
+func applySGR(style ansiStyle, params string) ansiStyle {
+	if params == "" {
+		return ansiStyle{}
+	}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			style = ansiStyle{}
+		case code == 1:
+			style.bold = true
+		case code == 2:
+			style.dim = true
+		case code == 3:
+			style.italic = true
+		case code == 4:
+			style.underline = true
+		case code == 9:
+			style.strike = true
+		case code == 22:
+			style.bold, style.dim = false, false
+		case code == 23:
+			style.italic = false
+		case code == 24:
+			style.underline = false
+		case code == 29:
+			style.strike = false
+		case code >= 30 && code <= 37:
+			style.fg = ansiBasicColors[code-30]
+		case code >= 90 && code <= 97:
+			style.fg = ansiBasicColors[code-90+8]
+		case code == 39:
+			style.fg = ""
+		case code >= 40 && code <= 47:
+			style.bg = ansiBasicColors[code-40]
+		case code >= 100 && code <= 107:
+			style.bg = ansiBasicColors[code-100+8]
+		case code == 49:
+			style.bg = ""
+		case code == 38 || code == 48:
+			color, consumed := parseExtendedColor(codes[i+1:])
+			i += consumed
+			if color != "" {
+				if code == 38 {
+					style.fg = color
+				} else {
+					style.bg = color
+				}
+			}
+		}
+	}
+	return style
+}
+
+// parseExtendedColor 解析 38/48 之后的 256 色 (5;n) 或真彩色 (2;r;g;b) 参数，返回颜色及消耗的参数个数
+func parseExtendedColor(args []string) (string, int) {
+	if len(args) == 0 {
+		return "", 0
+	}
+	switch args[0] {
+	case "5":
+		if len(args) < 2 {
+			return "", len(args)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 255 {
+			return "", 2
+		}
+		return ansi256Color(n), 2
+	case "2":
+		if len(args) < 4 {
+			return "", len(args)
+		}
+		rgb := make([]int, 3)
+		for i := 0; i < 3; i++ {
+			v, err := strconv.Atoi(args[i+1])
+			if err != nil || v < 0 || v > 255 {
+				return "", 4
+			}
+			rgb[i] = v
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), 4
+	}
+	return "", 1
+}
+
+// ansi256Color 将 xterm 256 色索引转换为十六进制颜色
+func ansi256Color(n int) string {
+	if n < 16 {
+		return ansiBasicColors[n]
+	}
+	if n >= 232 {
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+	n -= 16
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[(n/6)%6], levels[n%6])
+}
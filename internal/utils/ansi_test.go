@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestAnsiToHTML(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain <b>", "plain &lt;b&gt;"},
+		{"\x1b[31merror\x1b[0m done", `<span style="color:#cd3131">error</span> done`},
+		{"\x1b[1;32mok\x1b[22m!\x1b[m", `<span style="color:#0dbc79;font-weight:bold">ok</span><span style="color:#0dbc79">!</span>`},
+		{"\x1b[38;5;196mred\x1b[0m", `<span style="color:#ff0000">red</span>`},
+		{"\x1b[38;2;1;2;3mrgb", `<span style="color:#010203">rgb</span>`},
+		{"\x1b[2K\x1b[1Gprogress", "progress"},
+	}
+	for _, c := range cases {
+		if got := AnsiToHTML(c.in); got != c.want {
+			t.Errorf("AnsiToHTML(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestStripAnsi(t *testing.T) {
+	if got := StripAnsi("\x1b[31mred\x1b[0m \x1b]0;title\x07text"); got != "red text" {
+		t.Errorf("StripAnsi got %q", got)
+	}
+}
@@ -132,3 +132,30 @@ func DecompressFromBase64(data string) (string, error) {
 	return string(result), nil
 }
 
+
+// CompressZstd 使用 zstd 压缩文本，返回完整的 zstd 帧（用于日志外部存储）
+func CompressZstd(data string) []byte {
+	initZstd()
+	return zstdEncoder.EncodeAll([]byte(data), nil)
+}
+
+// DecompressZstd 解压 zstd 帧为文本
+func DecompressZstd(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	initZstd()
+	decompressed, err := zstdDecoder.DecodeAll(data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(decompressed), nil
+}
+
+// ZstdToBase64 将 zstd 帧编码为带前缀的 base64 字符串，格式与 CompressToBase64 的输出一致
+func ZstdToBase64(compressed []byte) string {
+	if len(compressed) == 0 {
+		return ""
+	}
+	return zstdPrefix + base64.StdEncoding.EncodeToString(compressed)
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"time"
+
 	"github.com/rs/xid"
 )
 
@@ -9,6 +11,11 @@ func GenerateID() string {
 	return xid.New().String()
 }
 
+// GenerateIDAt 生成时间部分为 t 的 ID，用于补传的历史记录按发生时间而非入库时间排序
+func GenerateIDAt(t time.Time) string {
+	return xid.NewWithTime(t).String()
+}
+
 // IsNumeric 检查字符串是否全为数字
 func IsNumeric(s string) bool {
 	for _, c := range s {
@@ -3,6 +3,51 @@ const BASE_URL = (window as any).__BASE_URL__ || ''
 const API_VERSION = (window as any).__API_VERSION__ || '/api/v1'
 const API_BASE_URL = BASE_URL + API_VERSION
 
+export type HostMetricName =
+  | 'cpu_percent' | 'load1' | 'mem_percent' | 'mem_used' | 'disk_percent' | 'disk_used'
+  | 'net_rx_bps' | 'net_tx_bps' | 'queue_depth' | 'running_tasks' | 'busy_workers'
+
+// Agent 历史指标：不含网络，另有 5/15 分钟平均负载
+export type AgentMetricName =
+  | 'cpu_percent' | 'load1' | 'load5' | 'load15' | 'mem_percent' | 'mem_used' | 'disk_percent' | 'disk_used'
+  | 'queue_depth' | 'running_tasks' | 'busy_workers'
+
+// 主机历史指标：24 小时内为 1 分钟分辨率，更早为 1 小时分辨率
+export interface HostHistory {
+  resolution: number
+  from: number
+  to: number
+  timestamps: number[]
+  series: Partial<Record<HostMetricName | AgentMetricName, { avg: number[]; max: number[] }>>
+}
+
+export interface TaskRunMarker {
+  log_id: string
+  task_id: string
+  task_name: string
+  agent_id: string | null
+  status: string
+  start: number
+  end: number
+  duration: number
+  cpu: number
+  max_rss: number
+}
+
+export interface HostHistoryQuery {
+  range?: string
+  from?: number
+  to?: number
+}
+
+function hostHistoryQuery(params: HostHistoryQuery) {
+  const query = new URLSearchParams()
+  if (params.range) query.set('range', params.range)
+  if (params.from) query.set('from', String(params.from))
+  if (params.to) query.set('to', String(params.to))
+  return query
+}
+
 interface ApiResponse<T> {
   code: number
   msg: string
@@ -179,7 +224,20 @@ export const api = {
     },
     execute: (id: string) => request<ExecutionResult>(`/execute/task/${id}`, { method: 'POST' }),
     stop: (logID: string) => request(`/tasks/stop/${logID}`, { method: 'POST' }),
-    tags: () => request<string[]>('/tasks/tags')
+    tags: () => request<string[]>('/tasks/tags'),
+    usage: (id: string, days?: number, limit?: number) => {
+      const query = new URLSearchParams()
+      if (days) query.set('days', String(days))
+      if (limit) query.set('limit', String(limit))
+      return request<TaskUsageTrend>(`/tasks/${id}/usage?${query}`)
+    },
+    usageRanking: (params?: { days?: number; sort?: TaskUsageSort; limit?: number }) => {
+      const query = new URLSearchParams()
+      if (params?.days) query.set('days', String(params.days))
+      if (params?.sort) query.set('sort', params.sort)
+      if (params?.limit) query.set('limit', String(params.limit))
+      return request<TaskUsageRankItem[]>(`/tasks/usage/ranking?${query}`)
+    }
   },
   scripts: {
     list: () => request<Script[]>('/scripts'),
@@ -240,6 +298,32 @@ export const api = {
     },
     get: (id: string) => request<LogDetail>(`/logs/${id}`),
     detail: (id: string) => request<LogDetail>(`/logs/${id}`),
+    lines: (id: string, params?: { start?: number; limit?: number } & LogViewOptions) => {
+      const query = logViewQuery(params)
+      if (params?.start) query.set('start', String(params.start))
+      if (params?.limit) query.set('limit', String(params.limit))
+      return request<LogLinesResult>(`/logs/${id}/lines?${query}`)
+    },
+    head: (id: string, n?: number, options?: LogViewOptions) => {
+      const query = logViewQuery(options)
+      if (n) query.set('n', String(n))
+      return request<LogLinesResult>(`/logs/${id}/head?${query}`)
+    },
+    tail: (id: string, n?: number, options?: LogViewOptions) => {
+      const query = logViewQuery(options)
+      if (n) query.set('n', String(n))
+      return request<LogLinesResult>(`/logs/${id}/tail?${query}`)
+    },
+    grep: (id: string, params: { keyword: string; regex?: boolean; ignore_case?: boolean; context?: number; limit?: number } & LogViewOptions) => {
+      const query = logViewQuery(params)
+      query.set('keyword', params.keyword)
+      if (params.regex) query.set('regex', 'true')
+      if (params.ignore_case) query.set('ignore_case', 'true')
+      if (params.context) query.set('context', String(params.context))
+      if (params.limit) query.set('limit', String(params.limit))
+      return request<LogGrepResult>(`/logs/${id}/grep?${query}`)
+    },
+    downloadUrl: (id: string) => `${API_BASE_URL}/logs/${id}/download`,
     delete: (id: string) => request(`/logs/${id}`, { method: 'DELETE' }),
     clear: (taskId?: string) => request('/logs/clear', { method: 'POST', body: JSON.stringify({ task_id: taskId }) })
   },
@@ -249,8 +333,45 @@ export const api = {
     sendStats: (days?: number) => request<DailyStats[]>(`/sendstats${days ? `?days=${days}` : ''}`),
     taskStats: (days?: number) => request<TaskStatsItem[]>(`/taskstats${days ? `?days=${days}` : ''}`)
   },
+  analytics: {
+    task: (id: string, days?: number) => request<TaskAnalytics>(`/analytics/tasks/${id}${days ? `?days=${days}` : ''}`),
+    tag: (tag: string, days?: number) =>
+      request<TaskAnalytics>(`/analytics/tags/${encodeURIComponent(tag)}${days ? `?days=${days}` : ''}`),
+    ranking: (params?: { sort?: AnalyticsRankSort; days?: number; tag?: string; limit?: number }) => {
+      const query = new URLSearchParams()
+      if (params?.sort) query.set('sort', params.sort)
+      if (params?.days) query.set('days', String(params.days))
+      if (params?.tag) query.set('tag', params.tag)
+      if (params?.limit) query.set('limit', String(params.limit))
+      return request<AnalyticsRankItem[]>(`/analytics/ranking?${query}`)
+    },
+    rebuild: () => request('/analytics/rebuild', { method: 'POST' })
+  },
+  broadcasts: {
+    start: (data: { task_id: string; selector?: string; max_parallel?: number }) =>
+      request<BroadcastRun>('/broadcasts', { method: 'POST', body: JSON.stringify(data) }),
+    list: (params?: { task_id?: string; page?: number; page_size?: number }) => {
+      const query = new URLSearchParams()
+      if (params?.task_id) query.set('task_id', params.task_id)
+      if (params?.page) query.set('page', String(params.page))
+      if (params?.page_size) query.set('page_size', String(params.page_size))
+      return request<{ data: BroadcastRun[]; total: number; page: number; page_size: number }>(`/broadcasts?${query}`)
+    },
+    detail: (id: string) => request<BroadcastRunDetail>(`/broadcasts/${id}`),
+    stop: (id: string) => request(`/broadcasts/${id}/stop`, { method: 'POST' })
+  },
   settings: {
     getMonitor: () => request<MonitorStats>('/monitor'),
+    getMonitorHistory: (params: HostHistoryQuery & { metrics?: HostMetricName[] }) => {
+      const query = hostHistoryQuery(params)
+      if (params.metrics?.length) query.set('metrics', params.metrics.join(','))
+      return request<HostHistory>(`/monitor/history?${query}`)
+    },
+    getMonitorMarkers: (params: HostHistoryQuery & { task_id?: string }) => {
+      const query = hostHistoryQuery(params)
+      if (params.task_id) query.set('task_id', params.task_id)
+      return request<TaskRunMarker[]>(`/monitor/history/markers?${query}`)
+    },
     changePassword: (data: { old_username?: string; username?: string; old_password: string; new_password?: string }) =>
       request('/settings/password', { method: 'POST', body: JSON.stringify(data) }),
     getSite: () => request<SiteSettings>('/settings/site'),
@@ -277,7 +398,7 @@ export const api = {
       if (params?.username) query.set('username', params.username)
       return request<LoginLogListResponse>(`/settings/loginlogs?${query}`)
     },
-    createBackup: () => request('/settings/backup', { method: 'POST' }),
+    createBackup: (includeLogs = true) => request(`/settings/backup?include_logs=${includeLogs}`, { method: 'POST' }),
     getBackupStatus: () => request<{ has_backup: boolean; backup_time: string }>('/settings/backup/status'),
     downloadBackup: () => `${API_BASE_URL}/settings/backup/download`,
     restoreBackup: async (file: File) => {
@@ -349,13 +470,14 @@ export const api = {
     }
   },
   deps: {
-    list: (params?: { language?: string; lang_version?: string }) => {
+    list: (params?: { language?: string; lang_version?: string; agent_id?: string }) => {
       const query = new URLSearchParams()
       if (params?.language) query.set('language', params.language)
       if (params?.lang_version) query.set('lang_version', params.lang_version)
+      if (params?.agent_id) query.set('agent_id', params.agent_id)
       return request<Dependency[]>(`/deps?${query}`)
     },
-    create: (data: { name: string; version?: string; language: string; lang_version?: string; remark?: string }) =>
+    create: (data: { name: string; version?: string; language: string; lang_version?: string; agent_id?: string; remark?: string }) =>
       request<Dependency>('/deps', { method: 'POST', body: JSON.stringify(data) }),
     delete: (id: string) => request(`/deps/${id}`, { method: 'DELETE' }),
     install: (data: any) => request<any>('/deps/install', { method: 'POST', body: JSON.stringify(data) }),
@@ -365,9 +487,10 @@ export const api = {
       return request<any>(`/deps/uninstall/${id}${query}`, { method: 'POST' })
     },
     reinstall: (id: string) => request(`/deps/reinstall/${id}`, { method: 'POST' }),
-    reinstallAll: (language: string, lang_version?: string) => {
+    reinstallAll: (language: string, lang_version?: string, agent_id?: string) => {
       const query = new URLSearchParams({ language })
       if (lang_version) query.set('lang_version', lang_version)
+      if (agent_id) query.set('agent_id', agent_id)
       return request(`/deps/reinstall-all?${query}`, { method: 'POST' })
     },
     getReinstallAllCmd: (language: string, lang_version?: string) => {
@@ -389,10 +512,21 @@ export const api = {
   agents: {
     list: () => request<Agent[]>('/agents'),
     getVersion: () => request<{ version: string; platforms: { os: string; arch: string; filename: string }[] }>('/agents/version'),
-    update: (id: string, data: { name: string; description?: string; enabled: boolean; scheduler_config: SchedulerConfig | null }) =>
+    update: (id: string, data: { name: string; description?: string; enabled: boolean; scheduler_config: SchedulerConfig | null; labels?: Record<string, string> }) =>
       request('/agents/' + id, { method: 'PUT', body: JSON.stringify(data) }),
+    match: (selector: string) => request<Agent[]>('/agents/match?selector=' + encodeURIComponent(selector)),
     delete: (id: string) => request('/agents/' + id, { method: 'DELETE' }),
     forceUpdate: (id: string) => request('/agents/' + id + '/update', { method: 'POST' }),
+    approve: (id: string) => request('/agents/' + id + '/approve', { method: 'POST' }),
+    reject: (id: string) => request('/agents/' + id + '/reject', { method: 'POST' }),
+    rotateKey: (id: string) => request('/agents/' + id + '/rotate-key', { method: 'POST' }),
+    approveKey: (id: string) => request('/agents/' + id + '/approve-key', { method: 'POST' }),
+    // 6 小时内为 1 分钟分辨率，更早为 10 分钟分辨率，最多 3 天
+    metrics: (id: string, params: HostHistoryQuery & { metrics?: AgentMetricName[] }) => {
+      const query = hostHistoryQuery(params)
+      if (params.metrics?.length) query.set('metrics', params.metrics.join(','))
+      return request<HostHistory>(`/agents/${id}/metrics?${query}`)
+    },
     downloadUrl: (os: string, arch: string) => `${API_BASE_URL}/agent/download?os=${os}&arch=${arch}`,
     // 令牌管理
     listTokens: () => request<AgentToken[]>('/agents/tokens'),
@@ -400,7 +534,15 @@ export const api = {
       request<AgentToken>('/agents/tokens', { method: 'POST', body: JSON.stringify(data) }),
     deleteToken: (id: string) => request('/agents/tokens/' + id, { method: 'DELETE' }),
     updateToken: (id: string, data: { remark?: string; max_uses?: number; expires_at?: string }) =>
-      request<AgentToken>('/agents/tokens/' + id, { method: 'PUT', body: JSON.stringify(data) })
+      request<AgentToken>('/agents/tokens/' + id, { method: 'PUT', body: JSON.stringify(data) }),
+    // 分批升级：先升级金丝雀 Agent，确认后放行其余 Agent
+    listRollouts: () => request<AgentRollout[]>('/agents/rollouts'),
+    createRollout: (data: { canary_percent: number; canary_ids: string[] }) =>
+      request<AgentRollout>('/agents/rollouts', { method: 'POST', body: JSON.stringify(data) }),
+    getRollout: (id: string) => request<AgentRolloutDetail>('/agents/rollouts/' + id),
+    promoteRollout: (id: string, force = false) =>
+      request('/agents/rollouts/' + id + '/promote' + (force ? '?force=true' : ''), { method: 'POST' }),
+    cancelRollout: (id: string) => request('/agents/rollouts/' + id + '/cancel', { method: 'POST' })
   },
   mise: {
     list: () => request<MiseLanguage[]>('/mise/ls'),
@@ -496,6 +638,13 @@ export interface FileNode {
   children?: FileNode[]
 }
 
+// 故障转移目标：备用 Agent、面板本机，或等待原 Agent 恢复若干分钟
+export interface FailoverTarget {
+  type: 'agent' | 'local' | 'wait'
+  agent_id?: string
+  minutes?: number
+}
+
 export interface Task {
   id: string
   name: string
@@ -518,6 +667,10 @@ export interface Task {
   pin_type: 'none' | 'top'
   languages: { name: string; version: string }[]
   agent_id: string | null
+  agent_selector?: string // agent_id 为空时按标签选择器路由，如 env=prod,role=worker
+  agent_strategy?: AgentStrategy
+  failover?: FailoverTarget[] // 指定的 Agent 不可用时依次尝试的目标
+  sync_files?: string // Agent 执行前从面板同步的脚本文件或目录，相对脚本目录，逗号分隔
   enabled: boolean
   last_run: string
   next_run: string
@@ -551,6 +704,7 @@ export interface RepoConfig {
 export interface ExecutionResult {
   task_id: string
   log_id?: string
+  queued_log_id?: string // 排队中的执行出队后使用的日志 ID
   success: boolean
   status?: string
   output?: string
@@ -616,6 +770,11 @@ export interface TaskLog {
   start_time: string | null
   end_time: string | null
   created_at: string
+  usage?: ResourceUsage
+  agent_id?: string | null
+  run_id?: string
+  synced_late?: boolean // Agent 断线期间执行，重连后补传
+  failover?: string // 故障转移原因，为空表示按原配置执行
 }
 
 export interface LogListResponse {
@@ -636,6 +795,156 @@ export interface LogDetail {
   start_time: string | null
   end_time: string | null
   created_at: string
+  usage?: ResourceUsage
+}
+
+// 进程树资源占用：CPU 时间为毫秒，内存与 I/O 为字节
+export interface ResourceUsage {
+  user_cpu: number
+  system_cpu: number
+  max_rss: number // 进程树中单个进程的峰值内存
+  read_bytes: number
+  write_bytes: number
+}
+
+export interface TaskUsagePoint extends ResourceUsage {
+  log_id: string
+  start_time: string | null
+  status: string
+  duration: number
+}
+
+export interface TaskUsageTrend {
+  task_id: string
+  days: number
+  points: TaskUsagePoint[]
+  summary: {
+    runs: number
+    avg_cpu: number
+    max_cpu: number
+    avg_rss: number
+    max_rss: number
+    read_bytes: number
+    write_bytes: number
+  }
+}
+
+export type TaskUsageSort = 'cpu' | 'rss' | 'io'
+
+export interface TaskUsageRankItem {
+  task_id: string
+  task_name: string
+  runs: number
+  total_cpu: number
+  max_rss: number
+  read_bytes: number
+  write_bytes: number
+}
+
+// 运行分析：耗时单位为毫秒，分位数按直方图估算
+export interface AnalyticsWindow {
+  window: string
+  runs: number
+  success: number
+  failed: number
+  cancelled: number
+  success_rate: number
+  p50: number
+  p95: number
+  max: number
+  avg: number
+  flakiness: number
+}
+
+export interface TaskAnalytics {
+  scope: 'task' | 'tag'
+  key: string
+  name: string
+  task_ids: string[]
+  days: number
+  windows: AnalyticsWindow[]
+  daily: { day: string; runs: number; success: number; failed: number; success_rate: number }[]
+  // [星期][小时]，星期 0 为周日
+  heatmap: { runs: number; failed: number }[][]
+}
+
+export type AnalyticsRankSort = 'failures' | 'failure_rate' | 'slowest' | 'flaky'
+
+export interface AnalyticsRankItem extends AnalyticsWindow {
+  task_id: string
+  task_name: string
+}
+
+export interface BroadcastRun {
+  id: string
+  task_id: string
+  task_name: string
+  selector: string
+  max_parallel: number
+  status: string
+  total: number
+  success: number
+  failed: number
+  cancelled: number
+  start_time: string | null
+  end_time: string | null
+  created_at: string
+  summary: string
+}
+
+export interface BroadcastRunDetail {
+  run: BroadcastRun
+  logs: TaskLog[]
+}
+
+export type LogLineFormat = 'raw' | 'plain' | 'html'
+export type LogStream = 'stdout' | 'stderr' | 'system'
+export type LogTimestampMode = 'relative' | 'absolute'
+
+export interface LogViewOptions {
+  format?: LogLineFormat
+  stream?: LogStream
+  timestamps?: LogTimestampMode
+}
+
+function logViewQuery(options?: LogViewOptions) {
+  const query = new URLSearchParams()
+  if (options?.format) query.set('format', options.format)
+  if (options?.stream) query.set('stream', options.stream)
+  if (options?.timestamps) query.set('timestamps', options.timestamps)
+  return query
+}
+
+export interface LogLine {
+  no: number
+  text: string
+  stream?: LogStream
+  time?: string
+}
+
+export interface LogLinesResult {
+  log_id: string
+  status: string
+  running: boolean
+  total_lines: number
+  start: number
+  end: number
+  has_more: boolean
+  lines: LogLine[]
+}
+
+export interface LogGrepMatch extends LogLine {
+  before?: LogLine[]
+  after?: LogLine[]
+}
+
+export interface LogGrepResult {
+  log_id: string
+  running: boolean
+  total_lines: number
+  match_count: number
+  limited: boolean
+  matches: LogGrepMatch[]
 }
 
 export interface AboutInfo {
@@ -674,6 +983,7 @@ export interface SchedulerSettings {
   worker_count: string
   queue_size: string
   rate_interval: string
+  broadcast_parallel?: string
 }
 
 
@@ -713,12 +1023,24 @@ export interface Dependency {
   version: string
   language: string
   lang_version: string
+  agent_id?: string // 为空表示面板本机
   remark: string
   log: string
   created_at: string
   updated_at: string
 }
 
+export interface AgentRuntime {
+  plugin: string
+  version: string
+}
+
+export interface AgentFeature {
+  capability: string
+  label: string
+  supported: boolean // 不支持时需要升级 Agent
+}
+
 export interface Agent {
   id: string
   name: string
@@ -734,11 +1056,47 @@ export interface Agent {
   os: string
   arch: string
   enabled: boolean
+  approval: '' | 'pending' | 'approved' | 'rejected' // 注册审批状态，空值视为已通过
+  key_fingerprint: string // 端到端加密公钥指纹，为空时变量与机密明文下发
+  public_key_at: string | null
+  pending_key_fingerprint: string // 未经旧私钥证明、等待管理员批准的新公钥指纹
+  protocol: number // 协商的协议版本，0 表示尚未连接过
+  features: AgentFeature[]
   scheduler_config: SchedulerConfig | null
+  labels: Record<string, string>
+  runtimes: AgentRuntime[]
+  load?: AgentLoad
+  metrics?: AgentHostMetrics
   created_at: string
   updated_at: string
 }
 
+export type AgentStrategy = 'round_robin' | 'least_busy' | 'random'
+
+// Agent 心跳上报的调度器负载，仅在线 Agent 有值
+export interface AgentLoad {
+  worker_count: number
+  busy_workers: number
+  queue_size: number
+  running_tasks: number
+}
+
+// Agent 心跳上报的主机资源，仅在线 Agent 有值
+export interface AgentHostMetrics {
+  cpu_percent: number
+  mem_total: number
+  mem_used: number
+  mem_percent: number
+  disk_path: string
+  disk_total: number
+  disk_used: number
+  disk_percent: number
+  load1: number
+  load5: number
+  load15: number
+  uptime: number
+}
+
 export interface SchedulerConfig {
   worker_count: number
   queue_size: number
@@ -758,6 +1116,43 @@ export interface AgentToken {
   created_at: string
 }
 
+export interface AgentRollout {
+  id: string
+  version: string
+  canary_percent: number
+  stage: 'canary' | 'all'
+  status: 'running' | 'success' | 'cancelled'
+  end_time: string | null
+  created_at: string
+  updated_at: string
+  total: number
+  canary: number
+  pending: number
+  running: number
+  success: number
+  failed: number
+}
+
+export interface AgentRolloutTarget {
+  id: string
+  rollout_id: string
+  agent_id: string
+  agent_name: string
+  canary: boolean
+  status: 'pending' | 'running' | 'success' | 'failed' | 'cancelled'
+  from_version: string
+  version: string
+  online: boolean
+  error: string
+  start_time: string | null
+  updated_at: string
+}
+
+export interface AgentRolloutDetail {
+  rollout: AgentRollout
+  targets: AgentRolloutTarget[]
+}
+
 export interface MiseLanguage {
   plugin: string
   version: string
@@ -847,7 +1242,8 @@ export const LOG_CATEGORY = {
   PUSH_LOG: 'push_log',
   LOGIN_LOG: 'login_log',
   SCHEDULER_LOG: 'scheduler_log',
-  FILTER_LOG: 'filter_log'
+  FILTER_LOG: 'filter_log',
+  AUDIT_LOG: 'audit_log'
 } as const
 
 export const LOG_LEVEL = {
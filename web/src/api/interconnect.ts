@@ -67,3 +67,210 @@ export function syncTask(node_ids: string[], tasks: any[]) {
 export function getChildStatus() {
   return request<{ parent_url: string; parent_token: string; connected: boolean }>('/interconnect/child/status', { method: 'GET' })
 }
+
+// 跨节点聚合结果中单个子节点的情况
+export interface FederatedNode {
+  node_id: string
+  node_name: string
+  status: 'ok' | 'offline' | 'timeout' | 'error'
+  msg?: string
+  total: number
+  more?: boolean
+  stale?: boolean // 子节点未及时响应，结果来自过期缓存
+  fetched_at?: string
+}
+
+export interface FederatedResult<T = Record<string, any>> {
+  items: (T & { node_id: string; node_name: string })[]
+  nodes: FederatedNode[]
+}
+
+export function getFederatedTasks(params: { name?: string; tags?: string; limit?: number } = {}) {
+  const query = new URLSearchParams()
+  if (params.name) query.set('name', params.name)
+  if (params.tags) query.set('tags', params.tags)
+  if (params.limit) query.set('limit', String(params.limit))
+  return request<FederatedResult>(`/interconnect/federated/tasks?${query}`, { method: 'GET' })
+}
+
+export function getFederatedFailures(status: 'failed' | 'timeout' = 'failed', limit = 50) {
+  return request<FederatedResult>(`/interconnect/federated/failures?status=${status}&limit=${limit}`, { method: 'GET' })
+}
+
+export function searchFederatedLogs(params: { keyword: string; regex?: boolean; status?: string; start_time?: string; end_time?: string; limit?: number }) {
+  const query = new URLSearchParams({ keyword: params.keyword })
+  if (params.regex) query.set('regex', 'true')
+  if (params.status) query.set('status', params.status)
+  if (params.start_time) query.set('start_time', params.start_time)
+  if (params.end_time) query.set('end_time', params.end_time)
+  if (params.limit) query.set('limit', String(params.limit))
+  return request<FederatedResult>(`/interconnect/federated/logs/search?${query}`, { method: 'GET' })
+}
+
+// 托管同步规则：带指定标签的任务与环境变量持续同步到所选子节点
+export interface ManagedSync {
+  id: string
+  name: string
+  task_tag: string
+  env_tag: string
+  node_ids: string // 逗号分隔
+  overwrite: boolean // 子节点上的修改以主节点为准覆盖
+  enabled: boolean
+  last_run_at?: string
+  last_error: string
+  created_at: string
+  updated_at: string
+}
+
+export type ManagedAction = 'none' | 'create' | 'update' | 'restore' | 'drift' | 'conflict' | 'release' | 'skip'
+
+export interface ManagedPlanItem {
+  kind: 'task' | 'env'
+  id: string
+  name: string
+  action: ManagedAction
+  reason?: string
+}
+
+export interface ManagedNodePlan {
+  node_id: string
+  node_name: string
+  error?: string
+  items: ManagedPlanItem[]
+}
+
+export interface ManagedSyncState {
+  id: string
+  sync_id: string
+  node_id: string
+  kind: 'task' | 'env'
+  resource_id: string
+  name: string
+  status: 'synced' | 'drift' | 'conflict' | 'error'
+  message: string
+  synced_at?: string
+  updated_at: string
+}
+
+export function getManagedSyncs() {
+  return request<ManagedSync[]>('/interconnect/managed', { method: 'GET' })
+}
+
+export function saveManagedSync(data: Partial<ManagedSync>) {
+  return request<ManagedSync>(data.id ? `/interconnect/managed/${data.id}` : '/interconnect/managed', {
+    method: data.id ? 'PUT' : 'POST',
+    body: JSON.stringify(data)
+  })
+}
+
+export function deleteManagedSync(id: string) {
+  return request<void>(`/interconnect/managed/${id}`, { method: 'DELETE' })
+}
+
+export function planManagedSync(id: string) {
+  return request<ManagedNodePlan[]>(`/interconnect/managed/${id}/plan`, { method: 'GET' })
+}
+
+export function runManagedSync(id: string) {
+  return request<ManagedNodePlan[]>(`/interconnect/managed/${id}/sync`, { method: 'POST' })
+}
+
+export function getManagedSyncStates(id: string) {
+  return request<ManagedSyncState[]>(`/interconnect/managed/${id}/states`, { method: 'GET' })
+}
+
+// 隧道端口转发：主节点监听端口经隧道转发到子节点可访问的 host:port
+export interface TunnelForward {
+  id: string
+  name: string
+  node_id: string
+  listen_port: number
+  target_host: string
+  target_port: number
+  bind_addr: string // 主节点监听地址，为空只监听 127.0.0.1
+  allowlist: string // 来源 IP 或 CIDR，逗号分隔，为空拒绝所有连接
+  enabled: boolean
+  remark: string
+  created_at: string
+  updated_at: string
+}
+
+export interface ForwardTraffic {
+  tx_bytes: number
+  rx_bytes: number
+  connections: number
+  active: number
+  rejected: number
+}
+
+export interface ForwardInfo extends TunnelForward {
+  node_name: string
+  running: boolean
+  error?: string
+  traffic: ForwardTraffic
+}
+
+export function getForwards() {
+  return request<ForwardInfo[]>('/interconnect/forwards', { method: 'GET' })
+}
+
+export function saveForward(data: Partial<TunnelForward>) {
+  return request<TunnelForward>(data.id ? `/interconnect/forwards/${data.id}` : '/interconnect/forwards', {
+    method: data.id ? 'PUT' : 'POST',
+    body: JSON.stringify(data)
+  })
+}
+
+export function setForwardEnabled(id: string, enabled: boolean) {
+  return request<void>(`/interconnect/forwards/${id}/enabled`, {
+    method: 'PUT',
+    body: JSON.stringify({ enabled })
+  })
+}
+
+export function deleteForward(id: string) {
+  return request<void>(`/interconnect/forwards/${id}`, { method: 'DELETE' })
+}
+
+// 远程执行：在子节点上执行任务，主节点转发实时日志并保存结果摘要
+export interface RemoteRun {
+  id: string
+  node_id: string
+  node_name: string
+  task_id: string
+  task_name: string
+  log_id: string
+  status: string // queued | running | success | failed | timeout | cancelled
+  exit_code: number
+  duration: number
+  error: string
+  output?: string
+  operator: string
+  started_at: string
+  finished_at?: string
+}
+
+export function runRemoteTask(nodeId: string, taskId: string, envs?: Record<string, string>) {
+  return request<RemoteRun>(`/interconnect/nodes/${nodeId}/tasks/${taskId}/run`, {
+    method: 'POST',
+    body: JSON.stringify({ envs: envs || {} })
+  })
+}
+
+export function getRemoteRuns(params?: { node_id?: string; page?: number; page_size?: number }) {
+  const query = new URLSearchParams()
+  if (params?.node_id) query.set('node_id', params.node_id)
+  if (params?.page) query.set('page', String(params.page))
+  if (params?.page_size) query.set('page_size', String(params.page_size))
+  return request<{ data: RemoteRun[]; total: number; page: number; page_size: number }>(`/interconnect/remote-runs?${query}`)
+}
+
+export function getRemoteRun(id: string) {
+  return request<RemoteRun>(`/interconnect/remote-runs/${id}`, { method: 'GET' })
+}
+
+export function remoteRunStreamUrl(id: string) {
+  const baseUrl = (window as any).__BASE_URL__ || ''
+  const apiVersion = (window as any).__API_VERSION__ || '/api/v1'
+  return `${window.location.protocol}//${window.location.host}${baseUrl}${apiVersion}/interconnect/remote-runs/${id}/stream`
+}